@@ -16,6 +16,7 @@ import (
 	"pai_smart_go_v2/pkg/kafka"
 	"pai_smart_go_v2/pkg/llm"
 	"pai_smart_go_v2/pkg/log"
+	"pai_smart_go_v2/pkg/rerank"
 	"pai_smart_go_v2/pkg/storage"
 	"pai_smart_go_v2/pkg/tika"
 	"pai_smart_go_v2/pkg/token"
@@ -70,7 +71,21 @@ func main() {
 	orgTagRepo := repository.NewOrganizationTagRepository(database.DB)
 	uploadRepo := repository.NewUploadRepository(database.DB, database.RDB)
 	docVectorRepo := repository.NewDocumentVectorRepository(database.DB)
-	conversationRepo := repository.NewConversationRepository(database.RDB)
+	conversationRepo := repository.NewConversationRepository(database.DB, database.RDB)
+	deadLetterRepo := repository.NewDeadLetterRepository(database.DB)
+	processingJobRepo := repository.NewProcessingJobRepository(database.DB, database.RDB)
+	indexMigrationRepo := repository.NewIndexMigrationRepository(database.DB)
+	folderRepo := repository.NewFolderRepository(database.DB)
+	if interrupted, err := indexMigrationRepo.MarkInterrupted(time.Now()); err != nil {
+		log.Errorf("清理中断的索引迁移记录失败: %v", err)
+	} else if interrupted > 0 {
+		log.Warnf("有 %d 个索引迁移因服务重启被中断，已标记为失败", interrupted)
+	}
+	if migrated, err := conversationRepo.BackfillFromRedis(context.Background()); err != nil {
+		log.Errorf("回填 Redis 会话记录到 MySQL 失败: %v", err)
+	} else if migrated > 0 {
+		log.Infof("已回填 %d 个 Redis 会话到 MySQL", migrated)
+	}
 
 	// 2. JWT Manager
 	jwtManager := token.NewJWTManager(
@@ -88,7 +103,10 @@ func main() {
 		storage.MinIOClient,
 		cfg.MinIO.BucketName,
 		kafka.NewProducerClient(),
+		processingJobRepo,
 	)
+	kafkaProducer := kafka.NewProducerClient()
+	deadLetterService := service.NewDeadLetterService(deadLetterRepo, uploadRepo, kafkaProducer, kafkaProducer)
 	var embeddingClient embedding.Client
 	var esClient es.Client
 	var searchService service.SearchService
@@ -97,6 +115,7 @@ func main() {
 	var tikaClient *tika.Client
 	var documentService service.DocumentService
 	var conversationService service.ConversationService
+	var indexMigrationService service.IndexMigrationService
 	var err error
 
 	tikaClient, err = tika.NewClient(cfg.Tika)
@@ -104,19 +123,60 @@ func main() {
 		log.Errorf("初始化 Tika 客户端失败，文档预览与后台文档处理将不可用: %v", err)
 	}
 
-	embeddingClient, err = embedding.NewClient(cfg.Embedding)
+	var embeddingCacheStats handler.EmbeddingCacheStatsProvider
+	// 索引记录了 embedding 模型时以索引为准，配置只作兜底，避免迁移切换后重启用旧模型检索新索引
+	embeddingCfg := cfg.Embedding
+	esClient, err = es.NewClient(cfg.Elasticsearch)
 	if err != nil {
-		log.Errorf("初始化 Embedding 客户端失败，搜索与后台文档处理将不可用: %v", err)
+		log.Errorf("初始化 Elasticsearch 客户端失败，搜索与后台文档处理将不可用: %v", err)
+	} else if ensureErr := esClient.EnsureIndex(context.Background()); ensureErr != nil {
+		log.Errorf("初始化 Elasticsearch 索引失败，搜索与后台文档处理将不可用: %v", ensureErr)
+		esClient = nil
+	} else if resolved, resolveErr := pipeline.ResolveActiveIndexEmbedding(context.Background(), esClient, cfg.Embedding); resolveErr != nil {
+		log.Errorf("Embedding 配置与当前索引不一致，搜索与后台文档处理将不可用: %v", resolveErr)
+		esClient = nil
 	} else {
-		esClient, err = es.NewClient(cfg.Elasticsearch)
+		embeddingCfg = resolved
+	}
+
+	if esClient != nil {
+		embeddingClient, err = embedding.NewClient(embeddingCfg)
 		if err != nil {
-			log.Errorf("初始化 Elasticsearch 客户端失败，搜索与后台文档处理将不可用: %v", err)
-		} else if ensureErr := esClient.EnsureIndex(context.Background()); ensureErr != nil {
-			log.Errorf("初始化 Elasticsearch 索引失败，搜索与后台文档处理将不可用: %v", ensureErr)
+			log.Errorf("初始化 Embedding 客户端失败，搜索与后台文档处理将不可用: %v", err)
+			embeddingClient = nil
 			esClient = nil
 		}
 	}
-	searchService = service.NewSearchService(embeddingClient, esClient, userService, uploadRepo)
+	if embeddingClient != nil {
+		if embeddingCfg.Cache.Enabled && database.RDB != nil {
+			cachedClient := embedding.NewCachedClient(embeddingClient, embedding.NewRedisCache(database.RDB), embeddingCfg)
+			embeddingClient = cachedClient
+			embeddingCacheStats = cachedClient
+		}
+		// 索引迁移切换别名后通过 Switch 让检索和文档处理改用新模型
+		switchableEmbedding := embedding.NewSwitchableClient(embeddingClient, embeddingCfg.Model, embeddingCfg.Dimensions)
+		embeddingClient = switchableEmbedding
+		indexMigrator := pipeline.NewIndexMigrator(uploadRepo, docVectorRepo, indexMigrationRepo, esClient, embeddingCfg, switchableEmbedding.Switch)
+		indexMigrationService = service.NewIndexMigrationService(indexMigrationRepo, indexMigrator, func(model string, dimensions int) (embedding.Client, error) {
+			migrationCfg := embeddingCfg
+			migrationCfg.Model = model
+			migrationCfg.Dimensions = dimensions
+			client, err := embedding.NewClient(migrationCfg)
+			if err != nil {
+				return nil, err
+			}
+			if migrationCfg.Cache.Enabled && database.RDB != nil {
+				return embedding.NewCachedClient(client, embedding.NewRedisCache(database.RDB), migrationCfg), nil
+			}
+			return client, nil
+		})
+	}
+	reranker, err := rerank.NewReranker(cfg.Rerank)
+	if err != nil {
+		log.Errorf("初始化 Rerank 失败，检索将跳过重排: %v", err)
+	}
+	folderService := service.NewFolderService(folderRepo, uploadRepo, docVectorRepo, esClient, userService)
+	searchService = service.NewSearchService(embeddingClient, esClient, userService, uploadRepo, folderService, reranker, cfg.Rerank)
 	llmClient, err = llm.NewClient(cfg.LLM)
 	if err != nil {
 		log.Errorf("初始化 LLM 客户端失败，聊天功能将不可用: %v", err)
@@ -134,6 +194,7 @@ func main() {
 		tikaClient,
 		docVectorRepo,
 		esClient,
+		kafkaProducer,
 	)
 	conversationService = service.NewConversationService(conversationRepo, userService)
 
@@ -142,9 +203,13 @@ func main() {
 	orgTagHandler := handler.NewOrgTagHandler(orgTagService)
 	uploadHandler := handler.NewUploadHandler(uploadService)
 	documentHandler := handler.NewDocumentHandler(documentService)
+	folderHandler := handler.NewFolderHandler(folderService)
 	searchHandler := handler.NewSearchHandler(searchService)
 	chatHandler := handler.NewChatHandler(chatService, userService, jwtManager, cfg.LLM)
 	conversationHandler := handler.NewConversationHandler(conversationService)
+	embeddingCacheHandler := handler.NewEmbeddingCacheHandler(embeddingCacheStats)
+	deadLetterHandler := handler.NewDeadLetterHandler(deadLetterService)
+	indexMigrationHandler := handler.NewIndexMigrationHandler(indexMigrationService)
 
 	// 4. 设置 Gin 模式
 	gin.SetMode(cfg.Server.Mode)
@@ -178,20 +243,39 @@ func main() {
 	{
 		upload.POST("/upload/simple", uploadHandler.SimpleUpload)
 		upload.GET("/upload/status", uploadHandler.GetUploadStatus)
+		upload.GET("/upload/status/stream", uploadHandler.StreamProcessingStatus)
 		upload.GET("/upload/supported-types", uploadHandler.GetSupportedTypes)
 		upload.POST("/upload/fast-upload", uploadHandler.FastUpload)
 		upload.GET("/documents/accessible", documentHandler.ListAccessibleFiles)
 		upload.GET("/documents/uploads", documentHandler.ListUploadedFiles)
 		upload.DELETE("/documents/:fileMd5", documentHandler.DeleteDocument)
+		upload.POST("/documents/:fileMd5/reprocess", documentHandler.ReprocessDocument)
 		upload.GET("/documents/download", documentHandler.GenerateDownloadURL)
 		upload.GET("/documents/preview", documentHandler.PreviewFile)
+		upload.GET("/documents/:fileMd5/versions", documentHandler.ListDocumentVersions)
+		upload.GET("/documents/versions/diff", documentHandler.DiffDocumentVersions)
+		upload.PUT("/documents/:fileMd5/folder", folderHandler.MoveDocument)
+		upload.PUT("/documents/:fileMd5/tags", documentHandler.UpdateDocumentTags)
+		upload.GET("/documents/:fileMd5/shares", documentHandler.ListDocumentShares)
+		upload.PUT("/documents/:fileMd5/shares", documentHandler.UpdateDocumentShares)
+		upload.GET("/folders", folderHandler.GetFolderTree)
+		upload.POST("/folders", folderHandler.CreateFolder)
+		upload.PUT("/folders/:folderId", folderHandler.RenameFolder)
+		upload.PUT("/folders/:folderId/parent", folderHandler.MoveFolder)
+		upload.DELETE("/folders/:folderId", folderHandler.DeleteFolder)
 		// 阶段七：分片上传
 		upload.POST("/upload/check", uploadHandler.CheckFile)
 		upload.POST("/upload/chunk", uploadHandler.UploadChunk)
 		upload.POST("/upload/merge", uploadHandler.MergeChunks)
 		upload.GET("/search/hybrid", searchHandler.HybridSearch)
+		upload.GET("/search/faceted", searchHandler.FacetedSearch)
 		upload.GET("/chat/websocket-token", chatHandler.GetWebSocketToken)
 		upload.GET("/users/conversation", conversationHandler.GetConversations)
+		upload.GET("/users/conversations", conversationHandler.ListConversations)
+		upload.POST("/users/conversations", conversationHandler.CreateConversation)
+		upload.PUT("/users/conversations/:conversationId", conversationHandler.RenameConversation)
+		upload.POST("/users/conversations/:conversationId/switch", conversationHandler.SwitchConversation)
+		upload.DELETE("/users/conversations/:conversationId", conversationHandler.DeleteConversation)
 	}
 
 	r.GET("/chat/:token", chatHandler.HandleWebSocket)
@@ -205,6 +289,20 @@ func main() {
 		admin.GET("/users/list", userHandler.ListUsers)
 		admin.PUT("/users/:userId/org-tags", userHandler.AssignOrgTagsToUser)
 		admin.GET("/conversation", conversationHandler.GetAllConversations)
+		admin.GET("/embedding-cache/stats", embeddingCacheHandler.GetStats)
+
+		// 文件处理死信：查询与重放
+		admin.GET("/dead-letters", deadLetterHandler.ListDeadLetters)
+		admin.GET("/dead-letters/:id", deadLetterHandler.GetDeadLetter)
+		admin.POST("/dead-letters/:id/replay", deadLetterHandler.ReplayDeadLetter)
+
+		// 文档批量重新处理（如更换 embedding 模型后重建向量）
+		admin.POST("/documents/reprocess", documentHandler.BulkReprocess)
+
+		// embedding 模型迁移：新建版本索引、重新向量化、切换别名
+		admin.POST("/index-migrations", indexMigrationHandler.StartMigration)
+		admin.GET("/index-migrations", indexMigrationHandler.ListMigrations)
+		admin.GET("/index-migrations/:id", indexMigrationHandler.GetMigration)
 
 		// 标签管理（独立标签域 Handler）
 		orgTags := admin.Group("/org-tags")
@@ -255,16 +353,26 @@ func main() {
 			docVectorRepo,
 			embeddingClient,
 			esClient,
-			cfg.Embedding,
+			embeddingCfg,
+			cfg.Chunking,
+			processingJobRepo,
+			tikaClient,
+			cfg.Tika.OCR,
 		)
 		consumerCtx, cancel := context.WithCancel(context.Background())
 		consumerCancel = cancel
+		delayQueue := kafka.NewRedisDelayQueue(database.RDB)
 		go func() {
 			retryStore := kafka.NewRedisRetryStore(database.RDB)
-			if consumeErr := kafka.StartConsumer(consumerCtx, cfg.Kafka, retryStore, processor); consumeErr != nil {
+			if consumeErr := kafka.StartConsumer(consumerCtx, cfg.Kafka, retryStore, delayQueue, processor, deadLetterService); consumeErr != nil {
 				log.Errorf("Kafka Consumer 退出: %v", consumeErr)
 			}
 		}()
+		go func() {
+			if schedulerErr := kafka.StartRetryScheduler(consumerCtx, cfg.Kafka, delayQueue, kafkaProducer); schedulerErr != nil {
+				log.Errorf("Kafka 重试调度器退出: %v", schedulerErr)
+			}
+		}()
 	}
 
 	// 启动 HTTP 服务器并实现优雅停机
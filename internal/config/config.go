@@ -23,7 +23,9 @@ type Config struct {
 	Tika          TikaConfig          `mapstructure:"tika"`
 	Elasticsearch ElasticsearchConfig `mapstructure:"elasticsearch"`
 	Embedding     EmbeddingConfig     `mapstructure:"embedding"`
+	Chunking      ChunkingConfig      `mapstructure:"chunking"`
 	LLM           LLMConfig           `mapstructure:"llm"`
+	Rerank        RerankConfig        `mapstructure:"rerank"`
 }
 
 // ServerConfig 存储服务器相关的配置。
@@ -73,16 +75,34 @@ type MinIOConfig struct {
 	BucketName      string `mapstructure:"bucket_name"`
 }
 
+// KafkaConfig 中 DeadLetterTopic 为空时使用 "<topic>.dlq"。
+// Workers 为并发处理消息的 worker 数，默认 1。
+// 失败任务第 n 次重试前等待 RetryBackoffSeconds * 2^(n-1) 秒，不超过 RetryBackoffMaxSeconds。
 type KafkaConfig struct {
-	Brokers            []string `mapstructure:"brokers"`
-	Topic              string   `mapstructure:"topic"`
-	GroupID            string   `mapstructure:"group_id"`
-	MaxRetry           int      `mapstructure:"max_retry"`
-	RetryKeyTTLSeconds int      `mapstructure:"retry_key_ttl_seconds"`
+	Brokers                 []string `mapstructure:"brokers"`
+	Topic                   string   `mapstructure:"topic"`
+	GroupID                 string   `mapstructure:"group_id"`
+	MaxRetry                int      `mapstructure:"max_retry"`
+	RetryKeyTTLSeconds      int      `mapstructure:"retry_key_ttl_seconds"`
+	DeadLetterTopic         string   `mapstructure:"dead_letter_topic"`
+	RetryBackoffSeconds     int      `mapstructure:"retry_backoff_seconds"`
+	RetryBackoffMaxSeconds  int      `mapstructure:"retry_backoff_max_seconds"`
+	RetryPollIntervalMillis int      `mapstructure:"retry_poll_interval_ms"`
+	Workers                 int      `mapstructure:"workers"`
 }
 
 type TikaConfig struct {
-	BaseURL        string `mapstructure:"base_url"`
+	BaseURL        string        `mapstructure:"base_url"`
+	TimeoutSeconds int           `mapstructure:"timeout_seconds"`
+	OCR            TikaOCRConfig `mapstructure:"ocr"`
+}
+
+// TikaOCRConfig 控制扫描件和图片的 OCR：图片直接走 OCR，PDF 在普通提取得到的有效字符数少于 MinTextLength（默认 50）时改用 OCR。
+// Language 为 Tesseract 语言包（默认 chi_sim+eng），OCR 较慢，单独使用 TimeoutSeconds（默认 120 秒）。
+type TikaOCRConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	Language       string `mapstructure:"language"`
+	MinTextLength  int    `mapstructure:"min_text_length"`
 	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
 }
 
@@ -97,12 +117,48 @@ type ElasticsearchConfig struct {
 	RefreshOnWrite bool     `mapstructure:"refresh_on_write"`
 }
 
+// EmbeddingConfig 中 BatchSize/Concurrency/MaxRetries/RetryBackoffMillis 只作用于文档处理时的批量向量化：
+// 每批最多 BatchSize 条文本，最多 Concurrency 批同时请求，单批失败按指数退避重试 MaxRetries 次。
 type EmbeddingConfig struct {
-	APIKey         string `mapstructure:"api_key"`
-	BaseURL        string `mapstructure:"base_url"`
-	Model          string `mapstructure:"model"`
-	Dimensions     int    `mapstructure:"dimensions"`
-	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+	APIKey             string               `mapstructure:"api_key"`
+	BaseURL            string               `mapstructure:"base_url"`
+	Model              string               `mapstructure:"model"`
+	Dimensions         int                  `mapstructure:"dimensions"`
+	TimeoutSeconds     int                  `mapstructure:"timeout_seconds"`
+	BatchSize          int                  `mapstructure:"batch_size"`
+	Concurrency        int                  `mapstructure:"concurrency"`
+	MaxRetries         int                  `mapstructure:"max_retries"`
+	RetryBackoffMillis int                  `mapstructure:"retry_backoff_ms"`
+	Cache              EmbeddingCacheConfig `mapstructure:"cache"`
+}
+
+// EmbeddingCacheConfig 控制按内容寻址的向量缓存（Redis），TTLHours 默认 30 天。
+type EmbeddingCacheConfig struct {
+	Enabled  bool `mapstructure:"enabled"`
+	TTLHours int  `mapstructure:"ttl_hours"`
+}
+
+// ChunkingConfig 控制文档分块。ChunkSize/ChunkOverlap 以字符（rune）计；
+// Strategies 按扩展名（不带点）覆盖分块策略（fixed/sentence/markdown/rows），DefaultStrategy 用于未匹配的类型。
+type ChunkingConfig struct {
+	ChunkSize       int               `mapstructure:"chunk_size"`
+	ChunkOverlap    int               `mapstructure:"chunk_overlap"`
+	DefaultStrategy string            `mapstructure:"default_strategy"`
+	Strategies      map[string]string `mapstructure:"strategies"`
+}
+
+// RerankConfig 控制混合检索之后的可选重排阶段。
+// Provider 为 http 时调用 OpenAI/BGE 风格的 /rerank 接口，为 lexical 时只使用本地词法打分；
+// TopN 是参与重排的候选条数，FallbackToLexical 控制远端失败时是否退回本地打分。
+type RerankConfig struct {
+	Enabled           bool   `mapstructure:"enabled"`
+	Provider          string `mapstructure:"provider"`
+	APIKey            string `mapstructure:"api_key"`
+	BaseURL           string `mapstructure:"base_url"`
+	Model             string `mapstructure:"model"`
+	TopN              int    `mapstructure:"top_n"`
+	TimeoutSeconds    int    `mapstructure:"timeout_seconds"`
+	FallbackToLexical bool   `mapstructure:"fallback_to_lexical"`
 }
 
 type LLMConfig struct {
@@ -117,10 +173,14 @@ type LLMConfig struct {
 	Prompt                      LLMPromptConfig     `mapstructure:"prompt"`
 }
 
+// LLMGenerationConfig 控制生成参数与对话记忆预算。
+// HistoryTokenBudget 是每轮送入模型的历史（含滚动摘要）的估算 token 上限，SummaryTokenBudget 是滚动摘要的目标长度。
 type LLMGenerationConfig struct {
-	Temperature float64 `mapstructure:"temperature"`
-	TopP        float64 `mapstructure:"top_p"`
-	MaxTokens   int     `mapstructure:"max_tokens"`
+	Temperature        float64 `mapstructure:"temperature"`
+	TopP               float64 `mapstructure:"top_p"`
+	MaxTokens          int     `mapstructure:"max_tokens"`
+	HistoryTokenBudget int     `mapstructure:"history_token_budget"`
+	SummaryTokenBudget int     `mapstructure:"summary_token_budget"`
 }
 
 type LLMPromptConfig struct {
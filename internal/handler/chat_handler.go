@@ -30,10 +30,13 @@ type ChatHandler struct {
 	upgrader    websocket.Upgrader
 }
 
+// chatClientMessage 是客户端发来的 websocket 帧；message 帧可带 scope 限定检索范围，省略时沿用会话已保存的范围。
 type chatClientMessage struct {
-	Type         string `json:"type"`
-	Content      string `json:"content"`
-	CommandToken string `json:"_internal_cmd_token"`
+	Type           string           `json:"type"`
+	Content        string           `json:"content"`
+	ConversationID string           `json:"conversationId"`
+	Scope          *model.ChatScope `json:"scope"`
+	CommandToken   string           `json:"_internal_cmd_token"`
 }
 
 type wsJSONWriter struct {
@@ -228,21 +231,21 @@ func (h *ChatHandler) HandleWebSocket(c *gin.Context) {
 				continue
 			}
 
-			go func(current *activeChatSession, question string) {
+			go func(current *activeChatSession, question string, conversationID string, scope *model.ChatScope) {
 				defer clearActive(current)
 
 				shouldStop := func() bool {
 					return streamCtx.Err() == context.Canceled
 				}
 
-				if err := h.chatService.StreamResponse(streamCtx, question, user, writer, shouldStop); err != nil {
+				if err := h.chatService.StreamResponse(streamCtx, question, conversationID, scope, user, writer, shouldStop); err != nil {
 					status, msg := mapServiceError(err)
 					if status == http.StatusInternalServerError {
 						msg = "Chat stream failed"
 					}
 					_ = writer.WriteJSON(gin.H{"error": msg})
 				}
-			}(current, content)
+			}(current, content, strings.TrimSpace(message.ConversationID), message.Scope)
 		default:
 			_ = writer.WriteJSON(gin.H{"error": "Unsupported message type"})
 		}
@@ -18,7 +18,7 @@ import (
 
 type fakeChatService struct{}
 
-func (f *fakeChatService) StreamResponse(ctx context.Context, question string, user *model.User, writer service.ChatResponseWriter, shouldStop func() bool) error {
+func (f *fakeChatService) StreamResponse(ctx context.Context, question string, conversationID string, scope *model.ChatScope, user *model.User, writer service.ChatResponseWriter, shouldStop func() bool) error {
 	return nil
 }
 
@@ -14,6 +14,11 @@ type ConversationHandler struct {
 	conversationService service.ConversationService
 }
 
+// ConversationTitleRequest 是新建和重命名会话的请求体。
+type ConversationTitleRequest struct {
+	Title string `json:"title"`
+}
+
 func NewConversationHandler(conversationService service.ConversationService) *ConversationHandler {
 	return &ConversationHandler{conversationService: conversationService}
 }
@@ -28,7 +33,7 @@ func (h *ConversationHandler) GetConversations(c *gin.Context) {
 		return
 	}
 
-	history, err := h.conversationService.GetConversationHistory(c.Request.Context(), user.ID)
+	history, err := h.conversationService.GetConversationHistory(c.Request.Context(), user.ID, c.Query("conversationId"))
 	if err != nil {
 		status, msg := mapServiceError(err)
 		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
@@ -42,6 +47,143 @@ func (h *ConversationHandler) GetConversations(c *gin.Context) {
 	})
 }
 
+// ListConversations 返回当前用户的全部会话，按最近活跃时间倒序。
+func (h *ConversationHandler) ListConversations(c *gin.Context) {
+	if h.conversationService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Conversation service is unavailable"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	conversations, err := h.conversationService.ListConversations(c.Request.Context(), user.ID)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Conversations retrieved successfully",
+		"data":    conversations,
+	})
+}
+
+// CreateConversation 新建会话并切换为当前会话，title 可为空。
+func (h *ConversationHandler) CreateConversation(c *gin.Context) {
+	if h.conversationService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Conversation service is unavailable"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req ConversationTitleRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Invalid request body"})
+			return
+		}
+	}
+
+	conversation, err := h.conversationService.CreateConversation(c.Request.Context(), user.ID, req.Title)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    http.StatusCreated,
+		"message": "Conversation created successfully",
+		"data":    conversation,
+	})
+}
+
+// RenameConversation 修改会话标题。
+func (h *ConversationHandler) RenameConversation(c *gin.Context) {
+	if h.conversationService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Conversation service is unavailable"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req ConversationTitleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Invalid request body"})
+		return
+	}
+
+	conversation, err := h.conversationService.RenameConversation(c.Request.Context(), user.ID, c.Param("conversationId"), req.Title)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Conversation renamed successfully",
+		"data":    conversation,
+	})
+}
+
+// SwitchConversation 把指定会话设为当前会话，后续未带 conversationId 的聊天消息会落到该会话。
+func (h *ConversationHandler) SwitchConversation(c *gin.Context) {
+	if h.conversationService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Conversation service is unavailable"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	conversation, err := h.conversationService.SwitchConversation(c.Request.Context(), user.ID, c.Param("conversationId"))
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Conversation switched successfully",
+		"data":    conversation,
+	})
+}
+
+// DeleteConversation 删除会话及其历史。
+func (h *ConversationHandler) DeleteConversation(c *gin.Context) {
+	if h.conversationService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Conversation service is unavailable"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.conversationService.DeleteConversation(c.Request.Context(), user.ID, c.Param("conversationId")); err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Conversation deleted successfully",
+	})
+}
+
 func (h *ConversationHandler) GetAllConversations(c *gin.Context) {
 	if h.conversationService == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Conversation service is unavailable"})
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,17 +16,49 @@ import (
 )
 
 type fakeConversationServiceForHandler struct {
-	getConversationHistoryFn func(ctx context.Context, userID uint) ([]model.ChatMessage, error)
+	getConversationHistoryFn func(ctx context.Context, userID uint, conversationID string) ([]model.ChatMessage, error)
+	listConversationsFn      func(ctx context.Context, userID uint) ([]model.Conversation, error)
+	createConversationFn     func(ctx context.Context, userID uint, title string) (*model.Conversation, error)
+	deleteConversationFn     func(ctx context.Context, userID uint, conversationID string) error
 	getAllConversationsFn    func(ctx context.Context, filter service.ConversationAdminFilter) ([]service.ConversationAdminRecord, error)
 }
 
-func (f *fakeConversationServiceForHandler) GetConversationHistory(ctx context.Context, userID uint) ([]model.ChatMessage, error) {
+func (f *fakeConversationServiceForHandler) GetConversationHistory(ctx context.Context, userID uint, conversationID string) ([]model.ChatMessage, error) {
 	if f.getConversationHistoryFn != nil {
-		return f.getConversationHistoryFn(ctx, userID)
+		return f.getConversationHistoryFn(ctx, userID, conversationID)
 	}
 	return []model.ChatMessage{}, nil
 }
 
+func (f *fakeConversationServiceForHandler) ListConversations(ctx context.Context, userID uint) ([]model.Conversation, error) {
+	if f.listConversationsFn != nil {
+		return f.listConversationsFn(ctx, userID)
+	}
+	return []model.Conversation{}, nil
+}
+
+func (f *fakeConversationServiceForHandler) CreateConversation(ctx context.Context, userID uint, title string) (*model.Conversation, error) {
+	if f.createConversationFn != nil {
+		return f.createConversationFn(ctx, userID, title)
+	}
+	return &model.Conversation{ID: "conv-new", UserID: userID, Title: title}, nil
+}
+
+func (f *fakeConversationServiceForHandler) RenameConversation(ctx context.Context, userID uint, conversationID string, title string) (*model.Conversation, error) {
+	return &model.Conversation{ID: conversationID, UserID: userID, Title: title}, nil
+}
+
+func (f *fakeConversationServiceForHandler) SwitchConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error) {
+	return &model.Conversation{ID: conversationID, UserID: userID}, nil
+}
+
+func (f *fakeConversationServiceForHandler) DeleteConversation(ctx context.Context, userID uint, conversationID string) error {
+	if f.deleteConversationFn != nil {
+		return f.deleteConversationFn(ctx, userID, conversationID)
+	}
+	return nil
+}
+
 func (f *fakeConversationServiceForHandler) GetAllConversations(ctx context.Context, filter service.ConversationAdminFilter) ([]service.ConversationAdminRecord, error) {
 	if f.getAllConversationsFn != nil {
 		return f.getAllConversationsFn(ctx, filter)
@@ -39,18 +73,24 @@ func newConversationRouter(h *ConversationHandler) *gin.Engine {
 		c.Next()
 	})
 	r.GET("/users/conversation", h.GetConversations)
+	r.GET("/users/conversations", h.ListConversations)
+	r.POST("/users/conversations", h.CreateConversation)
+	r.DELETE("/users/conversations/:conversationId", h.DeleteConversation)
 	r.GET("/admin/conversation", h.GetAllConversations)
 	return r
 }
 
 func TestConversationHandler_GetConversations_Success(t *testing.T) {
 	r := newConversationRouter(NewConversationHandler(&fakeConversationServiceForHandler{
-		getConversationHistoryFn: func(ctx context.Context, userID uint) ([]model.ChatMessage, error) {
+		getConversationHistoryFn: func(ctx context.Context, userID uint, conversationID string) ([]model.ChatMessage, error) {
+			if conversationID != "conv-2" {
+				t.Fatalf("unexpected conversationId: %q", conversationID)
+			}
 			return []model.ChatMessage{{Role: "user", Content: "hello"}}, nil
 		},
 	}))
 
-	req := httptest.NewRequest(http.MethodGet, "/users/conversation", nil)
+	req := httptest.NewRequest(http.MethodGet, "/users/conversation?conversationId=conv-2", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	if w.Code != http.StatusOK {
@@ -89,3 +129,58 @@ func TestConversationHandler_GetAllConversations_Success(t *testing.T) {
 		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
 	}
 }
+
+func TestConversationHandler_CreateConversation_Success(t *testing.T) {
+	r := newConversationRouter(NewConversationHandler(&fakeConversationServiceForHandler{
+		createConversationFn: func(ctx context.Context, userID uint, title string) (*model.Conversation, error) {
+			if userID != 11 || title != "周报" {
+				t.Fatalf("unexpected create input: userID=%d title=%q", userID, title)
+			}
+			return &model.Conversation{ID: "conv-3", UserID: userID, Title: title}, nil
+		},
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/users/conversations", strings.NewReader(`{"title":"周报"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expect 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data model.Conversation `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if resp.Data.ID != "conv-3" {
+		t.Fatalf("unexpected conversation: %+v", resp.Data)
+	}
+}
+
+func TestConversationHandler_CreateConversation_EmptyBody(t *testing.T) {
+	r := newConversationRouter(NewConversationHandler(&fakeConversationServiceForHandler{}))
+
+	req := httptest.NewRequest(http.MethodPost, "/users/conversations", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expect 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestConversationHandler_DeleteConversation_NotFound(t *testing.T) {
+	r := newConversationRouter(NewConversationHandler(&fakeConversationServiceForHandler{
+		deleteConversationFn: func(ctx context.Context, userID uint, conversationID string) error {
+			return service.ErrConversationNotFound
+		},
+	}))
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/conversations/conv-x", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
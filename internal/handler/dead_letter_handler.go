@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeadLetterHandler struct {
+	deadLetterService service.DeadLetterService
+}
+
+func NewDeadLetterHandler(deadLetterService service.DeadLetterService) *DeadLetterHandler {
+	return &DeadLetterHandler{deadLetterService: deadLetterService}
+}
+
+// ListDeadLetters 支持 status、fileMd5、limit、offset 查询参数。
+func (h *DeadLetterHandler) ListDeadLetters(c *gin.Context) {
+	if h.deadLetterService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Dead letter service is unavailable"})
+		return
+	}
+
+	filter := repository.DeadLetterFilter{
+		Status:  strings.TrimSpace(c.Query("status")),
+		FileMD5: strings.TrimSpace(c.Query("fileMd5")),
+	}
+	for _, param := range []struct {
+		name   string
+		target *int
+	}{{"limit", &filter.Limit}, {"offset", &filter.Offset}} {
+		raw := strings.TrimSpace(c.Query(param.name))
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    http.StatusBadRequest,
+				"error":   http.StatusText(http.StatusBadRequest),
+				"message": "Query parameter '" + param.name + "' must be a non-negative integer",
+			})
+			return
+		}
+		*param.target = parsed
+	}
+
+	result, err := h.deadLetterService.ListDeadLetters(c.Request.Context(), filter)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Dead letters retrieved successfully",
+		"data":    result,
+	})
+}
+
+func (h *DeadLetterHandler) GetDeadLetter(c *gin.Context) {
+	if h.deadLetterService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Dead letter service is unavailable"})
+		return
+	}
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+
+	record, err := h.deadLetterService.GetDeadLetter(c.Request.Context(), id)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Dead letter retrieved successfully",
+		"data":    record,
+	})
+}
+
+func (h *DeadLetterHandler) ReplayDeadLetter(c *gin.Context) {
+	if h.deadLetterService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Dead letter service is unavailable"})
+		return
+	}
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+
+	record, err := h.deadLetterService.ReplayDeadLetter(c.Request.Context(), id)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Dead letter replayed successfully",
+		"data":    record,
+	})
+}
+
+func parseDeadLetterID(c *gin.Context) (uint, bool) {
+	parsed, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || parsed == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Invalid dead letter id",
+		})
+		return 0, false
+	}
+	return uint(parsed), true
+}
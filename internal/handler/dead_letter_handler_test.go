@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/internal/service"
+	"pai_smart_go_v2/pkg/tasks"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeDeadLetterServiceForHandler struct {
+	listDeadLettersFn  func(ctx context.Context, filter repository.DeadLetterFilter) (*service.DeadLetterList, error)
+	replayDeadLetterFn func(ctx context.Context, id uint) (*model.FileTaskDeadLetter, error)
+}
+
+func (f *fakeDeadLetterServiceForHandler) HandleDeadLetter(ctx context.Context, deadLetter tasks.DeadLetterTask) error {
+	return nil
+}
+
+func (f *fakeDeadLetterServiceForHandler) ListDeadLetters(ctx context.Context, filter repository.DeadLetterFilter) (*service.DeadLetterList, error) {
+	if f.listDeadLettersFn != nil {
+		return f.listDeadLettersFn(ctx, filter)
+	}
+	return &service.DeadLetterList{}, nil
+}
+
+func (f *fakeDeadLetterServiceForHandler) GetDeadLetter(ctx context.Context, id uint) (*model.FileTaskDeadLetter, error) {
+	return &model.FileTaskDeadLetter{ID: id}, nil
+}
+
+func (f *fakeDeadLetterServiceForHandler) ReplayDeadLetter(ctx context.Context, id uint) (*model.FileTaskDeadLetter, error) {
+	if f.replayDeadLetterFn != nil {
+		return f.replayDeadLetterFn(ctx, id)
+	}
+	return &model.FileTaskDeadLetter{ID: id, Status: model.DeadLetterStatusReplayed}, nil
+}
+
+func newDeadLetterRouter(h *DeadLetterHandler) *gin.Engine {
+	r := gin.New()
+	r.GET("/admin/dead-letters", h.ListDeadLetters)
+	r.GET("/admin/dead-letters/:id", h.GetDeadLetter)
+	r.POST("/admin/dead-letters/:id/replay", h.ReplayDeadLetter)
+	return r
+}
+
+func TestDeadLetterHandler_ListDeadLetters_PassesFilter(t *testing.T) {
+	r := newDeadLetterRouter(NewDeadLetterHandler(&fakeDeadLetterServiceForHandler{
+		listDeadLettersFn: func(ctx context.Context, filter repository.DeadLetterFilter) (*service.DeadLetterList, error) {
+			if filter.Status != "pending" || filter.FileMD5 != "md5-a" || filter.Limit != 20 || filter.Offset != 40 {
+				t.Fatalf("unexpected filter: %+v", filter)
+			}
+			return &service.DeadLetterList{Items: []model.FileTaskDeadLetter{{ID: 1}}, Total: 1}, nil
+		},
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/dead-letters?status=pending&fileMd5=md5-a&limit=20&offset=40", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeadLetterHandler_ListDeadLetters_InvalidLimit(t *testing.T) {
+	r := newDeadLetterRouter(NewDeadLetterHandler(&fakeDeadLetterServiceForHandler{}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/dead-letters?limit=abc", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeadLetterHandler_ReplayDeadLetter_InvalidID(t *testing.T) {
+	r := newDeadLetterRouter(NewDeadLetterHandler(&fakeDeadLetterServiceForHandler{}))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/dead-letters/0/replay", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeadLetterHandler_ReplayDeadLetter_NotFound(t *testing.T) {
+	r := newDeadLetterRouter(NewDeadLetterHandler(&fakeDeadLetterServiceForHandler{
+		replayDeadLetterFn: func(ctx context.Context, id uint) (*model.FileTaskDeadLetter, error) {
+			return nil, service.ErrDeadLetterNotFound
+		},
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/dead-letters/3/replay", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
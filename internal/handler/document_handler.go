@@ -5,6 +5,8 @@ import (
 	"strconv"
 	"strings"
 
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
 	"pai_smart_go_v2/internal/service"
 	"pai_smart_go_v2/pkg/log"
 
@@ -87,19 +89,9 @@ func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 		return
 	}
 
-	var targetUserID *uint
-	if raw := strings.TrimSpace(c.Query("userId")); raw != "" {
-		parsed, err := strconv.ParseUint(raw, 10, 64)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"code":    http.StatusBadRequest,
-				"error":   http.StatusText(http.StatusBadRequest),
-				"message": "Query parameter 'userId' must be an unsigned integer",
-			})
-			return
-		}
-		value := uint(parsed)
-		targetUserID = &value
+	targetUserID, ok := parseTargetUserIDQuery(c)
+	if !ok {
+		return
 	}
 
 	if err := h.documentService.DeleteDocument(c.Request.Context(), fileMD5, user, targetUserID); err != nil {
@@ -115,6 +107,248 @@ func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 	})
 }
 
+// ReprocessDocument 将已上传的文件重新投递到处理队列；管理员可通过 userId 指定文件所有者。
+func (h *DocumentHandler) ReprocessDocument(c *gin.Context) {
+	if h.documentService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Document service is unavailable"})
+		return
+	}
+	fileMD5 := strings.TrimSpace(c.Param("fileMd5"))
+	if fileMD5 == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Path parameter 'fileMd5' is required",
+		})
+		return
+	}
+
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	targetUserID, ok := parseTargetUserIDQuery(c)
+	if !ok {
+		return
+	}
+
+	upload, err := h.documentService.ReprocessDocument(c.Request.Context(), fileMD5, user, targetUserID)
+	if err != nil {
+		log.Warnf("ReprocessDocument: user=%d md5=%s err=%v", user.ID, fileMD5, err)
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    http.StatusAccepted,
+		"message": "Document reprocessing has been queued",
+		"data":    upload,
+	})
+}
+
+// UpdateDocumentTagsRequest 整体覆盖文档的标签和自定义元数据，省略或传空即清空。
+type UpdateDocumentTagsRequest struct {
+	Tags           []string          `json:"tags"`
+	CustomMetadata map[string]string `json:"customMetadata"`
+}
+
+// UpdateDocumentTags 更新文档（含全部历史版本）的标签和自定义元数据；管理员可通过 userId 指定文件所有者。
+func (h *DocumentHandler) UpdateDocumentTags(c *gin.Context) {
+	if h.documentService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Document service is unavailable"})
+		return
+	}
+	fileMD5 := strings.TrimSpace(c.Param("fileMd5"))
+	if fileMD5 == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Path parameter 'fileMd5' is required",
+		})
+		return
+	}
+
+	var req UpdateDocumentTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Invalid request body"})
+		return
+	}
+
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+	targetUserID, ok := parseTargetUserIDQuery(c)
+	if !ok {
+		return
+	}
+
+	upload, err := h.documentService.UpdateDocumentTags(c.Request.Context(), fileMD5, req.Tags, req.CustomMetadata, user, targetUserID)
+	if err != nil {
+		log.Warnf("UpdateDocumentTags: user=%d md5=%s err=%v", user.ID, fileMD5, err)
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Document tags updated",
+		"data":    upload,
+	})
+}
+
+// UpdateDocumentSharesRequest 整体覆盖文档的共享授权，传空数组即取消全部共享。
+type UpdateDocumentSharesRequest struct {
+	Grants []service.ShareGrant `json:"grants"`
+}
+
+// ListDocumentShares 返回文档的共享授权；所有者、管理员和拥有 manage 授权的用户可查看。
+func (h *DocumentHandler) ListDocumentShares(c *gin.Context) {
+	if h.documentService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Document service is unavailable"})
+		return
+	}
+	fileMD5 := strings.TrimSpace(c.Param("fileMd5"))
+	if fileMD5 == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Path parameter 'fileMd5' is required",
+		})
+		return
+	}
+
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+	targetUserID, ok := parseTargetUserIDQuery(c)
+	if !ok {
+		return
+	}
+
+	shares, err := h.documentService.ListDocumentShares(c.Request.Context(), fileMD5, user, targetUserID)
+	if err != nil {
+		log.Warnf("ListDocumentShares: user=%d md5=%s err=%v", user.ID, fileMD5, err)
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Document shares retrieved",
+		"data":    shares,
+	})
+}
+
+// UpdateDocumentShares 覆盖文档（含全部历史版本）的共享授权并同步到检索索引；管理员可通过 userId 指定文件所有者。
+func (h *DocumentHandler) UpdateDocumentShares(c *gin.Context) {
+	if h.documentService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Document service is unavailable"})
+		return
+	}
+	fileMD5 := strings.TrimSpace(c.Param("fileMd5"))
+	if fileMD5 == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Path parameter 'fileMd5' is required",
+		})
+		return
+	}
+
+	var req UpdateDocumentSharesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Invalid request body"})
+		return
+	}
+
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+	targetUserID, ok := parseTargetUserIDQuery(c)
+	if !ok {
+		return
+	}
+
+	shares, err := h.documentService.UpdateDocumentShares(c.Request.Context(), fileMD5, req.Grants, user, targetUserID)
+	if err != nil {
+		log.Warnf("UpdateDocumentShares: user=%d md5=%s err=%v", user.ID, fileMD5, err)
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Document shares updated",
+		"data":    shares,
+	})
+}
+
+type bulkReprocessRequest struct {
+	ProcessingStatus  string `json:"processingStatus"`
+	OrgTag            string `json:"orgTag"`
+	ModelVersion      string `json:"modelVersion"`
+	AfterID           uint   `json:"afterId"`
+	IncludeSuperseded bool   `json:"includeSuperseded"`
+	Limit             int    `json:"limit"`
+}
+
+// BulkReprocess 供管理员按处理状态、组织标签、embedding 模型版本批量重新投递文件处理任务。
+// 已在排队或处理中的文件不会重复投递，因此 processingStatus 只能筛选已结束的状态；用返回的 nextAfterId 作为 afterId 翻到下一批。
+func (h *DocumentHandler) BulkReprocess(c *gin.Context) {
+	if h.documentService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Document service is unavailable"})
+		return
+	}
+
+	var req bulkReprocessRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Invalid request body"})
+			return
+		}
+	}
+
+	status := strings.ToLower(strings.TrimSpace(req.ProcessingStatus))
+	switch status {
+	case "", model.FileProcessingStatusIndexed, model.FileProcessingStatusEmpty, model.FileProcessingStatusFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Field 'processingStatus' is invalid"})
+		return
+	}
+	if req.Limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Field 'limit' must be a non-negative integer"})
+		return
+	}
+
+	result, err := h.documentService.BulkReprocess(c.Request.Context(), repository.ReprocessFilter{
+		ProcessingStatus:  status,
+		OrgTag:            strings.TrimSpace(req.OrgTag),
+		ModelVersion:      strings.TrimSpace(req.ModelVersion),
+		AfterID:           req.AfterID,
+		IncludeSuperseded: req.IncludeSuperseded,
+		Limit:             req.Limit,
+	})
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    http.StatusAccepted,
+		"message": "Document reprocessing has been queued",
+		"data":    result,
+	})
+}
+
 func (h *DocumentHandler) GenerateDownloadURL(c *gin.Context) {
 	if h.documentService == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Document service is unavailable"})
@@ -184,3 +418,92 @@ func (h *DocumentHandler) PreviewFile(c *gin.Context) {
 		"data":    info,
 	})
 }
+
+// ListDocumentVersions 返回文件所属逻辑文档的全部可访问版本。
+func (h *DocumentHandler) ListDocumentVersions(c *gin.Context) {
+	if h.documentService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Document service is unavailable"})
+		return
+	}
+	fileMD5 := strings.TrimSpace(c.Param("fileMd5"))
+	if fileMD5 == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Path parameter 'fileMd5' is required",
+		})
+		return
+	}
+
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.documentService.ListDocumentVersions(c.Request.Context(), fileMD5, user)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Document versions retrieved successfully",
+		"data":    versions,
+	})
+}
+
+// DiffDocumentVersions 比对同一文档两个版本（from、to 均为 fileMd5）的提取文本。
+func (h *DocumentHandler) DiffDocumentVersions(c *gin.Context) {
+	if h.documentService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Document service is unavailable"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	fromMD5 := strings.TrimSpace(c.Query("from"))
+	toMD5 := strings.TrimSpace(c.Query("to"))
+	if fromMD5 == "" || toMD5 == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Query parameters 'from' and 'to' are required",
+		})
+		return
+	}
+
+	diff, err := h.documentService.DiffDocumentVersions(c.Request.Context(), fromMD5, toMD5, user)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Document versions compared successfully",
+		"data":    diff,
+	})
+}
+
+func parseTargetUserIDQuery(c *gin.Context) (*uint, bool) {
+	raw := strings.TrimSpace(c.Query("userId"))
+	if raw == "" {
+		return nil, true
+	}
+	parsed, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Query parameter 'userId' must be an unsigned integer",
+		})
+		return nil, false
+	}
+	value := uint(parsed)
+	return &value, true
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
 	"pai_smart_go_v2/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +20,13 @@ type fakeDocumentServiceForHandler struct {
 	deleteDocumentFn        func(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) error
 	generateDownloadURLFn   func(ctx context.Context, fileMD5 string, fileName string, user *model.User) (*service.DownloadInfoDTO, error)
 	getFilePreviewContentFn func(ctx context.Context, fileMD5 string, fileName string, user *model.User) (*service.PreviewInfoDTO, error)
+	reprocessDocumentFn     func(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) (*model.FileUpload, error)
+	bulkReprocessFn         func(ctx context.Context, filter repository.ReprocessFilter) (*service.BulkReprocessResult, error)
+	listDocumentVersionsFn  func(ctx context.Context, fileMD5 string, user *model.User) ([]service.FileUploadDTO, error)
+	diffDocumentVersionsFn  func(ctx context.Context, fromMD5 string, toMD5 string, user *model.User) (*service.DocumentVersionDiffDTO, error)
+	updateDocumentTagsFn    func(ctx context.Context, fileMD5 string, tags []string, customMetadata map[string]string, user *model.User, targetUserID *uint) (*model.FileUpload, error)
+	listDocumentSharesFn    func(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) ([]model.DocumentShare, error)
+	updateDocumentSharesFn  func(ctx context.Context, fileMD5 string, grants []service.ShareGrant, user *model.User, targetUserID *uint) ([]model.DocumentShare, error)
 }
 
 func (f *fakeDocumentServiceForHandler) ListAccessibleFiles(ctx context.Context, user *model.User) ([]service.FileUploadDTO, error) {
@@ -41,6 +50,20 @@ func (f *fakeDocumentServiceForHandler) DeleteDocument(ctx context.Context, file
 	return nil
 }
 
+func (f *fakeDocumentServiceForHandler) ReprocessDocument(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) (*model.FileUpload, error) {
+	if f.reprocessDocumentFn != nil {
+		return f.reprocessDocumentFn(ctx, fileMD5, user, targetUserID)
+	}
+	return &model.FileUpload{FileMD5: fileMD5}, nil
+}
+
+func (f *fakeDocumentServiceForHandler) BulkReprocess(ctx context.Context, filter repository.ReprocessFilter) (*service.BulkReprocessResult, error) {
+	if f.bulkReprocessFn != nil {
+		return f.bulkReprocessFn(ctx, filter)
+	}
+	return &service.BulkReprocessResult{}, nil
+}
+
 func (f *fakeDocumentServiceForHandler) GenerateDownloadURL(ctx context.Context, fileMD5 string, fileName string, user *model.User) (*service.DownloadInfoDTO, error) {
 	if f.generateDownloadURLFn != nil {
 		return f.generateDownloadURLFn(ctx, fileMD5, fileName, user)
@@ -55,6 +78,41 @@ func (f *fakeDocumentServiceForHandler) GetFilePreviewContent(ctx context.Contex
 	return &service.PreviewInfoDTO{}, nil
 }
 
+func (f *fakeDocumentServiceForHandler) ListDocumentVersions(ctx context.Context, fileMD5 string, user *model.User) ([]service.FileUploadDTO, error) {
+	if f.listDocumentVersionsFn != nil {
+		return f.listDocumentVersionsFn(ctx, fileMD5, user)
+	}
+	return []service.FileUploadDTO{}, nil
+}
+
+func (f *fakeDocumentServiceForHandler) DiffDocumentVersions(ctx context.Context, fromMD5 string, toMD5 string, user *model.User) (*service.DocumentVersionDiffDTO, error) {
+	if f.diffDocumentVersionsFn != nil {
+		return f.diffDocumentVersionsFn(ctx, fromMD5, toMD5, user)
+	}
+	return &service.DocumentVersionDiffDTO{}, nil
+}
+
+func (f *fakeDocumentServiceForHandler) UpdateDocumentTags(ctx context.Context, fileMD5 string, tags []string, customMetadata map[string]string, user *model.User, targetUserID *uint) (*model.FileUpload, error) {
+	if f.updateDocumentTagsFn != nil {
+		return f.updateDocumentTagsFn(ctx, fileMD5, tags, customMetadata, user, targetUserID)
+	}
+	return &model.FileUpload{FileMD5: fileMD5, Tags: tags, CustomMetadata: customMetadata}, nil
+}
+
+func (f *fakeDocumentServiceForHandler) ListDocumentShares(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) ([]model.DocumentShare, error) {
+	if f.listDocumentSharesFn != nil {
+		return f.listDocumentSharesFn(ctx, fileMD5, user, targetUserID)
+	}
+	return []model.DocumentShare{}, nil
+}
+
+func (f *fakeDocumentServiceForHandler) UpdateDocumentShares(ctx context.Context, fileMD5 string, grants []service.ShareGrant, user *model.User, targetUserID *uint) ([]model.DocumentShare, error) {
+	if f.updateDocumentSharesFn != nil {
+		return f.updateDocumentSharesFn(ctx, fileMD5, grants, user, targetUserID)
+	}
+	return []model.DocumentShare{}, nil
+}
+
 func newDocumentRouter(h *DocumentHandler) *gin.Engine {
 	r := gin.New()
 	r.Use(func(c *gin.Context) {
@@ -64,8 +122,15 @@ func newDocumentRouter(h *DocumentHandler) *gin.Engine {
 	r.GET("/documents/accessible", h.ListAccessibleFiles)
 	r.GET("/documents/uploads", h.ListUploadedFiles)
 	r.DELETE("/documents/:fileMd5", h.DeleteDocument)
+	r.POST("/documents/:fileMd5/reprocess", h.ReprocessDocument)
+	r.POST("/admin/documents/reprocess", h.BulkReprocess)
 	r.GET("/documents/download", h.GenerateDownloadURL)
 	r.GET("/documents/preview", h.PreviewFile)
+	r.GET("/documents/:fileMd5/versions", h.ListDocumentVersions)
+	r.GET("/documents/versions/diff", h.DiffDocumentVersions)
+	r.PUT("/documents/:fileMd5/tags", h.UpdateDocumentTags)
+	r.GET("/documents/:fileMd5/shares", h.ListDocumentShares)
+	r.PUT("/documents/:fileMd5/shares", h.UpdateDocumentShares)
 	return r
 }
 
@@ -136,3 +201,168 @@ func TestDocumentHandler_DeleteDocument_AdminTargetUser(t *testing.T) {
 		t.Fatalf("unexpected target user id: %v", gotTargetUserID)
 	}
 }
+
+func TestDocumentHandler_ReprocessDocument_Accepted(t *testing.T) {
+	var gotTargetUserID *uint
+	r := newDocumentRouter(NewDocumentHandler(&fakeDocumentServiceForHandler{
+		reprocessDocumentFn: func(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) (*model.FileUpload, error) {
+			if fileMD5 != "md5r" || user.ID != 9 {
+				t.Fatalf("unexpected args: md5=%s user=%+v", fileMD5, user)
+			}
+			gotTargetUserID = targetUserID
+			return &model.FileUpload{FileMD5: fileMD5, ProcessingStatus: model.FileProcessingStatusPending}, nil
+		},
+	}))
+
+	w := doReq(r, http.MethodPost, "/documents/md5r/reprocess?userId=5", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expect 202, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if gotTargetUserID == nil || *gotTargetUserID != 5 {
+		t.Fatalf("unexpected target user id: %v", gotTargetUserID)
+	}
+}
+
+func TestDocumentHandler_ReprocessDocument_ErrorMapping(t *testing.T) {
+	r := newDocumentRouter(NewDocumentHandler(&fakeDocumentServiceForHandler{
+		reprocessDocumentFn: func(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) (*model.FileUpload, error) {
+			return nil, service.ErrFileNotFound
+		},
+	}))
+
+	w := doReq(r, http.MethodPost, "/documents/missing/reprocess", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestDocumentHandler_BulkReprocess_PassesFilter(t *testing.T) {
+	r := newDocumentRouter(NewDocumentHandler(&fakeDocumentServiceForHandler{
+		bulkReprocessFn: func(ctx context.Context, filter repository.ReprocessFilter) (*service.BulkReprocessResult, error) {
+			want := repository.ReprocessFilter{ProcessingStatus: "failed", OrgTag: "team-a", ModelVersion: "text-embedding-v3", AfterID: 120, IncludeSuperseded: true, Limit: 50}
+			if filter != want {
+				t.Fatalf("unexpected filter: %+v", filter)
+			}
+			return &service.BulkReprocessResult{Matched: 2, Enqueued: 2}, nil
+		},
+	}))
+
+	w := doReq(r, http.MethodPost, "/admin/documents/reprocess", `{"processingStatus":"FAILED","orgTag":"team-a","modelVersion":"text-embedding-v3","afterId":120,"includeSuperseded":true,"limit":50}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expect 202, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestDocumentHandler_BulkReprocess_InvalidStatus(t *testing.T) {
+	r := newDocumentRouter(NewDocumentHandler(&fakeDocumentServiceForHandler{}))
+
+	for _, body := range []string{`{"processingStatus":"done"}`, `{"processingStatus":"processing"}`} {
+		w := doReq(r, http.MethodPost, "/admin/documents/reprocess", body)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expect 400 for %s, got %d, body=%s", body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDocumentHandler_ListDocumentVersions_Success(t *testing.T) {
+	r := newDocumentRouter(NewDocumentHandler(&fakeDocumentServiceForHandler{
+		listDocumentVersionsFn: func(ctx context.Context, fileMD5 string, user *model.User) ([]service.FileUploadDTO, error) {
+			if fileMD5 != "md5-v2" || user.ID != 9 {
+				t.Fatalf("unexpected args: md5=%s user=%d", fileMD5, user.ID)
+			}
+			return []service.FileUploadDTO{
+				{FileUpload: model.FileUpload{FileMD5: "md5-v2", DocumentID: "doc-1", Version: 2, IsLatest: true}},
+				{FileUpload: model.FileUpload{FileMD5: "md5-v1", DocumentID: "doc-1", Version: 1}},
+			}, nil
+		},
+	}))
+
+	w := doReq(r, http.MethodGet, "/documents/md5-v2/versions", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestDocumentHandler_DiffDocumentVersions(t *testing.T) {
+	r := newDocumentRouter(NewDocumentHandler(&fakeDocumentServiceForHandler{
+		diffDocumentVersionsFn: func(ctx context.Context, fromMD5 string, toMD5 string, user *model.User) (*service.DocumentVersionDiffDTO, error) {
+			if fromMD5 != "md5-v1" || toMD5 != "md5-v2" {
+				t.Fatalf("unexpected args: from=%s to=%s", fromMD5, toMD5)
+			}
+			return nil, service.ErrInvalidInput
+		},
+	}))
+
+	w := doReq(r, http.MethodGet, "/documents/versions/diff?from=md5-v1", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for missing 'to', got %d", w.Code)
+	}
+	w = doReq(r, http.MethodGet, "/documents/versions/diff?from=md5-v1&to=md5-v2", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect service error to map to 400, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestDocumentHandler_UpdateDocumentTags(t *testing.T) {
+	var gotTags []string
+	var gotMetadata map[string]string
+	r := newDocumentRouter(NewDocumentHandler(&fakeDocumentServiceForHandler{
+		updateDocumentTagsFn: func(ctx context.Context, fileMD5 string, tags []string, customMetadata map[string]string, user *model.User, targetUserID *uint) (*model.FileUpload, error) {
+			if fileMD5 == "bad" {
+				return nil, service.ErrInvalidInput
+			}
+			gotTags, gotMetadata = tags, customMetadata
+			return &model.FileUpload{FileMD5: fileMD5, Tags: tags, CustomMetadata: customMetadata}, nil
+		},
+	}))
+
+	w := doReq(r, http.MethodPut, "/documents/md5t/tags", `{"tags":["财务","2024"],"customMetadata":{"project":"apollo"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if len(gotTags) != 2 || gotMetadata["project"] != "apollo" {
+		t.Fatalf("unexpected args: tags=%v metadata=%v", gotTags, gotMetadata)
+	}
+
+	if w := doReq(r, http.MethodPut, "/documents/md5t/tags", `{"tags":"财务"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for malformed body, got %d", w.Code)
+	}
+	if w := doReq(r, http.MethodPut, "/documents/bad/tags", `{"tags":[]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid tags, got %d", w.Code)
+	}
+}
+
+func TestDocumentHandler_DocumentShares(t *testing.T) {
+	var gotGrants []service.ShareGrant
+	r := newDocumentRouter(NewDocumentHandler(&fakeDocumentServiceForHandler{
+		listDocumentSharesFn: func(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) ([]model.DocumentShare, error) {
+			if fileMD5 == "missing" {
+				return nil, service.ErrFileNotFound
+			}
+			return []model.DocumentShare{{FileMD5: fileMD5, OwnerID: 9, GranteeOrgTag: "team-b", Permission: model.SharePermissionRead}}, nil
+		},
+		updateDocumentSharesFn: func(ctx context.Context, fileMD5 string, grants []service.ShareGrant, user *model.User, targetUserID *uint) ([]model.DocumentShare, error) {
+			gotGrants = grants
+			return []model.DocumentShare{}, nil
+		},
+	}))
+
+	w := doReq(r, http.MethodGet, "/documents/md5s/shares", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"orgTag":"team-b"`) {
+		t.Fatalf("expect shares in response, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if w := doReq(r, http.MethodGet, "/documents/missing/shares", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404 for missing file, got %d", w.Code)
+	}
+
+	w = doReq(r, http.MethodPut, "/documents/md5s/shares", `{"grants":[{"userId":5,"permission":"manage"},{"orgTag":"team-b"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if len(gotGrants) != 2 || gotGrants[0].UserID != 5 || gotGrants[0].Permission != "manage" || gotGrants[1].OrgTag != "team-b" {
+		t.Fatalf("unexpected grants: %+v", gotGrants)
+	}
+	if w := doReq(r, http.MethodPut, "/documents/md5s/shares", `{"grants":{}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for malformed body, got %d", w.Code)
+	}
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+
+	"pai_smart_go_v2/pkg/embedding"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EmbeddingCacheStatsProvider 由 embedding.CachedClient 实现。
+type EmbeddingCacheStatsProvider interface {
+	Stats() embedding.CacheStats
+}
+
+type EmbeddingCacheHandler struct {
+	stats EmbeddingCacheStatsProvider
+}
+
+func NewEmbeddingCacheHandler(stats EmbeddingCacheStatsProvider) *EmbeddingCacheHandler {
+	return &EmbeddingCacheHandler{stats: stats}
+}
+
+// GetStats 返回向量缓存命中统计；缓存未启用时 enabled 为 false。
+func (h *EmbeddingCacheHandler) GetStats(c *gin.Context) {
+	data := gin.H{"enabled": false}
+	if h.stats != nil {
+		data = gin.H{"enabled": true, "stats": h.stats.Stats()}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Get embedding cache stats successful",
+		"data":    data,
+	})
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pai_smart_go_v2/pkg/embedding"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeEmbeddingCacheStats struct {
+	stats embedding.CacheStats
+}
+
+func (f *fakeEmbeddingCacheStats) Stats() embedding.CacheStats {
+	return f.stats
+}
+
+func TestEmbeddingCacheHandler_GetStats(t *testing.T) {
+	r := gin.New()
+	r.GET("/admin/embedding-cache/stats", NewEmbeddingCacheHandler(&fakeEmbeddingCacheStats{
+		stats: embedding.CacheStats{Hits: 3, Misses: 1, HitRate: 0.75},
+	}).GetStats)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/embedding-cache/stats", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Enabled bool                 `json:"enabled"`
+			Stats   embedding.CacheStats `json:"stats"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if !resp.Data.Enabled || resp.Data.Stats.Hits != 3 || resp.Data.Stats.HitRate != 0.75 {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+}
+
+func TestEmbeddingCacheHandler_GetStats_Disabled(t *testing.T) {
+	r := gin.New()
+	r.GET("/admin/embedding-cache/stats", NewEmbeddingCacheHandler(nil).GetStats)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/embedding-cache/stats", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() == "" {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pai_smart_go_v2/internal/service"
+	"pai_smart_go_v2/pkg/log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FolderHandler 负责文档文件夹的管理接口，以及把文档移动到文件夹。
+type FolderHandler struct {
+	folderService service.FolderService
+}
+
+func NewFolderHandler(folderService service.FolderService) *FolderHandler {
+	return &FolderHandler{folderService: folderService}
+}
+
+// CreateFolderRequest 是创建文件夹的请求体；parentId 为空时创建根文件夹，orgTag 非空时创建组织文件夹。
+type CreateFolderRequest struct {
+	Name     string `json:"name" binding:"required"`
+	ParentID *uint  `json:"parentId"`
+	OrgTag   string `json:"orgTag"`
+}
+
+// RenameFolderRequest 是重命名文件夹的请求体。
+type RenameFolderRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// MoveFolderRequest 是移动文件夹的请求体；parentId 为空或 0 时移动到根目录。
+type MoveFolderRequest struct {
+	ParentID *uint `json:"parentId"`
+}
+
+// MoveDocumentRequest 是移动文档的请求体；folderId 为 0 时移回根目录。
+type MoveDocumentRequest struct {
+	FolderID *uint `json:"folderId" binding:"required"`
+}
+
+// GetFolderTree 返回当前用户可访问的文件夹树。
+func (h *FolderHandler) GetFolderTree(c *gin.Context) {
+	if h.folderService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Folder service is unavailable"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	tree, err := h.folderService.GetFolderTree(c.Request.Context(), user)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Folder tree retrieved successfully",
+		"data":    tree,
+	})
+}
+
+// CreateFolder 创建个人或组织文件夹。
+func (h *FolderHandler) CreateFolder(c *gin.Context) {
+	if h.folderService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Folder service is unavailable"})
+		return
+	}
+	var req CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Invalid request body"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	folder, err := h.folderService.CreateFolder(c.Request.Context(), user, req.Name, req.ParentID, req.OrgTag)
+	if err != nil {
+		log.Warnf("CreateFolder: user=%d err=%v", user.ID, err)
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    http.StatusCreated,
+		"message": "Folder created successfully",
+		"data":    folder,
+	})
+}
+
+// RenameFolder 重命名文件夹。
+func (h *FolderHandler) RenameFolder(c *gin.Context) {
+	if h.folderService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Folder service is unavailable"})
+		return
+	}
+	folderID, ok := parseFolderIDParam(c)
+	if !ok {
+		return
+	}
+	var req RenameFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Invalid request body"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	folder, err := h.folderService.RenameFolder(c.Request.Context(), user, folderID, req.Name)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Folder renamed successfully",
+		"data":    folder,
+	})
+}
+
+// MoveFolder 把文件夹移动到另一个父文件夹下。
+func (h *FolderHandler) MoveFolder(c *gin.Context) {
+	if h.folderService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Folder service is unavailable"})
+		return
+	}
+	folderID, ok := parseFolderIDParam(c)
+	if !ok {
+		return
+	}
+	var req MoveFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Invalid request body"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	folder, err := h.folderService.MoveFolder(c.Request.Context(), user, folderID, req.ParentID)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Folder moved successfully",
+		"data":    folder,
+	})
+}
+
+// DeleteFolder 删除空文件夹。
+func (h *FolderHandler) DeleteFolder(c *gin.Context) {
+	if h.folderService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Folder service is unavailable"})
+		return
+	}
+	folderID, ok := parseFolderIDParam(c)
+	if !ok {
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.folderService.DeleteFolder(c.Request.Context(), user, folderID); err != nil {
+		log.Warnf("DeleteFolder: user=%d folder=%d err=%v", user.ID, folderID, err)
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Folder deleted successfully",
+	})
+}
+
+// MoveDocument 把当前用户的文档（连同全部版本）移动到指定文件夹。
+func (h *FolderHandler) MoveDocument(c *gin.Context) {
+	if h.folderService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Folder service is unavailable"})
+		return
+	}
+	fileMD5 := strings.TrimSpace(c.Param("fileMd5"))
+	if fileMD5 == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Path parameter 'fileMd5' is required",
+		})
+		return
+	}
+	var req MoveDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "error": http.StatusText(http.StatusBadRequest), "message": "Invalid request body"})
+		return
+	}
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.folderService.MoveDocument(c.Request.Context(), user, fileMD5, *req.FolderID); err != nil {
+		log.Warnf("MoveDocument: user=%d md5=%s err=%v", user.ID, fileMD5, err)
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Document moved successfully",
+	})
+}
+
+func parseFolderIDParam(c *gin.Context) (uint, bool) {
+	parsed, err := strconv.ParseUint(strings.TrimSpace(c.Param("folderId")), 10, 64)
+	if err != nil || parsed == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Path parameter 'folderId' must be a positive integer",
+		})
+		return 0, false
+	}
+	return uint(parsed), true
+}
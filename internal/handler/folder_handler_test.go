@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeFolderService struct {
+	createFolderFn func(ctx context.Context, user *model.User, name string, parentID *uint, orgTag string) (*model.Folder, error)
+	moveFolderFn   func(ctx context.Context, user *model.User, folderID uint, parentID *uint) (*model.Folder, error)
+	deleteFolderFn func(ctx context.Context, user *model.User, folderID uint) error
+	moveDocumentFn func(ctx context.Context, user *model.User, fileMD5 string, folderID uint) error
+}
+
+func (f *fakeFolderService) CreateFolder(ctx context.Context, user *model.User, name string, parentID *uint, orgTag string) (*model.Folder, error) {
+	if f.createFolderFn != nil {
+		return f.createFolderFn(ctx, user, name, parentID, orgTag)
+	}
+	return &model.Folder{}, nil
+}
+
+func (f *fakeFolderService) RenameFolder(ctx context.Context, user *model.User, folderID uint, name string) (*model.Folder, error) {
+	return &model.Folder{ID: folderID, Name: name}, nil
+}
+
+func (f *fakeFolderService) MoveFolder(ctx context.Context, user *model.User, folderID uint, parentID *uint) (*model.Folder, error) {
+	if f.moveFolderFn != nil {
+		return f.moveFolderFn(ctx, user, folderID, parentID)
+	}
+	return &model.Folder{ID: folderID, ParentID: parentID}, nil
+}
+
+func (f *fakeFolderService) DeleteFolder(ctx context.Context, user *model.User, folderID uint) error {
+	if f.deleteFolderFn != nil {
+		return f.deleteFolderFn(ctx, user, folderID)
+	}
+	return nil
+}
+
+func (f *fakeFolderService) GetFolderTree(ctx context.Context, user *model.User) ([]*model.FolderNode, error) {
+	return []*model.FolderNode{}, nil
+}
+
+func (f *fakeFolderService) MoveDocument(ctx context.Context, user *model.User, fileMD5 string, folderID uint) error {
+	if f.moveDocumentFn != nil {
+		return f.moveDocumentFn(ctx, user, fileMD5, folderID)
+	}
+	return nil
+}
+
+func (f *fakeFolderService) ResolveSubtree(ctx context.Context, user *model.User, folderID uint) ([]uint, error) {
+	return []uint{folderID}, nil
+}
+
+func newFolderRouter(h *FolderHandler) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", &model.User{ID: 9, Username: "tester"})
+		c.Next()
+	})
+	r.GET("/folders", h.GetFolderTree)
+	r.POST("/folders", h.CreateFolder)
+	r.PUT("/folders/:folderId/parent", h.MoveFolder)
+	r.DELETE("/folders/:folderId", h.DeleteFolder)
+	r.PUT("/documents/:fileMd5/folder", h.MoveDocument)
+	return r
+}
+
+func TestFolderHandler_CreateFolder(t *testing.T) {
+	var gotParent *uint
+	var gotOrgTag string
+	r := newFolderRouter(NewFolderHandler(&fakeFolderService{
+		createFolderFn: func(ctx context.Context, user *model.User, name string, parentID *uint, orgTag string) (*model.Folder, error) {
+			gotParent, gotOrgTag = parentID, orgTag
+			return &model.Folder{ID: 3, Name: name, ParentID: parentID, UserID: user.ID, OrgTag: orgTag}, nil
+		},
+	}))
+
+	w := doReq(r, http.MethodPost, "/folders", `{"name":"季度报告","parentId":2,"orgTag":"team-a"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expect 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if gotParent == nil || *gotParent != 2 || gotOrgTag != "team-a" {
+		t.Fatalf("unexpected args: parent=%v orgTag=%q", gotParent, gotOrgTag)
+	}
+	var resp struct {
+		Data model.Folder `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Data.ID != 3 {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+
+	w = doReq(r, http.MethodPost, "/folders", `{"parentId":2}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 without name, got %d", w.Code)
+	}
+}
+
+func TestFolderHandler_ErrorMapping(t *testing.T) {
+	r := newFolderRouter(NewFolderHandler(&fakeFolderService{
+		moveFolderFn: func(ctx context.Context, user *model.User, folderID uint, parentID *uint) (*model.Folder, error) {
+			return nil, service.ErrFolderNotFound
+		},
+		deleteFolderFn: func(ctx context.Context, user *model.User, folderID uint) error {
+			return service.ErrFolderNotEmpty
+		},
+	}))
+
+	if w := doReq(r, http.MethodPut, "/folders/5/parent", `{"parentId":1}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404, got %d", w.Code)
+	}
+	if w := doReq(r, http.MethodDelete, "/folders/5", ""); w.Code != http.StatusConflict {
+		t.Fatalf("expect 409, got %d", w.Code)
+	}
+	if w := doReq(r, http.MethodDelete, "/folders/abc", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid folderId, got %d", w.Code)
+	}
+}
+
+func TestFolderHandler_MoveDocument(t *testing.T) {
+	var gotMD5 string
+	gotFolder := uint(99)
+	r := newFolderRouter(NewFolderHandler(&fakeFolderService{
+		moveDocumentFn: func(ctx context.Context, user *model.User, fileMD5 string, folderID uint) error {
+			gotMD5, gotFolder = fileMD5, folderID
+			return nil
+		},
+	}))
+
+	w := doReq(r, http.MethodPut, "/documents/md5-a/folder", `{"folderId":0}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if gotMD5 != "md5-a" || gotFolder != 0 {
+		t.Fatalf("unexpected args: md5=%q folder=%d", gotMD5, gotFolder)
+	}
+
+	if w := doReq(r, http.MethodPut, "/documents/md5-a/folder", `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 without folderId, got %d", w.Code)
+	}
+}
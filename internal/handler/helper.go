@@ -45,6 +45,20 @@ func mapServiceError(err error) (httpStatus int, message string) {
 		return http.StatusBadRequest, "Not all chunks have been uploaded"
 	case errors.Is(err, service.ErrMergeFailed):
 		return http.StatusInternalServerError, "Failed to merge chunks"
+	case errors.Is(err, service.ErrConversationNotFound):
+		return http.StatusNotFound, "Conversation not found"
+	case errors.Is(err, service.ErrDeadLetterNotFound):
+		return http.StatusNotFound, "Dead letter not found"
+	case errors.Is(err, service.ErrIndexMigrationNotFound):
+		return http.StatusNotFound, "Index migration not found"
+	case errors.Is(err, service.ErrIndexMigrationRunning):
+		return http.StatusConflict, "An index migration is already running"
+	case errors.Is(err, service.ErrFolderNotFound):
+		return http.StatusNotFound, "Folder not found"
+	case errors.Is(err, service.ErrFolderNotEmpty):
+		return http.StatusConflict, "Folder is not empty"
+	case errors.Is(err, service.ErrDocumentIndexStale):
+		return http.StatusConflict, "Document index is out of date, reprocess the document and retry"
 	case errors.Is(err, service.ErrServiceUnavailable):
 		return http.StatusServiceUnavailable, "Service unavailable"
 	default:
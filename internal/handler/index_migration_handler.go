@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pai_smart_go_v2/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IndexMigrationHandler struct {
+	migrationService service.IndexMigrationService
+}
+
+func NewIndexMigrationHandler(migrationService service.IndexMigrationService) *IndexMigrationHandler {
+	return &IndexMigrationHandler{migrationService: migrationService}
+}
+
+type startIndexMigrationRequest struct {
+	ModelVersion string `json:"modelVersion" binding:"required"`
+	VectorDims   int    `json:"vectorDims" binding:"required,gt=0"`
+}
+
+// StartMigration 在后台启动 embedding 模型迁移，立即返回迁移记录，进度通过查询接口获取。
+func (h *IndexMigrationHandler) StartMigration(c *gin.Context) {
+	if h.migrationService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Index migration service is unavailable"})
+		return
+	}
+
+	var req startIndexMigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.ModelVersion) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Fields 'modelVersion' and 'vectorDims' are required",
+		})
+		return
+	}
+
+	migration, err := h.migrationService.StartMigration(c.Request.Context(), req.ModelVersion, req.VectorDims)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    http.StatusAccepted,
+		"message": "Index migration started",
+		"data":    migration,
+	})
+}
+
+// ListMigrations 支持 limit 查询参数，按创建时间倒序返回。
+func (h *IndexMigrationHandler) ListMigrations(c *gin.Context) {
+	if h.migrationService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Index migration service is unavailable"})
+		return
+	}
+
+	limit := 0
+	if raw := strings.TrimSpace(c.Query("limit")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    http.StatusBadRequest,
+				"error":   http.StatusText(http.StatusBadRequest),
+				"message": "Query parameter 'limit' must be a non-negative integer",
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	migrations, err := h.migrationService.ListMigrations(c.Request.Context(), limit)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Index migrations retrieved successfully",
+		"data":    migrations,
+	})
+}
+
+func (h *IndexMigrationHandler) GetMigration(c *gin.Context) {
+	if h.migrationService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": http.StatusServiceUnavailable, "error": http.StatusText(http.StatusServiceUnavailable), "message": "Index migration service is unavailable"})
+		return
+	}
+	parsed, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || parsed == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": "Invalid index migration id",
+		})
+		return
+	}
+
+	migration, err := h.migrationService.GetMigration(c.Request.Context(), uint(parsed))
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{"code": status, "error": http.StatusText(status), "message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Index migration retrieved successfully",
+		"data":    migration,
+	})
+}
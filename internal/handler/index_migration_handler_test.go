@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeIndexMigrationServiceForHandler struct {
+	startMigrationFn func(ctx context.Context, modelVersion string, vectorDims int) (*model.IndexMigration, error)
+	getMigrationFn   func(ctx context.Context, id uint) (*model.IndexMigration, error)
+}
+
+func (f *fakeIndexMigrationServiceForHandler) StartMigration(ctx context.Context, modelVersion string, vectorDims int) (*model.IndexMigration, error) {
+	if f.startMigrationFn != nil {
+		return f.startMigrationFn(ctx, modelVersion, vectorDims)
+	}
+	return &model.IndexMigration{ID: 1, ModelVersion: modelVersion, VectorDims: vectorDims}, nil
+}
+
+func (f *fakeIndexMigrationServiceForHandler) ListMigrations(ctx context.Context, limit int) ([]model.IndexMigration, error) {
+	return []model.IndexMigration{}, nil
+}
+
+func (f *fakeIndexMigrationServiceForHandler) GetMigration(ctx context.Context, id uint) (*model.IndexMigration, error) {
+	if f.getMigrationFn != nil {
+		return f.getMigrationFn(ctx, id)
+	}
+	return &model.IndexMigration{ID: id}, nil
+}
+
+func newIndexMigrationRouter(h *IndexMigrationHandler) *gin.Engine {
+	r := gin.New()
+	r.POST("/admin/index-migrations", h.StartMigration)
+	r.GET("/admin/index-migrations", h.ListMigrations)
+	r.GET("/admin/index-migrations/:id", h.GetMigration)
+	return r
+}
+
+func TestIndexMigrationHandler_StartMigration_Accepted(t *testing.T) {
+	r := newIndexMigrationRouter(NewIndexMigrationHandler(&fakeIndexMigrationServiceForHandler{
+		startMigrationFn: func(ctx context.Context, modelVersion string, vectorDims int) (*model.IndexMigration, error) {
+			if modelVersion != "text-embedding-v4" || vectorDims != 1024 {
+				t.Fatalf("unexpected args: model=%s dims=%d", modelVersion, vectorDims)
+			}
+			return &model.IndexMigration{ID: 3, Status: model.IndexMigrationStatusRunning}, nil
+		},
+	}))
+
+	w := doReq(r, http.MethodPost, "/admin/index-migrations", `{"modelVersion":"text-embedding-v4","vectorDims":1024}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expect 202, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestIndexMigrationHandler_StartMigration_Validation(t *testing.T) {
+	r := newIndexMigrationRouter(NewIndexMigrationHandler(&fakeIndexMigrationServiceForHandler{}))
+
+	w := doReq(r, http.MethodPost, "/admin/index-migrations", `{"modelVersion":"text-embedding-v4","vectorDims":0}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestIndexMigrationHandler_StartMigration_AlreadyRunning(t *testing.T) {
+	r := newIndexMigrationRouter(NewIndexMigrationHandler(&fakeIndexMigrationServiceForHandler{
+		startMigrationFn: func(ctx context.Context, modelVersion string, vectorDims int) (*model.IndexMigration, error) {
+			return nil, service.ErrIndexMigrationRunning
+		},
+	}))
+
+	w := doReq(r, http.MethodPost, "/admin/index-migrations", `{"modelVersion":"text-embedding-v4","vectorDims":1024}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expect 409, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestIndexMigrationHandler_GetMigration_NotFound(t *testing.T) {
+	r := newIndexMigrationRouter(NewIndexMigrationHandler(&fakeIndexMigrationServiceForHandler{
+		getMigrationFn: func(ctx context.Context, id uint) (*model.IndexMigration, error) {
+			return nil, service.ErrIndexMigrationNotFound
+		},
+	}))
+
+	w := doReq(r, http.MethodGet, "/admin/index-migrations/7", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
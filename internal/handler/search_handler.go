@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"pai_smart_go_v2/internal/service"
 
@@ -32,7 +34,69 @@ func (h *SearchHandler) HybridSearch(c *gin.Context) {
 	if !ok {
 		return
 	}
+	query, topK, filter, ok := parseSearchParams(c)
+	if !ok {
+		return
+	}
+
+	results, err := h.searchService.HybridSearchWithFilter(c.Request.Context(), query, topK, user, filter)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{
+			"code":    status,
+			"error":   http.StatusText(status),
+			"message": msg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Search successful",
+		"data":    results,
+	})
+}
+
+// FacetedSearch 返回检索结果以及按标签、组织、文件类型、上传者和上传月份的分面计数，参数与 HybridSearch 相同。
+func (h *SearchHandler) FacetedSearch(c *gin.Context) {
+	if h.searchService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    http.StatusServiceUnavailable,
+			"error":   http.StatusText(http.StatusServiceUnavailable),
+			"message": "Search service is unavailable",
+		})
+		return
+	}
+
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+	query, topK, filter, ok := parseSearchParams(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.searchService.FacetedSearch(c.Request.Context(), query, topK, user, filter)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{
+			"code":    status,
+			"error":   http.StatusText(status),
+			"message": msg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "Search successful",
+		"data":    result,
+	})
+}
 
+// parseSearchParams 解析 query、topK 和过滤参数，参数不合法时直接写入 400 响应并返回 false。
+func parseSearchParams(c *gin.Context) (string, int, service.SearchFilter, bool) {
 	query := strings.TrimSpace(c.Query("query"))
 	topK := 10
 	if topKRaw := strings.TrimSpace(c.Query("topK")); topKRaw != "" {
@@ -43,25 +107,120 @@ func (h *SearchHandler) HybridSearch(c *gin.Context) {
 				"error":   http.StatusText(http.StatusBadRequest),
 				"message": "Query parameter 'topK' must be an integer",
 			})
-			return
+			return "", 0, service.SearchFilter{}, false
 		}
 		topK = parsed
 	}
 
-	results, err := h.searchService.HybridSearch(c.Request.Context(), query, topK, user)
+	filter, err := parseSearchFilter(c)
 	if err != nil {
-		status, msg := mapServiceError(err)
-		c.JSON(status, gin.H{
-			"code":    status,
-			"error":   http.StatusText(status),
-			"message": msg,
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"error":   http.StatusText(http.StatusBadRequest),
+			"message": err.Error(),
 		})
-		return
+		return "", 0, service.SearchFilter{}, false
+	}
+	return query, topK, filter, true
+}
+
+// parseSearchFilter 解析元数据过滤参数：language、author、authoredFrom/authoredTo（yyyy-MM-dd）、minPages/maxPages，
+// 以及是否检索旧版本的 allVersions、限定文件夹子树的 folderId；
+// 分面条件为可重复的 tag、fileType、orgTag、uploaderId、uploadedFrom/uploadedTo（yyyy-MM-dd）和 meta[key]=value。
+func parseSearchFilter(c *gin.Context) (service.SearchFilter, error) {
+	filter := service.SearchFilter{
+		Language: strings.TrimSpace(c.Query("language")),
+		Author:   strings.TrimSpace(c.Query("author")),
+		FileType: strings.TrimSpace(c.Query("fileType")),
+		OrgTag:   strings.TrimSpace(c.Query("orgTag")),
+	}
+	for _, tag := range c.QueryArray("tag") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+	if meta := c.QueryMap("meta"); len(meta) > 0 {
+		filter.CustomMetadata = meta
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"code":    http.StatusOK,
-		"message": "Search successful",
-		"data":    results,
-	})
+	if fromRaw := strings.TrimSpace(c.Query("authoredFrom")); fromRaw != "" {
+		parsed, err := time.Parse("2006-01-02", fromRaw)
+		if err != nil {
+			return filter, fmt.Errorf("Query parameter 'authoredFrom' must be a date in yyyy-MM-dd format")
+		}
+		filter.AuthoredFrom = &parsed
+	}
+	if toRaw := strings.TrimSpace(c.Query("authoredTo")); toRaw != "" {
+		parsed, err := time.Parse("2006-01-02", toRaw)
+		if err != nil {
+			return filter, fmt.Errorf("Query parameter 'authoredTo' must be a date in yyyy-MM-dd format")
+		}
+		parsed = parsed.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+		filter.AuthoredTo = &parsed
+	}
+
+	pageParams := []struct {
+		name   string
+		target *int
+	}{
+		{name: "minPages", target: &filter.MinPages},
+		{name: "maxPages", target: &filter.MaxPages},
+	}
+	for _, param := range pageParams {
+		raw := strings.TrimSpace(c.Query(param.name))
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			return filter, fmt.Errorf("Query parameter '%s' must be a non-negative integer", param.name)
+		}
+		*param.target = parsed
+	}
+
+	dateParams := []struct {
+		name   string
+		target **time.Time
+		endOf  bool
+	}{
+		{name: "uploadedFrom", target: &filter.UploadedFrom},
+		{name: "uploadedTo", target: &filter.UploadedTo, endOf: true},
+	}
+	for _, param := range dateParams {
+		raw := strings.TrimSpace(c.Query(param.name))
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return filter, fmt.Errorf("Query parameter '%s' must be a date in yyyy-MM-dd format", param.name)
+		}
+		if param.endOf {
+			parsed = parsed.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+		}
+		*param.target = &parsed
+	}
+	if raw := strings.TrimSpace(c.Query("uploaderId")); raw != "" {
+		uploaderID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || uploaderID == 0 {
+			return filter, fmt.Errorf("Query parameter 'uploaderId' must be a positive integer")
+		}
+		filter.UploaderID = uint(uploaderID)
+	}
+
+	if raw := strings.TrimSpace(c.Query("allVersions")); raw != "" {
+		allVersions, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, fmt.Errorf("Query parameter 'allVersions' must be a boolean")
+		}
+		filter.AllVersions = allVersions
+	}
+	if raw := strings.TrimSpace(c.Query("folderId")); raw != "" {
+		folderID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || folderID == 0 {
+			return filter, fmt.Errorf("Query parameter 'folderId' must be a positive integer")
+		}
+		filter.FolderID = uint(folderID)
+	}
+	return filter, nil
 }
@@ -10,12 +10,15 @@ import (
 
 	"pai_smart_go_v2/internal/model"
 	"pai_smart_go_v2/internal/service"
+	"pai_smart_go_v2/pkg/es"
 
 	"github.com/gin-gonic/gin"
 )
 
 type fakeSearchService struct {
-	hybridSearchFn func(ctx context.Context, query string, topK int, user *model.User) ([]model.SearchResponseDTO, error)
+	hybridSearchFn  func(ctx context.Context, query string, topK int, user *model.User) ([]model.SearchResponseDTO, error)
+	facetedSearchFn func(ctx context.Context, query string, topK int, user *model.User, filter service.SearchFilter) (*service.FacetedSearchResult, error)
+	lastFilter      service.SearchFilter
 }
 
 func (f *fakeSearchService) HybridSearch(ctx context.Context, query string, topK int, user *model.User) ([]model.SearchResponseDTO, error) {
@@ -25,6 +28,23 @@ func (f *fakeSearchService) HybridSearch(ctx context.Context, query string, topK
 	return nil, nil
 }
 
+func (f *fakeSearchService) HybridSearchWithFilter(ctx context.Context, query string, topK int, user *model.User, filter service.SearchFilter) ([]model.SearchResponseDTO, error) {
+	f.lastFilter = filter
+	return f.HybridSearch(ctx, query, topK, user)
+}
+
+func (f *fakeSearchService) FacetedSearch(ctx context.Context, query string, topK int, user *model.User, filter service.SearchFilter) (*service.FacetedSearchResult, error) {
+	f.lastFilter = filter
+	if f.facetedSearchFn != nil {
+		return f.facetedSearchFn(ctx, query, topK, user, filter)
+	}
+	return &service.FacetedSearchResult{}, nil
+}
+
+func (f *fakeSearchService) ValidateScope(ctx context.Context, user *model.User, scope *model.ChatScope) error {
+	return nil
+}
+
 func newSearchRouter(h *SearchHandler) *gin.Engine {
 	r := gin.New()
 	r.Use(func(c *gin.Context) {
@@ -32,6 +52,7 @@ func newSearchRouter(h *SearchHandler) *gin.Engine {
 		c.Next()
 	})
 	r.GET("/search/hybrid", h.HybridSearch)
+	r.GET("/search/faceted", h.FacetedSearch)
 	return r
 }
 
@@ -129,3 +150,84 @@ func TestSearchHandler_HybridSearch_InternalError(t *testing.T) {
 		t.Fatalf("unexpected status: %d body=%s", w.Code, w.Body.String())
 	}
 }
+
+func TestSearchHandler_HybridSearch_MetadataFilter(t *testing.T) {
+	svc := &fakeSearchService{}
+	r := newSearchRouter(NewSearchHandler(svc))
+
+	w := doReq(r, http.MethodGet, "/search/hybrid?query=report&language=zh&author=alice&authoredFrom=2024-01-01&authoredTo=2024-06-30&minPages=2&allVersions=true&folderId=4", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	filter := svc.lastFilter
+	if filter.Language != "zh" || filter.Author != "alice" || filter.MinPages != 2 || filter.MaxPages != 0 || !filter.AllVersions || filter.FolderID != 4 {
+		t.Fatalf("unexpected filter: %+v", filter)
+	}
+	if filter.AuthoredFrom == nil || filter.AuthoredTo == nil || filter.AuthoredTo.Format("2006-01-02 15:04:05") != "2024-06-30 23:59:59" {
+		t.Fatalf("unexpected authored range: %+v", filter)
+	}
+
+	w = doReq(r, http.MethodGet, "/search/hybrid?query=report&authoredFrom=2024/01/01", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid date, got %d", w.Code)
+	}
+	w = doReq(r, http.MethodGet, "/search/hybrid?query=report&maxPages=-1", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for negative pages, got %d", w.Code)
+	}
+	w = doReq(r, http.MethodGet, "/search/hybrid?query=report&allVersions=maybe", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid allVersions, got %d", w.Code)
+	}
+	w = doReq(r, http.MethodGet, "/search/hybrid?query=report&folderId=0", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid folderId, got %d", w.Code)
+	}
+}
+
+func TestSearchHandler_FacetedSearch(t *testing.T) {
+	svc := &fakeSearchService{
+		facetedSearchFn: func(ctx context.Context, query string, topK int, user *model.User, filter service.SearchFilter) (*service.FacetedSearchResult, error) {
+			return &service.FacetedSearchResult{
+				Results: []model.SearchResponseDTO{{FileMD5: "md5", Tags: []string{"财务"}}},
+				Facets:  es.Facets{es.FacetTags: {{Key: "财务", Count: 3}}},
+			}, nil
+		},
+	}
+	r := newSearchRouter(NewSearchHandler(svc))
+
+	w := doReq(r, http.MethodGet, "/search/faceted?query=report&tag=%E8%B4%A2%E5%8A%A1&tag=2024&fileType=pdf&orgTag=team-a&uploaderId=7&uploadedFrom=2024-01-01&uploadedTo=2024-03-31&meta[project]=apollo", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	filter := svc.lastFilter
+	if len(filter.Tags) != 2 || filter.Tags[0] != "财务" || filter.FileType != "pdf" || filter.OrgTag != "team-a" || filter.UploaderID != 7 {
+		t.Fatalf("unexpected filter: %+v", filter)
+	}
+	if filter.CustomMetadata["project"] != "apollo" {
+		t.Fatalf("unexpected custom metadata filter: %+v", filter.CustomMetadata)
+	}
+	if filter.UploadedFrom == nil || filter.UploadedTo == nil || filter.UploadedTo.Format("2006-01-02 15:04:05") != "2024-03-31 23:59:59" {
+		t.Fatalf("unexpected upload range: %+v", filter)
+	}
+
+	var resp struct {
+		Data struct {
+			Results []model.SearchResponseDTO `json:"results"`
+			Facets  es.Facets                 `json:"facets"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(resp.Data.Results) != 1 || len(resp.Data.Facets[es.FacetTags]) != 1 || resp.Data.Facets[es.FacetTags][0].Count != 3 {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+
+	if w := doReq(r, http.MethodGet, "/search/faceted?query=report&uploaderId=abc", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid uploaderId, got %d", w.Code)
+	}
+	if w := doReq(r, http.MethodGet, "/search/faceted?query=report&uploadedTo=2024/03/31", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid upload date, got %d", w.Code)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"pai_smart_go_v2/internal/service"
 	"pai_smart_go_v2/pkg/log"
@@ -11,6 +13,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// processingStatusHeartbeat 是处理进度 SSE 连接的心跳间隔。
+const processingStatusHeartbeat = 15 * time.Second
+
 // UploadHandler 负责文件上传/下载相关 HTTP 接口。
 // Handler 只做 HTTP 翻译，所有业务逻辑和存储交互封装在 UploadService 中。
 type UploadHandler struct {
@@ -26,7 +31,8 @@ func NewUploadHandler(uploadService service.UploadService) *UploadHandler {
 
 // SimpleUpload 处理简单文件上传请求。
 // 路由：POST /api/v1/upload/simple
-// 请求格式：multipart/form-data，字段 "file"（必选）、"orgTag"（可选）
+// 请求格式：multipart/form-data，字段 "file"（必选）、"orgTag"（可选）、
+// "documentId" 或 "newVersion"（可选，作为已有文档的新版本上传，见 parseVersionTarget）
 // 流程：解析文件 → 调用 Service（MD5计算 + 秒传检查 + MinIO上传 + DB写入）→ 返回结果
 func (h *UploadHandler) SimpleUpload(c *gin.Context) {
 	// 1. 从中间件上下文获取当前登录用户
@@ -59,6 +65,7 @@ func (h *UploadHandler) SimpleUpload(c *gin.Context) {
 		header.Filename,
 		header.Size,
 		file,
+		parseVersionTarget(c),
 	)
 	if err != nil {
 		status, msg := mapServiceError(err)
@@ -196,6 +203,78 @@ func (h *UploadHandler) GetUploadStatus(c *gin.Context) {
 	})
 }
 
+// StreamProcessingStatus 以 SSE 推送文件处理阶段和进度（事件名 progress）。
+// 路由：GET /api/v1/upload/status/stream?fileMd5=...
+// 指定 fileMd5 时先推送当前进度，处理结束后关闭连接；不指定时推送当前用户所有文件的进度，直到客户端断开。
+func (h *UploadHandler) StreamProcessingStatus(c *gin.Context) {
+	user, ok := getUserFromContext(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	fileMD5 := strings.TrimSpace(c.Query("fileMd5"))
+
+	// 先订阅再读取当前进度，避免两步之间的进度更新丢失。
+	jobs, closeFn, err := h.uploadService.SubscribeProcessingProgress(ctx, fileMD5, user.ID)
+	if err != nil {
+		status, msg := mapServiceError(err)
+		c.JSON(status, gin.H{
+			"code":    status,
+			"error":   http.StatusText(status),
+			"message": msg,
+		})
+		return
+	}
+	defer func() {
+		if closeErr := closeFn(); closeErr != nil {
+			log.Warnf("StreamProcessingStatus: 关闭进度订阅失败: %v", closeErr)
+		}
+	}()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if fileMD5 != "" {
+		current, err := h.uploadService.GetUploadStatus(ctx, fileMD5, user.ID)
+		if err == nil && current.Processing != nil {
+			c.SSEvent("progress", current.Processing)
+			c.Writer.Flush()
+			if current.Processing.IsFinished() {
+				return
+			}
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(processingStatusHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			// SSE 注释行，防止代理因空闲断开连接。
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case job, ok := <-jobs:
+			if !ok {
+				return
+			}
+			c.SSEvent("progress", job)
+			c.Writer.Flush()
+			if fileMD5 != "" && job.IsFinished() {
+				return
+			}
+		}
+	}
+}
+
 func (h *UploadHandler) GetSupportedTypes(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
@@ -243,7 +322,7 @@ func (h *UploadHandler) FastUpload(c *gin.Context) {
 // UploadChunk 上传单个分片。
 // 路由：POST /api/v1/upload/chunk
 // 请求格式：multipart/form-data
-// 字段：fileMd5, fileName, totalSize, chunkIndex, orgTag, isPublic, file
+// 字段：fileMd5, fileName, totalSize, chunkIndex, orgTag, isPublic, file，以及可选的 documentId / newVersion
 func (h *UploadHandler) UploadChunk(c *gin.Context) {
 	user, ok := getUserFromContext(c)
 	if !ok {
@@ -305,6 +384,7 @@ func (h *UploadHandler) UploadChunk(c *gin.Context) {
 		fileMD5, fileName, totalSize, chunkIndex,
 		file, header.Size,
 		user.ID, orgTag, isPublic,
+		parseVersionTarget(c),
 	)
 	if err != nil {
 		status, msg := mapServiceError(err)
@@ -362,3 +442,12 @@ func (h *UploadHandler) MergeChunks(c *gin.Context) {
 		"data":    result,
 	})
 }
+
+// parseVersionTarget 读取新版本声明：documentId 指定逻辑文档，newVersion=true 表示作为同名文档的新版本。
+func parseVersionTarget(c *gin.Context) service.VersionTarget {
+	newVersion := strings.TrimSpace(c.PostForm("newVersion"))
+	return service.VersionTarget{
+		DocumentID: strings.TrimSpace(c.PostForm("documentId")),
+		SameName:   newVersion == "true" || newVersion == "1",
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"pai_smart_go_v2/internal/model"
 	"pai_smart_go_v2/internal/service"
@@ -23,11 +25,12 @@ type fakeUploadServiceForHandler struct {
 	getStatusFn       func(ctx context.Context, fileMD5 string, userID uint) (*service.UploadStatusResult, error)
 	fastUploadFn      func(ctx context.Context, fileMD5 string, userID uint) (*service.FastUploadCheckResult, error)
 	getSupportedTypes func() []string
-	uploadChunkFn     func(ctx context.Context, fileMD5 string, fileName string, totalSize int64, chunkIndex int, reader io.Reader, chunkSize int64, userID uint, orgTag string, isPublic bool) (*service.ChunkUploadResult, error)
+	uploadChunkFn     func(ctx context.Context, fileMD5 string, fileName string, totalSize int64, chunkIndex int, reader io.Reader, chunkSize int64, userID uint, orgTag string, isPublic bool, target service.VersionTarget) (*service.ChunkUploadResult, error)
 	mergeChunksFn     func(ctx context.Context, fileMD5 string, fileName string, userID uint) (*service.MergeResult, error)
+	subscribeFn       func(ctx context.Context, fileMD5 string, userID uint) (<-chan model.FileProcessingJob, func() error, error)
 }
 
-func (f *fakeUploadServiceForHandler) SimpleUpload(ctx context.Context, userID uint, orgTag, fileName string, fileSize int64, reader io.Reader) (*service.UploadResult, error) {
+func (f *fakeUploadServiceForHandler) SimpleUpload(ctx context.Context, userID uint, orgTag, fileName string, fileSize int64, reader io.Reader, target service.VersionTarget) (*service.UploadResult, error) {
 	if f.simpleUploadFn != nil {
 		return f.simpleUploadFn(ctx, userID, orgTag, fileName, fileSize, reader)
 	}
@@ -69,9 +72,9 @@ func (f *fakeUploadServiceForHandler) GetSupportedTypes() []string {
 	return []string{".pdf"}
 }
 
-func (f *fakeUploadServiceForHandler) UploadChunk(ctx context.Context, fileMD5 string, fileName string, totalSize int64, chunkIndex int, reader io.Reader, chunkSize int64, userID uint, orgTag string, isPublic bool) (*service.ChunkUploadResult, error) {
+func (f *fakeUploadServiceForHandler) UploadChunk(ctx context.Context, fileMD5 string, fileName string, totalSize int64, chunkIndex int, reader io.Reader, chunkSize int64, userID uint, orgTag string, isPublic bool, target service.VersionTarget) (*service.ChunkUploadResult, error) {
 	if f.uploadChunkFn != nil {
-		return f.uploadChunkFn(ctx, fileMD5, fileName, totalSize, chunkIndex, reader, chunkSize, userID, orgTag, isPublic)
+		return f.uploadChunkFn(ctx, fileMD5, fileName, totalSize, chunkIndex, reader, chunkSize, userID, orgTag, isPublic, target)
 	}
 	return &service.ChunkUploadResult{UploadedChunks: []int{}, Progress: 0}, nil
 }
@@ -83,6 +86,15 @@ func (f *fakeUploadServiceForHandler) MergeChunks(ctx context.Context, fileMD5 s
 	return &service.MergeResult{ObjectURL: "", FileMD5: fileMD5, FileName: fileName}, nil
 }
 
+func (f *fakeUploadServiceForHandler) SubscribeProcessingProgress(ctx context.Context, fileMD5 string, userID uint) (<-chan model.FileProcessingJob, func() error, error) {
+	if f.subscribeFn != nil {
+		return f.subscribeFn(ctx, fileMD5, userID)
+	}
+	jobs := make(chan model.FileProcessingJob)
+	close(jobs)
+	return jobs, func() error { return nil }, nil
+}
+
 func newUploadPhase7Router(h *UploadHandler) *gin.Engine {
 	r := gin.New()
 	r.Use(func(c *gin.Context) {
@@ -91,6 +103,7 @@ func newUploadPhase7Router(h *UploadHandler) *gin.Engine {
 	})
 	r.POST("/upload/check", h.CheckFile)
 	r.GET("/upload/status", h.GetUploadStatus)
+	r.GET("/upload/status/stream", h.StreamProcessingStatus)
 	r.GET("/upload/supported-types", h.GetSupportedTypes)
 	r.POST("/upload/fast-upload", h.FastUpload)
 	r.POST("/upload/chunk", h.UploadChunk)
@@ -286,10 +299,11 @@ func TestUploadHandler_UploadChunk_Success(t *testing.T) {
 		orgTag     string
 		isPublic   bool
 		chunkSize  int64
+		target     service.VersionTarget
 	}
 
 	svc := &fakeUploadServiceForHandler{
-		uploadChunkFn: func(ctx context.Context, fileMD5 string, fileName string, totalSize int64, chunkIndex int, reader io.Reader, chunkSize int64, userID uint, orgTag string, isPublic bool) (*service.ChunkUploadResult, error) {
+		uploadChunkFn: func(ctx context.Context, fileMD5 string, fileName string, totalSize int64, chunkIndex int, reader io.Reader, chunkSize int64, userID uint, orgTag string, isPublic bool, target service.VersionTarget) (*service.ChunkUploadResult, error) {
 			got.fileMD5 = fileMD5
 			got.fileName = fileName
 			got.totalSize = totalSize
@@ -298,6 +312,7 @@ func TestUploadHandler_UploadChunk_Success(t *testing.T) {
 			got.orgTag = orgTag
 			got.isPublic = isPublic
 			got.chunkSize = chunkSize
+			got.target = target
 			return &service.ChunkUploadResult{UploadedChunks: []int{0, 1}, Progress: 66.6}, nil
 		},
 	}
@@ -310,6 +325,7 @@ func TestUploadHandler_UploadChunk_Success(t *testing.T) {
 		"chunkIndex": "1",
 		"orgTag":     "team-x",
 		"isPublic":   "1",
+		"documentId": "doc-1",
 	}, "file", "chunk.bin", []byte("chunk-data"))
 	if w.Code != http.StatusOK {
 		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
@@ -324,6 +340,9 @@ func TestUploadHandler_UploadChunk_Success(t *testing.T) {
 	if got.chunkSize <= 0 {
 		t.Fatalf("unexpected chunkSize: %d", got.chunkSize)
 	}
+	if got.target.DocumentID != "doc-1" || got.target.SameName {
+		t.Fatalf("unexpected version target: %+v", got.target)
+	}
 }
 
 func TestUploadHandler_MergeChunks_InvalidBody(t *testing.T) {
@@ -383,3 +402,59 @@ func TestUploadHandler_MergeChunks_Success(t *testing.T) {
 		t.Fatalf("unexpected service args: md5=%s file=%s user=%d", gotMD5, gotFileName, gotUserID)
 	}
 }
+
+func TestUploadHandler_StreamProcessingStatus_StopsWhenFinished(t *testing.T) {
+	finishedAt := time.Now()
+	closed := false
+	svc := &fakeUploadServiceForHandler{
+		getStatusFn: func(ctx context.Context, fileMD5 string, userID uint) (*service.UploadStatusResult, error) {
+			return &service.UploadStatusResult{
+				FileMD5:    fileMD5,
+				Completed:  true,
+				Processing: &model.FileProcessingJob{FileMD5: fileMD5, Stage: model.ProcessingStageEmbed, Progress: 40},
+			}, nil
+		},
+		subscribeFn: func(ctx context.Context, fileMD5 string, userID uint) (<-chan model.FileProcessingJob, func() error, error) {
+			if fileMD5 != "md5-s" || userID != 99 {
+				t.Fatalf("unexpected subscribe input: %s %d", fileMD5, userID)
+			}
+			jobs := make(chan model.FileProcessingJob, 2)
+			jobs <- model.FileProcessingJob{FileMD5: fileMD5, Stage: model.ProcessingStageIndex, Progress: 85}
+			jobs <- model.FileProcessingJob{FileMD5: fileMD5, Stage: model.ProcessingStageDone, Progress: 100, FinishedAt: &finishedAt}
+			return jobs, func() error { closed = true; return nil }, nil
+		},
+	}
+	r := newUploadPhase7Router(NewUploadHandler(svc))
+
+	w := doReq(r, http.MethodGet, "/upload/status/stream?fileMd5=md5-s", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("unexpected content type: %q", ct)
+	}
+	body := w.Body.String()
+	if strings.Count(body, "event:progress") != 3 {
+		t.Fatalf("expected snapshot plus two updates, got %q", body)
+	}
+	if !strings.Contains(body, `"stage":"done"`) {
+		t.Fatalf("expected final stage in stream, got %q", body)
+	}
+	if !closed {
+		t.Fatalf("expected subscription closed")
+	}
+}
+
+func TestUploadHandler_StreamProcessingStatus_FileNotFound(t *testing.T) {
+	svc := &fakeUploadServiceForHandler{
+		subscribeFn: func(ctx context.Context, fileMD5 string, userID uint) (<-chan model.FileProcessingJob, func() error, error) {
+			return nil, nil, service.ErrFileNotFound
+		},
+	}
+	r := newUploadPhase7Router(NewUploadHandler(svc))
+
+	w := doReq(r, http.MethodGet, "/upload/status/stream?fileMd5=missing", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404, got %d, body=%s", w.Code, w.Body.String())
+	}
+}
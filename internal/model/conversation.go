@@ -1,18 +1,82 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // ChatMessage 表示一条多轮对话消息。
+// ID 对应 chat_messages 主键，用于判断消息是否已并入滚动摘要；Redis 中的旧数据可能为 0。
+// 助手消息会附带本轮回答引用的资料，便于历史回放时还原 [n] 与文件片段的对应关系。
+// 用户消息会附带提问时生效的检索范围，未限定范围时省略。
 type ChatMessage struct {
-	Role      string    `json:"role"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID         uint            `json:"id,omitempty"`
+	Role       string          `json:"role"`
+	Content    string          `json:"content"`
+	References []ChatReference `json:"references,omitempty"`
+	Scope      *ChatScope      `json:"scope,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+// ChatScope 把对话限定在部分知识库内：指定文件、某个组织标签下的文档或某个文件夹（含子文件夹）。
+// 多个条件之间取并集，命中任意一项的文档都会被检索；访问权限过滤照常生效，范围只会缩小可检索的文档。
+type ChatScope struct {
+	FileMD5s []string `json:"fileMd5s,omitempty"`
+	OrgTag   string   `json:"orgTag,omitempty"`
+	FolderID uint     `json:"folderId,omitempty"`
+}
+
+// IsEmpty 判断范围是否未设置任何条件，空范围表示检索全部可访问文档。
+func (s *ChatScope) IsEmpty() bool {
+	return s == nil || (len(s.FileMD5s) == 0 && s.OrgTag == "" && s.FolderID == 0)
+}
+
+// ChatReference 表示回答中 [n] 引用对应的检索片段。
+// Index 与系统提示词里的参考资料编号一致，从 1 开始；Page/PageEnd/Section 为片段所在页码和章节，未知时省略。
+type ChatReference struct {
+	Index    int     `json:"index"`
+	FileMD5  string  `json:"fileMd5"`
+	FileName string  `json:"fileName"`
+	ChunkID  int     `json:"chunkId"`
+	Score    float64 `json:"score"`
+	Snippet  string  `json:"snippet"`
+	Page     int     `json:"page,omitempty"`
+	PageEnd  int     `json:"pageEnd,omitempty"`
+	Section  string  `json:"section,omitempty"`
 }
 
-// Conversation 表示当前会话的元信息。
-// 阶段十二先只在 Redis 中维护，不落 MySQL。
+// Conversation 表示一个具名会话的元信息，一个用户可以同时拥有多个会话。
+// MySQL 是唯一可信来源，Redis 只缓存元信息与最近若干轮消息；用户删除会话时只做软删除，完整记录留档备查。
+// Summary 是滚动摘要，覆盖 ID 不大于 SummarizedUntilID 的全部消息；Scope 是会话当前的检索范围，为空时检索全部可访问文档。
 type Conversation struct {
-	ID        string    `json:"id"`
-	UserID    uint      `json:"userId"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID                string         `gorm:"type:varchar(64);primaryKey" json:"id"`
+	UserID            uint           `gorm:"not null;index" json:"userId"`
+	Title             string         `gorm:"type:varchar(255);not null" json:"title"`
+	Summary           string         `gorm:"type:text" json:"summary,omitempty"`
+	SummarizedUntilID uint           `gorm:"not null;default:0" json:"summarizedUntilId,omitempty"`
+	Scope             *ChatScope     `gorm:"serializer:json;type:text" json:"scope,omitempty"`
+	CreatedAt         time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+// ChatMessageRecord 是 ChatMessage 在 chat_messages 表中的持久化形式，保存完整、不截断的对话记录。
+// References 和 Scope 以 JSON 文本落库，避免为引用单独建表。
+type ChatMessageRecord struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ConversationID string    `gorm:"type:varchar(64);not null;index" json:"conversationId"`
+	Role           string    `gorm:"type:varchar(20);not null" json:"role"`
+	Content        string    `gorm:"type:longtext;not null" json:"content"`
+	ReferencesJSON string    `gorm:"column:references_json;type:text" json:"-"`
+	ScopeJSON      string    `gorm:"column:scope_json;type:text" json:"-"`
+	CreatedAt      time.Time `gorm:"not null;index" json:"createdAt"`
+}
+
+func (ChatMessageRecord) TableName() string {
+	return "chat_messages"
 }
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+const (
+	DeadLetterStatusPending  = "pending"
+	DeadLetterStatusReplayed = "replayed"
+)
+
+// FileTaskDeadLetter 记录超过重试上限、已发往死信 topic 的文件处理任务，供管理员查询和重放。
+type FileTaskDeadLetter struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileMD5     string     `gorm:"type:varchar(32);not null;index" json:"fileMd5"`
+	FileName    string     `gorm:"type:varchar(255);not null" json:"fileName"`
+	UserID      uint       `gorm:"not null" json:"userId"`
+	OrgTag      string     `gorm:"type:varchar(50)" json:"orgTag"`
+	IsPublic    bool       `gorm:"not null;default:false" json:"isPublic"`
+	ObjectKey   string     `gorm:"type:varchar(500);not null" json:"objectKey"`
+	Error       string     `gorm:"type:text" json:"error"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	SourceTopic string     `gorm:"type:varchar(255)" json:"sourceTopic"`
+	Partition   int        `gorm:"not null;default:0" json:"partition"`
+	Offset      int64      `gorm:"not null;default:0" json:"offset"`
+	EnqueuedAt  time.Time  `json:"enqueuedAt"`
+	FailedAt    time.Time  `gorm:"index" json:"failedAt"`
+	Status      string     `gorm:"type:varchar(32);not null;default:'pending';index" json:"status"`
+	ReplayCount int        `gorm:"not null;default:0" json:"replayCount"`
+	ReplayedAt  *time.Time `gorm:"default:null" json:"replayedAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (FileTaskDeadLetter) TableName() string {
+	return "file_task_dead_letters"
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// SharePermissionRead 允许查看、下载、预览和检索文档。
+	SharePermissionRead = "read"
+	// SharePermissionManage 在只读之外还允许修改标签、重新处理和管理共享授权；删除文档仍只有所有者和管理员可以操作。
+	SharePermissionManage = "manage"
+)
+
+// DocumentShare 对应 document_shares 表，把所有者名下的一个文件授权给指定用户或组织标签，二者只设置一个。
+// 授权按文件记录，共享一个文档时其全部版本各记录一份，新版本上传时沿用上一版本的授权。
+type DocumentShare struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileMD5       string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_document_share_grantee,priority:1" json:"fileMd5"`
+	OwnerID       uint      `gorm:"not null;uniqueIndex:idx_document_share_grantee,priority:2" json:"ownerId"`
+	GranteeUserID uint      `gorm:"not null;default:0;index;uniqueIndex:idx_document_share_grantee,priority:3" json:"userId,omitempty"`
+	GranteeOrgTag string    `gorm:"type:varchar(50);not null;default:'';index;uniqueIndex:idx_document_share_grantee,priority:4" json:"orgTag,omitempty"`
+	Permission    string    `gorm:"type:varchar(16);not null;default:'read'" json:"permission"`
+	CreatedBy     uint      `gorm:"not null" json:"createdBy"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (DocumentShare) TableName() string {
+	return "document_shares"
+}
+
+// DocumentSharing 是冗余到分块和 ES 的被授权方列表，检索时与所有者、公开和组织标签一起做权限过滤。
+// 检索只需要读权限，所以不区分 read 和 manage。
+type DocumentSharing struct {
+	SharedUserIDs []uint   `gorm:"serializer:json;type:text" json:"sharedUserIds,omitempty"`
+	SharedOrgTags []string `gorm:"serializer:json;type:text" json:"sharedOrgTags,omitempty"`
+}
+
+// BuildDocumentSharing 汇总授权中的用户和组织标签，结果排序去重，便于比较。
+func BuildDocumentSharing(shares []DocumentShare) DocumentSharing {
+	var sharing DocumentSharing
+	seenUsers := make(map[uint]struct{}, len(shares))
+	seenTags := make(map[string]struct{}, len(shares))
+	for _, share := range shares {
+		if share.GranteeUserID != 0 {
+			if _, exists := seenUsers[share.GranteeUserID]; !exists {
+				seenUsers[share.GranteeUserID] = struct{}{}
+				sharing.SharedUserIDs = append(sharing.SharedUserIDs, share.GranteeUserID)
+			}
+		}
+		if share.GranteeOrgTag != "" {
+			if _, exists := seenTags[share.GranteeOrgTag]; !exists {
+				seenTags[share.GranteeOrgTag] = struct{}{}
+				sharing.SharedOrgTags = append(sharing.SharedOrgTags, share.GranteeOrgTag)
+			}
+		}
+	}
+	sort.Slice(sharing.SharedUserIDs, func(i, j int) bool { return sharing.SharedUserIDs[i] < sharing.SharedUserIDs[j] })
+	sort.Strings(sharing.SharedOrgTags)
+	return sharing
+}
+
+// Equal 判断两份授权列表是否一致，用于重新处理时判断 chunk 是否需要重建。
+func (s DocumentSharing) Equal(other DocumentSharing) bool {
+	if len(s.SharedUserIDs) != len(other.SharedUserIDs) || len(s.SharedOrgTags) != len(other.SharedOrgTags) {
+		return false
+	}
+	for i := range s.SharedUserIDs {
+		if s.SharedUserIDs[i] != other.SharedUserIDs[i] {
+			return false
+		}
+	}
+	for i := range s.SharedOrgTags {
+		if s.SharedOrgTags[i] != other.SharedOrgTags[i] {
+			return false
+		}
+	}
+	return true
+}
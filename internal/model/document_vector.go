@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
 
 // DocumentVector 表示文档经过分块后的最小检索单元。
 // 阶段九仅持久化文本与检索元数据，向量字段留到阶段十。
@@ -9,14 +13,82 @@ type DocumentVector struct {
 	FileMD5      string    `gorm:"type:varchar(32);not null;index" json:"fileMd5"`
 	ChunkID      int       `gorm:"not null" json:"chunkId"`
 	TextContent  string    `gorm:"type:text;not null" json:"textContent"`
+	ContentHash  string    `gorm:"type:char(64);index" json:"contentHash"`
 	ModelVersion string    `gorm:"type:varchar(100)" json:"modelVersion"`
 	UserID       uint      `gorm:"not null;index" json:"userId"`
 	OrgTag       string    `gorm:"type:varchar(50)" json:"orgTag"`
 	IsPublic     bool      `gorm:"not null;default:false" json:"isPublic"`
+	Superseded   bool      `gorm:"not null;default:false" json:"superseded"` // 所属文件已有更新的版本，默认不参与检索
+	FolderID     uint      `gorm:"not null;default:0;index" json:"folderId"` // 所属文件所在的文件夹，0 表示根目录
 	CreatedAt    time.Time `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	// Metadata 冗余一份所属文档的元数据，索引迁移只读 document_vectors 也能重建完整的 ES 文档。
+	Metadata DocumentMetadata `gorm:"embedded;embeddedPrefix:doc_" json:"metadata"`
+
+	// Location 记录分块在原文中的位置，用于检索结果和对话引用定位到页码和章节。
+	Location ChunkLocation `gorm:"embedded" json:"location"`
+
+	// Attributes 冗余一份所属文档的标签等属性，用于分面检索。
+	Attributes DocumentAttributes `gorm:"embedded" json:"attributes"`
+
+	// Sharing 冗余一份所属文件的共享授权，索引迁移时随分块重建 ES 权限字段。
+	Sharing DocumentSharing `gorm:"embedded" json:"sharing"`
+}
+
+// DocumentAttributes 是分面检索用到的文档属性：用户填写的标签和自定义元数据，以及文件类型和上传时间。
+type DocumentAttributes struct {
+	Tags           []string          `gorm:"serializer:json;type:text" json:"tags,omitempty"`
+	CustomMetadata map[string]string `gorm:"serializer:json;type:text" json:"customMetadata,omitempty"`
+	FileType       string            `gorm:"type:varchar(20)" json:"fileType,omitempty"`
+	UploadedAt     *time.Time        `gorm:"default:null" json:"uploadedAt,omitempty"`
+}
+
+// Equal 判断两份属性是否一致，用于重新处理时判断 chunk 是否需要重建。
+func (a DocumentAttributes) Equal(other DocumentAttributes) bool {
+	if a.FileType != other.FileType || len(a.Tags) != len(other.Tags) || len(a.CustomMetadata) != len(other.CustomMetadata) {
+		return false
+	}
+	for i := range a.Tags {
+		if a.Tags[i] != other.Tags[i] {
+			return false
+		}
+	}
+	for key, value := range a.CustomMetadata {
+		if otherValue, ok := other.CustomMetadata[key]; !ok || otherValue != value {
+			return false
+		}
+	}
+	if a.UploadedAt == nil || other.UploadedAt == nil {
+		return a.UploadedAt == nil && other.UploadedAt == nil
+	}
+	return a.UploadedAt.Equal(*other.UploadedAt)
+}
+
+// ChunkLocation 是分块在提取后正文中的位置。页码从 1 开始，没有分页信息（纯文本、表格等）时为 0；
+// CharStart/CharEnd 为字符偏移，左闭右开；SectionPath 为所在章节的标题路径，以 " > " 连接。
+type ChunkLocation struct {
+	PageStart   int    `gorm:"not null;default:0" json:"pageStart,omitempty"`
+	PageEnd     int    `gorm:"not null;default:0" json:"pageEnd,omitempty"`
+	CharStart   int    `gorm:"not null;default:0" json:"charStart"`
+	CharEnd     int    `gorm:"not null;default:0" json:"charEnd"`
+	SectionPath string `gorm:"type:varchar(1024)" json:"sectionPath,omitempty"`
 }
 
 func (DocumentVector) TableName() string {
 	return "document_vectors"
 }
+
+// HashChunkContent 返回 chunk 文本的 sha256，用于重新处理时判断 chunk 是否变化。
+func HashChunkContent(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// EffectiveContentHash 兼容引入 content_hash 之前写入的旧行：未保存哈希时按文本现算。
+func (v DocumentVector) EffectiveContentHash() string {
+	if v.ContentHash != "" {
+		return v.ContentHash
+	}
+	return HashChunkContent(v.TextContent)
+}
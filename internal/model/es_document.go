@@ -1,18 +1,41 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // EsDocument 表示写入 Elasticsearch 的检索文档。
 type EsDocument struct {
-	VectorID     string    `json:"vector_id"`
-	FileMD5      string    `json:"file_md5"`
-	ChunkID      int       `json:"chunk_id"`
-	TextContent  string    `json:"text_content"`
-	Vector       []float32 `json:"vector"`
-	ModelVersion string    `json:"model_version"`
-	UserID       uint      `json:"user_id"`
-	OrgTag       string    `json:"org_tag"`
-	IsPublic     bool      `json:"is_public"`
+	VectorID     string     `json:"vector_id"`
+	FileMD5      string     `json:"file_md5"`
+	ChunkID      int        `json:"chunk_id"`
+	TextContent  string     `json:"text_content"`
+	Vector       []float32  `json:"vector"`
+	ModelVersion string     `json:"model_version"`
+	UserID       uint       `json:"user_id"`
+	OrgTag       string     `json:"org_tag"`
+	IsPublic     bool       `json:"is_public"`
+	Superseded   bool       `json:"superseded,omitempty"`
+	FolderID     uint       `json:"folder_id,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	Author       string     `json:"author,omitempty"`
+	AuthoredAt   *time.Time `json:"authored_at,omitempty"`
+	PageCount    int        `json:"page_count,omitempty"`
+	Language     string     `json:"language,omitempty"`
+	PageStart    int        `json:"page_start,omitempty"`
+	PageEnd      int        `json:"page_end,omitempty"`
+	CharStart    int        `json:"char_start"`
+	CharEnd      int        `json:"char_end"`
+	SectionPath  string     `json:"section_path,omitempty"`
+	// Tags 等字段用于分面检索：tags、file_type 为 keyword，custom_metadata 为 flattened，uploaded_at 为 date。
+	Tags           []string          `json:"tags,omitempty"`
+	CustomMetadata map[string]string `json:"custom_metadata,omitempty"`
+	FileType       string            `json:"file_type,omitempty"`
+	UploadedAt     *time.Time        `json:"uploaded_at,omitempty"`
+	// SharedUserIDs、SharedOrgTags 是共享授权的被授权方，只用于权限过滤，检索时不返回。
+	SharedUserIDs []uint   `json:"shared_user_ids,omitempty"`
+	SharedOrgTags []string `json:"shared_org_tags,omitempty"`
 }
 
 // SearchResponseDTO 表示返回给前端的检索结果。
@@ -25,6 +48,21 @@ type SearchResponseDTO struct {
 	UserID      uint    `json:"userId"`
 	OrgTag      string  `json:"orgTag"`
 	IsPublic    bool    `json:"isPublic"`
+	Superseded  bool    `json:"superseded,omitempty"`
+	FolderID    uint    `json:"folderId,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	Author      string  `json:"author,omitempty"`
+	PageCount   int     `json:"pageCount,omitempty"`
+	Language    string  `json:"language,omitempty"`
+	PageStart   int     `json:"pageStart,omitempty"`
+	PageEnd     int     `json:"pageEnd,omitempty"`
+	CharStart   int     `json:"charStart"`
+	CharEnd     int     `json:"charEnd"`
+	SectionPath string  `json:"sectionPath,omitempty"`
+	// Tags、CustomMetadata、FileType 为所属文档的属性。
+	Tags           []string          `json:"tags,omitempty"`
+	CustomMetadata map[string]string `json:"customMetadata,omitempty"`
+	FileType       string            `json:"fileType,omitempty"`
 }
 
 func BuildVectorID(fileMD5 string, chunkID int) string {
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// Folder 对应 folders 表，用于把文档组织成树形的文件夹/集合。
+// OrgTag 为空时是 UserID 的个人文件夹；否则是组织文件夹，拥有该组织标签的用户都可以查看和管理。
+// 子文件夹与父文件夹的归属（个人/组织）始终一致。
+type Folder struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
+	ParentID  *uint     `gorm:"index" json:"parentId"`
+	UserID    uint      `gorm:"not null;index" json:"userId"` // 个人文件夹的所有者，组织文件夹记录创建人
+	OrgTag    string    `gorm:"type:varchar(50);index" json:"orgTag"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (Folder) TableName() string {
+	return "folders"
+}
+
+// AccessibleBy 判断用户能否查看和管理该文件夹：个人文件夹只属于所有者，组织文件夹属于该组织标签的成员。
+func (f Folder) AccessibleBy(userID uint, orgTags []string) bool {
+	if f.OrgTag == "" {
+		return f.UserID == userID
+	}
+	for _, tag := range orgTags {
+		if tag == f.OrgTag {
+			return true
+		}
+	}
+	return false
+}
+
+// FolderNode 是文件夹树的节点，DocumentCount 为直接位于该文件夹中的文档数（各文档只计最新版本）。
+type FolderNode struct {
+	ID            uint          `json:"id"`
+	Name          string        `json:"name"`
+	ParentID      *uint         `json:"parentId"`
+	OrgTag        string        `json:"orgTag"`
+	DocumentCount int64         `json:"documentCount"`
+	Children      []*FolderNode `json:"children"`
+}
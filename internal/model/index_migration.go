@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+const (
+	IndexMigrationStatusRunning   = "running"
+	IndexMigrationStatusCompleted = "completed"
+	IndexMigrationStatusFailed    = "failed"
+)
+
+// IndexMigration 记录一次 embedding 模型迁移：用新模型把 document_vectors 重新向量化写入新版本索引，
+// 完成后把 Elasticsearch 别名从 SourceIndex 原子切换到 TargetIndex。
+type IndexMigration struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ModelVersion   string     `gorm:"type:varchar(100);not null" json:"modelVersion"`
+	VectorDims     int        `gorm:"not null" json:"vectorDims"`
+	SourceIndex    string     `gorm:"type:varchar(255)" json:"sourceIndex"`
+	TargetIndex    string     `gorm:"type:varchar(255)" json:"targetIndex"`
+	Status         string     `gorm:"type:varchar(32);not null;default:'running';index" json:"status"`
+	TotalFiles     int64      `gorm:"not null;default:0" json:"totalFiles"`
+	MigratedFiles  int64      `gorm:"not null;default:0" json:"migratedFiles"`
+	MigratedChunks int64      `gorm:"not null;default:0" json:"migratedChunks"`
+	LastError      string     `gorm:"type:text" json:"lastError"`
+	StartedAt      time.Time  `json:"startedAt"`
+	SwappedAt      *time.Time `gorm:"default:null" json:"swappedAt,omitempty"`
+	FinishedAt     *time.Time `gorm:"default:null" json:"finishedAt,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (IndexMigration) TableName() string {
+	return "index_migrations"
+}
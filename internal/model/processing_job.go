@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// 文件处理阶段，按执行顺序排列。
+const (
+	ProcessingStageQueued   = "queued"
+	ProcessingStageDownload = "download"
+	ProcessingStageExtract  = "extract"
+	ProcessingStageChunk    = "chunk"
+	ProcessingStageEmbed    = "embed"
+	ProcessingStageIndex    = "index"
+	ProcessingStageDone     = "done"
+)
+
+// FileProcessingJob 记录一个文件最近一次处理的阶段、进度和各阶段耗时，每个 (file_md5, user_id) 一行。
+// Status 与 FileUpload.ProcessingStatus 取值一致。
+type FileProcessingJob struct {
+	ID             uint             `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileMD5        string           `gorm:"type:varchar(32);not null;uniqueIndex:idx_processing_job_file_user" json:"fileMd5"`
+	UserID         uint             `gorm:"not null;uniqueIndex:idx_processing_job_file_user" json:"userId"`
+	Stage          string           `gorm:"type:varchar(32);not null" json:"stage"`
+	Status         string           `gorm:"type:varchar(32);not null" json:"status"`
+	TotalChunks    int              `gorm:"not null;default:0" json:"totalChunks"`
+	ChangedChunks  int              `gorm:"not null;default:0" json:"changedChunks"` // 需要重新向量化的 chunk 数
+	EmbeddedChunks int              `gorm:"not null;default:0" json:"embeddedChunks"`
+	Progress       float64          `gorm:"not null;default:0" json:"progress"`          // 0-100
+	ErrorCode      string           `gorm:"type:varchar(64)" json:"errorCode,omitempty"` // 与 FileUpload.ProcessingErrorCode 一致
+	LastError      string           `gorm:"type:text" json:"lastError,omitempty"`
+	StageDurations map[string]int64 `gorm:"serializer:json;type:text" json:"stageDurationsMs"` // 阶段名 -> 耗时毫秒
+	StartedAt      time.Time        `json:"startedAt"`
+	StageStartedAt time.Time        `json:"stageStartedAt"`
+	FinishedAt     *time.Time       `gorm:"default:null" json:"finishedAt,omitempty"`
+	CreatedAt      time.Time        `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time        `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (FileProcessingJob) TableName() string {
+	return "file_processing_jobs"
+}
+
+// IsFinished 表示处理已结束（成功、空文档或失败），不会再有进度更新。
+func (j FileProcessingJob) IsFinished() bool {
+	return j.FinishedAt != nil
+}
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
 
 const (
 	FileUploadStatusUploading = 0
@@ -16,26 +20,80 @@ const (
 	FileProcessingStatusFailed     = "failed"
 )
 
+// 文件处理失败的分类错误码，记录在 FileUpload.ProcessingErrorCode。
+const (
+	ProcessingErrorStorage                    = "storage_error"
+	ProcessingErrorUnsupportedFormat          = "unsupported_format"
+	ProcessingErrorEncryptedDocument          = "encrypted_document"
+	ProcessingErrorCorruptedDocument          = "corrupted_document"
+	ProcessingErrorExtractTimeout             = "extract_timeout"
+	ProcessingErrorExtractFailed              = "extract_failed"
+	ProcessingErrorOCRFailed                  = "ocr_failed"
+	ProcessingErrorChunkFailed                = "chunk_failed"
+	ProcessingErrorEmbeddingDimensionMismatch = "embedding_dimension_mismatch"
+	ProcessingErrorEmbeddingFailed            = "embedding_failed"
+	ProcessingErrorIndexFailed                = "index_failed"
+	ProcessingErrorDatabase                   = "database_error"
+	ProcessingErrorInternal                   = "internal_error"
+)
+
 // 文件上传相关，记录元数据和状态
 type FileUpload struct {
-	ID               uint       `gorm:"primaryKey;autoIncrement" json:"id"`
-	FileMD5          string     `gorm:"type:varchar(32);not null" json:"fileMd5"`
-	FileName         string     `gorm:"type:varchar(255);not null" json:"fileName"`
-	TotalSize        int64      `gorm:"not null" json:"totalSize"`
-	Status           int        `gorm:"type:tinyint;not null;default:0" json:"status"` // 0: 上传中, 1: 上传完成, 2: 上传失败
-	ProcessingStatus string     `gorm:"type:varchar(32);not null;default:'pending'" json:"processingStatus"`
-	UserID           uint       `gorm:"not null" json:"userId"`
-	OrgTag           string     `gorm:"type:varchar(50)" json:"orgTag"`
-	IsPublic         bool       `gorm:"not null;default:false" json:"isPublic"`
-	MergedAt         *time.Time `gorm:"default:null" json:"mergedAt,omitempty"`
-	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"createdAt"`
-	UpdatedAt        time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+	ID                     uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileMD5                string     `gorm:"type:varchar(32);not null" json:"fileMd5"`
+	FileName               string     `gorm:"type:varchar(255);not null" json:"fileName"`
+	TotalSize              int64      `gorm:"not null" json:"totalSize"`
+	Status                 int        `gorm:"type:tinyint;not null;default:0" json:"status"` // 0: 上传中, 1: 上传完成, 2: 上传失败
+	ProcessingStatus       string     `gorm:"type:varchar(32);not null;default:'pending'" json:"processingStatus"`
+	ProcessingErrorCode    string     `gorm:"type:varchar(64)" json:"processingErrorCode,omitempty"` // 最近一次处理失败的错误码，重新处理时清空
+	ProcessingErrorMessage string     `gorm:"type:text" json:"processingErrorMessage,omitempty"`
+	UserID                 uint       `gorm:"not null" json:"userId"`
+	OrgTag                 string     `gorm:"type:varchar(50)" json:"orgTag"`
+	IsPublic               bool       `gorm:"not null;default:false" json:"isPublic"`
+	DocumentID             string     `gorm:"type:varchar(64);index" json:"documentId,omitempty"` // 逻辑文档 ID，同一文档的各版本共用；旧数据为空，首次上传新版本时补上
+	Version                int        `gorm:"not null;default:1" json:"version"`
+	IsLatest               bool       `gorm:"not null;default:true;index" json:"isLatest"` // 是否为该文档最新的已上传版本，只有最新版本默认参与检索和文档列表
+	FolderID               uint       `gorm:"not null;default:0;index" json:"folderId"`    // 所在文件夹，0 表示根目录；同一文档的各版本始终在同一文件夹
+	MergedAt               *time.Time `gorm:"default:null" json:"mergedAt,omitempty"`
+	CreatedAt              time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt              time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	// Tags 和 CustomMetadata 由用户填写，同一文档的各版本保持一致，随分块写入 ES 供分面检索。
+	Tags           []string          `gorm:"serializer:json;type:text" json:"tags,omitempty"`
+	CustomMetadata map[string]string `gorm:"serializer:json;type:text" json:"customMetadata,omitempty"`
+
+	Metadata DocumentMetadata `gorm:"embedded;embeddedPrefix:doc_" json:"metadata"`
 }
 
 func (FileUpload) TableName() string {
 	return "file_uploads"
 }
 
+// DocumentMetadata 是 Tika 从文档中提取的元数据，内嵌在 FileUpload 和 DocumentVector 中，并随每个分块写入 ES 供检索过滤和加权。
+type DocumentMetadata struct {
+	Title      string     `gorm:"type:varchar(512)" json:"title,omitempty"`
+	Author     string     `gorm:"type:varchar(255)" json:"author,omitempty"`
+	AuthoredAt *time.Time `gorm:"default:null" json:"authoredAt,omitempty"` // 文档自身记录的创建时间，不是上传时间
+	PageCount  int        `gorm:"not null;default:0" json:"pageCount,omitempty"`
+	Language   string     `gorm:"type:varchar(16)" json:"language,omitempty"`
+}
+
+// Equal 判断两份元数据是否一致，用于重新处理时判断 chunk 是否需要重建。
+func (m DocumentMetadata) Equal(other DocumentMetadata) bool {
+	if m.Title != other.Title || m.Author != other.Author || m.PageCount != other.PageCount || m.Language != other.Language {
+		return false
+	}
+	if m.AuthoredAt == nil || other.AuthoredAt == nil {
+		return m.AuthoredAt == nil && other.AuthoredAt == nil
+	}
+	return m.AuthoredAt.Equal(*other.AuthoredAt)
+}
+
+// FileTypeOf 返回文件扩展名（小写、不含点）作为文件类型，没有扩展名时返回空。
+func FileTypeOf(fileName string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+}
+
 // ChunkInfo 记录分片上传中每个分片的信息，与 FileUpload 通过 FileMD5 关联（1:N）
 type ChunkInfo struct {
 	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
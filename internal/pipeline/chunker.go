@@ -0,0 +1,468 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"pai_smart_go_v2/internal/config"
+)
+
+const (
+	ChunkStrategyFixed    = "fixed"
+	ChunkStrategySentence = "sentence"
+	ChunkStrategyMarkdown = "markdown"
+	ChunkStrategyRows     = "rows"
+)
+
+// defaultChunkStrategies 按扩展名选择分块策略，未列出的类型按句子/段落边界切分。
+var defaultChunkStrategies = map[string]string{
+	".md":       ChunkStrategyMarkdown,
+	".markdown": ChunkStrategyMarkdown,
+	".csv":      ChunkStrategyRows,
+	".xlsx":     ChunkStrategyRows,
+	".xls":      ChunkStrategyRows,
+}
+
+// Chunker 把 Tika 提取出的纯文本切成待向量化的片段。
+type Chunker interface {
+	Chunk(text string) ([]string, error)
+}
+
+// NewChunker 根据文件扩展名和 chunking 配置选择分块器。
+// 未配置 chunk_size 时沿用默认的 1000/100。
+func NewChunker(cfg config.ChunkingConfig, fileName string) (Chunker, error) {
+	size, overlap := cfg.ChunkSize, cfg.ChunkOverlap
+	if size <= 0 {
+		size = defaultTextChunkSize
+		if overlap == 0 {
+			overlap = defaultTextChunkOverlap
+		}
+	}
+	if overlap < 0 {
+		return nil, fmt.Errorf("chunk_overlap must be greater than or equal to 0")
+	}
+	if size <= overlap {
+		return nil, fmt.Errorf("chunk_size must be greater than chunk_overlap")
+	}
+
+	strategy := chunkStrategyFor(cfg, fileName)
+	switch strategy {
+	case ChunkStrategyFixed:
+		return fixedChunker{size: size, overlap: overlap}, nil
+	case ChunkStrategySentence:
+		return sentenceChunker{size: size, overlap: overlap}, nil
+	case ChunkStrategyMarkdown:
+		return markdownChunker{size: size, overlap: overlap}, nil
+	case ChunkStrategyRows:
+		return rowChunker{size: size}, nil
+	default:
+		return nil, fmt.Errorf("unknown chunk strategy %q", strategy)
+	}
+}
+
+func chunkStrategyFor(cfg config.ChunkingConfig, fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for key, strategy := range cfg.Strategies {
+		if strings.ToLower(normalizeExtension(key)) == ext && strings.TrimSpace(strategy) != "" {
+			return strings.ToLower(strings.TrimSpace(strategy))
+		}
+	}
+	if strategy, ok := defaultChunkStrategies[ext]; ok {
+		return strategy
+	}
+	if strategy := strings.TrimSpace(cfg.DefaultStrategy); strategy != "" {
+		return strings.ToLower(strategy)
+	}
+	return ChunkStrategySentence
+}
+
+func normalizeExtension(ext string) string {
+	ext = strings.TrimSpace(ext)
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// fixedChunker 是原先的定长滑动窗口切分。
+type fixedChunker struct {
+	size    int
+	overlap int
+}
+
+func (c fixedChunker) Chunk(text string) ([]string, error) {
+	return splitText(text, c.size, c.overlap)
+}
+
+// sentenceChunker 在段落和句子边界（含中文标点）处切分，并把相邻句子贪心合并到 size 以内；
+// 新片段以上一片段末尾不超过 overlap 的若干整句开头。
+type sentenceChunker struct {
+	size    int
+	overlap int
+}
+
+func (c sentenceChunker) Chunk(text string) ([]string, error) {
+	return packSegments(splitSentences(text), c.size, c.overlap, "")
+}
+
+// markdownChunker 先按标题切成小节，再把相邻小节合并到 size 以内；
+// 超长小节按句子继续切分，每个片段前面补上所属的标题路径。
+type markdownChunker struct {
+	size    int
+	overlap int
+}
+
+func (c markdownChunker) Chunk(text string) ([]string, error) {
+	sections := splitMarkdownSections(text)
+	chunks := make([]string, 0, len(sections))
+	var current strings.Builder
+	currentLen := 0
+
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+		currentLen = 0
+	}
+
+	for _, section := range sections {
+		content := strings.TrimSpace(section.content)
+		body := strings.TrimSpace(joinChunk(section.heading, content))
+		if body == "" {
+			continue
+		}
+		bodyLen := runeLen(body)
+		if bodyLen > c.size {
+			flush()
+			parts, err := packSegments(splitSentences(content), c.size, c.overlap, section.breadcrumb)
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, parts...)
+			continue
+		}
+		if currentLen > 0 && currentLen+bodyLen+2 > c.size {
+			flush()
+		}
+		if currentLen > 0 {
+			current.WriteString("\n\n")
+			currentLen += 2
+		}
+		current.WriteString(body)
+		currentLen += bodyLen
+	}
+	flush()
+	return chunks, nil
+}
+
+type markdownSection struct {
+	heading    string
+	breadcrumb string
+	content    string
+}
+
+// splitMarkdownSections 以 ATX 标题为界切分，忽略围栏代码块里的 # 行。
+func splitMarkdownSections(text string) []markdownSection {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	sections := make([]markdownSection, 0)
+	var headings [6]string
+	current := markdownSection{}
+	var content strings.Builder
+	fence := ""
+
+	flush := func() {
+		current.content = content.String()
+		sections = append(sections, current)
+		content.Reset()
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if marker := codeFenceMarker(trimmed); marker != "" {
+			if fence == "" {
+				fence = marker
+			} else if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		}
+		if level := markdownHeadingLevel(trimmed); fence == "" && level > 0 {
+			flush()
+			headings[level-1] = trimmed
+			for i := level; i < len(headings); i++ {
+				headings[i] = ""
+			}
+			path := make([]string, 0, level)
+			for _, heading := range headings[:level] {
+				if heading != "" {
+					path = append(path, heading)
+				}
+			}
+			current = markdownSection{heading: trimmed, breadcrumb: strings.Join(path, "\n")}
+			continue
+		}
+		content.WriteString(line)
+		content.WriteString("\n")
+	}
+	flush()
+	return sections
+}
+
+func markdownHeadingLevel(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0
+	}
+	if level == len(line) || line[level] == ' ' || line[level] == '\t' {
+		return level
+	}
+	return 0
+}
+
+func codeFenceMarker(line string) string {
+	if strings.HasPrefix(line, "```") {
+		return "```"
+	}
+	if strings.HasPrefix(line, "~~~") {
+		return "~~~"
+	}
+	return ""
+}
+
+// rowChunker 用于 CSV/XLSX：按行打包到 size 以内，不在行中间切断，
+// 每个片段都重复表头（XLSX 还包含工作表名），保证单个片段脱离上下文也能读懂。
+type rowChunker struct {
+	size int
+}
+
+func (c rowChunker) Chunk(text string) ([]string, error) {
+	chunks := make([]string, 0)
+	for _, block := range splitTableBlocks(text) {
+		prefix := strings.Join(block.header, "\n")
+		budget := c.size - runeLen(prefix) - 1
+		if prefix == "" {
+			budget = c.size
+		}
+		if budget <= 0 {
+			// 表头本身已经超过 size，只能退化为不带表头的行打包。
+			prefix, budget = "", c.size
+		}
+
+		rows := make([]string, 0)
+		rowsLen := 0
+		flush := func() {
+			if len(rows) == 0 {
+				return
+			}
+			chunks = append(chunks, joinChunk(prefix, strings.Join(rows, "\n")))
+			rows = rows[:0]
+			rowsLen = 0
+		}
+
+		for _, row := range block.rows {
+			rowLen := runeLen(row)
+			if rowLen > budget {
+				flush()
+				parts, err := splitText(row, budget, 0)
+				if err != nil {
+					return nil, err
+				}
+				for _, part := range parts {
+					chunks = append(chunks, joinChunk(prefix, part))
+				}
+				continue
+			}
+			if len(rows) > 0 && rowsLen+1+rowLen > budget {
+				flush()
+			}
+			if len(rows) > 0 {
+				rowsLen++
+			}
+			rows = append(rows, row)
+			rowsLen += rowLen
+		}
+		flush()
+		if len(block.rows) == 0 && prefix != "" {
+			chunks = append(chunks, prefix)
+		}
+	}
+	return chunks, nil
+}
+
+type tableBlock struct {
+	header []string
+	rows   []string
+}
+
+// splitTableBlocks 以空行分隔表格块（Tika 输出 XLSX 时每个工作表之间有空行）。
+// 块首行不含分隔符时视为工作表名，紧随其后的一行视为表头。
+func splitTableBlocks(text string) []tableBlock {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	blocks := make([]tableBlock, 0)
+	current := make([]string, 0)
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		block := tableBlock{}
+		idx := 0
+		if len(current) > 1 && !strings.ContainsAny(current[0], "\t,;") {
+			block.header = append(block.header, current[0])
+			idx = 1
+		}
+		if idx < len(current) {
+			block.header = append(block.header, current[idx])
+			idx++
+		}
+		block.rows = append(block.rows, current[idx:]...)
+		blocks = append(blocks, block)
+		current = current[:0]
+	}
+
+	for _, line := range lines {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return blocks
+}
+
+// splitSentences 把文本切成保留原始字符的句子片段：
+// 换行、中文句末标点（。！？；…）以及后接空白的英文句末标点都视为边界。
+func splitSentences(text string) []string {
+	runes := []rune(strings.ReplaceAll(text, "\r\n", "\n"))
+	segments := make([]string, 0)
+	start := 0
+
+	for i := 0; i < len(runes); i++ {
+		if !isSentenceBoundary(runes, i) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isClosingPunct(runes[end]) {
+			end++
+		}
+		segments = append(segments, string(runes[start:end]))
+		start = end
+		i = end - 1
+	}
+	if start < len(runes) {
+		segments = append(segments, string(runes[start:]))
+	}
+	return segments
+}
+
+func isSentenceBoundary(runes []rune, i int) bool {
+	switch runes[i] {
+	case '\n', '。', '！', '？', '；', '…':
+		return true
+	case '.', '!', '?', ';':
+		return i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+	}
+	return false
+}
+
+func isClosingPunct(r rune) bool {
+	switch r {
+	case '”', '’', '」', '』', '）', ')', '"', '\'', '…':
+		return true
+	}
+	return false
+}
+
+// packSegments 把句子片段贪心合并成不超过 size 的片段，超长句子退化为定长切分。
+// prefix 非空时会加在每个片段前面，并计入长度。
+func packSegments(segments []string, size int, overlap int, prefix string) ([]string, error) {
+	prefix = strings.TrimSpace(prefix)
+	budget := size
+	if prefix != "" {
+		budget = size - runeLen(prefix) - 1
+		if budget <= overlap {
+			prefix, budget = "", size
+		}
+	}
+	if budget <= overlap {
+		return nil, fmt.Errorf("chunk_size must be greater than overlap")
+	}
+
+	chunks := make([]string, 0)
+	window := make([]string, 0)
+	windowLen := 0
+	fresh := 0
+
+	emit := func() {
+		if fresh == 0 {
+			return
+		}
+		if chunk := strings.TrimSpace(strings.Join(window, "")); chunk != "" {
+			chunks = append(chunks, joinChunk(prefix, chunk))
+		}
+		// 保留末尾不超过 overlap 的整句作为下一片段的开头。
+		keep := 0
+		keptLen := 0
+		for i := len(window) - 1; i >= 0; i-- {
+			l := runeLen(window[i])
+			if keptLen+l > overlap {
+				break
+			}
+			keptLen += l
+			keep++
+		}
+		window = append(window[:0], window[len(window)-keep:]...)
+		windowLen = keptLen
+		fresh = 0
+	}
+
+	for _, segment := range segments {
+		segmentLen := runeLen(segment)
+		if segmentLen > budget {
+			emit()
+			window, windowLen = window[:0], 0
+			parts, err := splitText(segment, budget, overlap)
+			if err != nil {
+				return nil, err
+			}
+			for _, part := range parts {
+				if part = strings.TrimSpace(part); part != "" {
+					chunks = append(chunks, joinChunk(prefix, part))
+				}
+			}
+			continue
+		}
+		if windowLen+segmentLen > budget {
+			emit()
+			for windowLen+segmentLen > budget && len(window) > 0 {
+				windowLen -= runeLen(window[0])
+				window = window[1:]
+			}
+		}
+		window = append(window, segment)
+		windowLen += segmentLen
+		if strings.TrimSpace(segment) != "" {
+			fresh++
+		}
+	}
+	emit()
+	return chunks, nil
+}
+
+func joinChunk(prefix string, body string) string {
+	if prefix == "" {
+		return body
+	}
+	return prefix + "\n" + body
+}
+
+func runeLen(s string) int {
+	return len([]rune(s))
+}
@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"pai_smart_go_v2/internal/config"
+)
+
+func TestNewChunker_SelectsStrategyByExtension(t *testing.T) {
+	cases := []struct {
+		fileName string
+		cfg      config.ChunkingConfig
+		want     Chunker
+	}{
+		{fileName: "guide.md", want: markdownChunker{size: 1000, overlap: 100}},
+		{fileName: "data.CSV", want: rowChunker{size: 1000}},
+		{fileName: "report.xlsx", want: rowChunker{size: 1000}},
+		{fileName: "paper.pdf", want: sentenceChunker{size: 1000, overlap: 100}},
+		{
+			fileName: "notes.txt",
+			cfg:      config.ChunkingConfig{ChunkSize: 500, ChunkOverlap: 50, Strategies: map[string]string{"txt": "fixed"}},
+			want:     fixedChunker{size: 500, overlap: 50},
+		},
+		{
+			fileName: "paper.pdf",
+			cfg:      config.ChunkingConfig{ChunkSize: 300, DefaultStrategy: "fixed"},
+			want:     fixedChunker{size: 300, overlap: 0},
+		},
+	}
+
+	for _, tc := range cases {
+		got, err := NewChunker(tc.cfg, tc.fileName)
+		if err != nil {
+			t.Fatalf("NewChunker(%q) error = %v", tc.fileName, err)
+		}
+		if got != tc.want {
+			t.Fatalf("NewChunker(%q) = %#v, want %#v", tc.fileName, got, tc.want)
+		}
+	}
+}
+
+func TestNewChunker_InvalidConfig(t *testing.T) {
+	if _, err := NewChunker(config.ChunkingConfig{ChunkSize: 100, ChunkOverlap: 100}, "a.txt"); err == nil {
+		t.Fatalf("expected size <= overlap error")
+	}
+	if _, err := NewChunker(config.ChunkingConfig{ChunkSize: 100, ChunkOverlap: -1}, "a.txt"); err == nil {
+		t.Fatalf("expected negative overlap error")
+	}
+	if _, err := NewChunker(config.ChunkingConfig{Strategies: map[string]string{"txt": "semantic"}}, "a.txt"); err == nil {
+		t.Fatalf("expected unknown strategy error")
+	}
+}
+
+func TestSplitSentences_ChinesePunctuation(t *testing.T) {
+	got := splitSentences("第一句。第二句！“第三句？”Version 1.2 is out. Next\n段落")
+	want := []string{"第一句。", "第二句！", "“第三句？”", "Version 1.2 is out.", " Next\n", "段落"}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected segments: %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("segment[%d]=%q, want=%q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSentenceChunker_RespectsBoundariesAndOverlap(t *testing.T) {
+	chunks, err := sentenceChunker{size: 12, overlap: 5}.Chunk("甲甲甲甲。乙乙乙乙。丙丙丙丙。丁丁丁丁。")
+	if err != nil {
+		t.Fatalf("Chunk() error = %v", err)
+	}
+	want := []string{"甲甲甲甲。乙乙乙乙。", "乙乙乙乙。丙丙丙丙。", "丙丙丙丙。丁丁丁丁。"}
+	if len(chunks) != len(want) {
+		t.Fatalf("unexpected chunks: %q", chunks)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Fatalf("chunk[%d]=%q, want=%q", i, chunks[i], want[i])
+		}
+	}
+}
+
+func TestSentenceChunker_LongSentenceFallsBackToFixed(t *testing.T) {
+	chunks, err := sentenceChunker{size: 10, overlap: 2}.Chunk(strings.Repeat("字", 25) + "。短句。")
+	if err != nil {
+		t.Fatalf("Chunk() error = %v", err)
+	}
+	for _, chunk := range chunks {
+		if runeLen(chunk) > 10 {
+			t.Fatalf("chunk exceeds size: %q", chunk)
+		}
+	}
+	if chunks[len(chunks)-1] != "短句。" {
+		t.Fatalf("expected trailing sentence to start a fresh chunk, got %q", chunks)
+	}
+}
+
+func TestMarkdownChunker_SplitsByHeadings(t *testing.T) {
+	text := strings.Join([]string{
+		"# 安装",
+		"下载二进制。",
+		"## 配置",
+		"```bash",
+		"# 这不是标题",
+		"```",
+		"# 使用",
+		"运行服务。",
+	}, "\n")
+
+	chunks, err := markdownChunker{size: 40, overlap: 0}.Chunk(text)
+	if err != nil {
+		t.Fatalf("Chunk() error = %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("unexpected chunks: %q", chunks)
+	}
+	if !strings.HasPrefix(chunks[0], "# 安装") || !strings.Contains(chunks[0], "# 这不是标题") {
+		t.Fatalf("unexpected first chunk: %q", chunks[0])
+	}
+	if chunks[1] != "# 使用\n运行服务。" {
+		t.Fatalf("unexpected second chunk: %q", chunks[1])
+	}
+}
+
+func TestMarkdownChunker_LongSectionKeepsHeadingPath(t *testing.T) {
+	text := "# 指南\n## 部署\n" + strings.Repeat("步骤说明。", 10)
+
+	chunks, err := markdownChunker{size: 30, overlap: 0}.Chunk(text)
+	if err != nil {
+		t.Fatalf("Chunk() error = %v", err)
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("expected long section to be split, got %q", chunks)
+	}
+	for _, chunk := range chunks[1:] {
+		if !strings.HasPrefix(chunk, "# 指南\n## 部署\n") || runeLen(chunk) > 30 {
+			t.Fatalf("unexpected chunk: %q", chunk)
+		}
+	}
+}
+
+func TestRowChunker_RepeatsHeader(t *testing.T) {
+	text := "Sheet1\n\t姓名\t部门\n\t张三\t研发\n\t李四\t产品\n\t王五\t运营\n\n\nSheet2\n\t项目\t状态\n\tA\t完成\n"
+
+	chunks, err := rowChunker{size: 27}.Chunk(text)
+	if err != nil {
+		t.Fatalf("Chunk() error = %v", err)
+	}
+	want := []string{
+		"Sheet1\n\t姓名\t部门\n\t张三\t研发\n\t李四\t产品",
+		"Sheet1\n\t姓名\t部门\n\t王五\t运营",
+		"Sheet2\n\t项目\t状态\n\tA\t完成",
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("unexpected chunks: %q", chunks)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Fatalf("chunk[%d]=%q, want=%q", i, chunks[i], want[i])
+		}
+	}
+}
+
+func TestRowChunker_CSV(t *testing.T) {
+	chunks, err := rowChunker{size: 1000}.Chunk("id,name\n1,go\n2,rust\n")
+	if err != nil {
+		t.Fatalf("Chunk() error = %v", err)
+	}
+	if len(chunks) != 1 || chunks[0] != "id,name\n1,go\n2,rust" {
+		t.Fatalf("unexpected chunks: %q", chunks)
+	}
+}
@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/embedding"
+	"pai_smart_go_v2/pkg/tika"
+)
+
+const maxProcessingErrorDetail = 500
+
+// processingError 给处理流程中的错误标注所在环节，供 classifyProcessingError 归类。
+type processingError struct {
+	code string
+	err  error
+}
+
+func (e *processingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *processingError) Unwrap() error {
+	return e.err
+}
+
+func wrapProcessingError(code string, format string, args ...interface{}) error {
+	return &processingError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// permanentProcessingError 标记重试也不会成功的处理失败，Kafka consumer 通过 Permanent 识别后直接转入死信。
+type permanentProcessingError struct {
+	code string
+	err  error
+}
+
+func (e *permanentProcessingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentProcessingError) Unwrap() error {
+	return e.err
+}
+
+func (e *permanentProcessingError) Permanent() bool {
+	return true
+}
+
+// permanentProcessingErrors 是重试也不会成功的错误码：文件本身无法解析，或 embedding 返回的维度与配置不符，需要人工处理。
+var permanentProcessingErrors = map[string]bool{
+	model.ProcessingErrorUnsupportedFormat:          true,
+	model.ProcessingErrorEncryptedDocument:          true,
+	model.ProcessingErrorCorruptedDocument:          true,
+	model.ProcessingErrorEmbeddingDimensionMismatch: true,
+}
+
+// markPermanent 在错误码属于不可重试的失败时给 err 加上 permanentProcessingError 标记，其余原样返回。
+func markPermanent(code string, err error) error {
+	if err == nil || !permanentProcessingErrors[code] {
+		return err
+	}
+	return &permanentProcessingError{code: code, err: err}
+}
+
+var processingErrorDescriptions = map[string]string{
+	model.ProcessingErrorStorage:                    "Failed to read the file from object storage",
+	model.ProcessingErrorUnsupportedFormat:          "The file format is not supported by the text extractor",
+	model.ProcessingErrorEncryptedDocument:          "The document is encrypted or password protected",
+	model.ProcessingErrorCorruptedDocument:          "The document is damaged or could not be parsed",
+	model.ProcessingErrorExtractTimeout:             "Text extraction timed out",
+	model.ProcessingErrorExtractFailed:              "Text extraction failed",
+	model.ProcessingErrorOCRFailed:                  "OCR of the scanned document or image failed",
+	model.ProcessingErrorChunkFailed:                "Failed to split the document into chunks",
+	model.ProcessingErrorEmbeddingDimensionMismatch: "The embedding model returned vectors of an unexpected dimension",
+	model.ProcessingErrorEmbeddingFailed:            "Failed to generate embeddings",
+	model.ProcessingErrorIndexFailed:                "Failed to write the search index",
+	model.ProcessingErrorDatabase:                   "Failed to save processing results",
+	model.ProcessingErrorInternal:                   "Unexpected processing error",
+}
+
+// classifyProcessingError 把处理失败归类为稳定的错误码，并生成面向用户的说明（附带截断后的原始错误）。
+func classifyProcessingError(err error) (string, string) {
+	code := processingErrorCode(err)
+	message := processingErrorDescriptions[code]
+	if detail := strings.TrimSpace(err.Error()); detail != "" {
+		runes := []rune(detail)
+		if len(runes) > maxProcessingErrorDetail {
+			detail = string(runes[:maxProcessingErrorDetail]) + "..."
+		}
+		message += ": " + detail
+	}
+	return code, message
+}
+
+func processingErrorCode(err error) string {
+	if errors.Is(err, embedding.ErrDimensionMismatch) {
+		return model.ProcessingErrorEmbeddingDimensionMismatch
+	}
+
+	var stageErr *processingError
+	if !errors.As(err, &stageErr) {
+		return model.ProcessingErrorInternal
+	}
+	if stageErr.code != model.ProcessingErrorExtractFailed {
+		return stageErr.code
+	}
+
+	var tikaErr *tika.StatusError
+	if errors.As(err, &tikaErr) {
+		switch {
+		case tikaErr.StatusCode == http.StatusUnsupportedMediaType:
+			return model.ProcessingErrorUnsupportedFormat
+		case tikaErr.StatusCode == http.StatusUnprocessableEntity && strings.Contains(strings.ToLower(tikaErr.Body), "encrypt"):
+			return model.ProcessingErrorEncryptedDocument
+		case tikaErr.StatusCode == http.StatusUnprocessableEntity:
+			return model.ProcessingErrorCorruptedDocument
+		}
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return model.ProcessingErrorExtractTimeout
+	}
+	return model.ProcessingErrorExtractFailed
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/embedding"
+	"pai_smart_go_v2/pkg/tika"
+)
+
+func TestClassifyProcessingError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "encrypted pdf",
+			err:  wrapProcessingError(model.ProcessingErrorExtractFailed, "extract text by tika failed: %w", &tika.StatusError{StatusCode: http.StatusUnprocessableEntity, Body: "org.apache.tika.exception.EncryptedDocumentException"}),
+			want: model.ProcessingErrorEncryptedDocument,
+		},
+		{
+			name: "corrupted document",
+			err:  wrapProcessingError(model.ProcessingErrorExtractFailed, "extract text by tika failed: %w", &tika.StatusError{StatusCode: http.StatusUnprocessableEntity, Body: "TikaException"}),
+			want: model.ProcessingErrorCorruptedDocument,
+		},
+		{
+			name: "unsupported format",
+			err:  wrapProcessingError(model.ProcessingErrorExtractFailed, "extract text by tika failed: %w", &tika.StatusError{StatusCode: http.StatusUnsupportedMediaType}),
+			want: model.ProcessingErrorUnsupportedFormat,
+		},
+		{
+			name: "tika timeout",
+			err:  wrapProcessingError(model.ProcessingErrorExtractFailed, "extract text by tika failed: %w", fmt.Errorf("call tika failed: %w", context.DeadlineExceeded)),
+			want: model.ProcessingErrorExtractTimeout,
+		},
+		{
+			name: "dimension mismatch",
+			err:  wrapProcessingError(model.ProcessingErrorEmbeddingFailed, "vectorize document chunks failed: %w", fmt.Errorf("%w for chunk 0: got=768 want=1024", embedding.ErrDimensionMismatch)),
+			want: model.ProcessingErrorEmbeddingDimensionMismatch,
+		},
+		{
+			name: "index failure",
+			err:  wrapProcessingError(model.ProcessingErrorIndexFailed, "bulk index documents to elasticsearch failed: %w", errors.New("es status=503")),
+			want: model.ProcessingErrorIndexFailed,
+		},
+		{
+			name: "unclassified",
+			err:  errors.New("boom"),
+			want: model.ProcessingErrorInternal,
+		},
+	}
+
+	for _, tc := range cases {
+		code, message := classifyProcessingError(tc.err)
+		if code != tc.want {
+			t.Fatalf("%s: code = %q, want %q", tc.name, code, tc.want)
+		}
+		if !strings.HasPrefix(message, processingErrorDescriptions[tc.want]+": ") || !strings.Contains(message, tc.err.Error()) {
+			t.Fatalf("%s: unexpected message %q", tc.name, message)
+		}
+	}
+}
+
+func TestClassifyProcessingError_DimensionMismatchFromEmbeddingClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"index":0,"embedding":[0.1,0.2,0.3]}]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.EmbeddingConfig{BaseURL: server.URL, APIKey: "test-key", Model: "text-embedding-v4", Dimensions: 2}
+	client, err := embedding.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	p := &Processor{embedding: client, embeddingCfg: cfg}
+
+	_, _, err = p.vectorizeDocuments(context.Background(), []model.DocumentVector{{FileMD5: "md5v", ChunkID: 0, TextContent: "first"}}, nil)
+	if err == nil {
+		t.Fatal("expected vectorizeDocuments() error")
+	}
+	code, _ := classifyProcessingError(wrapProcessingError(model.ProcessingErrorEmbeddingFailed, "vectorize document chunks failed: %w", err))
+	if code != model.ProcessingErrorEmbeddingDimensionMismatch {
+		t.Fatalf("code = %q, want %q", code, model.ProcessingErrorEmbeddingDimensionMismatch)
+	}
+}
+
+func TestClassifyProcessingError_TruncatesDetail(t *testing.T) {
+	_, message := classifyProcessingError(errors.New(strings.Repeat("x", maxProcessingErrorDetail+100)))
+	if !strings.HasSuffix(message, "...") || len(message) > len(processingErrorDescriptions[model.ProcessingErrorInternal])+maxProcessingErrorDetail+10 {
+		t.Fatalf("expected truncated message, got length %d", len(message))
+	}
+}
+
+func TestMarkPermanent(t *testing.T) {
+	encrypted := wrapProcessingError(model.ProcessingErrorExtractFailed, "extract text by tika failed: %w", &tika.StatusError{StatusCode: http.StatusUnprocessableEntity, Body: "EncryptedDocumentException"})
+	code, _ := classifyProcessingError(encrypted)
+	marked := markPermanent(code, encrypted)
+	var permanent interface{ Permanent() bool }
+	if !errors.As(marked, &permanent) || !permanent.Permanent() {
+		t.Fatalf("expected encrypted document failure marked permanent, got %T", marked)
+	}
+	if marked.Error() != encrypted.Error() || processingErrorCode(marked) != model.ProcessingErrorEncryptedDocument {
+		t.Fatalf("expected marking to keep the original error, got %q", marked.Error())
+	}
+
+	transient := wrapProcessingError(model.ProcessingErrorIndexFailed, "bulk index documents to elasticsearch failed: %w", errors.New("es status=503"))
+	if marked := markPermanent(model.ProcessingErrorIndexFailed, transient); errors.As(marked, &permanent) {
+		t.Fatalf("expected transient failure left retryable")
+	}
+}
@@ -0,0 +1,263 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/embedding"
+	"pai_smart_go_v2/pkg/es"
+	"pai_smart_go_v2/pkg/log"
+)
+
+const (
+	migrationFilePageSize    = 100
+	maxMigrationCatchUpRound = 3
+)
+
+// CutoverFunc 在别名切换到新索引后调用，让检索和文档处理改用新模型的 embedding 客户端。
+type CutoverFunc func(client embedding.Client, model string, dimensions int)
+
+// IndexMigrator 用新的 embedding 模型把 document_vectors 逐个文件重新向量化，写入新版本索引，完成后切换别名。
+// 迁移期间检索和文档处理仍走别名指向的旧索引；全量迁移后把期间有变更的文件重新迁移，
+// 直到一轮内没有新变更（最多 maxMigrationCatchUpRound 轮）再切换，切换后再补一轮，覆盖切换前最后一刻的变更。
+type IndexMigrator struct {
+	uploadRepo    repository.UploadRepository
+	docVectorRepo repository.DocumentVectorRepository
+	migrationRepo repository.IndexMigrationRepository
+	esClient      es.Client
+	embeddingCfg  config.EmbeddingConfig
+	onCutover     CutoverFunc
+}
+
+func NewIndexMigrator(
+	uploadRepo repository.UploadRepository,
+	docVectorRepo repository.DocumentVectorRepository,
+	migrationRepo repository.IndexMigrationRepository,
+	esClient es.Client,
+	embeddingCfg config.EmbeddingConfig,
+	onCutover CutoverFunc,
+) *IndexMigrator {
+	return &IndexMigrator{
+		uploadRepo:    uploadRepo,
+		docVectorRepo: docVectorRepo,
+		migrationRepo: migrationRepo,
+		esClient:      esClient,
+		embeddingCfg:  embeddingCfg,
+		onCutover:     onCutover,
+	}
+}
+
+// Run 执行 migration 描述的迁移，过程中持久化进度，结束时写入 completed/failed 状态。
+// client 必须生成 migration.ModelVersion、migration.VectorDims 对应的向量。
+func (m *IndexMigrator) Run(ctx context.Context, migration *model.IndexMigration, client embedding.Client) error {
+	err := m.run(ctx, migration, client)
+
+	finishedAt := time.Now()
+	migration.FinishedAt = &finishedAt
+	if err != nil {
+		migration.Status = model.IndexMigrationStatusFailed
+		migration.LastError = err.Error()
+		log.Errorf("[IndexMigration] 迁移失败: id=%d target=%s err=%v", migration.ID, migration.TargetIndex, err)
+	} else {
+		migration.Status = model.IndexMigrationStatusCompleted
+		log.Infof("[IndexMigration] 迁移完成: id=%d target=%s files=%d chunks=%d", migration.ID, migration.TargetIndex, migration.MigratedFiles, migration.MigratedChunks)
+	}
+	if saveErr := m.migrationRepo.Save(migration); saveErr != nil {
+		log.Errorf("[IndexMigration] 保存迁移状态失败: id=%d err=%v", migration.ID, saveErr)
+	}
+	return err
+}
+
+// ResolveActiveIndexEmbedding 在启动时按别名指向索引 _meta 记录的模型、维度确定 embedding 配置。
+// 迁移切换后新模型只在运行中的进程里生效，重启时配置若仍是旧模型，以索引记录为准，查询向量才能与索引一致。
+// 索引未记录模型版本时沿用配置，此时维度与索引不一致无法纠正，返回错误。
+func ResolveActiveIndexEmbedding(ctx context.Context, esClient es.Client, cfg config.EmbeddingConfig) (config.EmbeddingConfig, error) {
+	active, err := esClient.ActiveIndexModel(ctx)
+	if err != nil {
+		return cfg, fmt.Errorf("read active index model failed: %w", err)
+	}
+	if active.ModelVersion == "" {
+		if active.VectorDims > 0 && cfg.Dimensions > 0 && active.VectorDims != cfg.Dimensions {
+			return cfg, fmt.Errorf("index %s uses %d-dim vectors but embedding is configured with %d dims (model=%q) and the index does not record its model; update embedding.model and embedding.dimensions to match the index",
+				active.Index, active.VectorDims, cfg.Dimensions, cfg.Model)
+		}
+		return cfg, nil
+	}
+
+	resolved := cfg
+	resolved.Model = active.ModelVersion
+	if active.VectorDims > 0 {
+		resolved.Dimensions = active.VectorDims
+	}
+	if resolved.Model != cfg.Model || resolved.Dimensions != cfg.Dimensions {
+		log.Warnf("[IndexMigration] embedding 配置与当前索引不一致，按索引记录使用 model=%s dims=%d（配置为 model=%s dims=%d），请同步修改 embedding 配置",
+			resolved.Model, resolved.Dimensions, cfg.Model, cfg.Dimensions)
+	}
+	return resolved, nil
+}
+
+func (m *IndexMigrator) run(ctx context.Context, migration *model.IndexMigration, client embedding.Client) error {
+	source, err := m.esClient.ActiveIndex(ctx)
+	if err != nil {
+		return fmt.Errorf("resolve active index failed: %w", err)
+	}
+	total, err := m.docVectorRepo.CountFiles()
+	if err != nil {
+		return fmt.Errorf("count files failed: %w", err)
+	}
+	target, err := m.esClient.CreateIndexVersion(ctx, migration.VectorDims, migration.ModelVersion)
+	if err != nil {
+		return fmt.Errorf("create target index failed: %w", err)
+	}
+	migration.SourceIndex = source
+	migration.TargetIndex = target
+	migration.TotalFiles = total
+	m.saveProgress(migration)
+	log.Infof("[IndexMigration] 开始迁移: id=%d source=%s target=%s model=%s dims=%d files=%d", migration.ID, source, target, migration.ModelVersion, migration.VectorDims, total)
+
+	targetCfg := m.embeddingCfg
+	targetCfg.Model = migration.ModelVersion
+	targetCfg.Dimensions = migration.VectorDims
+	worker := &Processor{embedding: client, esClient: m.esClient.ForIndex(target), embeddingCfg: targetCfg}
+
+	passStart := time.Now()
+	afterMD5 := ""
+	for {
+		fileMD5s, err := m.docVectorRepo.ListFileMD5s(afterMD5, migrationFilePageSize)
+		if err != nil {
+			return fmt.Errorf("list files failed: %w", err)
+		}
+		if len(fileMD5s) == 0 {
+			break
+		}
+		for _, fileMD5 := range fileMD5s {
+			if err := m.migrateFile(ctx, worker, migration, fileMD5, false); err != nil {
+				return err
+			}
+		}
+		afterMD5 = fileMD5s[len(fileMD5s)-1]
+		m.saveProgress(migration)
+	}
+
+	for round := 0; round < maxMigrationCatchUpRound; round++ {
+		changed, next, err := m.catchUp(ctx, worker, migration, passStart)
+		if err != nil {
+			return err
+		}
+		passStart = next
+		if changed == 0 {
+			break
+		}
+	}
+
+	if err := m.esClient.SwapAlias(ctx, target); err != nil {
+		return fmt.Errorf("swap alias failed: %w", err)
+	}
+	swappedAt := time.Now()
+	migration.SwappedAt = &swappedAt
+	m.saveProgress(migration)
+	log.Infof("[IndexMigration] 别名已切换: %s -> %s", source, target)
+
+	if m.onCutover != nil {
+		m.onCutover(client, migration.ModelVersion, migration.VectorDims)
+	}
+	if _, _, err := m.catchUp(ctx, worker, migration, passStart); err != nil {
+		return err
+	}
+	return nil
+}
+
+// catchUp 重新迁移 since 之后有变更的文件，返回变更文件数和下一轮的起点。
+// 上传记录和分块都要看：共享授权、标签等只改 document_vectors，不会更新 file_uploads。
+func (m *IndexMigrator) catchUp(ctx context.Context, worker *Processor, migration *model.IndexMigration, since time.Time) (int, time.Time, error) {
+	next := time.Now()
+	fileMD5s, err := m.changedFileMD5s(since)
+	if err != nil {
+		return 0, since, err
+	}
+	for _, fileMD5 := range fileMD5s {
+		if err := m.migrateFile(ctx, worker, migration, fileMD5, true); err != nil {
+			return 0, since, err
+		}
+	}
+	if len(fileMD5s) > 0 {
+		m.saveProgress(migration)
+		log.Infof("[IndexMigration] 已补迁移期间变更的文件: id=%d files=%d", migration.ID, len(fileMD5s))
+	}
+	return len(fileMD5s), next, nil
+}
+
+// changedFileMD5s 合并 since 之后上传记录或分块有变更的文件 MD5，按字典序去重。
+func (m *IndexMigrator) changedFileMD5s(since time.Time) ([]string, error) {
+	uploadMD5s, err := m.uploadRepo.FindFileMD5sUpdatedSince(since)
+	if err != nil {
+		return nil, fmt.Errorf("find changed uploads failed: %w", err)
+	}
+	vectorMD5s, err := m.docVectorRepo.FindFileMD5sUpdatedSince(since)
+	if err != nil {
+		return nil, fmt.Errorf("find changed document vectors failed: %w", err)
+	}
+	seen := make(map[string]struct{}, len(uploadMD5s)+len(vectorMD5s))
+	fileMD5s := make([]string, 0, len(uploadMD5s)+len(vectorMD5s))
+	for _, fileMD5 := range append(uploadMD5s, vectorMD5s...) {
+		if _, ok := seen[fileMD5]; ok {
+			continue
+		}
+		seen[fileMD5] = struct{}{}
+		fileMD5s = append(fileMD5s, fileMD5)
+	}
+	sort.Strings(fileMD5s)
+	return fileMD5s, nil
+}
+
+// migrateFile 把单个文件当前的全部分块写入目标索引；replace 为 true 时先清掉目标索引里该文件的旧文档。
+func (m *IndexMigrator) migrateFile(ctx context.Context, worker *Processor, migration *model.IndexMigration, fileMD5 string, replace bool) error {
+	vectors, err := m.docVectorRepo.FindByFileMD5(fileMD5)
+	if err != nil {
+		return fmt.Errorf("find document vectors failed: md5=%s: %w", fileMD5, err)
+	}
+	if replace {
+		if err := worker.esClient.DeleteDocumentsByFileMD5(ctx, fileMD5); err != nil {
+			return fmt.Errorf("delete stale target documents failed: md5=%s: %w", fileMD5, err)
+		}
+	}
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	for i := range vectors {
+		vectors[i].ModelVersion = migration.ModelVersion
+	}
+	esDocs, _, err := worker.vectorizeDocuments(ctx, vectors, nil)
+	if err != nil {
+		return fmt.Errorf("vectorize document chunks failed: md5=%s: %w", fileMD5, err)
+	}
+	if err := worker.esClient.BulkIndexDocuments(ctx, esDocs); err != nil {
+		return fmt.Errorf("bulk index target documents failed: md5=%s: %w", fileMD5, err)
+	}
+	// 按行 ID 记录模型版本：迁移期间被重新处理替换掉的分块是新行，不会被误标，由补迁移重新写入。
+	ids := make([]uint, 0, len(vectors))
+	for _, vector := range vectors {
+		ids = append(ids, vector.ID)
+	}
+	if err := m.docVectorRepo.UpdateModelVersion(ids, migration.ModelVersion); err != nil {
+		return fmt.Errorf("update document vector model_version failed: md5=%s: %w", fileMD5, err)
+	}
+
+	if !replace {
+		migration.MigratedFiles++
+	}
+	migration.MigratedChunks += int64(len(esDocs))
+	return nil
+}
+
+func (m *IndexMigrator) saveProgress(migration *model.IndexMigration) {
+	if err := m.migrationRepo.Save(migration); err != nil {
+		log.Warnf("[IndexMigration] 保存迁移进度失败: id=%d err=%v", migration.ID, err)
+	}
+}
@@ -0,0 +1,269 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/embedding"
+	"pai_smart_go_v2/pkg/es"
+)
+
+type fakeMigrationUploadRepo struct {
+	repository.UploadRepository
+	// changed 依次作为每次 FindFileMD5sUpdatedSince 的返回值，用完后返回空。
+	changed [][]string
+	calls   int
+}
+
+func (f *fakeMigrationUploadRepo) FindFileMD5sUpdatedSince(since time.Time) ([]string, error) {
+	f.calls++
+	if f.calls <= len(f.changed) {
+		return f.changed[f.calls-1], nil
+	}
+	return []string{}, nil
+}
+
+type fakeMigrationVectorRepo struct {
+	repository.DocumentVectorRepository
+	vectors map[string][]model.DocumentVector
+	// updatedModels 按行 ID 记录 UpdateModelVersion 写入的模型版本。
+	updatedModels map[uint]string
+	// changed 依次作为每次 FindFileMD5sUpdatedSince 的返回值，用完后返回空。
+	changed [][]string
+	calls   int
+}
+
+func (f *fakeMigrationVectorRepo) FindFileMD5sUpdatedSince(since time.Time) ([]string, error) {
+	f.calls++
+	if f.calls <= len(f.changed) {
+		return f.changed[f.calls-1], nil
+	}
+	return []string{}, nil
+}
+
+func (f *fakeMigrationVectorRepo) ListFileMD5s(afterMD5 string, limit int) ([]string, error) {
+	fileMD5s := make([]string, 0)
+	for _, fileMD5 := range []string{"md5-a", "md5-b"} {
+		if fileMD5 > afterMD5 && len(fileMD5s) < limit {
+			fileMD5s = append(fileMD5s, fileMD5)
+		}
+	}
+	return fileMD5s, nil
+}
+
+func (f *fakeMigrationVectorRepo) CountFiles() (int64, error) {
+	return int64(len(f.vectors)), nil
+}
+
+func (f *fakeMigrationVectorRepo) FindByFileMD5(fileMD5 string) ([]model.DocumentVector, error) {
+	return f.vectors[fileMD5], nil
+}
+
+func (f *fakeMigrationVectorRepo) UpdateModelVersion(ids []uint, modelVersion string) error {
+	for _, id := range ids {
+		f.updatedModels[id] = modelVersion
+	}
+	return nil
+}
+
+type fakeMigrationIndexMigrationRepo struct {
+	repository.IndexMigrationRepository
+	saved []model.IndexMigration
+}
+
+func (f *fakeMigrationIndexMigrationRepo) Save(migration *model.IndexMigration) error {
+	f.saved = append(f.saved, *migration)
+	return nil
+}
+
+type fakeMigrationESClient struct {
+	es.Client
+	index     string
+	events    *[]string
+	indexed   map[string][]model.EsDocument
+	swappedTo string
+}
+
+func (f *fakeMigrationESClient) ActiveIndex(ctx context.Context) (string, error) {
+	return "knowledge_base_v1", nil
+}
+
+func (f *fakeMigrationESClient) CreateIndexVersion(ctx context.Context, vectorDims int, modelVersion string) (string, error) {
+	*f.events = append(*f.events, "create")
+	return "knowledge_base_v2", nil
+}
+
+func (f *fakeMigrationESClient) SwapAlias(ctx context.Context, index string) error {
+	*f.events = append(*f.events, "swap:"+index)
+	f.swappedTo = index
+	return nil
+}
+
+func (f *fakeMigrationESClient) ForIndex(index string) es.Client {
+	return &fakeMigrationESClient{index: index, events: f.events, indexed: f.indexed}
+}
+
+func (f *fakeMigrationESClient) BulkIndexDocuments(ctx context.Context, docs []model.EsDocument) error {
+	*f.events = append(*f.events, "index:"+f.index+":"+docs[0].FileMD5)
+	f.indexed[f.index] = append(f.indexed[f.index], docs...)
+	return nil
+}
+
+func (f *fakeMigrationESClient) DeleteDocumentsByFileMD5(ctx context.Context, fileMD5 string) error {
+	*f.events = append(*f.events, "delete:"+f.index+":"+fileMD5)
+	return nil
+}
+
+func newTestIndexMigrator(uploadRepo *fakeMigrationUploadRepo, esClient *fakeMigrationESClient, onCutover CutoverFunc) (*IndexMigrator, *fakeMigrationVectorRepo, *fakeMigrationIndexMigrationRepo) {
+	vectorRepo := &fakeMigrationVectorRepo{vectors: map[string][]model.DocumentVector{
+		"md5-a": {
+			{ID: 1, FileMD5: "md5-a", ChunkID: 0, TextContent: "a0", ModelVersion: "old-model", UserID: 1},
+			{ID: 2, FileMD5: "md5-a", ChunkID: 1, TextContent: "a1", ModelVersion: "old-model", UserID: 1},
+		},
+		"md5-b": {
+			{ID: 3, FileMD5: "md5-b", ChunkID: 0, TextContent: "b0", ModelVersion: "old-model", UserID: 2, IsPublic: true},
+		},
+	}, updatedModels: map[uint]string{}}
+	migrationRepo := &fakeMigrationIndexMigrationRepo{}
+	migrator := NewIndexMigrator(uploadRepo, vectorRepo, migrationRepo, esClient, config.EmbeddingConfig{Model: "old-model", Dimensions: 2}, onCutover)
+	return migrator, vectorRepo, migrationRepo
+}
+
+func TestIndexMigrator_Run_MigratesCatchesUpAndSwaps(t *testing.T) {
+	events := []string{}
+	esClient := &fakeMigrationESClient{index: "knowledge_base", events: &events, indexed: map[string][]model.EsDocument{}}
+	uploadRepo := &fakeMigrationUploadRepo{changed: [][]string{{"md5-b"}}}
+	var cutoverModel string
+	migrator, vectorRepo, migrationRepo := newTestIndexMigrator(uploadRepo, esClient, func(client embedding.Client, model string, dimensions int) {
+		events = append(events, "cutover")
+		cutoverModel = model
+	})
+
+	migration := &model.IndexMigration{ID: 1, ModelVersion: "new-model", VectorDims: 3, Status: model.IndexMigrationStatusRunning}
+	err := migrator.Run(context.Background(), migration, &fakeEmbeddingClient{vector: []float32{0, 0.1, 0.2}})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{
+		"create",
+		"index:knowledge_base_v2:md5-a",
+		"index:knowledge_base_v2:md5-b",
+		"delete:knowledge_base_v2:md5-b",
+		"index:knowledge_base_v2:md5-b",
+		"swap:knowledge_base_v2",
+		"cutover",
+	}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected events:\n got=%v\nwant=%v", events, want)
+	}
+	for _, doc := range esClient.indexed["knowledge_base_v2"] {
+		if doc.ModelVersion != "new-model" || len(doc.Vector) != 3 {
+			t.Fatalf("unexpected migrated doc: %+v", doc)
+		}
+	}
+	if cutoverModel != "new-model" {
+		t.Fatalf("unexpected cutover model: %q", cutoverModel)
+	}
+	for _, id := range []uint{1, 2, 3} {
+		if vectorRepo.updatedModels[id] != "new-model" {
+			t.Fatalf("expected chunk %d marked with the target model, got %v", id, vectorRepo.updatedModels)
+		}
+	}
+
+	last := migrationRepo.saved[len(migrationRepo.saved)-1]
+	if last.Status != model.IndexMigrationStatusCompleted || last.SourceIndex != "knowledge_base_v1" || last.TargetIndex != "knowledge_base_v2" {
+		t.Fatalf("unexpected final migration: %+v", last)
+	}
+	if last.TotalFiles != 2 || last.MigratedFiles != 2 || last.MigratedChunks != 4 || last.SwappedAt == nil || last.FinishedAt == nil {
+		t.Fatalf("unexpected migration progress: %+v", last)
+	}
+}
+
+func TestIndexMigrator_Run_DimensionMismatchFailsBeforeSwap(t *testing.T) {
+	events := []string{}
+	esClient := &fakeMigrationESClient{index: "knowledge_base", events: &events, indexed: map[string][]model.EsDocument{}}
+	migrator, vectorRepo, migrationRepo := newTestIndexMigrator(&fakeMigrationUploadRepo{}, esClient, func(client embedding.Client, model string, dimensions int) {
+		t.Fatalf("cutover should not happen")
+	})
+
+	migration := &model.IndexMigration{ID: 2, ModelVersion: "new-model", VectorDims: 4, Status: model.IndexMigrationStatusRunning}
+	err := migrator.Run(context.Background(), migration, &fakeEmbeddingClient{vector: []float32{0, 0.1, 0.2}})
+	if !errors.Is(err, embedding.ErrDimensionMismatch) {
+		t.Fatalf("expected dimension mismatch, got %v", err)
+	}
+	if esClient.swappedTo != "" || len(vectorRepo.updatedModels) != 0 {
+		t.Fatalf("alias must not be swapped on failure: events=%v", events)
+	}
+	last := migrationRepo.saved[len(migrationRepo.saved)-1]
+	if last.Status != model.IndexMigrationStatusFailed || !strings.Contains(last.LastError, "dimension") {
+		t.Fatalf("unexpected final migration: %+v", last)
+	}
+}
+
+type fakeIndexModelESClient struct {
+	es.Client
+	active es.IndexModel
+}
+
+func (f *fakeIndexModelESClient) ActiveIndexModel(ctx context.Context) (es.IndexModel, error) {
+	return f.active, nil
+}
+
+func TestResolveActiveIndexEmbedding(t *testing.T) {
+	cfg := config.EmbeddingConfig{Model: "old-model", Dimensions: 2}
+	cases := []struct {
+		name      string
+		active    es.IndexModel
+		wantModel string
+		wantDims  int
+		wantErr   bool
+	}{
+		{name: "match", active: es.IndexModel{Index: "knowledge_base_v1", ModelVersion: "old-model", VectorDims: 2}, wantModel: "old-model", wantDims: 2},
+		{name: "legacy index without model", active: es.IndexModel{Index: "knowledge_base", VectorDims: 2}, wantModel: "old-model", wantDims: 2},
+		{name: "cut over to new model", active: es.IndexModel{Index: "knowledge_base_v2", ModelVersion: "new-model", VectorDims: 3}, wantModel: "new-model", wantDims: 3},
+		{name: "legacy dims mismatch", active: es.IndexModel{Index: "knowledge_base_v2", VectorDims: 4}, wantErr: true},
+	}
+	for _, tc := range cases {
+		resolved, err := ResolveActiveIndexEmbedding(context.Background(), &fakeIndexModelESClient{active: tc.active}, cfg)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: ResolveActiveIndexEmbedding() error = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if !tc.wantErr && (resolved.Model != tc.wantModel || resolved.Dimensions != tc.wantDims) {
+			t.Fatalf("%s: unexpected embedding config: model=%q dims=%d", tc.name, resolved.Model, resolved.Dimensions)
+		}
+	}
+}
+
+func TestIndexMigrator_Run_CatchesUpChunkOnlyChanges(t *testing.T) {
+	events := []string{}
+	esClient := &fakeMigrationESClient{index: "knowledge_base", events: &events, indexed: map[string][]model.EsDocument{}}
+	migrator, vectorRepo, _ := newTestIndexMigrator(&fakeMigrationUploadRepo{changed: [][]string{{"md5-b"}}}, esClient, nil)
+	// 共享授权更新只改了 md5-a 的分块，file_uploads 没有变化。
+	vectorRepo.changed = [][]string{{"md5-a", "md5-b"}}
+
+	migration := &model.IndexMigration{ID: 3, ModelVersion: "new-model", VectorDims: 3, Status: model.IndexMigrationStatusRunning}
+	if err := migrator.Run(context.Background(), migration, &fakeEmbeddingClient{vector: []float32{0, 0.1, 0.2}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{
+		"create",
+		"index:knowledge_base_v2:md5-a",
+		"index:knowledge_base_v2:md5-b",
+		"delete:knowledge_base_v2:md5-a",
+		"index:knowledge_base_v2:md5-a",
+		"delete:knowledge_base_v2:md5-b",
+		"index:knowledge_base_v2:md5-b",
+		"swap:knowledge_base_v2",
+	}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected events:\n got=%v\nwant=%v", events, want)
+	}
+}
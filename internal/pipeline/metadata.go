@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"strings"
+	"unicode"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/tika"
+)
+
+const (
+	maxMetadataTitleRunes  = 512
+	maxMetadataAuthorRunes = 255
+	maxMetadataLangRunes   = 16
+	languageSampleRunes    = 2000
+)
+
+// buildDocumentMetadata 把 Tika 元数据转换为落库格式；Tika 未给出语言时按正文的文字系统推断。
+func buildDocumentMetadata(meta tika.Metadata, text string) model.DocumentMetadata {
+	language := meta.Language
+	if language == "" {
+		language = detectLanguage(text)
+	}
+	return model.DocumentMetadata{
+		Title:      truncateRunes(meta.Title, maxMetadataTitleRunes),
+		Author:     truncateRunes(meta.Author, maxMetadataAuthorRunes),
+		AuthoredAt: meta.CreatedAt,
+		PageCount:  meta.PageCount,
+		Language:   truncateRunes(language, maxMetadataLangRunes),
+	}
+}
+
+// detectLanguage 按正文前 languageSampleRunes 个字符的文字系统粗略判断语言：
+// 含假名为 ja，谚文为 ko，汉字占多数为 zh，西里尔字母为 ru，其余拉丁字母统一归为 en；没有文字时返回空。
+func detectLanguage(text string) string {
+	var han, kana, hangul, cyrillic, latin, total int
+	for _, r := range text {
+		if total >= languageSampleRunes {
+			break
+		}
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		default:
+			continue
+		}
+		total++
+	}
+
+	switch {
+	case total == 0:
+		return ""
+	case kana > 0 && kana*5 >= han:
+		return "ja"
+	case hangul > han && hangul > latin:
+		return "ko"
+	case han > 0 && han*2 >= latin:
+		return "zh"
+	case cyrillic > latin:
+		return "ru"
+	default:
+		return "en"
+	}
+}
+
+func truncateRunes(value string, limit int) string {
+	value = strings.TrimSpace(value)
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit])
+}
@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"pai_smart_go_v2/pkg/tika"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":        "",
+		"1234 !!": "",
+		"这是一份关于 Go 并发的中文文档":         "zh",
+		"これは日本語の文書です":               "ja",
+		"한국어 문서입니다":                 "ko",
+		"Это документ на русском":   "ru",
+		"An English document here.": "en",
+	}
+	for text, want := range cases {
+		if got := detectLanguage(text); got != want {
+			t.Fatalf("detectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestBuildDocumentMetadata_PrefersTikaLanguageAndTruncates(t *testing.T) {
+	meta := buildDocumentMetadata(tika.Metadata{Title: strings.Repeat("标", 600), Language: "fr", PageCount: 4}, "中文正文")
+	if meta.Language != "fr" || meta.PageCount != 4 || len([]rune(meta.Title)) != maxMetadataTitleRunes {
+		t.Fatalf("unexpected metadata: language=%q pages=%d titleLen=%d", meta.Language, meta.PageCount, len([]rune(meta.Title)))
+	}
+
+	meta = buildDocumentMetadata(tika.Metadata{}, "中文正文")
+	if meta.Language != "zh" {
+		t.Fatalf("expected detected language, got %q", meta.Language)
+	}
+}
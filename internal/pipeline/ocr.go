@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/log"
+	"pai_smart_go_v2/pkg/tika"
+)
+
+const (
+	defaultOCRLanguage      = "chi_sim+eng"
+	defaultOCRMinTextLength = 50
+)
+
+// imageExtensions 只能靠 OCR 得到文字的图片类型。
+var imageExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".tif": true, ".tiff": true,
+}
+
+// OCRClient 识别扫描件和图片中的文字。tika.Client 通过 Tika 内置的 Tesseract 实现，也可以换成独立的 OCR 服务。
+type OCRClient interface {
+	ExtractTextWithOCR(ctx context.Context, reader io.Reader, fileName, language string) (string, error)
+}
+
+type extractFunc func(ctx context.Context, reader io.Reader, fileName string) (*tika.Document, error)
+
+// extractText 提取文件正文和元数据：开启 OCR 时图片直接走 OCR；PDF 先普通提取，有效字符少于阈值（通常是扫描件）再用 OCR 重新提取，
+// 取两者中有效字符更多的正文，元数据保留普通提取的结果。PDF 的 OCR 失败时保留普通提取的结果，只有两者都拿不到文字才算失败。
+func extractText(ctx context.Context, object io.ReadSeeker, fileName string, extract extractFunc, ocr OCRClient, cfg config.TikaOCRConfig) (*tika.Document, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	ocrEnabled := cfg.Enabled && ocr != nil
+	language := strings.TrimSpace(cfg.Language)
+	if language == "" {
+		language = defaultOCRLanguage
+	}
+
+	if ocrEnabled && imageExtensions[ext] {
+		text, err := ocr.ExtractTextWithOCR(ctx, object, fileName, language)
+		if err != nil {
+			return nil, wrapProcessingError(model.ProcessingErrorOCRFailed, "ocr image failed: %w", err)
+		}
+		return &tika.Document{Text: text}, nil
+	}
+
+	doc, err := extract(ctx, object, fileName)
+	if err != nil {
+		return nil, wrapProcessingError(model.ProcessingErrorExtractFailed, "extract text by tika failed: %w", err)
+	}
+
+	minTextLength := cfg.MinTextLength
+	if minTextLength <= 0 {
+		minTextLength = defaultOCRMinTextLength
+	}
+	textLength := meaningfulRuneCount(doc.Text)
+	if !ocrEnabled || ext != ".pdf" || textLength >= minTextLength {
+		return doc, nil
+	}
+
+	log.Infof("[Processor] PDF 文本过少，尝试 OCR: file=%s textLength=%d threshold=%d", fileName, textLength, minTextLength)
+	if _, err := object.Seek(0, io.SeekStart); err != nil {
+		return nil, wrapProcessingError(model.ProcessingErrorStorage, "rewind object for ocr failed: %w", err)
+	}
+	ocrText, err := ocr.ExtractTextWithOCR(ctx, object, fileName, language)
+	if err != nil {
+		if textLength == 0 {
+			return nil, wrapProcessingError(model.ProcessingErrorOCRFailed, "ocr scanned pdf failed: %w", err)
+		}
+		log.Warnf("[Processor] OCR 失败，保留普通提取结果: file=%s err=%v", fileName, err)
+		return doc, nil
+	}
+	if meaningfulRuneCount(ocrText) > textLength {
+		// OCR 的纯文本输出没有分页和标题标记，原有位置也不再对应新正文。
+		doc.Text = ocrText
+		doc.Pages = nil
+		doc.Headings = nil
+	}
+	return doc, nil
+}
+
+// meaningfulRuneCount 统计非空白、非控制字符数，扫描件的普通提取结果往往只有换行和分页符。
+func meaningfulRuneCount(text string) int {
+	count := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) && !unicode.IsControl(r) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/tika"
+)
+
+type fakeOCRClient struct {
+	text     string
+	err      error
+	calls    int
+	language string
+	content  string
+}
+
+func (f *fakeOCRClient) ExtractTextWithOCR(ctx context.Context, reader io.Reader, fileName, language string) (string, error) {
+	f.calls++
+	f.language = language
+	body, _ := io.ReadAll(reader)
+	f.content = string(body)
+	return f.text, f.err
+}
+
+func plainExtract(text string) extractFunc {
+	return func(ctx context.Context, reader io.Reader, fileName string) (*tika.Document, error) {
+		_, _ = io.ReadAll(reader)
+		return &tika.Document{Text: text, Metadata: tika.Metadata{Title: "原标题"}}, nil
+	}
+}
+
+func TestExtractText_ScannedPDFFallsBackToOCR(t *testing.T) {
+	ocr := &fakeOCRClient{text: "扫描件里识别出的文字"}
+	cfg := config.TikaOCRConfig{Enabled: true, MinTextLength: 5}
+
+	doc, err := extractText(context.Background(), strings.NewReader("pdf-bytes"), "scan.PDF", plainExtract("\n\f\n"), ocr, cfg)
+	if err != nil {
+		t.Fatalf("extractText() error = %v", err)
+	}
+	if doc.Text != "扫描件里识别出的文字" || doc.Metadata.Title != "原标题" || ocr.calls != 1 {
+		t.Fatalf("expected ocr text with original metadata, got %+v calls=%d", doc, ocr.calls)
+	}
+	if ocr.content != "pdf-bytes" || ocr.language != defaultOCRLanguage {
+		t.Fatalf("expected rewound object and default language, got content=%q language=%q", ocr.content, ocr.language)
+	}
+}
+
+func TestExtractText_SkipsOCRWhenTextSufficientOrDisabled(t *testing.T) {
+	ocr := &fakeOCRClient{text: "ocr"}
+
+	doc, err := extractText(context.Background(), strings.NewReader("pdf"), "a.pdf", plainExtract("足够长的正文内容"), ocr, config.TikaOCRConfig{Enabled: true, MinTextLength: 5})
+	if err != nil || doc.Text != "足够长的正文内容" {
+		t.Fatalf("unexpected result: doc=%+v err=%v", doc, err)
+	}
+	doc, err = extractText(context.Background(), strings.NewReader("pdf"), "a.pdf", plainExtract(""), ocr, config.TikaOCRConfig{})
+	if err != nil || doc.Text != "" {
+		t.Fatalf("unexpected result: doc=%+v err=%v", doc, err)
+	}
+	doc, err = extractText(context.Background(), strings.NewReader("docx"), "a.docx", plainExtract(""), ocr, config.TikaOCRConfig{Enabled: true})
+	if err != nil || doc.Text != "" {
+		t.Fatalf("unexpected result: doc=%+v err=%v", doc, err)
+	}
+	if ocr.calls != 0 {
+		t.Fatalf("ocr should not be called, calls=%d", ocr.calls)
+	}
+}
+
+func TestExtractText_ImageUsesOCRDirectly(t *testing.T) {
+	ocr := &fakeOCRClient{text: "截图文字"}
+	extract := func(ctx context.Context, reader io.Reader, fileName string) (*tika.Document, error) {
+		t.Fatalf("plain extraction should be skipped for images")
+		return nil, nil
+	}
+
+	doc, err := extractText(context.Background(), strings.NewReader("png"), "shot.png", extract, ocr, config.TikaOCRConfig{Enabled: true, Language: "eng"})
+	if err != nil || doc.Text != "截图文字" || ocr.language != "eng" {
+		t.Fatalf("unexpected result: doc=%+v language=%q err=%v", doc, ocr.language, err)
+	}
+}
+
+func TestExtractText_OCRFailure(t *testing.T) {
+	ocr := &fakeOCRClient{err: errors.New("tesseract not installed")}
+	cfg := config.TikaOCRConfig{Enabled: true, MinTextLength: 50}
+
+	doc, err := extractText(context.Background(), strings.NewReader("pdf"), "a.pdf", plainExtract("页眉"), ocr, cfg)
+	if err != nil || doc.Text != "页眉" {
+		t.Fatalf("expected plain text to be kept, got doc=%+v err=%v", doc, err)
+	}
+
+	_, err = extractText(context.Background(), strings.NewReader("pdf"), "a.pdf", plainExtract(" \n"), ocr, cfg)
+	if code, _ := classifyProcessingError(err); code != model.ProcessingErrorOCRFailed {
+		t.Fatalf("expected ocr_failed, got %q (%v)", code, err)
+	}
+}
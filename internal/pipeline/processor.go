@@ -31,6 +31,10 @@ type Processor struct {
 	embedding     embedding.Client
 	esClient      es.Client
 	embeddingCfg  config.EmbeddingConfig
+	chunkingCfg   config.ChunkingConfig
+	jobRepo       repository.ProcessingJobRepository
+	ocrClient     OCRClient
+	ocrCfg        config.TikaOCRConfig
 }
 
 func NewProcessor(
@@ -42,6 +46,10 @@ func NewProcessor(
 	embeddingClient embedding.Client,
 	esClient es.Client,
 	embeddingCfg config.EmbeddingConfig,
+	chunkingCfg config.ChunkingConfig,
+	jobRepo repository.ProcessingJobRepository,
+	ocrClient OCRClient,
+	ocrCfg config.TikaOCRConfig,
 ) *Processor {
 	return &Processor{
 		tikaClient:    tikaClient,
@@ -52,10 +60,14 @@ func NewProcessor(
 		embedding:     embeddingClient,
 		esClient:      esClient,
 		embeddingCfg:  embeddingCfg,
+		chunkingCfg:   chunkingCfg,
+		jobRepo:       jobRepo,
+		ocrClient:     ocrClient,
+		ocrCfg:        ocrCfg,
 	}
 }
 
-func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask) error {
+func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask) (err error) {
 	if p.tikaClient == nil {
 		return fmt.Errorf("tika client is nil")
 	}
@@ -80,32 +92,52 @@ func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask)
 	if err := p.updateProcessingStatus(task, model.FileProcessingStatusProcessing); err != nil {
 		return err
 	}
+	progress := newProgressReporter(p.jobRepo, task)
+	progress.start(ctx)
 	finalStatus := model.FileProcessingStatusFailed
 	defer func() {
-		if err := p.updateProcessingStatus(task, finalStatus); err != nil {
-			log.Errorf("[Processor] 更新处理状态失败: md5=%s status=%s err=%v", task.FileMD5, finalStatus, err)
+		errorCode := ""
+		var statusErr error
+		if finalStatus == model.FileProcessingStatusFailed && err != nil {
+			var errorMessage string
+			errorCode, errorMessage = classifyProcessingError(err)
+			statusErr = p.uploadRepo.MarkFileProcessingFailed(task.FileMD5, task.UserID, errorCode, errorMessage)
+			err = markPermanent(errorCode, err)
+		} else {
+			statusErr = p.updateProcessingStatus(task, finalStatus)
 		}
+		if statusErr != nil {
+			log.Errorf("[Processor] 更新处理状态失败: md5=%s status=%s err=%v", task.FileMD5, finalStatus, statusErr)
+		}
+		progress.finish(ctx, finalStatus, errorCode, err)
 	}()
 
 	log.Infof("[Processor] 开始处理文件: md5=%s objectKey=%s", task.FileMD5, task.ObjectKey)
 
+	progress.enterStage(ctx, model.ProcessingStageDownload)
 	object, err := p.minioClient.GetObject(ctx, p.bucketName, task.ObjectKey, minio.GetObjectOptions{})
 	if err != nil {
-		return fmt.Errorf("get object from minio failed: %w", err)
+		return wrapProcessingError(model.ProcessingErrorStorage, "get object from minio failed: %w", err)
 	}
 	defer object.Close()
 
 	if _, err := object.Stat(); err != nil {
-		return fmt.Errorf("stat object failed: %w", err)
+		return wrapProcessingError(model.ProcessingErrorStorage, "stat object failed: %w", err)
 	}
 
-	text, err := p.tikaClient.ExtractText(ctx, object, task.FileName)
+	progress.enterStage(ctx, model.ProcessingStageExtract)
+	doc, err := extractText(ctx, object, task.FileName, p.tikaClient.ExtractDocument, p.ocrClient, p.ocrCfg)
 	if err != nil {
-		return fmt.Errorf("extract text by tika failed: %w", err)
+		return err
+	}
+	text := doc.Text
+	metadata := buildDocumentMetadata(doc.Metadata, text)
+	if err := p.uploadRepo.UpdateDocumentMetadata(task.FileMD5, task.UserID, metadata); err != nil {
+		return wrapProcessingError(model.ProcessingErrorDatabase, "update document metadata failed: %w", err)
 	}
 
 	textLength := len([]rune(text))
-	log.Infof("[Processor] Tika 提取文本成功: md5=%s, textLength=%d", task.FileMD5, textLength)
+	log.Infof("[Processor] Tika 提取文本成功: md5=%s, textLength=%d, title=%q, pages=%d, language=%s", task.FileMD5, textLength, metadata.Title, metadata.PageCount, metadata.Language)
 
 	if strings.TrimSpace(text) == "" {
 		log.Warnf("[Processor] 文本为空，跳过分块: md5=%s", task.FileMD5)
@@ -113,9 +145,14 @@ func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask)
 		return nil
 	}
 
-	chunks, err := splitText(text, defaultTextChunkSize, defaultTextChunkOverlap)
+	progress.enterStage(ctx, model.ProcessingStageChunk)
+	chunker, err := NewChunker(p.chunkingCfg, task.FileName)
 	if err != nil {
-		return fmt.Errorf("split text failed: %w", err)
+		return wrapProcessingError(model.ProcessingErrorChunkFailed, "create chunker failed: %w", err)
+	}
+	chunks, err := chunker.Chunk(text)
+	if err != nil {
+		return wrapProcessingError(model.ProcessingErrorChunkFailed, "split text failed: %w", err)
 	}
 	if len(chunks) == 0 {
 		log.Warnf("[Processor] 分块结果为空，跳过写库: md5=%s", task.FileMD5)
@@ -123,39 +160,97 @@ func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask)
 		return nil
 	}
 
-	if err := p.docVectorRepo.DeleteByFileMD5(task.FileMD5); err != nil {
-		log.Warnf("[Processor] 删除旧分块失败，继续写入: md5=%s err=%v", task.FileMD5, err)
+	upload, err := p.uploadRepo.FindByFileMD5AndUserID(task.FileMD5, task.UserID)
+	if err != nil {
+		return wrapProcessingError(model.ProcessingErrorDatabase, "find upload record failed: %w", err)
 	}
-
-	vectors := buildDocumentVectors(task, chunks, p.embeddingCfg.Model)
-	if err := p.docVectorRepo.BatchCreate(vectors); err != nil {
-		return fmt.Errorf("batch create document vectors failed: %w", err)
+	task = withUploadState(task, upload)
+	locations := buildChunkLocations(text, chunks, task.FileName, doc.Pages, doc.Headings)
+	vectors := buildDocumentVectors(task, chunks, p.modelVersion(), metadata, locations)
+	versions, err := p.findDocumentVersions(task)
+	if err != nil {
+		return wrapProcessingError(model.ProcessingErrorDatabase, "find document versions failed: %w", err)
 	}
-
-	log.Infof("[Processor] 文本分块完成: md5=%s, chunks=%d", task.FileMD5, len(vectors))
-	log.Infof("[Processor] 批量写入 document_vectors 成功: md5=%s", task.FileMD5)
-
-	persistedVectors, err := p.docVectorRepo.FindByFileMD5(task.FileMD5)
+	superseded, olderMD5s := resolveVersionState(task, versions)
+	attributes := buildDocumentAttributes(upload)
+	shares, err := p.uploadRepo.FindShares(task.FileMD5, task.UserID)
 	if err != nil {
-		return fmt.Errorf("find document vectors by file_md5 failed: %w", err)
+		return wrapProcessingError(model.ProcessingErrorDatabase, "find document shares failed: %w", err)
 	}
-	if len(persistedVectors) == 0 {
-		log.Warnf("[Processor] 未找到已写入的 chunk，跳过向量化: md5=%s", task.FileMD5)
-		finalStatus = model.FileProcessingStatusEmpty
-		return nil
+	sharing := model.BuildDocumentSharing(shares)
+	for i := range vectors {
+		vectors[i].Superseded = superseded
+		vectors[i].Attributes = attributes
+		vectors[i].Sharing = sharing
 	}
+	log.Infof("[Processor] 文本分块完成: md5=%s, strategy=%s, chunks=%d", task.FileMD5, chunkStrategyFor(p.chunkingCfg, task.FileName), len(vectors))
 
-	esDocs, dims, err := p.vectorizeDocuments(ctx, persistedVectors)
+	existing, err := p.docVectorRepo.FindByFileMD5(task.FileMD5)
+	if err != nil {
+		return wrapProcessingError(model.ProcessingErrorDatabase, "find document vectors by file_md5 failed: %w", err)
+	}
+	plan, err := p.loadReusedEmbeddings(ctx, diffDocumentVectors(existing, vectors))
 	if err != nil {
-		return fmt.Errorf("vectorize document chunks failed: %w", err)
+		return wrapProcessingError(model.ProcessingErrorIndexFailed, "load reusable embeddings from elasticsearch failed: %w", err)
+	}
+	log.Infof("[Processor] 增量比对完成: md5=%s, unchanged=%d, reused=%d, changed=%d, removed=%d", task.FileMD5, plan.unchanged, len(plan.reused), len(plan.changed), len(plan.removedChunkIDs))
+	progress.setChunks(ctx, len(vectors), len(plan.changed))
+
+	// 先写 ES 再写 MySQL：ES 失败时 MySQL 仍是旧哈希，重试会重新算出同样的差异。
+	esDocs := make([]model.EsDocument, 0, len(plan.changed)+len(plan.reused))
+	if len(plan.changed) > 0 {
+		progress.enterStage(ctx, model.ProcessingStageEmbed)
+		embedded, dims, err := p.vectorizeDocuments(ctx, plan.changed, progress)
+		if err != nil {
+			return wrapProcessingError(model.ProcessingErrorEmbeddingFailed, "vectorize document chunks failed: %w", err)
+		}
+		log.Infof("[Processor] Embedding 生成成功: md5=%s, chunks=%d, dims=%d, model=%s", task.FileMD5, len(embedded), dims, p.modelVersion())
+		esDocs = append(esDocs, embedded...)
+	}
+	for _, chunk := range plan.reused {
+		esDocs = append(esDocs, buildEsDocument(chunk.vector, chunk.embedding, p.modelVersion()))
+	}
+	if len(esDocs) > 0 {
+		progress.enterStage(ctx, model.ProcessingStageIndex)
+		if err := p.esClient.BulkIndexDocuments(ctx, esDocs); err != nil {
+			return wrapProcessingError(model.ProcessingErrorIndexFailed, "bulk index documents to elasticsearch failed: %w", err)
+		}
+		log.Infof("[Processor] Elasticsearch 索引成功: md5=%s, docs=%d, index=%s", task.FileMD5, len(esDocs), p.esClient.IndexName())
+	}
+
+	if len(plan.removedChunkIDs) > 0 {
+		progress.enterStage(ctx, model.ProcessingStageIndex)
+		orphanIDs := make([]string, 0, len(plan.removedChunkIDs))
+		for _, chunkID := range plan.removedChunkIDs {
+			orphanIDs = append(orphanIDs, model.BuildVectorID(task.FileMD5, chunkID))
+		}
+		if err := p.esClient.DeleteDocumentsByVectorIDs(ctx, orphanIDs); err != nil {
+			return wrapProcessingError(model.ProcessingErrorIndexFailed, "delete orphan documents from elasticsearch failed: %w", err)
+		}
+		log.Infof("[Processor] 已删除多余的 ES 文档: md5=%s, docs=%d", task.FileMD5, len(orphanIDs))
 	}
-	log.Infof("[Processor] Embedding 生成成功: md5=%s, chunks=%d, dims=%d, model=%s", task.FileMD5, len(esDocs), dims, p.embeddingCfg.Model)
 
-	if err := p.esClient.BulkIndexDocuments(ctx, esDocs); err != nil {
-		return fmt.Errorf("bulk index documents to elasticsearch failed: %w", err)
+	if err := p.docVectorRepo.ReplaceChunks(task.FileMD5, plan.replacedChunkIDs(), plan.writtenVectors()); err != nil {
+		return wrapProcessingError(model.ProcessingErrorDatabase, "replace document vectors failed: %w", err)
+	}
+
+	// 新版本索引完成后才把旧版本移出默认检索，处理期间旧版本仍可被检索到。
+	if !superseded && len(olderMD5s) > 0 {
+		olderMD5s, err = p.exclusiveMD5s(task.UserID, olderMD5s)
+		if err != nil {
+			return wrapProcessingError(model.ProcessingErrorDatabase, "find other owners of older versions failed: %w", err)
+		}
+	}
+	if !superseded && len(olderMD5s) > 0 {
+		if err := p.esClient.MarkSuperseded(ctx, olderMD5s, task.UserID, true); err != nil {
+			return wrapProcessingError(model.ProcessingErrorIndexFailed, "mark older versions superseded in elasticsearch failed: %w", err)
+		}
+		if err := p.docVectorRepo.MarkSuperseded(olderMD5s, task.UserID, true); err != nil {
+			return wrapProcessingError(model.ProcessingErrorDatabase, "mark older versions superseded failed: %w", err)
+		}
+		log.Infof("[Processor] 已将旧版本移出默认检索: md5=%s document=%s versions=%d", task.FileMD5, task.DocumentID, len(olderMD5s))
 	}
 
-	log.Infof("[Processor] Elasticsearch 索引成功: md5=%s, docs=%d, index=%s", task.FileMD5, len(esDocs), p.esClient.IndexName())
 	log.Infof("[Processor] 文件处理成功完成: md5=%s", task.FileMD5)
 	finalStatus = model.FileProcessingStatusIndexed
 	return nil
@@ -165,6 +260,54 @@ func (p *Processor) updateProcessingStatus(task tasks.FileProcessingTask, status
 	return p.uploadRepo.UpdateFileProcessingStatus(task.FileMD5, task.UserID, status)
 }
 
+func (p *Processor) findDocumentVersions(task tasks.FileProcessingTask) ([]model.FileUpload, error) {
+	if strings.TrimSpace(task.DocumentID) == "" {
+		return nil, nil
+	}
+	return p.uploadRepo.FindDocumentVersions(task.DocumentID)
+}
+
+// exclusiveMD5s 去掉其他用户也持有的 fileMD5：相同内容的分块和 ES 文档按 fileMD5 共用，
+// 把它们标为旧版本会连带把其他用户的文件移出默认检索。
+func (p *Processor) exclusiveMD5s(userID uint, fileMD5s []string) ([]string, error) {
+	uploads, err := p.uploadRepo.FindBatchByMD5s(fileMD5s)
+	if err != nil {
+		return nil, err
+	}
+	shared := make(map[string]struct{}, len(uploads))
+	for _, upload := range uploads {
+		if upload.UserID != userID {
+			shared[upload.FileMD5] = struct{}{}
+		}
+	}
+	exclusive := make([]string, 0, len(fileMD5s))
+	for _, fileMD5 := range fileMD5s {
+		if _, ok := shared[fileMD5]; ok {
+			log.Infof("[Processor] 旧版本内容也被其他用户持有，保留在默认检索中: md5=%s", fileMD5)
+			continue
+		}
+		exclusive = append(exclusive, fileMD5)
+	}
+	return exclusive, nil
+}
+
+// resolveVersionState 判断当前文件是否已被同一文档的更新版本取代，并返回其余版本的 MD5。
+// 当前文件不是最新版本时（例如重新处理旧版本，或更新的版本已经先合并完成），其分块写入时即标记为已取代。
+func resolveVersionState(task tasks.FileProcessingTask, versions []model.FileUpload) (bool, []string) {
+	superseded := false
+	others := make([]string, 0, len(versions))
+	for _, version := range versions {
+		if version.FileMD5 == task.FileMD5 {
+			if version.UserID == task.UserID {
+				superseded = !version.IsLatest
+			}
+			continue
+		}
+		others = append(others, version.FileMD5)
+	}
+	return superseded, others
+}
+
 func splitText(text string, chunkSize int, overlap int) ([]string, error) {
 	if chunkSize <= 0 {
 		return nil, fmt.Errorf("chunk_size must be greater than 0")
@@ -201,42 +344,52 @@ func splitText(text string, chunkSize int, overlap int) ([]string, error) {
 	return chunks, nil
 }
 
-func buildDocumentVectors(task tasks.FileProcessingTask, chunks []string, modelVersion string) []model.DocumentVector {
+func buildDocumentVectors(task tasks.FileProcessingTask, chunks []string, modelVersion string, metadata model.DocumentMetadata, locations []model.ChunkLocation) []model.DocumentVector {
 	vectors := make([]model.DocumentVector, 0, len(chunks))
 	for i, chunk := range chunks {
+		var location model.ChunkLocation
+		if i < len(locations) {
+			location = locations[i]
+		}
 		vectors = append(vectors, model.DocumentVector{
 			FileMD5:      task.FileMD5,
 			ChunkID:      i,
 			TextContent:  chunk,
+			ContentHash:  model.HashChunkContent(chunk),
 			ModelVersion: modelVersion,
 			UserID:       task.UserID,
 			OrgTag:       task.OrgTag,
 			IsPublic:     task.IsPublic,
+			FolderID:     task.FolderID,
+			Metadata:     metadata,
+			Location:     location,
 		})
 	}
 	return vectors
 }
 
-func (p *Processor) vectorizeDocuments(ctx context.Context, vectors []model.DocumentVector) ([]model.EsDocument, int, error) {
-	esDocs := make([]model.EsDocument, 0, len(vectors))
-	dimensions := 0
-
-	for _, vector := range vectors {
-		embeddingVector, err := p.embedding.CreateEmbedding(ctx, vector.TextContent)
-		if err != nil {
-			return nil, 0, fmt.Errorf("create embedding for chunk %d failed: %w", vector.ChunkID, err)
-		}
-		if p.embeddingCfg.Dimensions > 0 && len(embeddingVector) != p.embeddingCfg.Dimensions {
-			return nil, 0, fmt.Errorf("embedding dimension mismatch for chunk %d: got=%d want=%d", vector.ChunkID, len(embeddingVector), p.embeddingCfg.Dimensions)
-		}
-		if dimensions == 0 {
-			dimensions = len(embeddingVector)
-		}
+// withUploadState 用上传记录中的组织标签、公开状态和文件夹覆盖任务里的值：
+// 延迟重试或在移动、修改之前排队的重新处理任务携带的是投递时的旧值。
+func withUploadState(task tasks.FileProcessingTask, upload *model.FileUpload) tasks.FileProcessingTask {
+	task.OrgTag = upload.OrgTag
+	task.IsPublic = upload.IsPublic
+	task.FolderID = upload.FolderID
+	return task
+}
 
-		esDocs = append(esDocs, buildEsDocument(vector, embeddingVector, p.embeddingCfg.Model))
+// buildDocumentAttributes 从上传记录取出分面检索用的属性，上传时间优先取合并完成时间。
+func buildDocumentAttributes(upload *model.FileUpload) model.DocumentAttributes {
+	uploadedAt := upload.MergedAt
+	if uploadedAt == nil && !upload.CreatedAt.IsZero() {
+		createdAt := upload.CreatedAt
+		uploadedAt = &createdAt
+	}
+	return model.DocumentAttributes{
+		Tags:           upload.Tags,
+		CustomMetadata: upload.CustomMetadata,
+		FileType:       model.FileTypeOf(upload.FileName),
+		UploadedAt:     uploadedAt,
 	}
-
-	return esDocs, dimensions, nil
 }
 
 func buildEsDocument(vector model.DocumentVector, embeddingVector []float32, defaultModelVersion string) model.EsDocument {
@@ -246,14 +399,32 @@ func buildEsDocument(vector model.DocumentVector, embeddingVector []float32, def
 	}
 
 	return model.EsDocument{
-		VectorID:     model.BuildVectorID(vector.FileMD5, vector.ChunkID),
-		FileMD5:      vector.FileMD5,
-		ChunkID:      vector.ChunkID,
-		TextContent:  vector.TextContent,
-		Vector:       embeddingVector,
-		ModelVersion: modelVersion,
-		UserID:       vector.UserID,
-		OrgTag:       vector.OrgTag,
-		IsPublic:     vector.IsPublic,
+		VectorID:       model.BuildVectorID(vector.FileMD5, vector.ChunkID),
+		FileMD5:        vector.FileMD5,
+		ChunkID:        vector.ChunkID,
+		TextContent:    vector.TextContent,
+		Vector:         embeddingVector,
+		ModelVersion:   modelVersion,
+		UserID:         vector.UserID,
+		OrgTag:         vector.OrgTag,
+		IsPublic:       vector.IsPublic,
+		Title:          vector.Metadata.Title,
+		Author:         vector.Metadata.Author,
+		AuthoredAt:     vector.Metadata.AuthoredAt,
+		PageCount:      vector.Metadata.PageCount,
+		Language:       vector.Metadata.Language,
+		PageStart:      vector.Location.PageStart,
+		PageEnd:        vector.Location.PageEnd,
+		CharStart:      vector.Location.CharStart,
+		CharEnd:        vector.Location.CharEnd,
+		SectionPath:    vector.Location.SectionPath,
+		Superseded:     vector.Superseded,
+		FolderID:       vector.FolderID,
+		Tags:           vector.Attributes.Tags,
+		CustomMetadata: vector.Attributes.CustomMetadata,
+		FileType:       vector.Attributes.FileType,
+		UploadedAt:     vector.Attributes.UploadedAt,
+		SharedUserIDs:  vector.Sharing.SharedUserIDs,
+		SharedOrgTags:  vector.Sharing.SharedOrgTags,
 	}
 }
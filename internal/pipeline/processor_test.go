@@ -3,17 +3,33 @@ package pipeline
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"pai_smart_go_v2/internal/config"
 	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/embedding"
+	"pai_smart_go_v2/pkg/log"
 	"pai_smart_go_v2/pkg/tasks"
 )
 
+func TestMain(m *testing.M) {
+	log.Init("error", "console", "")
+	m.Run()
+}
+
 type fakeEmbeddingClient struct {
 	vector []float32
 	err    error
+
+	mu         sync.Mutex
+	batchSizes []int
+	// failures 为前 N 次 CreateEmbeddings 调用返回 err，之后成功。
+	failures int
 }
 
 func (f *fakeEmbeddingClient) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
@@ -23,6 +39,23 @@ func (f *fakeEmbeddingClient) CreateEmbedding(ctx context.Context, text string)
 	return f.vector, nil
 }
 
+func (f *fakeEmbeddingClient) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	f.mu.Lock()
+	f.batchSizes = append(f.batchSizes, len(texts))
+	fail := f.err != nil && (f.failures == 0 || len(f.batchSizes) <= f.failures)
+	f.mu.Unlock()
+	if fail {
+		return nil, f.err
+	}
+
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		// 把文本编码进向量首位，便于校验批量结果没有错位。
+		vectors = append(vectors, append([]float32{float32(len(text))}, f.vector[1:]...))
+	}
+	return vectors, nil
+}
+
 func TestSplitText_LongTextWithOverlap(t *testing.T) {
 	text := strings.Repeat("a", 2500)
 
@@ -92,7 +125,7 @@ func TestBuildDocumentVectors(t *testing.T) {
 		IsPublic: true,
 	}
 
-	vectors := buildDocumentVectors(task, []string{"first", "second"}, "text-embedding-v4")
+	vectors := buildDocumentVectors(task, []string{"first", "second"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
 	if len(vectors) != 2 {
 		t.Fatalf("unexpected vector count: %d", len(vectors))
 	}
@@ -105,6 +138,67 @@ func TestBuildDocumentVectors(t *testing.T) {
 	if vectors[0].ModelVersion != "text-embedding-v4" {
 		t.Fatalf("unexpected model version: %+v", vectors[0])
 	}
+	if vectors[0].ContentHash != model.HashChunkContent("first") || vectors[0].ContentHash == vectors[1].ContentHash {
+		t.Fatalf("unexpected content hashes: %+v", vectors)
+	}
+}
+
+func TestResolveVersionState(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5-v2", UserID: 9, DocumentID: "doc-1"}
+	versions := []model.FileUpload{
+		{FileMD5: "md5-v3", UserID: 9, Version: 3, IsLatest: false},
+		{FileMD5: "md5-v2", UserID: 9, Version: 2, IsLatest: true},
+		{FileMD5: "md5-v1", UserID: 9, Version: 1, IsLatest: false},
+	}
+
+	superseded, others := resolveVersionState(task, versions)
+	if superseded {
+		t.Fatalf("expected latest version not to be superseded")
+	}
+	if len(others) != 2 || others[0] != "md5-v3" || others[1] != "md5-v1" {
+		t.Fatalf("unexpected other versions: %v", others)
+	}
+
+	versions[0].IsLatest, versions[1].IsLatest = true, false
+	if superseded, _ := resolveVersionState(task, versions); !superseded {
+		t.Fatalf("expected older version to be superseded")
+	}
+	if superseded, others := resolveVersionState(tasks.FileProcessingTask{FileMD5: "md5-x"}, nil); superseded || len(others) != 0 {
+		t.Fatalf("expected unversioned file to stay searchable, got %v %v", superseded, others)
+	}
+}
+
+type fakeOwnerUploadRepo struct {
+	repository.UploadRepository
+	uploads []model.FileUpload
+}
+
+func (f *fakeOwnerUploadRepo) FindBatchByMD5s(fileMD5s []string) ([]model.FileUpload, error) {
+	return f.uploads, nil
+}
+
+func TestProcessor_ExclusiveMD5s_SkipsContentHeldByOtherOwners(t *testing.T) {
+	p := &Processor{uploadRepo: &fakeOwnerUploadRepo{uploads: []model.FileUpload{
+		{FileMD5: "md5-v1", UserID: 7},
+		{FileMD5: "md5-v1", UserID: 8},
+		{FileMD5: "md5-v0", UserID: 7},
+	}}}
+
+	md5s, err := p.exclusiveMD5s(7, []string{"md5-v1", "md5-v0"})
+	if err != nil {
+		t.Fatalf("exclusiveMD5s() error = %v", err)
+	}
+	if len(md5s) != 1 || md5s[0] != "md5-v0" {
+		t.Fatalf("expected only md5-v0 to be superseded, got %v", md5s)
+	}
+}
+
+func TestWithUploadState_PrefersUploadRecord(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5v", UserID: 7, OrgTag: "team-a", IsPublic: true, FolderID: 3}
+	got := withUploadState(task, &model.FileUpload{OrgTag: "team-b", IsPublic: false, FolderID: 5})
+	if got.OrgTag != "team-b" || got.IsPublic || got.FolderID != 5 || got.FileMD5 != "md5v" {
+		t.Fatalf("expected folder, org tag and visibility from the upload record, got %+v", got)
+	}
 }
 
 func TestBuildEsDocument(t *testing.T) {
@@ -116,14 +210,37 @@ func TestBuildEsDocument(t *testing.T) {
 		UserID:       9,
 		OrgTag:       "team-a",
 		IsPublic:     true,
+		Metadata:     model.DocumentMetadata{Title: "手册", PageCount: 3, Language: "zh"},
+		Superseded:   true,
+		Attributes:   model.DocumentAttributes{Tags: []string{"财务"}, FileType: "pdf"},
 	}, []float32{0.1, 0.2}, "fallback-model")
 
 	if doc.VectorID != "md5v_2" {
 		t.Fatalf("unexpected vector id: %+v", doc)
 	}
-	if doc.ModelVersion != "text-embedding-v4" || len(doc.Vector) != 2 {
+	if doc.Title != "手册" || doc.PageCount != 3 || doc.Language != "zh" {
+		t.Fatalf("expected document metadata on es document: %+v", doc)
+	}
+	if doc.ModelVersion != "text-embedding-v4" || len(doc.Vector) != 2 || !doc.Superseded {
 		t.Fatalf("unexpected es document: %+v", doc)
 	}
+	if len(doc.Tags) != 1 || doc.Tags[0] != "财务" || doc.FileType != "pdf" {
+		t.Fatalf("expected document attributes on es document: %+v", doc)
+	}
+}
+
+func TestBuildDocumentAttributes(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	attributes := buildDocumentAttributes(&model.FileUpload{FileName: "Report.PDF", Tags: []string{"财务"}, CreatedAt: createdAt})
+	if attributes.FileType != "pdf" || len(attributes.Tags) != 1 || attributes.UploadedAt == nil || !attributes.UploadedAt.Equal(createdAt) {
+		t.Fatalf("unexpected attributes: %+v", attributes)
+	}
+
+	mergedAt := createdAt.Add(time.Hour)
+	attributes = buildDocumentAttributes(&model.FileUpload{FileName: "notes", CreatedAt: createdAt, MergedAt: &mergedAt})
+	if attributes.FileType != "" || !attributes.UploadedAt.Equal(mergedAt) {
+		t.Fatalf("expected merged time and empty file type: %+v", attributes)
+	}
 }
 
 func TestProcessor_VectorizeDocuments(t *testing.T) {
@@ -145,7 +262,7 @@ func TestProcessor_VectorizeDocuments(t *testing.T) {
 			OrgTag:       "team-a",
 			IsPublic:     true,
 		},
-	})
+	}, nil)
 	if err != nil {
 		t.Fatalf("vectorizeDocuments() error = %v", err)
 	}
@@ -168,7 +285,80 @@ func TestProcessor_VectorizeDocuments_Error(t *testing.T) {
 
 	if _, _, err := p.vectorizeDocuments(context.Background(), []model.DocumentVector{
 		{FileMD5: "md5v", ChunkID: 0, TextContent: "first"},
-	}); err == nil {
+	}, nil); err == nil {
 		t.Fatalf("expected vectorizeDocuments() error")
 	}
 }
+
+func TestProcessor_VectorizeDocuments_Batches(t *testing.T) {
+	client := &fakeEmbeddingClient{vector: []float32{0, 0.2}}
+	p := &Processor{
+		embedding: client,
+		embeddingCfg: config.EmbeddingConfig{
+			Model:       "text-embedding-v4",
+			Dimensions:  2,
+			BatchSize:   2,
+			Concurrency: 2,
+		},
+	}
+
+	vectors := make([]model.DocumentVector, 0, 5)
+	for i := 0; i < 5; i++ {
+		vectors = append(vectors, model.DocumentVector{FileMD5: "md5v", ChunkID: i, TextContent: strings.Repeat("x", i+1)})
+	}
+
+	docs, _, err := p.vectorizeDocuments(context.Background(), vectors, nil)
+	if err != nil {
+		t.Fatalf("vectorizeDocuments() error = %v", err)
+	}
+	if len(client.batchSizes) != 3 {
+		t.Fatalf("expected 3 batches, got %v", client.batchSizes)
+	}
+	for i, doc := range docs {
+		if doc.VectorID != fmt.Sprintf("md5v_%d", i) || doc.Vector[0] != float32(i+1) {
+			t.Fatalf("unexpected doc order at %d: %+v", i, doc)
+		}
+	}
+}
+
+func TestProcessor_VectorizeDocuments_RetriesTransientError(t *testing.T) {
+	client := &fakeEmbeddingClient{
+		vector:   []float32{0, 0.2},
+		err:      &embedding.APIError{StatusCode: 429, Body: "rate limited"},
+		failures: 2,
+	}
+	p := &Processor{
+		embedding: client,
+		embeddingCfg: config.EmbeddingConfig{
+			Model:              "text-embedding-v4",
+			MaxRetries:         2,
+			RetryBackoffMillis: 1,
+		},
+	}
+
+	if _, _, err := p.vectorizeDocuments(context.Background(), []model.DocumentVector{
+		{FileMD5: "md5v", ChunkID: 0, TextContent: "first"},
+	}, nil); err != nil {
+		t.Fatalf("vectorizeDocuments() error = %v", err)
+	}
+	if len(client.batchSizes) != 3 {
+		t.Fatalf("expected 2 retries, got %d calls", len(client.batchSizes))
+	}
+}
+
+func TestProcessor_VectorizeDocuments_NoRetryOnClientError(t *testing.T) {
+	client := &fakeEmbeddingClient{err: &embedding.APIError{StatusCode: 400, Body: "bad input"}}
+	p := &Processor{
+		embedding:    client,
+		embeddingCfg: config.EmbeddingConfig{MaxRetries: 3, RetryBackoffMillis: 1},
+	}
+
+	if _, _, err := p.vectorizeDocuments(context.Background(), []model.DocumentVector{
+		{FileMD5: "md5v", ChunkID: 0, TextContent: "first"},
+	}, nil); err == nil {
+		t.Fatalf("expected vectorizeDocuments() error")
+	}
+	if len(client.batchSizes) != 1 {
+		t.Fatalf("expected no retries for 4xx, got %d calls", len(client.batchSizes))
+	}
+}
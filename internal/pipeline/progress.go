@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/log"
+	"pai_smart_go_v2/pkg/tasks"
+)
+
+// stageProgress 是进入各阶段时的整体进度；embed 阶段按已向量化 chunk 数在区间内线性推进。
+var stageProgress = map[string]float64{
+	model.ProcessingStageQueued:   0,
+	model.ProcessingStageDownload: 0,
+	model.ProcessingStageExtract:  5,
+	model.ProcessingStageChunk:    20,
+	model.ProcessingStageEmbed:    25,
+	model.ProcessingStageIndex:    85,
+	model.ProcessingStageDone:     100,
+}
+
+// progressReporter 记录单个任务的处理进度。进度写入失败只记日志，不影响文件处理本身。
+// jobs 为 nil 时所有方法都是空操作。
+type progressReporter struct {
+	jobs repository.ProcessingJobRepository
+	now  func() time.Time
+
+	mu  sync.Mutex
+	job model.FileProcessingJob
+}
+
+func newProgressReporter(jobs repository.ProcessingJobRepository, task tasks.FileProcessingTask) *progressReporter {
+	return &progressReporter{
+		jobs: jobs,
+		now:  time.Now,
+		job: model.FileProcessingJob{
+			FileMD5: task.FileMD5,
+			UserID:  task.UserID,
+		},
+	}
+}
+
+// start 重置进度记录，重新处理同一文件时覆盖上一次的结果。
+func (r *progressReporter) start(ctx context.Context) {
+	if r == nil || r.jobs == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.job.Stage = model.ProcessingStageQueued
+	r.job.Status = model.FileProcessingStatusProcessing
+	r.job.TotalChunks = 0
+	r.job.ChangedChunks = 0
+	r.job.EmbeddedChunks = 0
+	r.job.Progress = 0
+	r.job.ErrorCode = ""
+	r.job.LastError = ""
+	r.job.StageDurations = map[string]int64{}
+	r.job.StartedAt = now
+	r.job.StageStartedAt = now
+	r.job.FinishedAt = nil
+	r.saveLocked(ctx)
+}
+
+func (r *progressReporter) enterStage(ctx context.Context, stage string) {
+	if r == nil || r.jobs == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.job.Stage == stage {
+		return
+	}
+	r.closeStageLocked()
+	r.job.Stage = stage
+	r.job.Progress = stageProgress[stage]
+	r.saveLocked(ctx)
+}
+
+// setChunks 记录分块总数和本次需要重新向量化的 chunk 数。
+func (r *progressReporter) setChunks(ctx context.Context, total int, changed int) {
+	if r == nil || r.jobs == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.job.TotalChunks = total
+	r.job.ChangedChunks = changed
+	r.saveLocked(ctx)
+}
+
+// addEmbedded 在一批 chunk 向量化完成后调用，可被多个 batch goroutine 并发调用。
+func (r *progressReporter) addEmbedded(ctx context.Context, n int) {
+	if r == nil || r.jobs == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.job.EmbeddedChunks += n
+	if r.job.ChangedChunks > 0 {
+		start := stageProgress[model.ProcessingStageEmbed]
+		span := stageProgress[model.ProcessingStageIndex] - start
+		ratio := float64(r.job.EmbeddedChunks) / float64(r.job.ChangedChunks)
+		if ratio > 1 {
+			ratio = 1
+		}
+		r.job.Progress = start + span*ratio
+	}
+	r.saveLocked(ctx)
+}
+
+// finish 写入最终状态。失败时保留出错阶段，便于判断卡在哪一步。
+func (r *progressReporter) finish(ctx context.Context, status string, errorCode string, processErr error) {
+	if r == nil || r.jobs == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closeStageLocked()
+	now := r.now()
+	r.job.Status = status
+	r.job.FinishedAt = &now
+	r.job.ErrorCode = errorCode
+	if processErr != nil {
+		r.job.LastError = processErr.Error()
+	} else {
+		r.job.Stage = model.ProcessingStageDone
+		r.job.Progress = stageProgress[model.ProcessingStageDone]
+	}
+	r.saveLocked(ctx)
+}
+
+func (r *progressReporter) closeStageLocked() {
+	now := r.now()
+	if r.job.Stage != "" && r.job.Stage != model.ProcessingStageDone {
+		if r.job.StageDurations == nil {
+			r.job.StageDurations = map[string]int64{}
+		}
+		r.job.StageDurations[r.job.Stage] += now.Sub(r.job.StageStartedAt).Milliseconds()
+	}
+	r.job.StageStartedAt = now
+}
+
+func (r *progressReporter) saveLocked(ctx context.Context) {
+	job := r.job
+	job.StageDurations = make(map[string]int64, len(r.job.StageDurations))
+	for stage, ms := range r.job.StageDurations {
+		job.StageDurations[stage] = ms
+	}
+
+	if err := r.jobs.Save(&job); err != nil {
+		log.Errorf("[Processor] 保存处理进度失败: md5=%s stage=%s err=%v", job.FileMD5, job.Stage, err)
+		return
+	}
+	// 任务上下文已取消时仍推送最终状态，避免订阅方一直停留在处理中。
+	if err := r.jobs.PublishProgress(context.WithoutCancel(ctx), &job); err != nil {
+		log.Warnf("[Processor] 推送处理进度失败: md5=%s stage=%s err=%v", job.FileMD5, job.Stage, err)
+	}
+}
@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/tasks"
+)
+
+type fakeProcessingJobRepo struct {
+	saved     []model.FileProcessingJob
+	published []model.FileProcessingJob
+}
+
+func (f *fakeProcessingJobRepo) Save(job *model.FileProcessingJob) error {
+	f.saved = append(f.saved, *job)
+	return nil
+}
+
+func (f *fakeProcessingJobRepo) FindByFileMD5AndUserID(fileMD5 string, userID uint) (*model.FileProcessingJob, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeProcessingJobRepo) PublishProgress(ctx context.Context, job *model.FileProcessingJob) error {
+	f.published = append(f.published, *job)
+	return nil
+}
+
+func (f *fakeProcessingJobRepo) SubscribeProgress(ctx context.Context, userID uint) (<-chan model.FileProcessingJob, func() error, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+func newTestProgressReporter(repo *fakeProcessingJobRepo) (*progressReporter, *time.Time) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	reporter := newProgressReporter(repo, tasks.FileProcessingTask{FileMD5: "md5-p", UserID: 3})
+	reporter.now = func() time.Time { return clock }
+	return reporter, &clock
+}
+
+func TestProgressReporter_TracksStagesAndEmbedProgress(t *testing.T) {
+	repo := &fakeProcessingJobRepo{}
+	reporter, clock := newTestProgressReporter(repo)
+	ctx := context.Background()
+
+	reporter.start(ctx)
+	reporter.enterStage(ctx, model.ProcessingStageDownload)
+	*clock = clock.Add(2 * time.Second)
+	reporter.enterStage(ctx, model.ProcessingStageExtract)
+	*clock = clock.Add(3 * time.Second)
+	reporter.enterStage(ctx, model.ProcessingStageEmbed)
+	reporter.setChunks(ctx, 10, 4)
+	reporter.addEmbedded(ctx, 2)
+
+	last := repo.saved[len(repo.saved)-1]
+	if last.Stage != model.ProcessingStageEmbed || last.EmbeddedChunks != 2 || last.Progress != 55 {
+		t.Fatalf("unexpected embed progress: %+v", last)
+	}
+	if last.StageDurations[model.ProcessingStageDownload] != 2000 || last.StageDurations[model.ProcessingStageExtract] != 3000 {
+		t.Fatalf("unexpected stage durations: %+v", last.StageDurations)
+	}
+
+	*clock = clock.Add(time.Second)
+	reporter.finish(ctx, model.FileProcessingStatusIndexed, "", nil)
+	last = repo.saved[len(repo.saved)-1]
+	if last.Stage != model.ProcessingStageDone || last.Progress != 100 || last.Status != model.FileProcessingStatusIndexed || last.FinishedAt == nil {
+		t.Fatalf("unexpected final job: %+v", last)
+	}
+	if last.StageDurations[model.ProcessingStageEmbed] != 1000 {
+		t.Fatalf("expected embed duration recorded, got %+v", last.StageDurations)
+	}
+	if len(repo.published) != len(repo.saved) {
+		t.Fatalf("expected every saved update to be published: saved=%d published=%d", len(repo.saved), len(repo.published))
+	}
+}
+
+func TestProgressReporter_FailureKeepsStageAndError(t *testing.T) {
+	repo := &fakeProcessingJobRepo{}
+	reporter, _ := newTestProgressReporter(repo)
+	ctx := context.Background()
+
+	reporter.start(ctx)
+	reporter.enterStage(ctx, model.ProcessingStageExtract)
+	reporter.finish(ctx, model.FileProcessingStatusFailed, model.ProcessingErrorExtractTimeout, errors.New("tika timeout"))
+
+	last := repo.saved[len(repo.saved)-1]
+	if last.Stage != model.ProcessingStageExtract || last.Status != model.FileProcessingStatusFailed || last.LastError != "tika timeout" || last.ErrorCode != model.ProcessingErrorExtractTimeout {
+		t.Fatalf("unexpected failed job: %+v", last)
+	}
+	if last.Progress != 5 {
+		t.Fatalf("expected progress to stay at failed stage, got %v", last.Progress)
+	}
+}
+
+func TestProgressReporter_NilRepositoryIsNoop(t *testing.T) {
+	reporter := newProgressReporter(nil, tasks.FileProcessingTask{FileMD5: "md5-p"})
+	reporter.start(context.Background())
+	reporter.addEmbedded(context.Background(), 1)
+	reporter.finish(context.Background(), model.FileProcessingStatusIndexed, "", nil)
+
+	var nilReporter *progressReporter
+	nilReporter.addEmbedded(context.Background(), 1)
+}
@@ -0,0 +1,210 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/tika"
+)
+
+const (
+	maxSectionPathRunes = 1024
+	sectionPathSep      = " > "
+)
+
+// buildChunkLocations 计算每个分块在正文中的位置：字符偏移、起止页码和所在章节的标题路径。
+// 分块器会去掉首尾空白、给片段补上标题路径或表头，所以按行定位而不是整段匹配；定位不到的分块返回零值。
+// headings 为空时，Markdown 文件按 ATX 标题推断章节。
+func buildChunkLocations(text string, chunks []string, fileName string, pages []tika.Page, headings []tika.Heading) []model.ChunkLocation {
+	spans := locateChunks(text, chunks)
+	if len(headings) == 0 && defaultChunkStrategies[strings.ToLower(filepath.Ext(fileName))] == ChunkStrategyMarkdown {
+		headings = markdownHeadings(text)
+	}
+
+	runes := []rune(text)
+	headingStarts := make(map[int]bool, len(headings))
+	for _, heading := range headings {
+		headingStarts[heading.Offset] = true
+	}
+
+	locations := make([]model.ChunkLocation, len(chunks))
+	for i, span := range spans {
+		if span.end <= span.start {
+			continue
+		}
+		// 分块以标题开头时，章节取标题之后第一行正文所在的章节。
+		anchor := span.start
+		for anchor < span.end && headingStarts[anchor] {
+			anchor = nextLineStart(runes, anchor)
+		}
+		if anchor >= span.end {
+			anchor = span.start
+		}
+		locations[i] = model.ChunkLocation{
+			PageStart:   pageAt(pages, span.start),
+			PageEnd:     pageAt(pages, span.end-1),
+			CharStart:   span.start,
+			CharEnd:     span.end,
+			SectionPath: sectionPathAt(headings, anchor),
+		}
+	}
+	return locations
+}
+
+func nextLineStart(runes []rune, offset int) int {
+	for i := offset; i < len(runes); i++ {
+		if runes[i] == '\n' {
+			return i + 1
+		}
+	}
+	return len(runes)
+}
+
+// chunkSpan 是分块在正文中的字符（rune）区间，左闭右开；未定位时为零值。
+type chunkSpan struct {
+	start int
+	end   int
+}
+
+// locateChunks 按顺序在正文中定位每个分块：先从上一个分块之后查找最后一个非空行，
+// 再向前逐行确认与正文连续，遇到不连续的行（分块器补上的标题路径或表头）即停止。
+func locateChunks(text string, chunks []string) []chunkSpan {
+	spans := make([]chunkSpan, len(chunks))
+	counter := &runeCounter{text: text}
+	prevStart, prevEnd := 0, 0
+	for i, chunk := range chunks {
+		lines := nonEmptyLines(chunk)
+		if len(lines) == 0 {
+			continue
+		}
+		last := lines[len(lines)-1]
+
+		from := prevEnd - len(last) + 1
+		if from < prevStart {
+			from = prevStart
+		}
+		lastAt := indexFrom(text, last, from)
+		if lastAt < 0 {
+			lastAt = indexFrom(text, last, prevStart)
+		}
+		if lastAt < 0 {
+			continue
+		}
+
+		start := lastAt
+		for j := len(lines) - 2; j >= 0; j-- {
+			before := strings.TrimRightFunc(text[:start], unicode.IsSpace)
+			if !strings.HasSuffix(before, lines[j]) {
+				break
+			}
+			start = len(before) - len(lines[j])
+		}
+		end := lastAt + len(last)
+
+		spans[i] = chunkSpan{start: counter.at(start), end: counter.at(end)}
+		prevStart, prevEnd = start, end
+	}
+	return spans
+}
+
+func nonEmptyLines(chunk string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(chunk, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			lines = append(lines, trimmed)
+		}
+	}
+	return lines
+}
+
+func indexFrom(text string, sub string, from int) int {
+	if from < 0 {
+		from = 0
+	}
+	if from > len(text) {
+		return -1
+	}
+	at := strings.Index(text[from:], sub)
+	if at < 0 {
+		return -1
+	}
+	return from + at
+}
+
+// runeCounter 把字节偏移换算为字符偏移；分块基本按顺序定位，从上次的位置增量计数即可。
+type runeCounter struct {
+	text      string
+	bytePos   int
+	runeCount int
+}
+
+func (c *runeCounter) at(bytePos int) int {
+	if bytePos >= c.bytePos {
+		c.runeCount += utf8.RuneCountInString(c.text[c.bytePos:bytePos])
+	} else {
+		c.runeCount -= utf8.RuneCountInString(c.text[bytePos:c.bytePos])
+	}
+	c.bytePos = bytePos
+	return c.runeCount
+}
+
+// pageAt 返回包含字符偏移 offset 的页码，没有分页信息时返回 0。
+func pageAt(pages []tika.Page, offset int) int {
+	for _, page := range pages {
+		if offset >= page.Start && offset < page.End {
+			return page.Number
+		}
+	}
+	return 0
+}
+
+// sectionPathAt 返回 offset 所在章节的标题路径，如 "1 概述 > 1.1 背景"。
+func sectionPathAt(headings []tika.Heading, offset int) string {
+	var stack [6]string
+	for _, heading := range headings {
+		if heading.Offset > offset {
+			break
+		}
+		if heading.Level < 1 || heading.Level > len(stack) {
+			continue
+		}
+		stack[heading.Level-1] = heading.Text
+		for i := heading.Level; i < len(stack); i++ {
+			stack[i] = ""
+		}
+	}
+	path := make([]string, 0, len(stack))
+	for _, title := range stack {
+		if title != "" {
+			path = append(path, title)
+		}
+	}
+	return truncateRunes(strings.Join(path, sectionPathSep), maxSectionPathRunes)
+}
+
+// markdownHeadings 按 ATX 标题提取 Markdown 的章节标题，忽略围栏代码块里的 # 行。
+func markdownHeadings(text string) []tika.Heading {
+	headings := make([]tika.Heading, 0)
+	fence := ""
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if marker := codeFenceMarker(trimmed); marker != "" {
+			if fence == "" {
+				fence = marker
+			} else if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		}
+		if level := markdownHeadingLevel(trimmed); fence == "" && level > 0 {
+			if title := strings.TrimSpace(trimmed[level:]); title != "" {
+				headings = append(headings, tika.Heading{Level: level, Text: title, Offset: offset})
+			}
+		}
+		offset += utf8.RuneCountInString(line)
+	}
+	return headings
+}
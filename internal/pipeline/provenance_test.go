@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"pai_smart_go_v2/pkg/tika"
+)
+
+func TestBuildChunkLocations_PagesAndHeadings(t *testing.T) {
+	text := "1 概述\n第一页正文。\n1.1 背景\n第二页正文。\n第二页结尾。\n"
+	pages := []tika.Page{{Number: 1, Start: 0, End: 12}, {Number: 2, Start: 12, End: 33}}
+	headings := []tika.Heading{{Level: 1, Text: "1 概述", Offset: 0}, {Level: 2, Text: "1.1 背景", Offset: 12}}
+
+	chunks := []string{"1 概述\n第一页正文。\n1.1 背景", "第二页正文。\n第二页结尾。"}
+	locations := buildChunkLocations(text, chunks, "report.pdf", pages, headings)
+
+	first := locations[0]
+	if first.CharStart != 0 || first.CharEnd != 18 || first.PageStart != 1 || first.PageEnd != 2 || first.SectionPath != "1 概述" {
+		t.Fatalf("unexpected first location: %+v", first)
+	}
+	second := locations[1]
+	if second.CharStart != 19 || second.CharEnd != 32 || second.PageStart != 2 || second.PageEnd != 2 || second.SectionPath != "1 概述 > 1.1 背景" {
+		t.Fatalf("unexpected second location: %+v", second)
+	}
+	if got := string([]rune(text)[second.CharStart:second.CharEnd]); got != "第二页正文。\n第二页结尾。" {
+		t.Fatalf("offsets do not point at chunk text: %q", got)
+	}
+}
+
+func TestBuildChunkLocations_MarkdownHeadingPrefixAndOverlap(t *testing.T) {
+	var body strings.Builder
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&body, "第%d步说明。", i)
+	}
+	text := "# 指南\n## 部署\n" + body.String()
+	chunks, err := markdownChunker{size: 30, overlap: 5}.Chunk(text)
+	if err != nil {
+		t.Fatalf("Chunk() error = %v", err)
+	}
+
+	locations := buildChunkLocations(text, chunks, "guide.md", nil, nil)
+	if locations[0].CharStart != 0 || locations[0].CharEnd != 4 || locations[0].SectionPath != "指南" {
+		t.Fatalf("unexpected heading-only location: %+v", locations[0])
+	}
+	runes := []rune(text)
+	prevStart := -1
+	for i := 1; i < len(locations); i++ {
+		location := locations[i]
+		if location.PageStart != 0 || location.SectionPath != "指南 > 部署" {
+			t.Fatalf("unexpected location[%d]: %+v", i, location)
+		}
+		if location.CharStart <= prevStart || location.CharEnd > len(runes) {
+			t.Fatalf("offsets should move forward: location[%d]=%+v", i, location)
+		}
+		// 分块器补上的标题路径不在原文该位置，偏移只覆盖正文部分。
+		body := strings.TrimPrefix(chunks[i], "# 指南\n## 部署\n")
+		if got := string(runes[location.CharStart:location.CharEnd]); !strings.HasSuffix(got, strings.TrimSpace(body)) {
+			t.Fatalf("location[%d] covers %q, chunk %q", i, got, chunks[i])
+		}
+		prevStart = location.CharStart
+	}
+}
+
+func TestBuildChunkLocations_UnmatchedChunk(t *testing.T) {
+	locations := buildChunkLocations("原文内容", []string{"完全不同"}, "a.txt", nil, nil)
+	if locations[0].CharEnd != 0 || locations[0].SectionPath != "" {
+		t.Fatalf("expected zero location, got %+v", locations[0])
+	}
+}
@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"sort"
+
+	"pai_smart_go_v2/internal/model"
+)
+
+// reindexPlan 描述一次重新处理需要改动的 chunk。
+// changed 需要重新向量化；reused 的内容和模型与某条旧 chunk 相同，沿用旧向量只重写 ES 文档；
+// 两者都会覆盖写入 MySQL。removedChunkIDs 是新分块里已不存在的旧 chunk，需要从 ES 和 MySQL 删除。
+type reindexPlan struct {
+	changed         []model.DocumentVector
+	reused          []reusedChunk
+	removedChunkIDs []int
+	unchanged       int
+}
+
+// reusedChunk 是可以沿用旧向量的新 chunk，sourceVectorID 是向量所在的旧 ES 文档。
+type reusedChunk struct {
+	vector         model.DocumentVector
+	sourceVectorID string
+	embedding      []float32
+}
+
+// replacedChunkIDs 返回需要先从 MySQL 删除的 chunk_id（重新向量化的、沿用向量的和被移除的）。
+func (p reindexPlan) replacedChunkIDs() []int {
+	ids := make([]int, 0, len(p.changed)+len(p.reused)+len(p.removedChunkIDs))
+	for _, vector := range p.changed {
+		ids = append(ids, vector.ChunkID)
+	}
+	for _, chunk := range p.reused {
+		ids = append(ids, chunk.vector.ChunkID)
+	}
+	return append(ids, p.removedChunkIDs...)
+}
+
+// writtenVectors 返回需要写入 MySQL 的新行。
+func (p reindexPlan) writtenVectors() []model.DocumentVector {
+	vectors := make([]model.DocumentVector, 0, len(p.changed)+len(p.reused))
+	vectors = append(vectors, p.changed...)
+	for _, chunk := range p.reused {
+		vectors = append(vectors, chunk.vector)
+	}
+	return vectors
+}
+
+// diffDocumentVectors 按内容哈希和模型版本匹配新旧分块：
+// 同一 chunk_id 只有一条旧记录且所有字段一致时视为未变化；
+// 否则只要任意旧 chunk 的内容哈希和模型版本相同，就沿用它的向量（插入段落导致 chunk_id 整体后移时也成立），
+// 只重写 ES 文档；都匹配不上时才重新向量化。
+func diffDocumentVectors(existing []model.DocumentVector, next []model.DocumentVector) reindexPlan {
+	existingByChunk := make(map[int][]model.DocumentVector, len(existing))
+	existingByContent := make(map[embeddingKey]model.DocumentVector, len(existing))
+	for _, vector := range existing {
+		existingByChunk[vector.ChunkID] = append(existingByChunk[vector.ChunkID], vector)
+		key := embeddingKeyOf(vector)
+		if _, ok := existingByContent[key]; !ok {
+			existingByContent[key] = vector
+		}
+	}
+
+	plan := reindexPlan{changed: make([]model.DocumentVector, 0)}
+	nextChunks := make(map[int]struct{}, len(next))
+	for _, vector := range next {
+		nextChunks[vector.ChunkID] = struct{}{}
+		olds := existingByChunk[vector.ChunkID]
+		if len(olds) == 1 && sameIndexedChunk(olds[0], vector) {
+			plan.unchanged++
+			continue
+		}
+		if old, ok := existingByContent[embeddingKeyOf(vector)]; ok {
+			plan.reused = append(plan.reused, reusedChunk{vector: vector, sourceVectorID: model.BuildVectorID(old.FileMD5, old.ChunkID)})
+			continue
+		}
+		plan.changed = append(plan.changed, vector)
+	}
+
+	plan.removedChunkIDs = make([]int, 0)
+	for chunkID := range existingByChunk {
+		if _, ok := nextChunks[chunkID]; !ok {
+			plan.removedChunkIDs = append(plan.removedChunkIDs, chunkID)
+		}
+	}
+	sort.Ints(plan.removedChunkIDs)
+	return plan
+}
+
+// embeddingKey 决定能否沿用向量：只看内容哈希和模型版本，权限、元数据等字段不影响向量。
+type embeddingKey struct {
+	contentHash  string
+	modelVersion string
+}
+
+func embeddingKeyOf(vector model.DocumentVector) embeddingKey {
+	return embeddingKey{contentHash: vector.EffectiveContentHash(), modelVersion: vector.ModelVersion}
+}
+
+// sameIndexedChunk 判断 ES 文档是否无需重写：向量相同且写入 ES 的其余字段也都一致。
+func sameIndexedChunk(old model.DocumentVector, next model.DocumentVector) bool {
+	return embeddingKeyOf(old) == embeddingKeyOf(next) &&
+		old.UserID == next.UserID &&
+		old.OrgTag == next.OrgTag &&
+		old.IsPublic == next.IsPublic &&
+		old.Metadata.Equal(next.Metadata) &&
+		old.Location == next.Location &&
+		old.Superseded == next.Superseded &&
+		old.FolderID == next.FolderID &&
+		old.Attributes.Equal(next.Attributes) &&
+		old.Sharing.Equal(next.Sharing)
+}
@@ -0,0 +1,178 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/es"
+	"pai_smart_go_v2/pkg/tasks"
+)
+
+type fakeReuseESClient struct {
+	es.Client
+	docs      map[string]model.EsDocument
+	requested []string
+}
+
+func (f *fakeReuseESClient) GetDocumentsByVectorIDs(ctx context.Context, vectorIDs []string) (map[string]model.EsDocument, error) {
+	f.requested = append(f.requested, vectorIDs...)
+	docs := make(map[string]model.EsDocument)
+	for _, id := range vectorIDs {
+		if doc, ok := f.docs[id]; ok {
+			docs[id] = doc
+		}
+	}
+	return docs, nil
+}
+
+func TestDiffDocumentVectors(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5v", UserID: 7, OrgTag: "team-a"}
+	existing := buildDocumentVectors(task, []string{"a", "b", "c", "d"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
+	// 旧数据没有 content_hash 时按文本现算。
+	existing[0].ContentHash = ""
+	existing = append(existing, model.DocumentVector{FileMD5: "md5v", ChunkID: 2, TextContent: "c", UserID: 7, OrgTag: "team-a", ModelVersion: "text-embedding-v4"})
+
+	next := buildDocumentVectors(task, []string{"a", "B", "c"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
+	plan := diffDocumentVectors(existing, next)
+
+	if plan.unchanged != 1 {
+		t.Fatalf("expected only chunk 0 unchanged, got %d", plan.unchanged)
+	}
+	if len(plan.changed) != 1 || plan.changed[0].ChunkID != 1 {
+		t.Fatalf("expected only chunk 1 to be embedded again, got %+v", plan.changed)
+	}
+	// chunk 2 有两条旧记录，内容没变：沿用向量并重写，去掉重复行。
+	if len(plan.reused) != 1 || plan.reused[0].vector.ChunkID != 2 || plan.reused[0].sourceVectorID != "md5v_2" {
+		t.Fatalf("expected duplicated chunk 2 to reuse its embedding, got %+v", plan.reused)
+	}
+	if len(plan.removedChunkIDs) != 1 || plan.removedChunkIDs[0] != 3 {
+		t.Fatalf("expected chunk 3 removed, got %+v", plan.removedChunkIDs)
+	}
+	if ids := plan.replacedChunkIDs(); len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+		t.Fatalf("unexpected replaced chunk ids: %+v", ids)
+	}
+	if written := plan.writtenVectors(); len(written) != 2 || written[0].ChunkID != 1 || written[1].ChunkID != 2 {
+		t.Fatalf("unexpected written vectors: %+v", written)
+	}
+}
+
+func TestDiffDocumentVectors_InsertedChunkReusesShiftedEmbeddings(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5v", UserID: 7}
+	existing := buildDocumentVectors(task, []string{"a", "b", "c"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
+
+	plan := diffDocumentVectors(existing, buildDocumentVectors(task, []string{"a", "new", "b", "c"}, "text-embedding-v4", model.DocumentMetadata{}, nil))
+	if plan.unchanged != 1 || len(plan.removedChunkIDs) != 0 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if len(plan.changed) != 1 || plan.changed[0].TextContent != "new" {
+		t.Fatalf("expected only the inserted chunk to be embedded, got %+v", plan.changed)
+	}
+	if len(plan.reused) != 2 ||
+		plan.reused[0].vector.ChunkID != 2 || plan.reused[0].sourceVectorID != "md5v_1" ||
+		plan.reused[1].vector.ChunkID != 3 || plan.reused[1].sourceVectorID != "md5v_2" {
+		t.Fatalf("expected shifted chunks to reuse embeddings by content hash, got %+v", plan.reused)
+	}
+}
+
+func TestDiffDocumentVectors_MetadataChangeReindexes(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5v", UserID: 7, OrgTag: "team-a"}
+	existing := buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v3", model.DocumentMetadata{}, nil)
+
+	task.IsPublic = true
+	plan := diffDocumentVectors(existing, buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v4", model.DocumentMetadata{}, nil))
+	if plan.unchanged != 0 || len(plan.changed) != 2 || len(plan.reused) != 0 || len(plan.removedChunkIDs) != 0 {
+		t.Fatalf("expected model change to embed all chunks again, got %+v", plan)
+	}
+
+	plan = diffDocumentVectors(existing, buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v3", model.DocumentMetadata{}, nil))
+	if plan.unchanged != 0 || len(plan.changed) != 0 || len(plan.reused) != 2 {
+		t.Fatalf("expected permission change to only rewrite documents, got %+v", plan)
+	}
+}
+
+func TestDiffDocumentVectors_DocumentMetadataChangeReindexes(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5v", UserID: 7}
+	authoredAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	existing := buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v4", model.DocumentMetadata{Title: "旧标题", AuthoredAt: &authoredAt}, nil)
+
+	sameTime := authoredAt
+	plan := diffDocumentVectors(existing, buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v4", model.DocumentMetadata{Title: "旧标题", AuthoredAt: &sameTime}, nil))
+	if plan.unchanged != 2 {
+		t.Fatalf("expected equal metadata to keep chunks, got %+v", plan)
+	}
+	plan = diffDocumentVectors(existing, buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v4", model.DocumentMetadata{Title: "新标题", AuthoredAt: &sameTime}, nil))
+	if plan.unchanged != 0 || len(plan.changed) != 0 || len(plan.reused) != 2 {
+		t.Fatalf("expected title change to rewrite all chunks without embedding, got %+v", plan)
+	}
+}
+
+func TestDiffDocumentVectors_TagChangeReindexes(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5v", UserID: 7}
+	existing := buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
+	next := buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
+	for i := range next {
+		next[i].Attributes = model.DocumentAttributes{Tags: []string{"财务"}, CustomMetadata: map[string]string{"project": "apollo"}}
+	}
+
+	plan := diffDocumentVectors(existing, next)
+	if plan.unchanged != 0 || len(plan.changed) != 0 || len(plan.reused) != 2 {
+		t.Fatalf("expected tag change to rewrite all chunks without embedding, got %+v", plan)
+	}
+	if plan = diffDocumentVectors(next, next); plan.unchanged != 2 {
+		t.Fatalf("expected equal attributes to keep chunks, got %+v", plan)
+	}
+}
+
+func TestDiffDocumentVectors_SharingChangeReindexes(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5v", UserID: 7}
+	existing := buildDocumentVectors(task, []string{"a"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
+	next := buildDocumentVectors(task, []string{"a"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
+	next[0].Sharing = model.BuildDocumentSharing([]model.DocumentShare{{GranteeUserID: 5}, {GranteeOrgTag: "team-b"}, {GranteeUserID: 5}})
+
+	if plan := diffDocumentVectors(existing, next); plan.unchanged != 0 || len(plan.changed) != 0 || len(plan.reused) != 1 {
+		t.Fatalf("expected sharing change to rewrite the chunk without embedding, got %+v", plan)
+	}
+	if len(next[0].Sharing.SharedUserIDs) != 1 || len(next[0].Sharing.SharedOrgTags) != 1 {
+		t.Fatalf("expected deduplicated grantees, got %+v", next[0].Sharing)
+	}
+}
+
+func TestDiffDocumentVectors_NothingChanged(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5v", UserID: 7}
+	vectors := buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
+
+	plan := diffDocumentVectors(vectors, buildDocumentVectors(task, []string{"a", "b"}, "text-embedding-v4", model.DocumentMetadata{}, nil))
+	if plan.unchanged != 2 || len(plan.changed) != 0 || len(plan.reused) != 0 || len(plan.removedChunkIDs) != 0 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+}
+
+func TestProcessor_LoadReusedEmbeddings_FallsBackWhenSourceMissing(t *testing.T) {
+	task := tasks.FileProcessingTask{FileMD5: "md5v", UserID: 7}
+	existing := buildDocumentVectors(task, []string{"a", "b", "c"}, "text-embedding-v4", model.DocumentMetadata{}, nil)
+	plan := diffDocumentVectors(existing, buildDocumentVectors(task, []string{"new", "a", "b", "c"}, "text-embedding-v4", model.DocumentMetadata{}, nil))
+
+	esClient := &fakeReuseESClient{docs: map[string]model.EsDocument{
+		"md5v_0": {Vector: []float32{0.1, 0.2}, ModelVersion: "text-embedding-v4"},
+		"md5v_1": {Vector: []float32{0.3}, ModelVersion: "text-embedding-v4"},
+	}}
+	p := &Processor{esClient: esClient, embedding: &fakeEmbeddingClient{vector: []float32{1, 0}}, embeddingCfg: config.EmbeddingConfig{Model: "text-embedding-v4", Dimensions: 2}}
+
+	plan, err := p.loadReusedEmbeddings(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("loadReusedEmbeddings() error = %v", err)
+	}
+	if len(esClient.requested) != 3 {
+		t.Fatalf("expected all reused sources fetched at once, got %+v", esClient.requested)
+	}
+	if len(plan.reused) != 1 || plan.reused[0].vector.ChunkID != 1 || len(plan.reused[0].embedding) != 2 {
+		t.Fatalf("expected chunk 1 to reuse md5v_0, got %+v", plan.reused)
+	}
+	// md5v_1 维度不对、md5v_2 已不在 ES 中，退回重新向量化。
+	if len(plan.changed) != 3 || plan.changed[0].ChunkID != 0 || plan.changed[1].ChunkID != 2 || plan.changed[2].ChunkID != 3 {
+		t.Fatalf("expected chunks 0, 2 and 3 to be embedded, got %+v", plan.changed)
+	}
+}
@@ -0,0 +1,219 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/embedding"
+	"pai_smart_go_v2/pkg/log"
+)
+
+const (
+	defaultEmbeddingBatchSize    = 10
+	defaultEmbeddingConcurrency  = 4
+	defaultEmbeddingMaxRetries   = 3
+	defaultEmbeddingRetryBackoff = 500 * time.Millisecond
+	maxEmbeddingRetryBackoff     = 10 * time.Second
+)
+
+type embeddingBatch struct {
+	start int
+	end   int
+}
+
+// vectorizeDocuments 把 chunk 按 batch_size 分批，最多 concurrency 批并发调用 embedding 接口；
+// 任意一批在重试后仍失败时取消其余批次并返回错误，成功时结果顺序与 vectors 一致。
+// 每批完成后向 progress 汇报进度，progress 可为 nil。
+func (p *Processor) vectorizeDocuments(ctx context.Context, vectors []model.DocumentVector, progress *progressReporter) ([]model.EsDocument, int, error) {
+	embeddings := make([][]float32, len(vectors))
+	batches := splitEmbeddingBatches(len(vectors), p.embeddingBatchSize())
+
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, p.embeddingConcurrency())
+
+dispatch:
+	for _, batch := range batches {
+		select {
+		case sem <- struct{}{}:
+		case <-batchCtx.Done():
+			break dispatch
+		}
+
+		wg.Add(1)
+		go func(batch embeddingBatch) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			texts := make([]string, 0, batch.end-batch.start)
+			for _, vector := range vectors[batch.start:batch.end] {
+				texts = append(texts, vector.TextContent)
+			}
+
+			result, err := p.createEmbeddingsWithRetry(batchCtx, texts)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("create embedding for chunks %d-%d failed: %w", vectors[batch.start].ChunkID, vectors[batch.end-1].ChunkID, err)
+					cancel()
+				})
+				return
+			}
+			copy(embeddings[batch.start:batch.end], result)
+			progress.addEmbedded(batchCtx, len(result))
+		}(batch)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	esDocs := make([]model.EsDocument, 0, len(vectors))
+	wantDims := p.vectorDims()
+	modelVersion := p.modelVersion()
+	dimensions := 0
+	for i, vector := range vectors {
+		embeddingVector := embeddings[i]
+		if wantDims > 0 && len(embeddingVector) != wantDims {
+			return nil, 0, fmt.Errorf("%w for chunk %d: got=%d want=%d", embedding.ErrDimensionMismatch, vector.ChunkID, len(embeddingVector), wantDims)
+		}
+		if dimensions == 0 {
+			dimensions = len(embeddingVector)
+		}
+
+		esDocs = append(esDocs, buildEsDocument(vector, embeddingVector, modelVersion))
+	}
+
+	return esDocs, dimensions, nil
+}
+
+// loadReusedEmbeddings 从 ES 读出 plan.reused 要沿用的旧向量；旧文档已不存在、模型版本或维度对不上时
+// 退回重新向量化，移入 plan.changed。
+func (p *Processor) loadReusedEmbeddings(ctx context.Context, plan reindexPlan) (reindexPlan, error) {
+	if len(plan.reused) == 0 {
+		return plan, nil
+	}
+
+	sourceIDs := make([]string, 0, len(plan.reused))
+	for _, chunk := range plan.reused {
+		sourceIDs = append(sourceIDs, chunk.sourceVectorID)
+	}
+	sources, err := p.esClient.GetDocumentsByVectorIDs(ctx, sourceIDs)
+	if err != nil {
+		return plan, err
+	}
+
+	wantDims := p.vectorDims()
+	reused := make([]reusedChunk, 0, len(plan.reused))
+	for _, chunk := range plan.reused {
+		source, ok := sources[chunk.sourceVectorID]
+		if !ok || len(source.Vector) == 0 || source.ModelVersion != chunk.vector.ModelVersion || (wantDims > 0 && len(source.Vector) != wantDims) {
+			plan.changed = append(plan.changed, chunk.vector)
+			continue
+		}
+		chunk.embedding = source.Vector
+		reused = append(reused, chunk)
+	}
+	plan.reused = reused
+	return plan, nil
+}
+
+// createEmbeddingsWithRetry 对单批文本调用 embedding 接口，可重试错误按指数退避重试。
+func (p *Processor) createEmbeddingsWithRetry(ctx context.Context, texts []string) ([][]float32, error) {
+	maxRetries := p.embeddingMaxRetries()
+	backoff := p.embeddingRetryBackoff()
+
+	for attempt := 0; ; attempt++ {
+		result, err := p.embedding.CreateEmbeddings(ctx, texts)
+		if err == nil && len(result) != len(texts) {
+			err = fmt.Errorf("embedding result count mismatch: got=%d want=%d", len(result), len(texts))
+		}
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= maxRetries || !embedding.IsRetryable(err) {
+			return nil, err
+		}
+
+		log.Warnf("[Processor] Embedding 批次失败，%s 后重试 (%d/%d): size=%d err=%v", backoff, attempt+1, maxRetries, len(texts), err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > maxEmbeddingRetryBackoff {
+			backoff = maxEmbeddingRetryBackoff
+		}
+	}
+}
+
+func splitEmbeddingBatches(total int, batchSize int) []embeddingBatch {
+	batches := make([]embeddingBatch, 0, (total+batchSize-1)/batchSize)
+	for start := 0; start < total; start += batchSize {
+		end := start + batchSize
+		if end > total {
+			end = total
+		}
+		batches = append(batches, embeddingBatch{start: start, end: end})
+	}
+	return batches
+}
+
+// modelVersion 返回当前使用的 embedding 模型；索引迁移切换模型后以 embedding 客户端报告的为准。
+func (p *Processor) modelVersion() string {
+	if info, ok := p.embedding.(embedding.ModelInfo); ok {
+		return info.Model()
+	}
+	return p.embeddingCfg.Model
+}
+
+func (p *Processor) vectorDims() int {
+	if info, ok := p.embedding.(embedding.ModelInfo); ok {
+		return info.Dimensions()
+	}
+	return p.embeddingCfg.Dimensions
+}
+
+func (p *Processor) embeddingBatchSize() int {
+	if p.embeddingCfg.BatchSize > 0 {
+		return p.embeddingCfg.BatchSize
+	}
+	return defaultEmbeddingBatchSize
+}
+
+func (p *Processor) embeddingConcurrency() int {
+	if p.embeddingCfg.Concurrency > 0 {
+		return p.embeddingCfg.Concurrency
+	}
+	return defaultEmbeddingConcurrency
+}
+
+func (p *Processor) embeddingMaxRetries() int {
+	if p.embeddingCfg.MaxRetries > 0 {
+		return p.embeddingCfg.MaxRetries
+	}
+	return defaultEmbeddingMaxRetries
+}
+
+func (p *Processor) embeddingRetryBackoff() time.Duration {
+	if p.embeddingCfg.RetryBackoffMillis > 0 {
+		return time.Duration(p.embeddingCfg.RetryBackoffMillis) * time.Millisecond
+	}
+	return defaultEmbeddingRetryBackoff
+}
@@ -3,46 +3,81 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
 	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/log"
 	"pai_smart_go_v2/pkg/token"
 
 	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
 )
 
 const (
-	defaultConversationTTL   = 7 * 24 * time.Hour
-	defaultConversationLimit = 20
+	defaultConversationTTL = 7 * 24 * time.Hour
+	// defaultConversationLimit 只是 Redis 最近消息缓存的条数上限，真正送入模型的历史由 token 预算筛选。
+	defaultConversationLimit = 50
+	// DefaultConversationTitle 是未命名会话的默认标题。
+	DefaultConversationTitle = "新对话"
 )
 
+// ErrConversationNotFound 表示会话不存在、已过期或不属于当前用户。
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ConversationRepository 管理会话与对话记录。
+// MySQL 保存完整会话与消息；Redis 作为写穿缓存，保存当前会话指针、会话元信息以及最近 historyLimit 条消息。
 type ConversationRepository interface {
 	GetConversationID(ctx context.Context, userID uint) (string, error)
 	GetOrCreateConversationID(ctx context.Context, userID uint) (string, error)
+	SetCurrentConversationID(ctx context.Context, userID uint, conversationID string) error
+	CreateConversation(ctx context.Context, userID uint, title string) (*model.Conversation, error)
+	GetConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error)
+	ListConversations(ctx context.Context, userID uint) ([]model.Conversation, error)
+	RenameConversation(ctx context.Context, userID uint, conversationID string, title string) (*model.Conversation, error)
+	DeleteConversation(ctx context.Context, userID uint, conversationID string) error
+	// GetConversationHistory 返回最近 historyLimit 条消息，优先读 Redis，用于拼接模型上下文。
 	GetConversationHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, error)
-	UpdateConversationHistory(ctx context.Context, conversationID string, messages []model.ChatMessage) error
+	// GetConversationTranscript 从 MySQL 读取完整对话记录。
+	GetConversationTranscript(ctx context.Context, conversationID string) ([]model.ChatMessage, error)
+	// AppendConversationMessages 先把新消息写入 MySQL，再同步刷新 Redis 中的最近消息缓存。
+	AppendConversationMessages(ctx context.Context, conversationID string, messages []model.ChatMessage) error
+	// UpdateConversationSummary 保存滚动摘要及其覆盖到的最后一条消息 ID；已有覆盖更新的摘要时不做修改。
+	UpdateConversationSummary(ctx context.Context, conversationID string, summary string, summarizedUntilID uint) error
+	// UpdateConversationScope 保存会话的检索范围，scope 为空时清除范围。
+	UpdateConversationScope(ctx context.Context, conversationID string, scope *model.ChatScope) error
 	GetAllUserConversationMappings(ctx context.Context) (map[uint]string, error)
+	// GetAllUserConversationIDs 汇总每个用户名下的全部会话（包含已被用户删除的会话）。
+	GetAllUserConversationIDs(ctx context.Context) (map[uint][]string, error)
+	// BackfillFromRedis 把只存在于 Redis 的旧会话补写进 MySQL，可重复执行，返回本次补写的会话数。
+	BackfillFromRedis(ctx context.Context) (int, error)
 }
 
 type conversationRepository struct {
+	db           *gorm.DB
 	rdb          *redis.Client
 	ttl          time.Duration
 	historyLimit int
 }
 
-func NewConversationRepository(rdb *redis.Client) ConversationRepository {
+func NewConversationRepository(db *gorm.DB, rdb *redis.Client) ConversationRepository {
 	return &conversationRepository{
+		db:           db,
 		rdb:          rdb,
 		ttl:          defaultConversationTTL,
 		historyLimit: defaultConversationLimit,
 	}
 }
 
+func (r *conversationRepository) ready() bool {
+	return r.db != nil && r.rdb != nil
+}
+
 func (r *conversationRepository) GetOrCreateConversationID(ctx context.Context, userID uint) (string, error) {
-	if r.rdb == nil || userID == 0 {
+	if !r.ready() || userID == 0 {
 		return "", fmt.Errorf("conversation repository is not ready")
 	}
 
@@ -51,21 +86,189 @@ func (r *conversationRepository) GetOrCreateConversationID(ctx context.Context,
 	case err != nil:
 		return "", err
 	case strings.TrimSpace(conversationID) != "":
-		if expireErr := r.rdb.Expire(ctx, currentConversationKey(userID), r.ttl).Err(); expireErr != nil {
-			return "", fmt.Errorf("refresh current conversation ttl failed: %w", expireErr)
+		if _, metaErr := r.GetConversation(ctx, userID, conversationID); metaErr == nil {
+			if expireErr := r.rdb.Expire(ctx, currentConversationKey(userID), r.ttl).Err(); expireErr != nil {
+				return "", fmt.Errorf("refresh current conversation ttl failed: %w", expireErr)
+			}
+			return conversationID, nil
+		} else if !errors.Is(metaErr, ErrConversationNotFound) {
+			return "", metaErr
+		}
+	}
+
+	conversation, err := r.CreateConversation(ctx, userID, "")
+	if err != nil {
+		return "", err
+	}
+	if err := r.SetCurrentConversationID(ctx, userID, conversation.ID); err != nil {
+		return "", err
+	}
+	return conversation.ID, nil
+}
+
+func (r *conversationRepository) SetCurrentConversationID(ctx context.Context, userID uint, conversationID string) error {
+	if !r.ready() || userID == 0 || strings.TrimSpace(conversationID) == "" {
+		return fmt.Errorf("conversation repository is not ready")
+	}
+	if err := r.rdb.Set(ctx, currentConversationKey(userID), strings.TrimSpace(conversationID), r.ttl).Err(); err != nil {
+		return fmt.Errorf("set current conversation failed: %w", err)
+	}
+	return nil
+}
+
+func (r *conversationRepository) CreateConversation(ctx context.Context, userID uint, title string) (*model.Conversation, error) {
+	if !r.ready() || userID == 0 {
+		return nil, fmt.Errorf("conversation repository is not ready")
+	}
+
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = DefaultConversationTitle
+	}
+	now := time.Now()
+	conversation := &model.Conversation{
+		ID:        token.GenerateRandomString(16),
+		UserID:    userID,
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := r.db.WithContext(ctx).Create(conversation).Error; err != nil {
+		return nil, fmt.Errorf("create conversation failed: %w", err)
+	}
+	r.cacheConversationMeta(ctx, conversation)
+	return conversation, nil
+}
+
+// GetConversation 读取会话元信息并校验归属，先查 Redis 缓存，未命中再查 MySQL。
+// 阶段十二生成的旧会话只有 current_conversation 指针、没有任何记录，这里会按需补登记。
+func (r *conversationRepository) GetConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error) {
+	if !r.ready() || userID == 0 {
+		return nil, fmt.Errorf("conversation repository is not ready")
+	}
+	conversationID = strings.TrimSpace(conversationID)
+	if conversationID == "" {
+		return nil, ErrConversationNotFound
+	}
+
+	conversation, err := r.loadCachedConversationMeta(ctx, conversationID)
+	if err != nil {
+		log.Warnf("读取会话元信息缓存失败，回退 MySQL: conversation_id=%s err=%v", conversationID, err)
+	}
+	if conversation == nil {
+		var stored model.Conversation
+		err := r.db.WithContext(ctx).Where("id = ?", conversationID).First(&stored).Error
+		switch {
+		case err == nil:
+			conversation = &stored
+			r.cacheConversationMeta(ctx, conversation)
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, fmt.Errorf("get conversation failed: %w", err)
 		}
-		return conversationID, nil
+	}
+	if conversation != nil {
+		if conversation.UserID != userID {
+			return nil, ErrConversationNotFound
+		}
+		return conversation, nil
 	}
 
-	conversationID = token.GenerateRandomString(16)
-	if err := r.rdb.Set(ctx, currentConversationKey(userID), conversationID, r.ttl).Err(); err != nil {
-		return "", fmt.Errorf("set current conversation failed: %w", err)
+	currentID, err := r.GetConversationID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if currentID != conversationID {
+		return nil, ErrConversationNotFound
+	}
+
+	now := time.Now()
+	conversation = &model.Conversation{
+		ID:        conversationID,
+		UserID:    userID,
+		Title:     DefaultConversationTitle,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := r.db.WithContext(ctx).Create(conversation).Error; err != nil {
+		return nil, fmt.Errorf("register legacy conversation failed: %w", err)
 	}
-	return conversationID, nil
+	r.cacheConversationMeta(ctx, conversation)
+	return conversation, nil
+}
+
+func (r *conversationRepository) ListConversations(ctx context.Context, userID uint) ([]model.Conversation, error) {
+	if !r.ready() || userID == 0 {
+		return nil, fmt.Errorf("conversation repository is not ready")
+	}
+
+	currentID, err := r.GetConversationID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if currentID != "" {
+		// 确保只有当前会话指针的旧会话也能出现在列表中。
+		if _, err := r.GetConversation(ctx, userID, currentID); err != nil && !errors.Is(err, ErrConversationNotFound) {
+			return nil, err
+		}
+	}
+
+	var conversations []model.Conversation
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("updated_at DESC").Find(&conversations).Error; err != nil {
+		return nil, fmt.Errorf("list user conversations failed: %w", err)
+	}
+	return conversations, nil
+}
+
+func (r *conversationRepository) RenameConversation(ctx context.Context, userID uint, conversationID string, title string) (*model.Conversation, error) {
+	conversation, err := r.GetConversation(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = DefaultConversationTitle
+	}
+	now := time.Now()
+	if err := r.db.WithContext(ctx).Model(&model.Conversation{}).
+		Where("id = ?", conversation.ID).
+		Updates(map[string]interface{}{"title": title, "updated_at": now}).Error; err != nil {
+		return nil, fmt.Errorf("rename conversation failed: %w", err)
+	}
+	conversation.Title = title
+	conversation.UpdatedAt = now
+	r.cacheConversationMeta(ctx, conversation)
+	return conversation, nil
+}
+
+// DeleteConversation 对会话做软删除：用户侧不可见，但 chat_messages 中的完整记录保留。
+func (r *conversationRepository) DeleteConversation(ctx context.Context, userID uint, conversationID string) error {
+	conversation, err := r.GetConversation(ctx, userID, conversationID)
+	if err != nil {
+		return err
+	}
+
+	if err := r.db.WithContext(ctx).Where("id = ?", conversation.ID).Delete(&model.Conversation{}).Error; err != nil {
+		return fmt.Errorf("delete conversation failed: %w", err)
+	}
+	if err := r.rdb.Del(ctx, conversationHistoryKey(conversation.ID), conversationMetaKey(conversation.ID)).Err(); err != nil {
+		return fmt.Errorf("delete conversation cache failed: %w", err)
+	}
+
+	currentID, err := r.GetConversationID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if currentID == conversation.ID {
+		if err := r.rdb.Del(ctx, currentConversationKey(userID)).Err(); err != nil {
+			return fmt.Errorf("clear current conversation failed: %w", err)
+		}
+	}
+	return nil
 }
 
 func (r *conversationRepository) GetConversationID(ctx context.Context, userID uint) (string, error) {
-	if r.rdb == nil || userID == 0 {
+	if !r.ready() || userID == 0 {
 		return "", fmt.Errorf("conversation repository is not ready")
 	}
 
@@ -81,38 +284,143 @@ func (r *conversationRepository) GetConversationID(ctx context.Context, userID u
 }
 
 func (r *conversationRepository) GetConversationHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
-	if r.rdb == nil || strings.TrimSpace(conversationID) == "" {
+	if !r.ready() || strings.TrimSpace(conversationID) == "" {
 		return []model.ChatMessage{}, nil
 	}
 
-	payload, err := r.rdb.Get(ctx, conversationHistoryKey(conversationID)).Result()
-	switch {
-	case err == redis.Nil:
-		return []model.ChatMessage{}, nil
-	case err != nil:
+	history, ok, cacheErr := r.loadCachedHistory(ctx, conversationID)
+	if cacheErr != nil {
+		log.Warnf("读取会话历史缓存失败，回退 MySQL: conversation_id=%s err=%v", conversationID, cacheErr)
+	}
+	if ok {
+		return history, nil
+	}
+
+	var records []model.ChatMessageRecord
+	if err := r.db.WithContext(ctx).
+		Where("conversation_id = ?", conversationID).
+		Order("id DESC").
+		Limit(r.historyLimit).
+		Find(&records).Error; err != nil {
 		return nil, fmt.Errorf("get conversation history failed: %w", err)
 	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
 
-	var history []model.ChatMessage
-	if err := json.Unmarshal([]byte(payload), &history); err != nil {
-		return nil, fmt.Errorf("unmarshal conversation history failed: %w", err)
+	history = toChatMessages(records)
+	if cacheErr == nil {
+		r.cacheHistory(ctx, conversationID, history)
 	}
 	return history, nil
 }
 
-func (r *conversationRepository) UpdateConversationHistory(ctx context.Context, conversationID string, messages []model.ChatMessage) error {
-	if r.rdb == nil || strings.TrimSpace(conversationID) == "" {
+func (r *conversationRepository) GetConversationTranscript(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
+	if !r.ready() || strings.TrimSpace(conversationID) == "" {
+		return []model.ChatMessage{}, nil
+	}
+
+	var records []model.ChatMessageRecord
+	if err := r.db.WithContext(ctx).
+		Where("conversation_id = ?", conversationID).
+		Order("id ASC").
+		Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("get conversation transcript failed: %w", err)
+	}
+	return toChatMessages(records), nil
+}
+
+func (r *conversationRepository) AppendConversationMessages(ctx context.Context, conversationID string, messages []model.ChatMessage) error {
+	if !r.ready() || strings.TrimSpace(conversationID) == "" {
 		return fmt.Errorf("conversation repository is not ready")
 	}
+	if len(messages) == 0 {
+		return nil
+	}
 
-	trimmed := trimConversationHistory(messages, r.historyLimit)
-	payload, err := json.Marshal(trimmed)
+	records, err := toChatMessageRecords(conversationID, messages)
 	if err != nil {
-		return fmt.Errorf("marshal conversation history failed: %w", err)
+		return err
 	}
 
-	if err := r.rdb.Set(ctx, conversationHistoryKey(conversationID), payload, r.ttl).Err(); err != nil {
-		return fmt.Errorf("save conversation history failed: %w", err)
+	// 写库前先取出缓存窗口，避免写库后缓存未命中时把刚写入的消息重复追加一次。
+	cached, cacheHit, cacheErr := r.loadCachedHistory(ctx, conversationID)
+
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&records).Error; err != nil {
+			return fmt.Errorf("save conversation messages failed: %w", err)
+		}
+		if err := tx.Model(&model.Conversation{}).
+			Where("id = ?", conversationID).
+			Update("updated_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("touch conversation failed: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	appended := make([]model.ChatMessage, len(messages))
+	for i, message := range messages {
+		message.ID = records[i].ID
+		appended[i] = message
+	}
+
+	if err := r.rdb.Del(ctx, conversationMetaKey(conversationID)).Err(); err != nil {
+		log.Warnf("清理会话元信息缓存失败: conversation_id=%s err=%v", conversationID, err)
+	}
+	switch {
+	case cacheErr != nil:
+		log.Warnf("读取会话历史缓存失败，跳过缓存刷新: conversation_id=%s err=%v", conversationID, cacheErr)
+	case cacheHit:
+		r.cacheHistory(ctx, conversationID, append(cached, appended...))
+	default:
+		if _, err := r.GetConversationHistory(ctx, conversationID); err != nil {
+			log.Warnf("回填会话历史缓存失败: conversation_id=%s err=%v", conversationID, err)
+		}
+	}
+	return nil
+}
+
+func (r *conversationRepository) UpdateConversationSummary(ctx context.Context, conversationID string, summary string, summarizedUntilID uint) error {
+	if !r.ready() || strings.TrimSpace(conversationID) == "" {
+		return fmt.Errorf("conversation repository is not ready")
+	}
+
+	// 摘要属于内部记忆，不应改变会话列表的 updated_at 排序，因此用 UpdateColumns。
+	// 并发刷新时较慢的一次可能基于更早的消息，只允许 summarized_until_id 向前推进。
+	if err := r.db.WithContext(ctx).Model(&model.Conversation{}).
+		Where("id = ?", conversationID).
+		Where("summarized_until_id < ?", summarizedUntilID).
+		UpdateColumns(map[string]interface{}{
+			"summary":             summary,
+			"summarized_until_id": summarizedUntilID,
+		}).Error; err != nil {
+		return fmt.Errorf("update conversation summary failed: %w", err)
+	}
+	if err := r.rdb.Del(ctx, conversationMetaKey(conversationID)).Err(); err != nil {
+		log.Warnf("清理会话元信息缓存失败: conversation_id=%s err=%v", conversationID, err)
+	}
+	return nil
+}
+
+func (r *conversationRepository) UpdateConversationScope(ctx context.Context, conversationID string, scope *model.ChatScope) error {
+	if !r.ready() || strings.TrimSpace(conversationID) == "" {
+		return fmt.Errorf("conversation repository is not ready")
+	}
+	if scope.IsEmpty() {
+		scope = nil
+	}
+
+	// 与摘要一样用 UpdateColumns，切换范围不改变会话列表的排序；Select 保证清除范围时写入 NULL。
+	if err := r.db.WithContext(ctx).Model(&model.Conversation{}).
+		Where("id = ?", conversationID).
+		Select("scope").
+		UpdateColumns(&model.Conversation{Scope: scope}).Error; err != nil {
+		return fmt.Errorf("update conversation scope failed: %w", err)
+	}
+	if err := r.rdb.Del(ctx, conversationMetaKey(conversationID)).Err(); err != nil {
+		log.Warnf("清理会话元信息缓存失败: conversation_id=%s err=%v", conversationID, err)
 	}
 	return nil
 }
@@ -159,6 +467,160 @@ func (r *conversationRepository) GetAllUserConversationMappings(ctx context.Cont
 	return result, nil
 }
 
+func (r *conversationRepository) GetAllUserConversationIDs(ctx context.Context) (map[uint][]string, error) {
+	if !r.ready() {
+		return nil, fmt.Errorf("conversation repository is not ready")
+	}
+
+	var conversations []model.Conversation
+	if err := r.db.WithContext(ctx).Unscoped().
+		Select("id", "user_id").
+		Order("created_at ASC").
+		Find(&conversations).Error; err != nil {
+		return nil, fmt.Errorf("list all conversations failed: %w", err)
+	}
+
+	result := make(map[uint][]string)
+	for _, conversation := range conversations {
+		result[conversation.UserID] = append(result[conversation.UserID], conversation.ID)
+	}
+	return result, nil
+}
+
+func (r *conversationRepository) BackfillFromRedis(ctx context.Context) (int, error) {
+	if !r.ready() {
+		return 0, fmt.Errorf("conversation repository is not ready")
+	}
+
+	candidates, err := r.collectRedisConversationIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for userID, conversationIDs := range candidates {
+		for _, conversationID := range conversationIDs {
+			var existing int64
+			if err := r.db.WithContext(ctx).Unscoped().Model(&model.Conversation{}).
+				Where("id = ?", conversationID).
+				Count(&existing).Error; err != nil {
+				return migrated, fmt.Errorf("check conversation existence failed: %w", err)
+			}
+			if existing > 0 {
+				continue
+			}
+
+			conversation, err := r.loadCachedConversationMeta(ctx, conversationID)
+			if err != nil {
+				return migrated, err
+			}
+			history, _, err := r.loadCachedHistory(ctx, conversationID)
+			if err != nil {
+				return migrated, err
+			}
+			if conversation == nil {
+				conversation = &model.Conversation{ID: conversationID, Title: DefaultConversationTitle, CreatedAt: time.Now()}
+				if len(history) > 0 && !history[0].CreatedAt.IsZero() {
+					conversation.CreatedAt = history[0].CreatedAt
+				}
+				conversation.UpdatedAt = conversation.CreatedAt
+			}
+			conversation.UserID = userID
+
+			records, err := toChatMessageRecords(conversationID, history)
+			if err != nil {
+				return migrated, err
+			}
+			if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(conversation).Error; err != nil {
+					return fmt.Errorf("backfill conversation failed: %w", err)
+				}
+				if len(records) == 0 {
+					return nil
+				}
+				if err := tx.Create(&records).Error; err != nil {
+					return fmt.Errorf("backfill conversation messages failed: %w", err)
+				}
+				return nil
+			}); err != nil {
+				return migrated, err
+			}
+			migrated++
+		}
+	}
+	return migrated, nil
+}
+
+// collectRedisConversationIDs 收集 Redis 中只存在于旧版本的会话：每个用户的 current_conversation 指针，
+// 消息历史在对应的 conversation:<id> 中。
+func (r *conversationRepository) collectRedisConversationIDs(ctx context.Context) (map[uint][]string, error) {
+	currentMappings, err := r.GetAllUserConversationMappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint][]string, len(currentMappings))
+	for userID, conversationID := range currentMappings {
+		result[userID] = append(result[userID], conversationID)
+	}
+	return result, nil
+}
+
+func (r *conversationRepository) loadCachedConversationMeta(ctx context.Context, conversationID string) (*model.Conversation, error) {
+	payload, err := r.rdb.Get(ctx, conversationMetaKey(conversationID)).Result()
+	switch {
+	case err == redis.Nil:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("get conversation meta failed: %w", err)
+	}
+
+	var conversation model.Conversation
+	if err := json.Unmarshal([]byte(payload), &conversation); err != nil {
+		return nil, fmt.Errorf("unmarshal conversation meta failed: %w", err)
+	}
+	return &conversation, nil
+}
+
+// cacheConversationMeta 写穿会话元信息缓存；MySQL 已写成功，缓存失败只记日志。
+func (r *conversationRepository) cacheConversationMeta(ctx context.Context, conversation *model.Conversation) {
+	payload, err := json.Marshal(conversation)
+	if err != nil {
+		log.Warnf("序列化会话元信息失败: conversation_id=%s err=%v", conversation.ID, err)
+		return
+	}
+	if err := r.rdb.Set(ctx, conversationMetaKey(conversation.ID), payload, r.ttl).Err(); err != nil {
+		log.Warnf("写入会话元信息缓存失败: conversation_id=%s err=%v", conversation.ID, err)
+	}
+}
+
+func (r *conversationRepository) loadCachedHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, bool, error) {
+	payload, err := r.rdb.Get(ctx, conversationHistoryKey(conversationID)).Result()
+	switch {
+	case err == redis.Nil:
+		return []model.ChatMessage{}, false, nil
+	case err != nil:
+		return nil, false, fmt.Errorf("get conversation history cache failed: %w", err)
+	}
+
+	var history []model.ChatMessage
+	if err := json.Unmarshal([]byte(payload), &history); err != nil {
+		return nil, false, fmt.Errorf("unmarshal conversation history failed: %w", err)
+	}
+	return history, true, nil
+}
+
+func (r *conversationRepository) cacheHistory(ctx context.Context, conversationID string, messages []model.ChatMessage) {
+	payload, err := json.Marshal(trimConversationHistory(messages, r.historyLimit))
+	if err != nil {
+		log.Warnf("序列化会话历史失败: conversation_id=%s err=%v", conversationID, err)
+		return
+	}
+	if err := r.rdb.Set(ctx, conversationHistoryKey(conversationID), payload, r.ttl).Err(); err != nil {
+		log.Warnf("写入会话历史缓存失败: conversation_id=%s err=%v", conversationID, err)
+	}
+}
+
 func currentConversationKey(userID uint) string {
 	return fmt.Sprintf("user:%d:current_conversation", userID)
 }
@@ -167,6 +629,10 @@ func conversationHistoryKey(conversationID string) string {
 	return fmt.Sprintf("conversation:%s", conversationID)
 }
 
+func conversationMetaKey(conversationID string) string {
+	return fmt.Sprintf("conversation:%s:meta", conversationID)
+}
+
 func trimConversationHistory(messages []model.ChatMessage, limit int) []model.ChatMessage {
 	if len(messages) == 0 {
 		return []model.ChatMessage{}
@@ -177,14 +643,73 @@ func trimConversationHistory(messages []model.ChatMessage, limit int) []model.Ch
 	return messages[len(messages)-limit:]
 }
 
+func toChatMessageRecords(conversationID string, messages []model.ChatMessage) ([]model.ChatMessageRecord, error) {
+	records := make([]model.ChatMessageRecord, 0, len(messages))
+	for _, message := range messages {
+		record := model.ChatMessageRecord{
+			ConversationID: conversationID,
+			Role:           message.Role,
+			Content:        message.Content,
+			CreatedAt:      message.CreatedAt,
+		}
+		if record.CreatedAt.IsZero() {
+			record.CreatedAt = time.Now()
+		}
+		if len(message.References) > 0 {
+			payload, err := json.Marshal(message.References)
+			if err != nil {
+				return nil, fmt.Errorf("marshal message references failed: %w", err)
+			}
+			record.ReferencesJSON = string(payload)
+		}
+		if !message.Scope.IsEmpty() {
+			payload, err := json.Marshal(message.Scope)
+			if err != nil {
+				return nil, fmt.Errorf("marshal message scope failed: %w", err)
+			}
+			record.ScopeJSON = string(payload)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func toChatMessages(records []model.ChatMessageRecord) []model.ChatMessage {
+	messages := make([]model.ChatMessage, 0, len(records))
+	for _, record := range records {
+		message := model.ChatMessage{
+			ID:        record.ID,
+			Role:      record.Role,
+			Content:   record.Content,
+			CreatedAt: record.CreatedAt,
+		}
+		if record.ReferencesJSON != "" {
+			// 引用只是辅助信息，解析失败时保留消息正文。
+			_ = json.Unmarshal([]byte(record.ReferencesJSON), &message.References)
+		}
+		if record.ScopeJSON != "" {
+			var scope model.ChatScope
+			if err := json.Unmarshal([]byte(record.ScopeJSON), &scope); err == nil && !scope.IsEmpty() {
+				message.Scope = &scope
+			}
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
 func parseUserIDFromConversationKey(key string) (uint, error) {
+	return parseUserIDFromKey(key, ":current_conversation")
+}
+
+func parseUserIDFromKey(key string, suffix string) (uint, error) {
 	trimmed := strings.TrimSpace(key)
-	if !strings.HasPrefix(trimmed, "user:") || !strings.HasSuffix(trimmed, ":current_conversation") {
+	if !strings.HasPrefix(trimmed, "user:") || !strings.HasSuffix(trimmed, suffix) {
 		return 0, fmt.Errorf("invalid conversation key: %s", key)
 	}
 
 	userIDPart := strings.TrimPrefix(trimmed, "user:")
-	userIDPart = strings.TrimSuffix(userIDPart, ":current_conversation")
+	userIDPart = strings.TrimSuffix(userIDPart, suffix)
 	parsed, err := strconv.ParseUint(userIDPart, 10, 64)
 	if err != nil {
 		return 0, err
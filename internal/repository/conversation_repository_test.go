@@ -2,12 +2,50 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"testing"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
 )
 
-func TestConversationRepository_GetConversationID_NotFound(t *testing.T) {
+func newMockConversationRepo(t *testing.T) (ConversationRepository, sqlmock.Sqlmock, *redis.Client) {
+	t.Helper()
+
+	sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("sqlmock.New() error: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	gdb, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open() error: %v", err)
+	}
+
 	rdb := newFakeRedisClient(t)
-	repo := NewConversationRepository(rdb)
+	return NewConversationRepository(gdb, rdb), mock, rdb
+}
+
+func conversationRows(conversations ...model.Conversation) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "user_id", "title", "created_at", "updated_at", "deleted_at"})
+	for _, conversation := range conversations {
+		rows.AddRow(conversation.ID, conversation.UserID, conversation.Title, conversation.CreatedAt, conversation.UpdatedAt, nil)
+	}
+	return rows
+}
+
+func TestConversationRepository_GetConversationID_NotFound(t *testing.T) {
+	repo, _, _ := newMockConversationRepo(t)
 
 	conversationID, err := repo.GetConversationID(context.Background(), 42)
 	if err != nil {
@@ -19,8 +57,7 @@ func TestConversationRepository_GetConversationID_NotFound(t *testing.T) {
 }
 
 func TestConversationRepository_GetAllUserConversationMappings(t *testing.T) {
-	rdb := newFakeRedisClient(t)
-	repo := NewConversationRepository(rdb)
+	repo, _, rdb := newMockConversationRepo(t)
 
 	if err := rdb.Set(context.Background(), "user:3:current_conversation", "conv-3", 0).Err(); err != nil {
 		t.Fatalf("seed redis key error: %v", err)
@@ -53,3 +90,254 @@ func TestParseUserIDFromConversationKey(t *testing.T) {
 		t.Fatalf("expected userID=9, got %d", userID)
 	}
 }
+
+func TestConversationRepository_CreateConversation_CachesMeta(t *testing.T) {
+	repo, mock, _ := newMockConversationRepo(t)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `conversations`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	conversation, err := repo.CreateConversation(ctx, 5, "")
+	if err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+	if conversation.Title != DefaultConversationTitle {
+		t.Fatalf("expected default title, got %q", conversation.Title)
+	}
+
+	// 元信息已写入 Redis 缓存，再次读取不应访问 MySQL。
+	got, err := repo.GetConversation(ctx, 5, conversation.ID)
+	if err != nil {
+		t.Fatalf("GetConversation() error = %v", err)
+	}
+	if got.ID != conversation.ID {
+		t.Fatalf("unexpected conversation: %+v", got)
+	}
+	if _, err := repo.GetConversation(ctx, 6, conversation.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("expected foreign user to get ErrConversationNotFound, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestConversationRepository_GetConversation_FallbackToMySQL(t *testing.T) {
+	repo, mock, rdb := newMockConversationRepo(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT \\* FROM `conversations` WHERE id = \\? AND `conversations`.`deleted_at` IS NULL").
+		WithArgs("conv-db", 1).
+		WillReturnRows(conversationRows(model.Conversation{ID: "conv-db", UserID: 5, Title: "周报", CreatedAt: now, UpdatedAt: now}))
+
+	conversation, err := repo.GetConversation(ctx, 5, "conv-db")
+	if err != nil {
+		t.Fatalf("GetConversation() error = %v", err)
+	}
+	if conversation.Title != "周报" {
+		t.Fatalf("unexpected conversation: %+v", conversation)
+	}
+	if _, err := rdb.Get(ctx, conversationMetaKey("conv-db")).Result(); err != nil {
+		t.Fatalf("expected conversation meta to be cached: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestConversationRepository_AppendConversationMessages_WriteThrough(t *testing.T) {
+	repo, mock, rdb := newMockConversationRepo(t)
+	ctx := context.Background()
+
+	cached, _ := json.Marshal([]model.ChatMessage{{Role: "user", Content: "上一轮"}})
+	if err := rdb.Set(ctx, conversationHistoryKey("conv-1"), cached, 0).Err(); err != nil {
+		t.Fatalf("seed history cache error: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `chat_messages`").WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec("UPDATE `conversations` SET `updated_at`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.AppendConversationMessages(ctx, "conv-1", []model.ChatMessage{
+		{Role: "user", Content: "问题"},
+		{Role: "assistant", Content: "回答", References: []model.ChatReference{{Index: 1, FileMD5: "md5"}}},
+	})
+	if err != nil {
+		t.Fatalf("AppendConversationMessages() error = %v", err)
+	}
+
+	history, err := repo.GetConversationHistory(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("GetConversationHistory() error = %v", err)
+	}
+	if len(history) != 3 || history[2].Content != "回答" || len(history[2].References) != 1 || history[2].ID != 2 {
+		t.Fatalf("unexpected cached history: %+v", history)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestConversationRepository_UpdateConversationSummary(t *testing.T) {
+	repo, mock, rdb := newMockConversationRepo(t)
+	ctx := context.Background()
+
+	if err := rdb.Set(ctx, conversationMetaKey("conv-1"), `{"id":"conv-1","userId":5}`, 0).Err(); err != nil {
+		t.Fatalf("seed meta cache error: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `conversations` SET `summarized_until_id`=\\?,`summary`=\\? WHERE id = \\? AND summarized_until_id < \\?").
+		WithArgs(uint(8), "摘要", "conv-1", uint(8)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.UpdateConversationSummary(ctx, "conv-1", "摘要", 8); err != nil {
+		t.Fatalf("UpdateConversationSummary() error = %v", err)
+	}
+	if _, err := rdb.Get(ctx, conversationMetaKey("conv-1")).Result(); err != redis.Nil {
+		t.Fatalf("expected meta cache to be invalidated, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestConversationRepository_UpdateConversationScope(t *testing.T) {
+	repo, mock, rdb := newMockConversationRepo(t)
+	ctx := context.Background()
+
+	if err := rdb.Set(ctx, conversationMetaKey("conv-1"), `{"id":"conv-1","userId":5}`, 0).Err(); err != nil {
+		t.Fatalf("seed meta cache error: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `conversations` SET `scope`=\\? WHERE id = \\?").
+		WithArgs(`{"fileMd5s":["md5-a"],"folderId":3}`, "conv-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `conversations` SET `scope`=\\? WHERE id = \\?").
+		WithArgs(nil, "conv-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.UpdateConversationScope(ctx, "conv-1", &model.ChatScope{FileMD5s: []string{"md5-a"}, FolderID: 3}); err != nil {
+		t.Fatalf("UpdateConversationScope() error = %v", err)
+	}
+	if _, err := rdb.Get(ctx, conversationMetaKey("conv-1")).Result(); err != redis.Nil {
+		t.Fatalf("expected meta cache to be invalidated, got %v", err)
+	}
+	if err := repo.UpdateConversationScope(ctx, "conv-1", &model.ChatScope{}); err != nil {
+		t.Fatalf("UpdateConversationScope() clear error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestConversationRepository_GetConversationHistory_CacheMiss(t *testing.T) {
+	repo, mock, rdb := newMockConversationRepo(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	// 按 id 倒序取最近消息，返回前需要翻转回时间正序。
+	mock.ExpectQuery("SELECT \\* FROM `chat_messages` WHERE conversation_id = \\? ORDER BY id DESC LIMIT \\?").
+		WithArgs("conv-1", defaultConversationLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "role", "content", "references_json", "scope_json", "created_at"}).
+			AddRow(2, "conv-1", "assistant", "回答", `[{"index":1,"fileMd5":"md5"}]`, "", now).
+			AddRow(1, "conv-1", "user", "问题", "", `{"orgTag":"team-a"}`, now))
+
+	history, err := repo.GetConversationHistory(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("GetConversationHistory() error = %v", err)
+	}
+	if len(history) != 2 || history[0].Role != "user" || history[1].References[0].FileMD5 != "md5" {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	if history[0].Scope == nil || history[0].Scope.OrgTag != "team-a" || history[1].Scope != nil {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	if _, err := rdb.Get(ctx, conversationHistoryKey("conv-1")).Result(); err != nil {
+		t.Fatalf("expected history to be cached: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestConversationRepository_DeleteConversation_SoftDelete(t *testing.T) {
+	repo, mock, rdb := newMockConversationRepo(t)
+	ctx := context.Background()
+
+	meta, _ := json.Marshal(model.Conversation{ID: "conv-1", UserID: 5, Title: "周报"})
+	if err := rdb.Set(ctx, conversationMetaKey("conv-1"), meta, 0).Err(); err != nil {
+		t.Fatalf("seed meta cache error: %v", err)
+	}
+	if err := rdb.Set(ctx, currentConversationKey(5), "conv-1", 0).Err(); err != nil {
+		t.Fatalf("seed current pointer error: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `conversations` SET `deleted_at`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.DeleteConversation(ctx, 5, "conv-1"); err != nil {
+		t.Fatalf("DeleteConversation() error = %v", err)
+	}
+	currentID, err := repo.GetConversationID(ctx, 5)
+	if err != nil {
+		t.Fatalf("GetConversationID() error = %v", err)
+	}
+	if currentID != "" {
+		t.Fatalf("expected current pointer to be cleared, got %q", currentID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestConversationRepository_BackfillFromRedis(t *testing.T) {
+	repo, mock, rdb := newMockConversationRepo(t)
+	ctx := context.Background()
+
+	history, _ := json.Marshal([]model.ChatMessage{
+		{Role: "user", Content: "旧问题", CreatedAt: time.Now().Add(-time.Hour)},
+		{Role: "assistant", Content: "旧回答", CreatedAt: time.Now()},
+	})
+	if err := rdb.Set(ctx, currentConversationKey(3), "conv-legacy", 0).Err(); err != nil {
+		t.Fatalf("seed current pointer error: %v", err)
+	}
+	if err := rdb.Set(ctx, conversationHistoryKey("conv-legacy"), history, 0).Err(); err != nil {
+		t.Fatalf("seed history error: %v", err)
+	}
+	if err := rdb.Set(ctx, currentConversationKey(4), "conv-done", 0).Err(); err != nil {
+		t.Fatalf("seed migrated pointer error: %v", err)
+	}
+
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `conversations` WHERE id = \\?").
+		WithArgs("conv-legacy").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `conversations` WHERE id = \\?").
+		WithArgs("conv-done").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `conversations`").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `chat_messages`").WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+
+	migrated, err := repo.BackfillFromRedis(ctx)
+	if err != nil {
+		t.Fatalf("BackfillFromRedis() error = %v", err)
+	}
+	if migrated != 1 {
+		t.Fatalf("expected 1 migrated conversation, got %d", migrated)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
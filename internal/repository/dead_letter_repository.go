@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDeadLetterListLimit = 50
+	maxDeadLetterListLimit     = 200
+)
+
+// DeadLetterFilter 是管理员查询死信记录的条件，零值表示不过滤。
+type DeadLetterFilter struct {
+	Status  string
+	FileMD5 string
+	Limit   int
+	Offset  int
+}
+
+type DeadLetterRepository interface {
+	Create(deadLetter *model.FileTaskDeadLetter) error
+	List(filter DeadLetterFilter) ([]model.FileTaskDeadLetter, int64, error)
+	FindByID(id uint) (*model.FileTaskDeadLetter, error)
+	MarkReplayed(id uint, replayedAt time.Time) error
+}
+
+type deadLetterRepository struct {
+	db *gorm.DB
+}
+
+func NewDeadLetterRepository(db *gorm.DB) DeadLetterRepository {
+	return &deadLetterRepository{db: db}
+}
+
+func (r *deadLetterRepository) Create(deadLetter *model.FileTaskDeadLetter) error {
+	return r.db.Create(deadLetter).Error
+}
+
+func (r *deadLetterRepository) List(filter DeadLetterFilter) ([]model.FileTaskDeadLetter, int64, error) {
+	query := r.db.Model(&model.FileTaskDeadLetter{})
+	if status := strings.TrimSpace(filter.Status); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if fileMD5 := strings.TrimSpace(filter.FileMD5); fileMD5 != "" {
+		query = query.Where("file_md5 = ?", fileMD5)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultDeadLetterListLimit
+	}
+	if limit > maxDeadLetterListLimit {
+		limit = maxDeadLetterListLimit
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	var records []model.FileTaskDeadLetter
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+func (r *deadLetterRepository) FindByID(id uint) (*model.FileTaskDeadLetter, error) {
+	var record model.FileTaskDeadLetter
+	if err := r.db.First(&record, id).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *deadLetterRepository) MarkReplayed(id uint, replayedAt time.Time) error {
+	return r.db.Model(&model.FileTaskDeadLetter{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       model.DeadLetterStatusReplayed,
+		"replay_count": gorm.Expr("replay_count + 1"),
+		"replayed_at":  replayedAt,
+	}).Error
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func newMockDeadLetterRepo(t *testing.T) (DeadLetterRepository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("sqlmock.New() error: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	gdb, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open() error: %v", err)
+	}
+
+	return NewDeadLetterRepository(gdb), mock
+}
+
+func TestDeadLetterRepository_List_FiltersAndClampsLimit(t *testing.T) {
+	repo, mock := newMockDeadLetterRepo(t)
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `file_task_dead_letters` WHERE status = \\? AND file_md5 = \\?").
+		WithArgs("pending", "md5-a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT \\* FROM `file_task_dead_letters` WHERE status = \\? AND file_md5 = \\? ORDER BY id DESC LIMIT \\? OFFSET \\?").
+		WithArgs("pending", "md5-a", maxDeadLetterListLimit, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "file_md5", "status"}).AddRow(9, "md5-a", "pending"))
+
+	records, total, err := repo.List(DeadLetterFilter{Status: "pending", FileMD5: "md5-a", Limit: 1000, Offset: 10})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if total != 3 || len(records) != 1 || records[0].ID != 9 {
+		t.Fatalf("unexpected result: total=%d records=%+v", total, records)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDeadLetterRepository_MarkReplayed(t *testing.T) {
+	repo, mock := newMockDeadLetterRepo(t)
+
+	replayedAt := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `file_task_dead_letters` SET .*`replay_count`=replay_count \\+ 1.* WHERE id = \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.MarkReplayed(5, replayedAt); err != nil {
+		t.Fatalf("MarkReplayed() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
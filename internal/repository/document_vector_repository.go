@@ -3,6 +3,7 @@ package repository
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"pai_smart_go_v2/internal/model"
 
@@ -15,6 +16,25 @@ type DocumentVectorRepository interface {
 	BatchCreate(vectors []model.DocumentVector) error
 	FindByFileMD5(fileMD5 string) ([]model.DocumentVector, error)
 	DeleteByFileMD5(fileMD5 string) error
+	// ReplaceChunks 在一个事务里删除 replacedChunkIDs 对应的旧行并写入 vectors，
+	// 用于增量重建：只有内容变化、新增或已移除的 chunk 会被改动。
+	ReplaceChunks(fileMD5 string, replacedChunkIDs []int, vectors []model.DocumentVector) error
+	// ListFileMD5s 按 file_md5 升序分页返回有分块的文件，afterMD5 为上一页最后一个值。
+	ListFileMD5s(afterMD5 string, limit int) ([]string, error)
+	CountFiles() (int64, error)
+	// FindFileMD5sUpdatedSince 返回 since 之后有分块变更（重建、共享授权、标签、文件夹等）的文件 MD5，去重。
+	FindFileMD5sUpdatedSince(since time.Time) ([]string, error)
+	// UpdateModelVersion 把 ids 对应的分块标记为 modelVersion，索引迁移把分块写入新索引后调用。
+	// 不更新 updated_at，避免迁移自身的写入被当作期间变更反复补迁移。
+	UpdateModelVersion(ids []uint, modelVersion string) error
+	// MarkSuperseded 更新用户名下 fileMD5s 所有分块的 superseded 标记，文档版本变化时调用。
+	MarkSuperseded(fileMD5s []string, userID uint, superseded bool) error
+	// UpdateFolder 更新用户名下 fileMD5s 所有分块的 folder_id，文档移动到其他文件夹时调用。
+	UpdateFolder(fileMD5s []string, userID uint, folderID uint) error
+	// UpdateTags 更新用户名下 fileMD5s 所有分块冗余的标签和自定义元数据，用户修改文档标签时调用。
+	UpdateTags(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error
+	// UpdateSharing 更新用户名下 fileMD5s 所有分块冗余的共享授权，文档授权变化时调用。
+	UpdateSharing(fileMD5s []string, userID uint, sharing model.DocumentSharing) error
 }
 
 type documentVectorRepository struct {
@@ -50,3 +70,115 @@ func (r *documentVectorRepository) DeleteByFileMD5(fileMD5 string) error {
 	}
 	return r.db.Where("file_md5 = ?", fileMD5).Delete(&model.DocumentVector{}).Error
 }
+
+func (r *documentVectorRepository) ReplaceChunks(fileMD5 string, replacedChunkIDs []int, vectors []model.DocumentVector) error {
+	if strings.TrimSpace(fileMD5) == "" {
+		return fmt.Errorf("file_md5 is required")
+	}
+	if len(replacedChunkIDs) == 0 && len(vectors) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if len(replacedChunkIDs) > 0 {
+			if err := tx.Where("file_md5 = ? AND chunk_id IN ?", fileMD5, replacedChunkIDs).Delete(&model.DocumentVector{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(vectors) > 0 {
+			if err := tx.CreateInBatches(vectors, defaultDocumentVectorBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *documentVectorRepository) ListFileMD5s(afterMD5 string, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = defaultDocumentVectorBatchSize
+	}
+
+	var fileMD5s []string
+	err := r.db.Model(&model.DocumentVector{}).
+		Distinct("file_md5").
+		Where("file_md5 > ?", afterMD5).
+		Order("file_md5 ASC").
+		Limit(limit).
+		Pluck("file_md5", &fileMD5s).Error
+	if err != nil {
+		return nil, err
+	}
+	return fileMD5s, nil
+}
+
+func (r *documentVectorRepository) CountFiles() (int64, error) {
+	var count int64
+	if err := r.db.Model(&model.DocumentVector{}).Distinct("file_md5").Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *documentVectorRepository) FindFileMD5sUpdatedSince(since time.Time) ([]string, error) {
+	var fileMD5s []string
+	err := r.db.Model(&model.DocumentVector{}).
+		Distinct("file_md5").
+		Where("updated_at >= ?", since).
+		Order("file_md5 ASC").
+		Pluck("file_md5", &fileMD5s).Error
+	if err != nil {
+		return nil, err
+	}
+	return fileMD5s, nil
+}
+
+func (r *documentVectorRepository) UpdateModelVersion(ids []uint, modelVersion string) error {
+	if strings.TrimSpace(modelVersion) == "" {
+		return fmt.Errorf("model_version is required")
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Model(&model.DocumentVector{}).
+		Where("id IN ?", ids).
+		UpdateColumn("model_version", modelVersion).Error
+}
+
+func (r *documentVectorRepository) MarkSuperseded(fileMD5s []string, userID uint, superseded bool) error {
+	if len(fileMD5s) == 0 {
+		return nil
+	}
+	return r.db.Model(&model.DocumentVector{}).
+		Where("file_md5 IN ? AND user_id = ?", fileMD5s, userID).
+		Update("superseded", superseded).Error
+}
+
+func (r *documentVectorRepository) UpdateFolder(fileMD5s []string, userID uint, folderID uint) error {
+	if len(fileMD5s) == 0 {
+		return nil
+	}
+	return r.db.Model(&model.DocumentVector{}).
+		Where("file_md5 IN ? AND user_id = ?", fileMD5s, userID).
+		Update("folder_id", folderID).Error
+}
+
+func (r *documentVectorRepository) UpdateTags(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+	if len(fileMD5s) == 0 {
+		return nil
+	}
+	return r.db.Model(&model.DocumentVector{}).
+		Where("file_md5 IN ? AND user_id = ?", fileMD5s, userID).
+		Select("tags", "custom_metadata").
+		Updates(&model.DocumentVector{Attributes: model.DocumentAttributes{Tags: tags, CustomMetadata: customMetadata}}).Error
+}
+
+func (r *documentVectorRepository) UpdateSharing(fileMD5s []string, userID uint, sharing model.DocumentSharing) error {
+	if len(fileMD5s) == 0 {
+		return nil
+	}
+	return r.db.Model(&model.DocumentVector{}).
+		Where("file_md5 IN ? AND user_id = ?", fileMD5s, userID).
+		Select("shared_user_ids", "shared_org_tags").
+		Updates(&model.DocumentVector{Sharing: sharing}).Error
+}
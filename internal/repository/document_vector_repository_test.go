@@ -103,3 +103,109 @@ func TestDocumentVectorRepository_DeleteByFileMD5(t *testing.T) {
 		t.Fatalf("unmet expectations: %v", err)
 	}
 }
+
+func TestDocumentVectorRepository_ReplaceChunks(t *testing.T) {
+	repo, mock := newMockDocumentVectorRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `document_vectors` WHERE file_md5 = \\? AND chunk_id IN \\(\\?,\\?\\)").
+		WithArgs("md5v", 1, 3).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO `document_vectors`").WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectCommit()
+
+	err := repo.ReplaceChunks("md5v", []int{1, 3}, []model.DocumentVector{
+		{FileMD5: "md5v", ChunkID: 1, TextContent: "chunk-1", ContentHash: model.HashChunkContent("chunk-1"), UserID: 7},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceChunks() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDocumentVectorRepository_ReplaceChunks_Noop(t *testing.T) {
+	repo, mock := newMockDocumentVectorRepo(t)
+
+	if err := repo.ReplaceChunks("md5v", nil, nil); err != nil {
+		t.Fatalf("ReplaceChunks() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unexpected queries: %v", err)
+	}
+}
+
+func TestDocumentVectorRepository_MarkSuperseded_ScopedToOwner(t *testing.T) {
+	repo, mock := newMockDocumentVectorRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `document_vectors` SET `superseded`=\\?,`updated_at`=\\? WHERE file_md5 IN \\(\\?\\) AND user_id = \\?").
+		WithArgs(true, sqlmock.AnyArg(), "md5v", uint(7)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := repo.MarkSuperseded([]string{"md5v"}, 7, true); err != nil {
+		t.Fatalf("MarkSuperseded() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDocumentVectorRepository_UpdateFolder_ScopedToOwner(t *testing.T) {
+	repo, mock := newMockDocumentVectorRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `document_vectors` SET `folder_id`=\\?,`updated_at`=\\? WHERE file_md5 IN \\(\\?,\\?\\) AND user_id = \\?").
+		WithArgs(uint(5), sqlmock.AnyArg(), "md5-v1", "md5-v2", uint(7)).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectCommit()
+
+	if err := repo.UpdateFolder([]string{"md5-v1", "md5-v2"}, 7, 5); err != nil {
+		t.Fatalf("UpdateFolder() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDocumentVectorRepository_UpdateModelVersion_ByIDs(t *testing.T) {
+	repo, mock := newMockDocumentVectorRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `document_vectors` SET `model_version`=\\? WHERE id IN \\(\\?,\\?\\)$").
+		WithArgs("new-model", uint(1), uint(2)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := repo.UpdateModelVersion([]uint{1, 2}, "new-model"); err != nil {
+		t.Fatalf("UpdateModelVersion() error: %v", err)
+	}
+	if err := repo.UpdateModelVersion(nil, "new-model"); err != nil {
+		t.Fatalf("UpdateModelVersion(nil) error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDocumentVectorRepository_FindFileMD5sUpdatedSince(t *testing.T) {
+	repo, mock := newMockDocumentVectorRepo(t)
+	since := time.Now().Add(-time.Minute)
+
+	mock.ExpectQuery("SELECT DISTINCT `file_md5` FROM `document_vectors` WHERE updated_at >= \\? ORDER BY file_md5 ASC").
+		WithArgs(since).
+		WillReturnRows(sqlmock.NewRows([]string{"file_md5"}).AddRow("md5-a").AddRow("md5-b"))
+
+	fileMD5s, err := repo.FindFileMD5sUpdatedSince(since)
+	if err != nil {
+		t.Fatalf("FindFileMD5sUpdatedSince() error: %v", err)
+	}
+	if len(fileMD5s) != 2 || fileMD5s[0] != "md5-a" {
+		t.Fatalf("unexpected files: %v", fileMD5s)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
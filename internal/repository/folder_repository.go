@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"pai_smart_go_v2/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrFolderNotEmpty 表示文件夹下仍有子文件夹或文档，禁止直接删除。
+	ErrFolderNotEmpty = errors.New("folder is not empty")
+)
+
+// FolderRepository 定义文件夹的持久化操作。文件夹是树形结构，通过 ParentID 实现父子关系。
+type FolderRepository interface {
+	Create(folder *model.Folder) error
+	FindByID(id uint) (*model.Folder, error)
+	// FindAccessible 返回用户的个人文件夹和 orgTags 下的组织文件夹，按 id 升序。
+	FindAccessible(userID uint, orgTags []string) ([]model.Folder, error)
+	// FindSubtreeIDs 返回 rootID 及其全部后代文件夹的 ID。
+	FindSubtreeIDs(rootID uint) ([]uint, error)
+	// Update 更新文件夹的 name 和 parent_id。
+	Update(folder *model.Folder) error
+	// Delete 保护删除：有子文件夹或文档时返回 ErrFolderNotEmpty。
+	// 使用事务保证"检查 + 删除"的原子性。
+	Delete(id uint) error
+	// CountDocuments 统计每个文件夹中直接存放的文档数，只计已上传文档的最新版本。
+	CountDocuments(folderIDs []uint) (map[uint]int64, error)
+}
+
+type folderRepository struct {
+	db *gorm.DB
+}
+
+func NewFolderRepository(db *gorm.DB) FolderRepository {
+	return &folderRepository{db: db}
+}
+
+func (r *folderRepository) Create(folder *model.Folder) error {
+	if folder == nil {
+		return fmt.Errorf("folder is nil")
+	}
+	return r.db.Create(folder).Error
+}
+
+func (r *folderRepository) FindByID(id uint) (*model.Folder, error) {
+	var folder model.Folder
+	if err := r.db.First(&folder, id).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+func (r *folderRepository) FindAccessible(userID uint, orgTags []string) ([]model.Folder, error) {
+	scope := r.db.Where("org_tag = '' AND user_id = ?", userID)
+	if len(orgTags) > 0 {
+		scope = scope.Or("org_tag IN ?", orgTags)
+	}
+
+	var folders []model.Folder
+	if err := r.db.Where(scope).Order("id ASC").Find(&folders).Error; err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// FindSubtreeIDs 按层向下查找子文件夹；visited 防止脏数据中的环导致死循环。
+func (r *folderRepository) FindSubtreeIDs(rootID uint) ([]uint, error) {
+	ids := []uint{rootID}
+	visited := map[uint]struct{}{rootID: {}}
+	frontier := []uint{rootID}
+	for len(frontier) > 0 {
+		var children []uint
+		if err := r.db.Model(&model.Folder{}).
+			Where("parent_id IN ?", frontier).
+			Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+
+		frontier = frontier[:0]
+		for _, id := range children {
+			if _, exists := visited[id]; exists {
+				continue
+			}
+			visited[id] = struct{}{}
+			ids = append(ids, id)
+			frontier = append(frontier, id)
+		}
+	}
+	return ids, nil
+}
+
+// Update 使用 Select 限定只更新 name 和 parent_id，parent_id 为 nil 时置空（移动到根目录）。
+func (r *folderRepository) Update(folder *model.Folder) error {
+	if folder == nil {
+		return fmt.Errorf("folder is nil")
+	}
+
+	tx := r.db.Model(&model.Folder{}).
+		Where("id = ?", folder.ID).
+		Select("name", "parent_id").
+		Updates(folder)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *folderRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var childCount int64
+		if err := tx.Model(&model.Folder{}).
+			Where("parent_id = ?", id).
+			Count(&childCount).Error; err != nil {
+			return err
+		}
+		if childCount > 0 {
+			return ErrFolderNotEmpty
+		}
+
+		var documentCount int64
+		if err := tx.Model(&model.FileUpload{}).
+			Where("folder_id = ?", id).
+			Count(&documentCount).Error; err != nil {
+			return err
+		}
+		if documentCount > 0 {
+			return ErrFolderNotEmpty
+		}
+
+		res := tx.Delete(&model.Folder{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (r *folderRepository) CountDocuments(folderIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(folderIDs))
+	if len(folderIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		FolderID uint
+		Count    int64
+	}
+	if err := r.db.Model(&model.FileUpload{}).
+		Select("folder_id, COUNT(*) AS count").
+		Where("folder_id IN ? AND status = ? AND is_latest = ?", folderIDs, model.FileUploadStatusUploaded, true).
+		Group("folder_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.FolderID] = row.Count
+	}
+	return counts, nil
+}
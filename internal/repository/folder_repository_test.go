@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func newMockFolderRepo(t *testing.T) (FolderRepository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("sqlmock.New() error: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	gdb, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open() error: %v", err)
+	}
+
+	return NewFolderRepository(gdb), mock
+}
+
+func TestFolderRepository_FindAccessible(t *testing.T) {
+	repo, mock := newMockFolderRepo(t)
+
+	mock.ExpectQuery("SELECT \\* FROM `folders` WHERE \\(org_tag = '' AND user_id = \\?\\) OR org_tag IN \\(\\?,\\?\\) ORDER BY id ASC").
+		WithArgs(7, "team-a", "team-b").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "parent_id", "user_id", "org_tag"}).
+			AddRow(1, "我的文档", nil, 7, "").
+			AddRow(2, "团队手册", nil, 3, "team-a"))
+
+	folders, err := repo.FindAccessible(7, []string{"team-a", "team-b"})
+	if err != nil {
+		t.Fatalf("FindAccessible() error: %v", err)
+	}
+	if len(folders) != 2 || folders[1].OrgTag != "team-a" {
+		t.Fatalf("unexpected folders: %+v", folders)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestFolderRepository_FindSubtreeIDs(t *testing.T) {
+	repo, mock := newMockFolderRepo(t)
+
+	mock.ExpectQuery("SELECT `id` FROM `folders` WHERE parent_id IN \\(\\?\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2).AddRow(3))
+	mock.ExpectQuery("SELECT `id` FROM `folders` WHERE parent_id IN \\(\\?,\\?\\)").
+		WithArgs(2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery("SELECT `id` FROM `folders` WHERE parent_id IN \\(\\?\\)").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	ids, err := repo.FindSubtreeIDs(1)
+	if err != nil {
+		t.Fatalf("FindSubtreeIDs() error: %v", err)
+	}
+	if len(ids) != 4 || ids[0] != 1 || ids[3] != 4 {
+		t.Fatalf("unexpected subtree: %v", ids)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestFolderRepository_Delete_NotEmpty(t *testing.T) {
+	repo, mock := newMockFolderRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `folders` WHERE parent_id = \\?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `file_uploads` WHERE folder_id = \\?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectRollback()
+
+	err := repo.Delete(5)
+	if !errors.Is(err, ErrFolderNotEmpty) {
+		t.Fatalf("expected ErrFolderNotEmpty, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestFolderRepository_CountDocuments(t *testing.T) {
+	repo, mock := newMockFolderRepo(t)
+
+	mock.ExpectQuery("SELECT folder_id, COUNT\\(\\*\\) AS count FROM `file_uploads` WHERE folder_id IN \\(\\?,\\?\\) AND status = \\? AND is_latest = \\? GROUP BY `folder_id`").
+		WithArgs(1, 2, 1, true).
+		WillReturnRows(sqlmock.NewRows([]string{"folder_id", "count"}).AddRow(2, 3))
+
+	counts, err := repo.CountDocuments([]uint{1, 2})
+	if err != nil {
+		t.Fatalf("CountDocuments() error: %v", err)
+	}
+	if counts[1] != 0 || counts[2] != 3 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const defaultIndexMigrationListLimit = 20
+
+type IndexMigrationRepository interface {
+	Create(migration *model.IndexMigration) error
+	// Save 整行更新迁移记录，迁移任务用它持久化进度和最终状态。
+	Save(migration *model.IndexMigration) error
+	FindByID(id uint) (*model.IndexMigration, error)
+	List(limit int) ([]model.IndexMigration, error)
+	// MarkInterrupted 把遗留的 running 记录标记为失败，用于进程重启后清理被中断的迁移。
+	MarkInterrupted(finishedAt time.Time) (int64, error)
+}
+
+type indexMigrationRepository struct {
+	db *gorm.DB
+}
+
+func NewIndexMigrationRepository(db *gorm.DB) IndexMigrationRepository {
+	return &indexMigrationRepository{db: db}
+}
+
+func (r *indexMigrationRepository) Create(migration *model.IndexMigration) error {
+	return r.db.Create(migration).Error
+}
+
+func (r *indexMigrationRepository) Save(migration *model.IndexMigration) error {
+	return r.db.Save(migration).Error
+}
+
+func (r *indexMigrationRepository) FindByID(id uint) (*model.IndexMigration, error) {
+	var migration model.IndexMigration
+	if err := r.db.First(&migration, id).Error; err != nil {
+		return nil, err
+	}
+	return &migration, nil
+}
+
+func (r *indexMigrationRepository) List(limit int) ([]model.IndexMigration, error) {
+	if limit <= 0 {
+		limit = defaultIndexMigrationListLimit
+	}
+
+	var migrations []model.IndexMigration
+	if err := r.db.Order("id DESC").Limit(limit).Find(&migrations).Error; err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+func (r *indexMigrationRepository) MarkInterrupted(finishedAt time.Time) (int64, error) {
+	result := r.db.Model(&model.IndexMigration{}).
+		Where("status = ?", model.IndexMigrationStatusRunning).
+		Updates(map[string]interface{}{
+			"status":      model.IndexMigrationStatusFailed,
+			"last_error":  "interrupted by service restart",
+			"finished_at": finishedAt,
+		})
+	return result.RowsAffected, result.Error
+}
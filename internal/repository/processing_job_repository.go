@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/log"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProcessingJobRepository 持久化文件处理进度（GORM），并通过 Redis Pub/Sub 广播进度变化，
+// 使处理任务和 HTTP 推送连接可以位于不同实例。
+type ProcessingJobRepository interface {
+	// Save 按 (file_md5, user_id) 插入或覆盖进度记录。
+	Save(job *model.FileProcessingJob) error
+	FindByFileMD5AndUserID(fileMD5 string, userID uint) (*model.FileProcessingJob, error)
+
+	PublishProgress(ctx context.Context, job *model.FileProcessingJob) error
+	// SubscribeProgress 订阅某个用户所有文件的进度变化，调用方必须调用返回的 close 函数释放订阅。
+	SubscribeProgress(ctx context.Context, userID uint) (<-chan model.FileProcessingJob, func() error, error)
+}
+
+type processingJobRepository struct {
+	db  *gorm.DB
+	rdb *redis.Client
+}
+
+func NewProcessingJobRepository(db *gorm.DB, rdb *redis.Client) ProcessingJobRepository {
+	return &processingJobRepository{db: db, rdb: rdb}
+}
+
+func processingProgressChannel(userID uint) string {
+	return fmt.Sprintf("file:processing:progress:%d", userID)
+}
+
+func (r *processingJobRepository) Save(job *model.FileProcessingJob) error {
+	if job == nil {
+		return fmt.Errorf("processing job is nil")
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "file_md5"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"stage", "status", "total_chunks", "changed_chunks", "embedded_chunks", "progress",
+			"error_code", "last_error", "stage_durations", "started_at", "stage_started_at", "finished_at", "updated_at",
+		}),
+	}).Create(job).Error
+}
+
+func (r *processingJobRepository) FindByFileMD5AndUserID(fileMD5 string, userID uint) (*model.FileProcessingJob, error) {
+	var job model.FileProcessingJob
+	if err := r.db.Where("file_md5 = ? AND user_id = ?", fileMD5, userID).First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *processingJobRepository) PublishProgress(ctx context.Context, job *model.FileProcessingJob) error {
+	if r.rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("marshal processing job failed: %w", err)
+	}
+	return r.rdb.Publish(ctx, processingProgressChannel(job.UserID), payload).Err()
+}
+
+func (r *processingJobRepository) SubscribeProgress(ctx context.Context, userID uint) (<-chan model.FileProcessingJob, func() error, error) {
+	if r.rdb == nil {
+		return nil, nil, fmt.Errorf("redis client is nil")
+	}
+	pubsub := r.rdb.Subscribe(ctx, processingProgressChannel(userID))
+	// 等待订阅确认，避免订阅建立前发布的进度丢失且无法感知连接错误。
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, nil, err
+	}
+
+	jobs := make(chan model.FileProcessingJob)
+	go func() {
+		defer close(jobs)
+		for msg := range pubsub.Channel() {
+			var job model.FileProcessingJob
+			if err := json.Unmarshal([]byte(msg.Payload), &job); err != nil {
+				log.Warnf("SubscribeProgress: 进度消息反序列化失败: %v", err)
+				continue
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return jobs, pubsub.Close, nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func newMockProcessingJobRepo(t *testing.T) (ProcessingJobRepository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("sqlmock.New() error: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	gdb, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open() error: %v", err)
+	}
+
+	return NewProcessingJobRepository(gdb, nil), mock
+}
+
+func TestProcessingJobRepository_Save_UpsertsByFileAndUser(t *testing.T) {
+	repo, mock := newMockProcessingJobRepo(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `file_processing_jobs` .* ON DUPLICATE KEY UPDATE `stage`=VALUES\\(`stage`\\).*`stage_durations`=VALUES\\(`stage_durations`\\)").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.Save(&model.FileProcessingJob{
+		FileMD5:        "md5-a",
+		UserID:         2,
+		Stage:          model.ProcessingStageEmbed,
+		Status:         model.FileProcessingStatusProcessing,
+		StageDurations: map[string]int64{model.ProcessingStageExtract: 1200},
+		StartedAt:      time.Now(),
+		StageStartedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestProcessingJobRepository_FindByFileMD5AndUserID_DecodesDurations(t *testing.T) {
+	repo, mock := newMockProcessingJobRepo(t)
+
+	mock.ExpectQuery("SELECT \\* FROM `file_processing_jobs` WHERE file_md5 = \\? AND user_id = \\?").
+		WithArgs("md5-a", 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "file_md5", "user_id", "stage", "status", "progress", "stage_durations"}).
+			AddRow(1, "md5-a", 2, "index", "processing", 85.0, `{"extract":1200}`))
+
+	job, err := repo.FindByFileMD5AndUserID("md5-a", 2)
+	if err != nil {
+		t.Fatalf("FindByFileMD5AndUserID() error = %v", err)
+	}
+	if job.Stage != model.ProcessingStageIndex || job.StageDurations[model.ProcessingStageExtract] != 1200 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+}
@@ -4,26 +4,84 @@ import (
 	"context"
 	"fmt"
 	"pai_smart_go_v2/internal/model"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
+const (
+	defaultReprocessLimit = 100
+	maxReprocessLimit     = 1000
+)
+
+// ReprocessFilter 是管理员批量重新处理文档的筛选条件，零值表示不过滤。
+// ModelVersion 匹配 document_vectors 中任一 chunk 使用的 embedding 模型；
+// AfterID 为上一批最后一条记录的 id，用于分批翻页；IncludeSuperseded 为 true 时也包含已被新版本取代的旧版本。
+type ReprocessFilter struct {
+	ProcessingStatus  string
+	OrgTag            string
+	ModelVersion      string
+	AfterID           uint
+	IncludeSuperseded bool
+	Limit             int
+}
+
 // UploadRepository 定义文件上传数据的持久化操作（GORM + Redis）。
 type UploadRepository interface {
 	// --- GORM: FileUpload ---
 	Create(upload *model.FileUpload) error
 	FindByFileMD5AndUserID(fileMD5 string, userID uint) (*model.FileUpload, error)
 	FindBatchByMD5s(fileMD5s []string) ([]model.FileUpload, error)
+	// FindFilesByUserID、FindAccessibleFiles 和 FindAccessibleFilesByName 只返回各文档的最新版本；
+	// FindAccessibleFileByMD5 可以定位到任一版本，旧版本仍可下载和预览。
 	FindFilesByUserID(userID uint) ([]model.FileUpload, error)
 	FindAccessibleFiles(userID uint, orgTags []string) ([]model.FileUpload, error)
 	FindAccessibleFileByMD5(userID uint, orgTags []string, fileMD5 string) (*model.FileUpload, error)
 	FindAccessibleFilesByName(userID uint, orgTags []string, fileName string) ([]model.FileUpload, error)
 	FindByID(id uint) (*model.FileUpload, error)
+	// FindReprocessCandidates 返回已合并完成、符合筛选条件的上传记录，按 id 升序；
+	// 已在排队或处理中（pending/processing）的记录不会返回。
+	FindReprocessCandidates(filter ReprocessFilter) ([]model.FileUpload, error)
+	// FindFileMD5sUpdatedSince 返回 since 之后有过变更（处理状态更新等）的文件 MD5，去重。
+	FindFileMD5sUpdatedSince(since time.Time) ([]string, error)
 	DeleteFileUploadRecord(fileMD5 string, userID uint) error
 	UpdateFileUploadStatus(fileMD5 string, userID uint, status int, mergedAt *time.Time) error
+	// UpdateFileProcessingStatus 更新处理状态并清空上一次的失败原因。
 	UpdateFileProcessingStatus(fileMD5 string, userID uint, processingStatus string) error
+	// MarkFileProcessingFailed 把处理状态置为 failed 并记录分类后的错误码和说明。
+	MarkFileProcessingFailed(fileMD5 string, userID uint, errorCode string, errorMessage string) error
+	// UpdateDocumentMetadata 覆盖写入 Tika 提取的文档元数据，未识别到的字段会被清空。
+	UpdateDocumentMetadata(fileMD5 string, userID uint, metadata model.DocumentMetadata) error
+
+	// --- GORM: 文档版本 ---
+	// FindDocumentVersions 返回逻辑文档的全部版本（含上传中的），按版本号降序。
+	FindDocumentVersions(documentID string) ([]model.FileUpload, error)
+	// FindAccessibleDocumentVersions 返回用户有权访问的已上传版本，按版本号降序。
+	FindAccessibleDocumentVersions(userID uint, orgTags []string, documentID string) ([]model.FileUpload, error)
+	// FindLatestByFileName 返回用户名下同名文档的最新已上传版本。
+	FindLatestByFileName(userID uint, fileName string) (*model.FileUpload, error)
+	// AssignDocumentID 给引入版本之前上传、还没有逻辑文档 ID 的记录补上 documentID。
+	AssignDocumentID(fileMD5 string, userID uint, documentID string) error
+	// PromoteVersion 在一个事务里把 fileMD5 对应的版本设为文档最新版本，其余版本取消最新标记。
+	PromoteVersion(documentID string, fileMD5 string, userID uint) error
+
+	// --- GORM: 文件夹 ---
+	// UpdateFolder 把用户名下的 fileMD5s 移动到 folderID（0 表示根目录）。
+	UpdateFolder(fileMD5s []string, userID uint, folderID uint) error
+
+	// --- GORM: 标签 ---
+	// UpdateTags 整体覆盖用户名下 fileMD5s 的标签和自定义元数据，nil 表示清空。
+	UpdateTags(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error
+
+	// --- GORM: 共享授权 ---
+	// FindShares 返回 ownerID 名下 fileMD5 的全部共享授权。
+	FindShares(fileMD5 string, ownerID uint) ([]model.DocumentShare, error)
+	// ReplaceShares 在一个事务里把 ownerID 名下每个 fileMD5 的授权整体替换为 shares，shares 为空即全部撤销。
+	ReplaceShares(fileMD5s []string, ownerID uint, shares []model.DocumentShare) error
+	// FindManagedOwnerIDs 返回把 fileMD5 以 manage 权限授权给该用户（直接授权或通过 orgTags）的所有者。
+	FindManagedOwnerIDs(fileMD5 string, userID uint, orgTags []string) ([]uint, error)
 
 	// --- GORM: ChunkInfo ---
 	CreateChunkInfo(chunk *model.ChunkInfo) error
@@ -81,7 +139,7 @@ func (r *uploadRepository) FindBatchByMD5s(fileMD5s []string) ([]model.FileUploa
 
 func (r *uploadRepository) FindFilesByUserID(userID uint) ([]model.FileUpload, error) {
 	var uploads []model.FileUpload
-	if err := r.db.Where("user_id = ? AND status = ?", userID, 1).
+	if err := r.db.Where("user_id = ? AND status = ? AND is_latest = ?", userID, 1, true).
 		Order("created_at DESC").
 		Find(&uploads).Error; err != nil {
 		return nil, err
@@ -92,6 +150,7 @@ func (r *uploadRepository) FindFilesByUserID(userID uint) ([]model.FileUpload, e
 func (r *uploadRepository) FindAccessibleFiles(userID uint, orgTags []string) ([]model.FileUpload, error) {
 	var uploads []model.FileUpload
 	if err := r.buildAccessibleFilesQuery(userID, orgTags).
+		Where("is_latest = ?", true).
 		Order("created_at DESC").
 		Find(&uploads).Error; err != nil {
 		return nil, err
@@ -99,6 +158,56 @@ func (r *uploadRepository) FindAccessibleFiles(userID uint, orgTags []string) ([
 	return uploads, nil
 }
 
+func (r *uploadRepository) FindReprocessCandidates(filter ReprocessFilter) ([]model.FileUpload, error) {
+	query := r.db.Model(&model.FileUpload{}).
+		Where("status = ?", model.FileUploadStatusUploaded).
+		Where("processing_status NOT IN ?", []string{model.FileProcessingStatusPending, model.FileProcessingStatusProcessing})
+	if filter.AfterID > 0 {
+		query = query.Where("id > ?", filter.AfterID)
+	}
+	if !filter.IncludeSuperseded {
+		query = query.Where("is_latest = ?", true)
+	}
+	if status := strings.TrimSpace(filter.ProcessingStatus); status != "" {
+		query = query.Where("processing_status = ?", status)
+	}
+	if orgTag := strings.TrimSpace(filter.OrgTag); orgTag != "" {
+		query = query.Where("org_tag = ?", orgTag)
+	}
+	if modelVersion := strings.TrimSpace(filter.ModelVersion); modelVersion != "" {
+		query = query.Where("file_md5 IN (?)", r.db.Model(&model.DocumentVector{}).
+			Distinct("file_md5").
+			Where("model_version = ?", modelVersion))
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultReprocessLimit
+	}
+	if limit > maxReprocessLimit {
+		limit = maxReprocessLimit
+	}
+
+	var uploads []model.FileUpload
+	if err := query.Order("id ASC").Limit(limit).Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+func (r *uploadRepository) FindFileMD5sUpdatedSince(since time.Time) ([]string, error) {
+	var fileMD5s []string
+	err := r.db.Model(&model.FileUpload{}).
+		Distinct("file_md5").
+		Where("updated_at >= ?", since).
+		Order("file_md5 ASC").
+		Pluck("file_md5", &fileMD5s).Error
+	if err != nil {
+		return nil, err
+	}
+	return fileMD5s, nil
+}
+
 func (r *uploadRepository) FindAccessibleFileByMD5(userID uint, orgTags []string, fileMD5 string) (*model.FileUpload, error) {
 	var upload model.FileUpload
 	if err := r.buildAccessibleFilesQuery(userID, orgTags).
@@ -112,7 +221,7 @@ func (r *uploadRepository) FindAccessibleFileByMD5(userID uint, orgTags []string
 func (r *uploadRepository) FindAccessibleFilesByName(userID uint, orgTags []string, fileName string) ([]model.FileUpload, error) {
 	var uploads []model.FileUpload
 	if err := r.buildAccessibleFilesQuery(userID, orgTags).
-		Where("file_name = ?", fileName).
+		Where("file_name = ? AND is_latest = ?", fileName, true).
 		Order("created_at DESC").
 		Find(&uploads).Error; err != nil {
 		return nil, err
@@ -146,7 +255,165 @@ func (r *uploadRepository) UpdateFileUploadStatus(fileMD5 string, userID uint, s
 func (r *uploadRepository) UpdateFileProcessingStatus(fileMD5 string, userID uint, processingStatus string) error {
 	return r.db.Model(&model.FileUpload{}).
 		Where("file_md5 = ? AND user_id = ?", fileMD5, userID).
-		Update("processing_status", processingStatus).Error
+		Updates(map[string]interface{}{
+			"processing_status":        processingStatus,
+			"processing_error_code":    "",
+			"processing_error_message": "",
+		}).Error
+}
+
+func (r *uploadRepository) MarkFileProcessingFailed(fileMD5 string, userID uint, errorCode string, errorMessage string) error {
+	return r.db.Model(&model.FileUpload{}).
+		Where("file_md5 = ? AND user_id = ?", fileMD5, userID).
+		Updates(map[string]interface{}{
+			"processing_status":        model.FileProcessingStatusFailed,
+			"processing_error_code":    errorCode,
+			"processing_error_message": errorMessage,
+		}).Error
+}
+
+func (r *uploadRepository) UpdateDocumentMetadata(fileMD5 string, userID uint, metadata model.DocumentMetadata) error {
+	return r.db.Model(&model.FileUpload{}).
+		Where("file_md5 = ? AND user_id = ?", fileMD5, userID).
+		Updates(map[string]interface{}{
+			"doc_title":       metadata.Title,
+			"doc_author":      metadata.Author,
+			"doc_authored_at": metadata.AuthoredAt,
+			"doc_page_count":  metadata.PageCount,
+			"doc_language":    metadata.Language,
+		}).Error
+}
+
+// ========== GORM: 文档版本 ==========
+
+func (r *uploadRepository) FindDocumentVersions(documentID string) ([]model.FileUpload, error) {
+	if strings.TrimSpace(documentID) == "" {
+		return []model.FileUpload{}, nil
+	}
+	var uploads []model.FileUpload
+	if err := r.db.Where("document_id = ?", documentID).
+		Order("version DESC").
+		Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+func (r *uploadRepository) FindAccessibleDocumentVersions(userID uint, orgTags []string, documentID string) ([]model.FileUpload, error) {
+	var uploads []model.FileUpload
+	if err := r.buildAccessibleFilesQuery(userID, orgTags).
+		Where("document_id = ?", documentID).
+		Order("version DESC").
+		Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+func (r *uploadRepository) FindLatestByFileName(userID uint, fileName string) (*model.FileUpload, error) {
+	var upload model.FileUpload
+	if err := r.db.Where("user_id = ? AND file_name = ? AND status = ? AND is_latest = ?", userID, fileName, model.FileUploadStatusUploaded, true).
+		Order("version DESC").
+		First(&upload).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (r *uploadRepository) AssignDocumentID(fileMD5 string, userID uint, documentID string) error {
+	return r.db.Model(&model.FileUpload{}).
+		Where("file_md5 = ? AND user_id = ? AND (document_id = '' OR document_id IS NULL)", fileMD5, userID).
+		Update("document_id", documentID).Error
+}
+
+func (r *uploadRepository) PromoteVersion(documentID string, fileMD5 string, userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.FileUpload{}).
+			Where("document_id = ? AND NOT (file_md5 = ? AND user_id = ?)", documentID, fileMD5, userID).
+			Update("is_latest", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.FileUpload{}).
+			Where("file_md5 = ? AND user_id = ?", fileMD5, userID).
+			Update("is_latest", true).Error
+	})
+}
+
+// ========== GORM: 文件夹 ==========
+
+func (r *uploadRepository) UpdateFolder(fileMD5s []string, userID uint, folderID uint) error {
+	if len(fileMD5s) == 0 {
+		return nil
+	}
+	return r.db.Model(&model.FileUpload{}).
+		Where("file_md5 IN ? AND user_id = ?", fileMD5s, userID).
+		Update("folder_id", folderID).Error
+}
+
+// ========== GORM: 标签 ==========
+
+func (r *uploadRepository) UpdateTags(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+	if len(fileMD5s) == 0 {
+		return nil
+	}
+	// 用结构体加 Select 更新，json 序列化器才会生效，nil 也会按 NULL 写入。
+	return r.db.Model(&model.FileUpload{}).
+		Where("file_md5 IN ? AND user_id = ?", fileMD5s, userID).
+		Select("tags", "custom_metadata").
+		Updates(&model.FileUpload{Tags: tags, CustomMetadata: customMetadata}).Error
+}
+
+// ========== GORM: 共享授权 ==========
+
+func (r *uploadRepository) FindShares(fileMD5 string, ownerID uint) ([]model.DocumentShare, error) {
+	var shares []model.DocumentShare
+	if err := r.db.Where("file_md5 = ? AND owner_id = ?", fileMD5, ownerID).
+		Order("id ASC").
+		Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (r *uploadRepository) ReplaceShares(fileMD5s []string, ownerID uint, shares []model.DocumentShare) error {
+	if len(fileMD5s) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_md5 IN ? AND owner_id = ?", fileMD5s, ownerID).
+			Delete(&model.DocumentShare{}).Error; err != nil {
+			return err
+		}
+		if len(shares) == 0 {
+			return nil
+		}
+		rows := make([]model.DocumentShare, 0, len(fileMD5s)*len(shares))
+		for _, fileMD5 := range fileMD5s {
+			for _, share := range shares {
+				rows = append(rows, model.DocumentShare{
+					FileMD5:       fileMD5,
+					OwnerID:       ownerID,
+					GranteeUserID: share.GranteeUserID,
+					GranteeOrgTag: share.GranteeOrgTag,
+					Permission:    share.Permission,
+					CreatedBy:     share.CreatedBy,
+				})
+			}
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+func (r *uploadRepository) FindManagedOwnerIDs(fileMD5 string, userID uint, orgTags []string) ([]uint, error) {
+	var ownerIDs []uint
+	if err := r.db.Model(&model.DocumentShare{}).
+		Distinct("owner_id").
+		Where("file_md5 = ? AND permission = ?", fileMD5, model.SharePermissionManage).
+		Where(r.shareGranteeCondition(userID, orgTags)).
+		Pluck("owner_id", &ownerIDs).Error; err != nil {
+		return nil, err
+	}
+	return ownerIDs, nil
 }
 
 // ========== GORM: ChunkInfo ==========
@@ -214,11 +481,26 @@ func (r *uploadRepository) DeleteUploadMark(ctx context.Context, fileMD5 string,
 	return r.rdb.Del(ctx, key).Err()
 }
 
+// buildAccessibleFilesQuery 可访问的文件：自己的、公开的、所属组织标签的，以及共享给本人或所属组织标签的（任意权限）。
 func (r *uploadRepository) buildAccessibleFilesQuery(userID uint, orgTags []string) *gorm.DB {
 	base := r.db.Model(&model.FileUpload{}).Where("status = ?", 1)
 	permission := r.db.Where("user_id = ?", userID).Or("is_public = ?", true)
 	if len(orgTags) > 0 {
 		permission = permission.Or("org_tag IN ?", orgTags)
 	}
+	shared := r.db.Model(&model.DocumentShare{}).
+		Select("1").
+		Where("document_shares.file_md5 = file_uploads.file_md5 AND document_shares.owner_id = file_uploads.user_id").
+		Where(r.shareGranteeCondition(userID, orgTags))
+	permission = permission.Or("EXISTS (?)", shared)
 	return base.Where(permission)
 }
+
+// shareGranteeCondition 匹配授权给 userID 本人或 orgTags 中任一组织标签的共享记录。
+func (r *uploadRepository) shareGranteeCondition(userID uint, orgTags []string) *gorm.DB {
+	condition := r.db.Where("document_shares.grantee_user_id = ?", userID)
+	if len(orgTags) > 0 {
+		condition = condition.Or("document_shares.grantee_org_tag IN ?", orgTags)
+	}
+	return condition
+}
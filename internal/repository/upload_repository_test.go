@@ -158,11 +158,45 @@ func TestUploadRepository_FindBatchByMD5s_Empty(t *testing.T) {
 	}
 }
 
+func TestUploadRepository_FindReprocessCandidates(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectQuery("SELECT .* FROM `file_uploads` WHERE status = \\? AND processing_status NOT IN \\(\\?,\\?\\) AND id > \\? AND is_latest = \\? AND processing_status = \\? AND org_tag = \\? AND file_md5 IN \\(SELECT DISTINCT `file_md5` FROM `document_vectors` WHERE model_version = \\?\\) ORDER BY id ASC LIMIT \\?").
+		WithArgs(1, "pending", "processing", uint(40), true, "indexed", "team-a", "old-model", 100).
+		WillReturnRows(fileUploadRows())
+
+	uploads, err := repo.FindReprocessCandidates(ReprocessFilter{ProcessingStatus: "indexed", OrgTag: "team-a", ModelVersion: "old-model", AfterID: 40})
+	if err != nil {
+		t.Fatalf("FindReprocessCandidates() error: %v", err)
+	}
+	if len(uploads) != 1 || uploads[0].FileMD5 != "md5v" {
+		t.Fatalf("unexpected uploads: %+v", uploads)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUploadRepository_FindReprocessCandidates_CapsLimit(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectQuery("SELECT .* FROM `file_uploads` WHERE status = \\? AND processing_status NOT IN \\(\\?,\\?\\) ORDER BY id ASC LIMIT \\?").
+		WithArgs(1, "pending", "processing", 1000).
+		WillReturnRows(fileUploadRows())
+
+	if _, err := repo.FindReprocessCandidates(ReprocessFilter{IncludeSuperseded: true, Limit: 5000}); err != nil {
+		t.Fatalf("FindReprocessCandidates() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
 func TestUploadRepository_FindFilesByUserID(t *testing.T) {
 	repo, mock := newMockUploadRepo(t, nil)
 
-	mock.ExpectQuery("SELECT .* FROM `file_uploads` WHERE user_id = \\? AND status = \\? ORDER BY created_at DESC").
-		WithArgs(uint(2), 1).
+	mock.ExpectQuery("SELECT .* FROM `file_uploads` WHERE user_id = \\? AND status = \\? AND is_latest = \\? ORDER BY created_at DESC").
+		WithArgs(uint(2), 1, true).
 		WillReturnRows(fileUploadRows())
 
 	uploads, err := repo.FindFilesByUserID(2)
@@ -180,8 +214,8 @@ func TestUploadRepository_FindFilesByUserID(t *testing.T) {
 func TestUploadRepository_FindAccessibleFiles(t *testing.T) {
 	repo, mock := newMockUploadRepo(t, nil)
 
-	mock.ExpectQuery("SELECT .* FROM `file_uploads` WHERE status = \\? AND \\(user_id = \\? OR is_public = \\? OR org_tag IN \\(.+\\)\\) ORDER BY created_at DESC").
-		WithArgs(1, uint(7), true, "team-a", "team-b").
+	mock.ExpectQuery("SELECT .* FROM `file_uploads` WHERE status = \\? AND \\(user_id = \\? OR is_public = \\? OR org_tag IN \\(.+\\) OR EXISTS \\(SELECT 1 FROM `document_shares` .*document_shares.grantee_user_id = \\? OR document_shares.grantee_org_tag IN \\(.+\\)\\)\\)\\) AND is_latest = \\? ORDER BY created_at DESC").
+		WithArgs(1, uint(7), true, "team-a", "team-b", uint(7), "team-a", "team-b", true).
 		WillReturnRows(fileUploadRows())
 
 	uploads, err := repo.FindAccessibleFiles(7, []string{"team-a", "team-b"})
@@ -249,6 +283,156 @@ func TestUploadRepository_UpdateFileUploadStatus(t *testing.T) {
 	}
 }
 
+func TestUploadRepository_MarkFileProcessingFailed(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `file_uploads` SET `processing_error_code`=\\?,`processing_error_message`=\\?,`processing_status`=\\?,`updated_at`=\\? WHERE file_md5 = \\? AND user_id = \\?").
+		WithArgs(model.ProcessingErrorExtractTimeout, "Text extraction timed out", model.FileProcessingStatusFailed, sqlmock.AnyArg(), "md5v", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.MarkFileProcessingFailed("md5v", 2, model.ProcessingErrorExtractTimeout, "Text extraction timed out"); err != nil {
+		t.Fatalf("MarkFileProcessingFailed() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUploadRepository_UpdateFileProcessingStatus_ClearsError(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `file_uploads` SET `processing_error_code`=\\?,`processing_error_message`=\\?,`processing_status`=\\?").
+		WithArgs("", "", model.FileProcessingStatusProcessing, sqlmock.AnyArg(), "md5v", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.UpdateFileProcessingStatus("md5v", 2, model.FileProcessingStatusProcessing); err != nil {
+		t.Fatalf("UpdateFileProcessingStatus() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUploadRepository_UpdateDocumentMetadata(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `file_uploads` SET `doc_author`=\\?,`doc_authored_at`=\\?,`doc_language`=\\?,`doc_page_count`=\\?,`doc_title`=\\?").
+		WithArgs("张三", nil, "zh", 12, "季度报告", sqlmock.AnyArg(), "md5v", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	metadata := model.DocumentMetadata{Title: "季度报告", Author: "张三", PageCount: 12, Language: "zh"}
+	if err := repo.UpdateDocumentMetadata("md5v", 2, metadata); err != nil {
+		t.Fatalf("UpdateDocumentMetadata() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUploadRepository_FindLatestByFileName(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectQuery("SELECT .* FROM `file_uploads` WHERE user_id = \\? AND file_name = \\? AND status = \\? AND is_latest = \\? ORDER BY version DESC.* LIMIT \\?").
+		WithArgs(uint(2), "a.pdf", model.FileUploadStatusUploaded, true, 1).
+		WillReturnRows(fileUploadRows())
+
+	upload, err := repo.FindLatestByFileName(2, "a.pdf")
+	if err != nil {
+		t.Fatalf("FindLatestByFileName() error: %v", err)
+	}
+	if upload.FileMD5 != "md5v" {
+		t.Fatalf("unexpected upload: %+v", upload)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUploadRepository_PromoteVersion(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `file_uploads` SET `is_latest`=\\?,`updated_at`=\\? WHERE document_id = \\? AND NOT \\(file_md5 = \\? AND user_id = \\?\\)").
+		WithArgs(false, sqlmock.AnyArg(), "doc-1", "md5-v2", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `file_uploads` SET `is_latest`=\\?,`updated_at`=\\? WHERE file_md5 = \\? AND user_id = \\?").
+		WithArgs(true, sqlmock.AnyArg(), "md5-v2", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.PromoteVersion("doc-1", "md5-v2", 2); err != nil {
+		t.Fatalf("PromoteVersion() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUploadRepository_UpdateTags(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `file_uploads` SET `updated_at`=\\?,`tags`=\\?,`custom_metadata`=\\? WHERE file_md5 IN \\(\\?,\\?\\) AND user_id = \\?").
+		WithArgs(sqlmock.AnyArg(), `["财务","2024"]`, `{"project":"apollo"}`, "md5-v1", "md5-v2", 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := repo.UpdateTags([]string{"md5-v1", "md5-v2"}, 2, []string{"财务", "2024"}, map[string]string{"project": "apollo"}); err != nil {
+		t.Fatalf("UpdateTags() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUploadRepository_ReplaceShares(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `document_shares` WHERE file_md5 IN \\(\\?,\\?\\) AND owner_id = \\?").
+		WithArgs("md5-v1", "md5-v2", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `document_shares`").
+		WillReturnResult(sqlmock.NewResult(1, 4))
+	mock.ExpectCommit()
+
+	shares := []model.DocumentShare{
+		{GranteeUserID: 5, Permission: model.SharePermissionRead, CreatedBy: 2},
+		{GranteeOrgTag: "team-b", Permission: model.SharePermissionManage, CreatedBy: 2},
+	}
+	if err := repo.ReplaceShares([]string{"md5-v1", "md5-v2"}, 2, shares); err != nil {
+		t.Fatalf("ReplaceShares() error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUploadRepository_FindManagedOwnerIDs(t *testing.T) {
+	repo, mock := newMockUploadRepo(t, nil)
+
+	mock.ExpectQuery("SELECT DISTINCT `owner_id` FROM `document_shares` WHERE \\(file_md5 = \\? AND permission = \\?\\) AND \\(document_shares.grantee_user_id = \\? OR document_shares.grantee_org_tag IN \\(\\?\\)\\)").
+		WithArgs("md5v", model.SharePermissionManage, uint(7), "team-a").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow(2))
+
+	ownerIDs, err := repo.FindManagedOwnerIDs("md5v", 7, []string{"team-a"})
+	if err != nil {
+		t.Fatalf("FindManagedOwnerIDs() error: %v", err)
+	}
+	if len(ownerIDs) != 1 || ownerIDs[0] != 2 {
+		t.Fatalf("unexpected owner ids: %v", ownerIDs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
 func TestUploadRepository_CreateChunkInfo_Nil(t *testing.T) {
 	repo, _ := newMockUploadRepo(t, nil)
 
@@ -366,6 +550,7 @@ func TestUploadRepository_GetUploadedChunksFromRedis_KeyNotFound(t *testing.T) {
 type fakeRedisBackend struct {
 	mu     sync.Mutex
 	values map[string][]byte
+	sets   map[string]map[string]struct{}
 }
 
 func newFakeRedisClient(t *testing.T) *redis.Client {
@@ -373,6 +558,7 @@ func newFakeRedisClient(t *testing.T) *redis.Client {
 
 	backend := &fakeRedisBackend{
 		values: make(map[string][]byte),
+		sets:   make(map[string]map[string]struct{}),
 	}
 
 	rdb := redis.NewClient(&redis.Options{
@@ -525,6 +711,21 @@ func (s *fakeRedisBackend) execute(writer *bufio.Writer, args []string) error {
 			}
 		}
 		return writeInteger(writer, deleted)
+	case "sadd":
+		if len(args) < 3 {
+			return fmt.Errorf("ERR wrong number of arguments for 'sadd'")
+		}
+		return writeInteger(writer, s.sAdd(args[1], args[2:]...))
+	case "srem":
+		if len(args) < 3 {
+			return fmt.Errorf("ERR wrong number of arguments for 'srem'")
+		}
+		return writeInteger(writer, s.sRem(args[1], args[2:]...))
+	case "smembers":
+		if len(args) != 2 {
+			return fmt.Errorf("ERR wrong number of arguments for 'smembers'")
+		}
+		return writeArrayOfBulkStrings(writer, s.sMembers(args[1])...)
 	default:
 		return fmt.Errorf("ERR unknown command '%s'", cmd)
 	}
@@ -551,9 +752,62 @@ func (s *fakeRedisBackend) del(key string) bool {
 	if ok {
 		delete(s.values, key)
 	}
+	if _, isSet := s.sets[key]; isSet {
+		delete(s.sets, key)
+		ok = true
+	}
 	return ok
 }
 
+func (s *fakeRedisBackend) sAdd(key string, members ...string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, ok := s.sets[key]
+	if !ok {
+		set = make(map[string]struct{})
+		s.sets[key] = set
+	}
+	var added int64
+	for _, member := range members {
+		if _, exists := set[member]; !exists {
+			set[member] = struct{}{}
+			added++
+		}
+	}
+	return added
+}
+
+func (s *fakeRedisBackend) sRem(key string, members ...string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := s.sets[key]
+	var removed int64
+	for _, member := range members {
+		if _, exists := set[member]; exists {
+			delete(set, member)
+			removed++
+		}
+	}
+	if set != nil && len(set) == 0 {
+		delete(s.sets, key)
+	}
+	return removed
+}
+
+func (s *fakeRedisBackend) sMembers(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := make([]string, 0, len(s.sets[key]))
+	for member := range s.sets[key] {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
 func (s *fakeRedisBackend) set(key string, value []byte) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -567,7 +821,7 @@ func (s *fakeRedisBackend) keys(matchPattern string) []string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	keys := make([]string, 0, len(s.values))
+	keys := make([]string, 0, len(s.values)+len(s.sets))
 	for key := range s.values {
 		matched, err := path.Match(matchPattern, key)
 		if err != nil || !matched {
@@ -575,6 +829,13 @@ func (s *fakeRedisBackend) keys(matchPattern string) []string {
 		}
 		keys = append(keys, key)
 	}
+	for key := range s.sets {
+		matched, err := path.Match(matchPattern, key)
+		if err != nil || !matched {
+			continue
+		}
+		keys = append(keys, key)
+	}
 	sort.Strings(keys)
 	return keys
 }
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/llm"
+	"pai_smart_go_v2/pkg/log"
+)
+
+const (
+	defaultHistoryTokenBudget = 2000
+	defaultSummaryTokenBudget = 400
+	// chatMessageTokenOverhead 近似每条消息的角色与分隔符开销。
+	chatMessageTokenOverhead = 4
+	summaryRefreshTimeout    = 60 * time.Second
+)
+
+// conversationMemory 是本轮送入模型的对话记忆：滚动摘要 + 预算内的最近消息。
+// overflow 是超出预算、但尚未并入摘要的旧消息，回答结束后会被压缩进新的摘要。
+type conversationMemory struct {
+	summary  string
+	recent   []model.ChatMessage
+	overflow []model.ChatMessage
+}
+
+// buildConversationMemory 从最新消息往回挑选，直到估算 token 用完预算；摘要本身也计入预算。
+func buildConversationMemory(conversation *model.Conversation, history []model.ChatMessage, budget int) conversationMemory {
+	var summarizedUntilID uint
+	memory := conversationMemory{}
+	if conversation != nil {
+		memory.summary = strings.TrimSpace(conversation.Summary)
+		summarizedUntilID = conversation.SummarizedUntilID
+	}
+
+	pending := make([]model.ChatMessage, 0, len(history))
+	for _, message := range history {
+		// ID 为 0 的旧缓存消息无法判断是否已被摘要覆盖，保守地当作未摘要处理。
+		if message.ID != 0 && message.ID <= summarizedUntilID {
+			continue
+		}
+		pending = append(pending, message)
+	}
+
+	remaining := budget - estimateTokens(memory.summary)
+	start := len(pending)
+	for i := len(pending) - 1; i >= 0; i-- {
+		cost := estimateTokens(pending[i].Content) + chatMessageTokenOverhead
+		if cost > remaining {
+			break
+		}
+		remaining -= cost
+		start = i
+	}
+	// 让保留的上下文从用户提问开始，避免以一条孤立的助手回答开头。
+	for start < len(pending) && pending[start].Role != "user" {
+		start++
+	}
+
+	memory.recent = pending[start:]
+	memory.overflow = pending[:start]
+	return memory
+}
+
+func (m conversationMemory) toLLMMessages() []llm.Message {
+	messages := make([]llm.Message, 0, len(m.recent)+1)
+	if m.summary != "" {
+		messages = append(messages, llm.Message{
+			Role:    "system",
+			Content: "以下是本会话更早内容的摘要，仅作为背景参考：\n" + m.summary,
+		})
+	}
+	return append(messages, toLLMMessages(m.recent)...)
+}
+
+// estimateTokens 粗略估算 token 数：汉字等 CJK 字符按 1 个计，其余字符按 4 个折 1 个计。
+func estimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+			continue
+		}
+		other++
+	}
+	return cjk + (other+3)/4
+}
+
+func (s *chatService) historyTokenBudget() int {
+	if s.llmCfg.Generation.HistoryTokenBudget > 0 {
+		return s.llmCfg.Generation.HistoryTokenBudget
+	}
+	return defaultHistoryTokenBudget
+}
+
+func (s *chatService) summaryTokenBudget() int {
+	if s.llmCfg.Generation.SummaryTokenBudget > 0 {
+		return s.llmCfg.Generation.SummaryTokenBudget
+	}
+	return defaultSummaryTokenBudget
+}
+
+// refreshConversationSummary 把 overflow 中已落库的消息与已有摘要合并成新的滚动摘要。
+// 摘要失败只影响后续轮次的上下文质量，因此只记日志。
+func (s *chatService) refreshConversationSummary(conversationID string, memory conversationMemory) {
+	var summarizedUntilID uint
+	messages := make([]model.ChatMessage, 0, len(memory.overflow))
+	for _, message := range memory.overflow {
+		if message.ID == 0 {
+			continue
+		}
+		messages = append(messages, message)
+		summarizedUntilID = message.ID
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), summaryRefreshTimeout)
+	defer cancel()
+
+	summary, err := s.summarizeConversation(ctx, memory.summary, messages)
+	if err != nil {
+		log.Warnf("refreshConversationSummary: summarize failed: conversation_id=%s err=%v", conversationID, err)
+		return
+	}
+	if err := s.conversationRepo.UpdateConversationSummary(ctx, conversationID, summary, summarizedUntilID); err != nil {
+		log.Warnf("refreshConversationSummary: save summary failed: conversation_id=%s err=%v", conversationID, err)
+		return
+	}
+	log.Infow("conversation summary refreshed",
+		"conversation_id", conversationID,
+		"summarized_messages", len(messages),
+		"summarized_until_id", summarizedUntilID,
+		"summary_tokens", estimateTokens(summary),
+	)
+}
+
+func (s *chatService) summarizeConversation(ctx context.Context, previous string, messages []model.ChatMessage) (string, error) {
+	var transcript strings.Builder
+	for _, message := range messages {
+		transcript.WriteString(fmt.Sprintf("%s：%s\n", chatRoleLabel(message.Role), strings.TrimSpace(message.Content)))
+	}
+
+	previous = strings.TrimSpace(previous)
+	if previous == "" {
+		previous = "（无）"
+	}
+	prompt := []llm.Message{
+		{
+			Role: "system",
+			Content: fmt.Sprintf("你负责压缩多轮对话记忆。请把已有摘要与新增对话合并成一段不超过 %d 个 token 的中文摘要，"+
+				"保留用户关注的问题、已给出的关键结论、约束条件和未解决事项，不要编造，不要输出摘要以外的内容。", s.summaryTokenBudget()),
+		},
+		{
+			Role:    "user",
+			Content: "已有摘要：\n" + previous + "\n\n新增对话：\n" + transcript.String(),
+		},
+	}
+
+	collector := &llmTextCollector{}
+	if err := s.llmClient.StreamChat(ctx, prompt, collector); err != nil {
+		return "", err
+	}
+	summary := strings.TrimSpace(collector.builder.String())
+	if summary == "" {
+		return "", fmt.Errorf("llm returned empty summary")
+	}
+	return summary, nil
+}
+
+// llmTextCollector 收集非流式场景下的模型输出。
+type llmTextCollector struct {
+	builder strings.Builder
+}
+
+func (c *llmTextCollector) WriteMessage(_ int, data []byte) error {
+	c.builder.Write(data)
+	return nil
+}
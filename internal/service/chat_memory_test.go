@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/llm"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	if got := estimateTokens("你好世界"); got != 4 {
+		t.Fatalf("expected 4 tokens for 4 Han characters, got %d", got)
+	}
+	if got := estimateTokens("hello world!"); got != 3 {
+		t.Fatalf("expected 3 tokens for 12 ascii characters, got %d", got)
+	}
+	if got := estimateTokens(""); got != 0 {
+		t.Fatalf("expected 0 tokens for empty text, got %d", got)
+	}
+}
+
+func TestBuildConversationMemory(t *testing.T) {
+	history := []model.ChatMessage{
+		{ID: 1, Role: "user", Content: "已摘要的问题"},
+		{ID: 2, Role: "assistant", Content: "已摘要的回答"},
+		{ID: 3, Role: "user", Content: strings.Repeat("长", 40)},
+		{ID: 4, Role: "assistant", Content: strings.Repeat("答", 40)},
+		{ID: 5, Role: "user", Content: "短问题"},
+		{ID: 6, Role: "assistant", Content: "短回答"},
+	}
+	conversation := &model.Conversation{ID: "conv-1", Summary: "摘要", SummarizedUntilID: 2}
+
+	// 预算 = 摘要 2 + 两条短消息各 3+4，再多一条 44 token 的助手回答就超出。
+	memory := buildConversationMemory(conversation, history, 30)
+	if memory.summary != "摘要" {
+		t.Fatalf("unexpected summary: %q", memory.summary)
+	}
+	if len(memory.recent) != 2 || memory.recent[0].ID != 5 {
+		t.Fatalf("unexpected recent messages: %+v", memory.recent)
+	}
+	if len(memory.overflow) != 2 || memory.overflow[0].ID != 3 || memory.overflow[1].ID != 4 {
+		t.Fatalf("unexpected overflow: %+v", memory.overflow)
+	}
+
+	// 预算刚好截在助手回答上时，不应让上下文以孤立的助手消息开头。
+	memory = buildConversationMemory(nil, history[4:], 8)
+	if len(memory.recent) != 0 || len(memory.overflow) != 2 {
+		t.Fatalf("expected orphan assistant message to be dropped, got recent=%+v overflow=%+v", memory.recent, memory.overflow)
+	}
+
+	messages := buildConversationMemory(conversation, history, 1000).toLLMMessages()
+	if len(messages) != 5 || messages[0].Role != "system" || !strings.Contains(messages[0].Content, "摘要") {
+		t.Fatalf("unexpected llm messages: %+v", messages)
+	}
+}
+
+func TestChatServiceStreamResponseRefreshesSummary(t *testing.T) {
+	conversationRepo := &fakeConversationRepo{
+		history: []model.ChatMessage{
+			{ID: 1, Role: "user", Content: strings.Repeat("旧", 50)},
+			{ID: 2, Role: "assistant", Content: strings.Repeat("答", 50)},
+			{ID: 3, Role: "user", Content: "上一轮"},
+			{ID: 4, Role: "assistant", Content: "上一轮回答"},
+		},
+		summaryUpdated: make(chan struct{}, 1),
+	}
+	var calls [][]llm.Message
+	llmClient := &fakeLLMClient{
+		streamChatFn: func(ctx context.Context, messages []llm.Message, writer llm.MessageWriter) error {
+			if messages[0].Content == condenseQuestionSystemPrompt {
+				return writer.WriteMessage(llm.TextMessageType, []byte("问题"))
+			}
+			calls = append(calls, append([]llm.Message{}, messages...))
+			if len(calls) == 1 {
+				return writer.WriteMessage(llm.TextMessageType, []byte("回答"))
+			}
+			return writer.WriteMessage(llm.TextMessageType, []byte("新的摘要"))
+		},
+	}
+	svc := NewChatService(&fakeChatSearchService{
+		results: []model.SearchResponseDTO{{FileName: "doc.txt", TextContent: "chunk"}},
+	}, llmClient, conversationRepo, config.LLMConfig{
+		Generation: config.LLMGenerationConfig{HistoryTokenBudget: 20},
+	})
+
+	if err := svc.StreamResponse(context.Background(), "问题", "", nil, &model.User{ID: 1}, &fakeChatWriter{}, nil); err != nil {
+		t.Fatalf("StreamResponse() error = %v", err)
+	}
+
+	select {
+	case <-conversationRepo.summaryUpdated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected summary to be refreshed")
+	}
+
+	// 只有预算内的上一轮进入回答上下文：system + 上一轮两条 + 当前问题。
+	if len(calls[0]) != 4 || calls[0][1].Content != "上一轮" {
+		t.Fatalf("unexpected chat context: %+v", calls[0])
+	}
+	if conversationRepo.summary != "新的摘要" || conversationRepo.summarizedUntilID != 2 {
+		t.Fatalf("unexpected summary state: %q until=%d", conversationRepo.summary, conversationRepo.summarizedUntilID)
+	}
+	if !strings.Contains(calls[1][1].Content, strings.Repeat("旧", 50)) {
+		t.Fatalf("expected overflow messages in summary prompt, got %+v", calls[1])
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"pai_smart_go_v2/pkg/llm"
+	"pai_smart_go_v2/pkg/log"
+)
+
+const (
+	queryRewriteTimeout      = 15 * time.Second
+	queryRewriteHistoryLimit = 6
+	maxRewrittenQueryLength  = 200
+)
+
+const condenseQuestionSystemPrompt = "你负责为知识库检索改写问题。请结合对话历史，把用户最新的问题改写成一个脱离上下文也能看懂的独立检索问题，" +
+	"补全其中的指代和省略（例如“第二个”“它”“那这个呢”）。只输出改写后的问题本身，不要回答问题，不要添加解释；如果原问题已经完整，原样输出。"
+
+// condenseQuestion 结合会话记忆把追问改写成独立的检索问题。
+// 没有历史时直接返回原问题；改写失败或输出异常时回退原问题，不影响本轮回答。
+func (s *chatService) condenseQuestion(ctx context.Context, question string, memory conversationMemory) string {
+	history := memory.recent
+	if len(history) > queryRewriteHistoryLimit {
+		history = history[len(history)-queryRewriteHistoryLimit:]
+	}
+	if len(history) == 0 && memory.summary == "" {
+		return question
+	}
+
+	var transcript strings.Builder
+	if memory.summary != "" {
+		transcript.WriteString("更早对话摘要：")
+		transcript.WriteString(memory.summary)
+		transcript.WriteString("\n")
+	}
+	for _, message := range history {
+		transcript.WriteString(fmt.Sprintf("%s：%s\n", chatRoleLabel(message.Role), strings.TrimSpace(message.Content)))
+	}
+
+	rewriteCtx, cancel := context.WithTimeout(ctx, queryRewriteTimeout)
+	defer cancel()
+
+	collector := &llmTextCollector{}
+	err := s.llmClient.StreamChat(rewriteCtx, []llm.Message{
+		{Role: "system", Content: condenseQuestionSystemPrompt},
+		{Role: "user", Content: "对话历史：\n" + transcript.String() + "\n最新问题：" + question},
+	}, collector)
+	if err != nil {
+		log.Warnf("condenseQuestion: rewrite failed, fallback to original question: %v", err)
+		return question
+	}
+
+	rewritten := normalizeRewrittenQuery(collector.builder.String())
+	if rewritten == "" {
+		return question
+	}
+	return rewritten
+}
+
+// normalizeRewrittenQuery 只保留第一行并去掉模型常见的引号、前缀，过长的输出视为异常。
+func normalizeRewrittenQuery(text string) string {
+	text = strings.TrimSpace(text)
+	if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+		text = strings.TrimSpace(text[:idx])
+	}
+	for _, prefix := range []string{"改写后的问题：", "改写后的问题:", "独立问题：", "独立问题:"} {
+		text = strings.TrimSpace(strings.TrimPrefix(text, prefix))
+	}
+	text = strings.Trim(text, "\"'“”‘’「」")
+	text = strings.TrimSpace(text)
+	if len([]rune(text)) > maxRewrittenQueryLength {
+		return ""
+	}
+	return text
+}
+
+func chatRoleLabel(role string) string {
+	if role == "assistant" {
+		return "助手"
+	}
+	return "用户"
+}
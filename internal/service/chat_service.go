@@ -10,20 +10,29 @@ import (
 
 	"pai_smart_go_v2/internal/config"
 	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
 	"pai_smart_go_v2/pkg/llm"
 	"pai_smart_go_v2/pkg/log"
 )
 
-const defaultChatSearchTopK = 6
+const (
+	defaultChatSearchTopK       = 6
+	defaultChatReferenceSnippet = 200
+)
 
 type chatSearchProvider interface {
-	HybridSearch(ctx context.Context, query string, topK int, user *model.User) ([]model.SearchResponseDTO, error)
+	HybridSearchWithFilter(ctx context.Context, query string, topK int, user *model.User, filter SearchFilter) ([]model.SearchResponseDTO, error)
+	ValidateScope(ctx context.Context, user *model.User, scope *model.ChatScope) error
 }
 
 type chatConversationRepository interface {
 	GetOrCreateConversationID(ctx context.Context, userID uint) (string, error)
+	GetConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error)
+	SetCurrentConversationID(ctx context.Context, userID uint, conversationID string) error
 	GetConversationHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, error)
-	UpdateConversationHistory(ctx context.Context, conversationID string, messages []model.ChatMessage) error
+	AppendConversationMessages(ctx context.Context, conversationID string, messages []model.ChatMessage) error
+	UpdateConversationSummary(ctx context.Context, conversationID string, summary string, summarizedUntilID uint) error
+	UpdateConversationScope(ctx context.Context, conversationID string, scope *model.ChatScope) error
 }
 
 type ChatResponseWriter interface {
@@ -31,7 +40,9 @@ type ChatResponseWriter interface {
 }
 
 type ChatService interface {
-	StreamResponse(ctx context.Context, question string, user *model.User, writer ChatResponseWriter, shouldStop func() bool) error
+	// StreamResponse 在指定会话中流式回答问题；conversationID 为空时沿用用户当前会话。
+	// scope 为 nil 时沿用会话已保存的检索范围，否则替换会话的范围，空范围表示取消限定。
+	StreamResponse(ctx context.Context, question string, conversationID string, scope *model.ChatScope, user *model.User, writer ChatResponseWriter, shouldStop func() bool) error
 }
 
 type chatService struct {
@@ -61,20 +72,27 @@ func NewChatService(
 	}
 }
 
-func (s *chatService) StreamResponse(ctx context.Context, question string, user *model.User, writer ChatResponseWriter, shouldStop func() bool) error {
+func (s *chatService) StreamResponse(ctx context.Context, question string, conversationID string, scope *model.ChatScope, user *model.User, writer ChatResponseWriter, shouldStop func() bool) error {
 	if s.searchService == nil || s.llmClient == nil || s.conversationRepo == nil || writer == nil {
 		return ErrInternal
 	}
 	if user == nil || strings.TrimSpace(question) == "" {
 		return ErrInvalidInput
 	}
+	if scope != nil && len(scope.FileMD5s) > maxScopeFiles {
+		return ErrInvalidInput
+	}
 
 	question = strings.TrimSpace(question)
 	startedAt := time.Now()
-	conversationID, err := s.conversationRepo.GetOrCreateConversationID(ctx, user.ID)
+	conversation, err := s.resolveConversation(ctx, user.ID, conversationID)
 	if err != nil {
-		log.Errorf("StreamResponse: get conversation id failed: %v", err)
-		return ErrInternal
+		return err
+	}
+	conversationID = conversation.ID
+	scope, err = s.resolveConversationScope(ctx, user, conversation, scope)
+	if err != nil {
+		return err
 	}
 	log.Infow("chat stream started",
 		"user_id", user.ID,
@@ -91,16 +109,34 @@ func (s *chatService) StreamResponse(ctx context.Context, question string, user
 		log.Errorf("StreamResponse: get conversation history failed: %v", err)
 		return ErrInternal
 	}
+	memory := buildConversationMemory(conversation, history, s.historyTokenBudget())
+
+	searchQuery := s.condenseQuestion(ctx, question, memory)
+	if searchQuery != question {
+		log.Infow("chat query rewritten",
+			"user_id", user.ID,
+			"conversation_id", conversationID,
+			"question_preview", truncateForLog(question, 120),
+			"search_query_preview", truncateForLog(searchQuery, 120),
+		)
+	}
 
-	searchResults, err := s.searchService.HybridSearch(ctx, question, defaultChatSearchTopK, user)
+	searchResults, err := s.searchService.HybridSearchWithFilter(ctx, searchQuery, defaultChatSearchTopK, user, SearchFilter{Scope: scope})
 	if err != nil {
 		return err
 	}
 	log.Infow("chat retrieval completed",
 		"user_id", user.ID,
 		"conversation_id", conversationID,
+		"question_preview", truncateForLog(question, 120),
+		"search_query_preview", truncateForLog(searchQuery, 120),
+		"query_rewritten", searchQuery != question,
+		"scoped", scope != nil,
 		"hits", len(searchResults),
 		"top_k", defaultChatSearchTopK,
+		"history_messages", len(memory.recent),
+		"history_overflow", len(memory.overflow),
+		"has_summary", memory.summary != "",
 	)
 
 	assistantAnswer := strings.TrimSpace(s.llmCfg.Prompt.NoResultText)
@@ -111,10 +147,10 @@ func (s *chatService) StreamResponse(ctx context.Context, question string, user
 		if err := writer.WriteJSON(map[string]string{"chunk": assistantAnswer}); err != nil {
 			return err
 		}
-		if err := writer.WriteJSON(map[string]string{"type": "completion", "status": "finished"}); err != nil {
+		if err := writer.WriteJSON(map[string]string{"type": "completion", "status": "finished", "conversationId": conversationID}); err != nil {
 			return err
 		}
-		s.persistConversation(conversationID, history, question, assistantAnswer)
+		s.persistConversation(conversationID, memory, question, scope, assistantAnswer, nil)
 		log.Infow("chat stream finished",
 			"user_id", user.ID,
 			"conversation_id", conversationID,
@@ -126,12 +162,17 @@ func (s *chatService) StreamResponse(ctx context.Context, question string, user
 		return nil
 	}
 
+	references := buildChatReferences(searchResults)
+	if err := writer.WriteJSON(map[string]interface{}{"type": "references", "references": references}); err != nil {
+		return err
+	}
+
 	interceptor := &wsWriterInterceptor{
 		writer:     writer,
 		shouldStop: shouldStop,
 	}
 
-	messages := append([]llm.Message{{Role: "system", Content: s.buildSystemPrompt(searchResults)}}, toLLMMessages(history)...)
+	messages := append([]llm.Message{{Role: "system", Content: s.buildSystemPrompt(searchResults)}}, memory.toLLMMessages()...)
 	messages = append(messages, llm.Message{Role: "user", Content: question})
 
 	err = s.llmClient.StreamChat(ctx, messages, interceptor)
@@ -145,13 +186,13 @@ func (s *chatService) StreamResponse(ctx context.Context, question string, user
 		}
 	}
 
-	if writeErr := writer.WriteJSON(map[string]string{"type": "completion", "status": status}); writeErr != nil {
+	if writeErr := writer.WriteJSON(map[string]string{"type": "completion", "status": status, "conversationId": conversationID}); writeErr != nil {
 		return writeErr
 	}
 
 	answer := strings.TrimSpace(interceptor.builder.String())
 	if answer != "" {
-		s.persistConversation(conversationID, history, question, answer)
+		s.persistConversation(conversationID, memory, question, scope, answer, references)
 	}
 	log.Infow("chat stream finished",
 		"user_id", user.ID,
@@ -164,6 +205,101 @@ func (s *chatService) StreamResponse(ctx context.Context, question string, user
 	return nil
 }
 
+// resolveConversation 校验前端指定的会话归属并切换为当前会话；未指定时沿用或新建当前会话。
+func (s *chatService) resolveConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error) {
+	conversationID = strings.TrimSpace(conversationID)
+	switchCurrent := conversationID != ""
+	if !switchCurrent {
+		currentID, err := s.conversationRepo.GetOrCreateConversationID(ctx, userID)
+		if err != nil {
+			log.Errorf("StreamResponse: get conversation id failed: %v", err)
+			return nil, ErrInternal
+		}
+		conversationID = currentID
+	}
+
+	conversation, err := s.conversationRepo.GetConversation(ctx, userID, conversationID)
+	if err != nil {
+		if errors.Is(err, repository.ErrConversationNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		log.Errorf("StreamResponse: get conversation failed: %v", err)
+		return nil, ErrInternal
+	}
+	if switchCurrent {
+		if err := s.conversationRepo.SetCurrentConversationID(ctx, userID, conversation.ID); err != nil {
+			log.Errorf("StreamResponse: switch current conversation failed: %v", err)
+			return nil, ErrInternal
+		}
+	}
+	return conversation, nil
+}
+
+// resolveConversationScope 返回本轮生效的检索范围：未指定时沿用会话范围，指定且与会话范围不同时
+// 先校验用户能否访问新范围（文件夹不存在或无权访问时直接返回错误），再保存为会话的新范围。
+func (s *chatService) resolveConversationScope(ctx context.Context, user *model.User, conversation *model.Conversation, scope *model.ChatScope) (*model.ChatScope, error) {
+	if scope == nil {
+		return normalizeChatScope(conversation.Scope), nil
+	}
+
+	scope = normalizeChatScope(scope)
+	if sameChatScope(scope, normalizeChatScope(conversation.Scope)) {
+		return scope, nil
+	}
+	if err := s.searchService.ValidateScope(ctx, user, scope); err != nil {
+		return nil, err
+	}
+	if err := s.conversationRepo.UpdateConversationScope(ctx, conversation.ID, scope); err != nil {
+		log.Errorf("StreamResponse: update conversation scope failed: %v", err)
+		return nil, ErrInternal
+	}
+	conversation.Scope = scope
+	return scope, nil
+}
+
+// normalizeChatScope 去掉空白和重复的文件，范围为空时返回 nil。
+func normalizeChatScope(scope *model.ChatScope) *model.ChatScope {
+	if scope.IsEmpty() {
+		return nil
+	}
+
+	normalized := &model.ChatScope{
+		OrgTag:   strings.TrimSpace(scope.OrgTag),
+		FolderID: scope.FolderID,
+	}
+	seen := make(map[string]struct{}, len(scope.FileMD5s))
+	for _, fileMD5 := range scope.FileMD5s {
+		fileMD5 = strings.TrimSpace(fileMD5)
+		if fileMD5 == "" {
+			continue
+		}
+		if _, ok := seen[fileMD5]; ok {
+			continue
+		}
+		seen[fileMD5] = struct{}{}
+		normalized.FileMD5s = append(normalized.FileMD5s, fileMD5)
+	}
+	if normalized.IsEmpty() {
+		return nil
+	}
+	return normalized
+}
+
+func sameChatScope(a, b *model.ChatScope) bool {
+	if a.IsEmpty() || b.IsEmpty() {
+		return a.IsEmpty() && b.IsEmpty()
+	}
+	if a.OrgTag != b.OrgTag || a.FolderID != b.FolderID || len(a.FileMD5s) != len(b.FileMD5s) {
+		return false
+	}
+	for i := range a.FileMD5s {
+		if a.FileMD5s[i] != b.FileMD5s[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *chatService) buildSystemPrompt(results []model.SearchResponseDTO) string {
 	templateContent := strings.TrimSpace(s.llmCfg.Prompt.Template)
 	if templateContent != "" {
@@ -193,11 +329,7 @@ func (s *chatService) buildSystemPrompt(results []model.SearchResponseDTO) strin
 	builder.WriteString(refStart)
 	builder.WriteByte('\n')
 	for i, item := range results {
-		fileName := strings.TrimSpace(item.FileName)
-		if fileName == "" {
-			fileName = item.FileMD5
-		}
-		builder.WriteString(fmt.Sprintf("[%d] (%s) %s\n", i+1, fileName, strings.TrimSpace(item.TextContent)))
+		builder.WriteString(fmt.Sprintf("[%d] (%s) %s\n", i+1, referenceSourceLabel(item), strings.TrimSpace(item.TextContent)))
 	}
 	builder.WriteString(refEnd)
 	return builder.String()
@@ -218,11 +350,7 @@ func renderPromptTemplate(templateContent string, results []model.SearchResponse
 
 	var references strings.Builder
 	for i, item := range results {
-		fileName := strings.TrimSpace(item.FileName)
-		if fileName == "" {
-			fileName = item.FileMD5
-		}
-		references.WriteString(fmt.Sprintf("[%d] (%s) %s\n", i+1, fileName, strings.TrimSpace(item.TextContent)))
+		references.WriteString(fmt.Sprintf("[%d] (%s) %s\n", i+1, referenceSourceLabel(item), strings.TrimSpace(item.TextContent)))
 	}
 
 	var rendered strings.Builder
@@ -237,18 +365,82 @@ func renderPromptTemplate(templateContent string, results []model.SearchResponse
 	return strings.TrimSpace(rendered.String()), nil
 }
 
-func (s *chatService) persistConversation(conversationID string, history []model.ChatMessage, question, answer string) {
+// buildChatReferences 把检索结果转换为结构化引用，编号与系统提示词中的 [n] 保持一致。
+func buildChatReferences(results []model.SearchResponseDTO) []model.ChatReference {
+	references := make([]model.ChatReference, 0, len(results))
+	for i, item := range results {
+		fileName := strings.TrimSpace(item.FileName)
+		if fileName == "" {
+			fileName = item.FileMD5
+		}
+		references = append(references, model.ChatReference{
+			Index:    i + 1,
+			FileMD5:  item.FileMD5,
+			FileName: fileName,
+			ChunkID:  item.ChunkID,
+			Score:    item.Score,
+			Snippet:  buildReferenceSnippet(item.TextContent, defaultChatReferenceSnippet),
+			Page:     item.PageStart,
+			PageEnd:  item.PageEnd,
+			Section:  item.SectionPath,
+		})
+	}
+	return references
+}
+
+// referenceSourceLabel 是提示词中参考资料的来源标注：文件名，有页码或章节时附在后面。
+func referenceSourceLabel(item model.SearchResponseDTO) string {
+	source := strings.TrimSpace(item.FileName)
+	if source == "" {
+		source = item.FileMD5
+	}
+	if location := referenceLocationLabel(item.PageStart, item.PageEnd, item.SectionPath); location != "" {
+		source += ", " + location
+	}
+	return source
+}
+
+// referenceLocationLabel 生成参考资料的位置说明，如 "第 3-4 页, 1 概述 > 1.1 背景"；没有页码和章节时返回空。
+func referenceLocationLabel(pageStart, pageEnd int, section string) string {
+	parts := make([]string, 0, 2)
+	switch {
+	case pageStart > 0 && pageEnd > pageStart:
+		parts = append(parts, fmt.Sprintf("第 %d-%d 页", pageStart, pageEnd))
+	case pageStart > 0:
+		parts = append(parts, fmt.Sprintf("第 %d 页", pageStart))
+	}
+	if section = strings.TrimSpace(section); section != "" {
+		parts = append(parts, section)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// buildReferenceSnippet 折叠空白后截断片段，避免把整块原文塞进引用帧。
+func buildReferenceSnippet(text string, limit int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if limit <= 0 || len(runes) <= limit {
+		return string(runes)
+	}
+	return string(runes[:limit]) + "..."
+}
+
+// persistConversation 追加本轮问答；若本轮有历史超出 token 预算，再异步把它们压缩进滚动摘要。
+func (s *chatService) persistConversation(conversationID string, memory conversationMemory, question string, scope *model.ChatScope, answer string, references []model.ChatReference) {
 	if strings.TrimSpace(conversationID) == "" || strings.TrimSpace(answer) == "" {
 		return
 	}
 
-	nextHistory := append(append([]model.ChatMessage{}, history...),
-		model.ChatMessage{Role: "user", Content: question, CreatedAt: time.Now()},
-		model.ChatMessage{Role: "assistant", Content: answer, CreatedAt: time.Now()},
-	)
+	messages := []model.ChatMessage{
+		{Role: "user", Content: question, Scope: scope, CreatedAt: time.Now()},
+		{Role: "assistant", Content: answer, References: references, CreatedAt: time.Now()},
+	}
 
-	if err := s.conversationRepo.UpdateConversationHistory(context.Background(), conversationID, nextHistory); err != nil {
+	if err := s.conversationRepo.AppendConversationMessages(context.Background(), conversationID, messages); err != nil {
 		log.Errorf("persistConversation: save conversation history failed: %v", err)
+		return
+	}
+	if len(memory.overflow) > 0 {
+		go s.refreshConversationSummary(conversationID, memory)
 	}
 }
 
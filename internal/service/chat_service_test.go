@@ -8,6 +8,7 @@ import (
 
 	"pai_smart_go_v2/internal/config"
 	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
 	"pai_smart_go_v2/pkg/llm"
 )
 
@@ -17,21 +18,37 @@ type fakeChatSearchService struct {
 	query   string
 	topK    int
 	userID  uint
+	filter  SearchFilter
+	// validateErr 非空时 ValidateScope 返回该错误，模拟范围中的文件夹无权访问。
+	validateErr error
+	validated   []*model.ChatScope
 }
 
-func (f *fakeChatSearchService) HybridSearch(ctx context.Context, query string, topK int, user *model.User) ([]model.SearchResponseDTO, error) {
+func (f *fakeChatSearchService) HybridSearchWithFilter(ctx context.Context, query string, topK int, user *model.User, filter SearchFilter) ([]model.SearchResponseDTO, error) {
 	f.query = query
 	f.topK = topK
+	f.filter = filter
 	if user != nil {
 		f.userID = user.ID
 	}
 	return f.results, f.err
 }
 
+func (f *fakeChatSearchService) ValidateScope(ctx context.Context, user *model.User, scope *model.ChatScope) error {
+	f.validated = append(f.validated, scope)
+	return f.validateErr
+}
+
 type fakeConversationRepo struct {
-	conversationID string
-	history        []model.ChatMessage
-	savedHistory   []model.ChatMessage
+	conversationID    string
+	currentID         string
+	summary           string
+	summarizedUntilID uint
+	scope             *model.ChatScope
+	scopeUpdates      int
+	history           []model.ChatMessage
+	savedHistory      []model.ChatMessage
+	summaryUpdated    chan struct{}
 }
 
 func (f *fakeConversationRepo) GetOrCreateConversationID(ctx context.Context, userID uint) (string, error) {
@@ -41,12 +58,45 @@ func (f *fakeConversationRepo) GetOrCreateConversationID(ctx context.Context, us
 	return f.conversationID, nil
 }
 
+func (f *fakeConversationRepo) GetConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error) {
+	if conversationID != "conv-owned" && conversationID != f.conversationID {
+		return nil, repository.ErrConversationNotFound
+	}
+	return &model.Conversation{
+		ID:                conversationID,
+		UserID:            userID,
+		Summary:           f.summary,
+		SummarizedUntilID: f.summarizedUntilID,
+		Scope:             f.scope,
+	}, nil
+}
+
+func (f *fakeConversationRepo) SetCurrentConversationID(ctx context.Context, userID uint, conversationID string) error {
+	f.currentID = conversationID
+	return nil
+}
+
 func (f *fakeConversationRepo) GetConversationHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
 	return append([]model.ChatMessage{}, f.history...), nil
 }
 
-func (f *fakeConversationRepo) UpdateConversationHistory(ctx context.Context, conversationID string, messages []model.ChatMessage) error {
-	f.savedHistory = append([]model.ChatMessage{}, messages...)
+func (f *fakeConversationRepo) AppendConversationMessages(ctx context.Context, conversationID string, messages []model.ChatMessage) error {
+	f.savedHistory = append(append([]model.ChatMessage{}, f.history...), messages...)
+	return nil
+}
+
+func (f *fakeConversationRepo) UpdateConversationSummary(ctx context.Context, conversationID string, summary string, summarizedUntilID uint) error {
+	f.summary = summary
+	f.summarizedUntilID = summarizedUntilID
+	if f.summaryUpdated != nil {
+		f.summaryUpdated <- struct{}{}
+	}
+	return nil
+}
+
+func (f *fakeConversationRepo) UpdateConversationScope(ctx context.Context, conversationID string, scope *model.ChatScope) error {
+	f.scope = scope
+	f.scopeUpdates++
 	return nil
 }
 
@@ -62,15 +112,23 @@ func (f *fakeLLMClient) StreamChat(ctx context.Context, messages []llm.Message,
 }
 
 type fakeChatWriter struct {
-	payloads []map[string]string
+	payloads   []map[string]string
+	references [][]model.ChatReference
 }
 
 func (w *fakeChatWriter) WriteJSON(v interface{}) error {
-	payload, ok := v.(map[string]string)
-	if !ok {
+	switch payload := v.(type) {
+	case map[string]string:
+		w.payloads = append(w.payloads, payload)
+	case map[string]interface{}:
+		references, ok := payload["references"].([]model.ChatReference)
+		if payload["type"] != "references" || !ok {
+			return errors.New("unexpected structured payload")
+		}
+		w.references = append(w.references, references)
+	default:
 		return errors.New("unexpected payload type")
 	}
-	w.payloads = append(w.payloads, payload)
 	return nil
 }
 
@@ -79,7 +137,12 @@ func TestChatServiceStreamResponseSuccess(t *testing.T) {
 		results: []model.SearchResponseDTO{{
 			FileMD5:     "md5",
 			FileName:    "go.pdf",
+			ChunkID:     3,
 			TextContent: "Go 使用 goroutine 实现并发。",
+			Score:       1.5,
+			PageStart:   2,
+			PageEnd:     3,
+			SectionPath: "语言特性 > 并发",
 		}},
 	}
 	conversationRepo := &fakeConversationRepo{
@@ -88,6 +151,9 @@ func TestChatServiceStreamResponseSuccess(t *testing.T) {
 	var gotMessages []llm.Message
 	llmClient := &fakeLLMClient{
 		streamChatFn: func(ctx context.Context, messages []llm.Message, writer llm.MessageWriter) error {
+			if messages[0].Content == condenseQuestionSystemPrompt {
+				return writer.WriteMessage(llm.TextMessageType, []byte("“Go 语言有什么特点？”"))
+			}
 			gotMessages = append([]llm.Message{}, messages...)
 			if err := writer.WriteMessage(llm.TextMessageType, []byte("Go")); err != nil {
 				return err
@@ -107,18 +173,21 @@ func TestChatServiceStreamResponseSuccess(t *testing.T) {
 	})
 
 	writer := &fakeChatWriter{}
-	err := svc.StreamResponse(context.Background(), "Go 有什么特点？", &model.User{ID: 9}, writer, func() bool { return false })
+	err := svc.StreamResponse(context.Background(), "Go 有什么特点？", "", nil, &model.User{ID: 9}, writer, func() bool { return false })
 	if err != nil {
 		t.Fatalf("StreamResponse() error = %v", err)
 	}
 
-	if searchSvc.query != "Go 有什么特点？" || searchSvc.topK != defaultChatSearchTopK || searchSvc.userID != 9 {
+	if searchSvc.query != "Go 语言有什么特点？" || searchSvc.topK != defaultChatSearchTopK || searchSvc.userID != 9 {
 		t.Fatalf("unexpected search input: query=%q topK=%d userID=%d", searchSvc.query, searchSvc.topK, searchSvc.userID)
 	}
 	if len(gotMessages) != 3 {
 		t.Fatalf("expected 3 llm messages, got %d", len(gotMessages))
 	}
-	if !strings.Contains(gotMessages[0].Content, "<<REF>>") || !strings.Contains(gotMessages[0].Content, "go.pdf") {
+	if gotMessages[2].Content != "Go 有什么特点？" {
+		t.Fatalf("expected original question to reach the llm, got %q", gotMessages[2].Content)
+	}
+	if !strings.Contains(gotMessages[0].Content, "<<REF>>") || !strings.Contains(gotMessages[0].Content, "[1] (go.pdf, 第 2-3 页, 语言特性 > 并发)") {
 		t.Fatalf("unexpected system prompt: %s", gotMessages[0].Content)
 	}
 	if len(writer.payloads) != 3 {
@@ -127,7 +196,7 @@ func TestChatServiceStreamResponseSuccess(t *testing.T) {
 	if writer.payloads[0]["chunk"] != "Go" || writer.payloads[1]["chunk"] != " 很适合高并发场景" {
 		t.Fatalf("unexpected chunks: %+v", writer.payloads)
 	}
-	if writer.payloads[2]["status"] != "finished" {
+	if writer.payloads[2]["status"] != "finished" || writer.payloads[2]["conversationId"] != "conv-1" {
 		t.Fatalf("unexpected completion payload: %+v", writer.payloads[2])
 	}
 	if len(conversationRepo.savedHistory) != 3 {
@@ -136,6 +205,55 @@ func TestChatServiceStreamResponseSuccess(t *testing.T) {
 	if conversationRepo.savedHistory[2].Content != "Go 很适合高并发场景" {
 		t.Fatalf("unexpected saved answer: %s", conversationRepo.savedHistory[2].Content)
 	}
+	if len(writer.references) != 1 || len(writer.references[0]) != 1 {
+		t.Fatalf("expected one references frame, got %+v", writer.references)
+	}
+	ref := writer.references[0][0]
+	if ref.Index != 1 || ref.FileMD5 != "md5" || ref.FileName != "go.pdf" || ref.ChunkID != 3 || ref.Score != 1.5 || ref.Snippet == "" ||
+		ref.Page != 2 || ref.PageEnd != 3 || ref.Section != "语言特性 > 并发" {
+		t.Fatalf("unexpected reference: %+v", ref)
+	}
+	if saved := conversationRepo.savedHistory[2].References; len(saved) != 1 || saved[0] != ref {
+		t.Fatalf("expected assistant message to keep references, got %+v", saved)
+	}
+}
+
+func TestBuildReferenceSnippet(t *testing.T) {
+	if got := buildReferenceSnippet("  第一行\n\n第二行  ", 10); got != "第一行 第二行" {
+		t.Fatalf("unexpected collapsed snippet: %q", got)
+	}
+	if got := buildReferenceSnippet("abcdef", 3); got != "abc..." {
+		t.Fatalf("unexpected truncated snippet: %q", got)
+	}
+}
+
+func TestReferenceLocationLabel(t *testing.T) {
+	cases := []struct {
+		pageStart, pageEnd int
+		section            string
+		want               string
+	}{
+		{pageStart: 3, pageEnd: 3, want: "第 3 页"},
+		{pageStart: 3, pageEnd: 4, section: "概述", want: "第 3-4 页, 概述"},
+		{section: " 安装 > 配置 ", want: "安装 > 配置"},
+		{},
+	}
+	for _, tc := range cases {
+		if got := referenceLocationLabel(tc.pageStart, tc.pageEnd, tc.section); got != tc.want {
+			t.Fatalf("referenceLocationLabel(%d, %d, %q) = %q, want %q", tc.pageStart, tc.pageEnd, tc.section, got, tc.want)
+		}
+	}
+}
+
+func TestChatServiceBuildSystemPrompt_InlineRulesIncludeLocation(t *testing.T) {
+	svc := &chatService{}
+	prompt := svc.buildSystemPrompt([]model.SearchResponseDTO{
+		{FileName: "go.pdf", TextContent: "并发", PageStart: 2, SectionPath: "语言特性"},
+		{FileMD5: "md5-b", TextContent: "调度"},
+	})
+	if !strings.Contains(prompt, "[1] (go.pdf, 第 2 页, 语言特性) 并发") || !strings.Contains(prompt, "[2] (md5-b) 调度") {
+		t.Fatalf("expected built-in prompt to label sources like the template path, got %s", prompt)
+	}
 }
 
 func TestChatServiceStreamResponseNoSearchResult(t *testing.T) {
@@ -147,7 +265,7 @@ func TestChatServiceStreamResponseNoSearchResult(t *testing.T) {
 	})
 
 	writer := &fakeChatWriter{}
-	err := svc.StreamResponse(context.Background(), "问题", &model.User{ID: 1}, writer, func() bool { return false })
+	err := svc.StreamResponse(context.Background(), "问题", "", nil, &model.User{ID: 1}, writer, func() bool { return false })
 	if err != nil {
 		t.Fatalf("StreamResponse() error = %v", err)
 	}
@@ -161,6 +279,9 @@ func TestChatServiceStreamResponseNoSearchResult(t *testing.T) {
 	if len(conversationRepo.savedHistory) != 2 {
 		t.Fatalf("unexpected saved history: %+v", conversationRepo.savedHistory)
 	}
+	if len(writer.references) != 0 || conversationRepo.savedHistory[1].References != nil {
+		t.Fatalf("expected no references without search hits, got %+v", writer.references)
+	}
 }
 
 func TestChatServiceStreamResponseStopped(t *testing.T) {
@@ -178,7 +299,7 @@ func TestChatServiceStreamResponseStopped(t *testing.T) {
 	}, llmClient, conversationRepo, config.LLMConfig{})
 
 	writer := &fakeChatWriter{}
-	err := svc.StreamResponse(context.Background(), "问题", &model.User{ID: 1}, writer, func() bool { return false })
+	err := svc.StreamResponse(context.Background(), "问题", "", nil, &model.User{ID: 1}, writer, func() bool { return false })
 	if err != nil {
 		t.Fatalf("StreamResponse() error = %v", err)
 	}
@@ -190,3 +311,105 @@ func TestChatServiceStreamResponseStopped(t *testing.T) {
 		t.Fatalf("unexpected saved history after stop: %+v", conversationRepo.savedHistory)
 	}
 }
+
+func TestChatServiceStreamResponseExplicitConversation(t *testing.T) {
+	conversationRepo := &fakeConversationRepo{}
+	svc := NewChatService(&fakeChatSearchService{}, &fakeLLMClient{}, conversationRepo, config.LLMConfig{})
+
+	writer := &fakeChatWriter{}
+	if err := svc.StreamResponse(context.Background(), "问题", "conv-owned", nil, &model.User{ID: 1}, writer, nil); err != nil {
+		t.Fatalf("StreamResponse() error = %v", err)
+	}
+	if conversationRepo.currentID != "conv-owned" {
+		t.Fatalf("expected conversation to become current, got %q", conversationRepo.currentID)
+	}
+	if got := writer.payloads[len(writer.payloads)-1]["conversationId"]; got != "conv-owned" {
+		t.Fatalf("unexpected completion conversationId: %q", got)
+	}
+
+	err := svc.StreamResponse(context.Background(), "问题", "conv-other", nil, &model.User{ID: 1}, &fakeChatWriter{}, nil)
+	if !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("expected ErrConversationNotFound, got %v", err)
+	}
+}
+
+func TestChatServiceStreamResponseScope(t *testing.T) {
+	searchSvc := &fakeChatSearchService{}
+	conversationRepo := &fakeConversationRepo{}
+	svc := NewChatService(searchSvc, &fakeLLMClient{}, conversationRepo, config.LLMConfig{})
+	ctx := context.Background()
+	user := &model.User{ID: 1}
+
+	scope := &model.ChatScope{FileMD5s: []string{" md5-a ", "md5-a", "md5-b"}, FolderID: 3}
+	if err := svc.StreamResponse(ctx, "问题", "", scope, user, &fakeChatWriter{}, nil); err != nil {
+		t.Fatalf("StreamResponse() error = %v", err)
+	}
+	if conversationRepo.scopeUpdates != 1 || conversationRepo.scope == nil || len(conversationRepo.scope.FileMD5s) != 2 {
+		t.Fatalf("expected normalized scope saved on the conversation, got %+v", conversationRepo.scope)
+	}
+	if searchSvc.filter.Scope == nil || searchSvc.filter.Scope.FolderID != 3 {
+		t.Fatalf("expected scope passed to search, got %+v", searchSvc.filter)
+	}
+	if conversationRepo.savedHistory[0].Scope == nil || conversationRepo.savedHistory[0].Scope.FolderID != 3 {
+		t.Fatalf("expected scope recorded on the user message, got %+v", conversationRepo.savedHistory[0])
+	}
+
+	// 未指定范围时沿用会话范围，且不重复保存。
+	searchSvc.filter = SearchFilter{}
+	if err := svc.StreamResponse(ctx, "追问", "", nil, user, &fakeChatWriter{}, nil); err != nil {
+		t.Fatalf("StreamResponse() error = %v", err)
+	}
+	if conversationRepo.scopeUpdates != 1 || searchSvc.filter.Scope == nil || searchSvc.filter.Scope.FolderID != 3 {
+		t.Fatalf("expected conversation scope reused, updates=%d filter=%+v", conversationRepo.scopeUpdates, searchSvc.filter)
+	}
+
+	// 空范围取消限定。
+	if err := svc.StreamResponse(ctx, "问题", "", &model.ChatScope{}, user, &fakeChatWriter{}, nil); err != nil {
+		t.Fatalf("StreamResponse() error = %v", err)
+	}
+	if conversationRepo.scopeUpdates != 2 || conversationRepo.scope != nil || searchSvc.filter.Scope != nil {
+		t.Fatalf("expected scope cleared, got %+v", conversationRepo.scope)
+	}
+}
+
+func TestChatServiceStreamResponseScope_ForbiddenFolderNotSaved(t *testing.T) {
+	searchSvc := &fakeChatSearchService{validateErr: ErrFolderNotFound}
+	conversationRepo := &fakeConversationRepo{scope: &model.ChatScope{FolderID: 3}}
+	svc := NewChatService(searchSvc, &fakeLLMClient{}, conversationRepo, config.LLMConfig{})
+
+	err := svc.StreamResponse(context.Background(), "问题", "", &model.ChatScope{FolderID: 9}, &model.User{ID: 1}, &fakeChatWriter{}, nil)
+	if !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("expected ErrFolderNotFound, got %v", err)
+	}
+	if len(searchSvc.validated) != 1 || searchSvc.validated[0].FolderID != 9 {
+		t.Fatalf("expected new scope validated, got %+v", searchSvc.validated)
+	}
+	if conversationRepo.scopeUpdates != 0 || conversationRepo.scope.FolderID != 3 {
+		t.Fatalf("expected conversation scope untouched, updates=%d scope=%+v", conversationRepo.scopeUpdates, conversationRepo.scope)
+	}
+}
+
+func TestChatServiceCondenseQuestionFallback(t *testing.T) {
+	svc := &chatService{llmClient: &fakeLLMClient{
+		streamChatFn: func(ctx context.Context, messages []llm.Message, writer llm.MessageWriter) error {
+			return errors.New("llm down")
+		},
+	}}
+
+	memory := conversationMemory{recent: []model.ChatMessage{{Role: "user", Content: "列出三种排序算法"}}}
+	if got := svc.condenseQuestion(context.Background(), "第二个呢？", memory); got != "第二个呢？" {
+		t.Fatalf("expected fallback to original question, got %q", got)
+	}
+	if got := svc.condenseQuestion(context.Background(), "第二个呢？", conversationMemory{}); got != "第二个呢？" {
+		t.Fatalf("expected original question without history, got %q", got)
+	}
+}
+
+func TestNormalizeRewrittenQuery(t *testing.T) {
+	if got := normalizeRewrittenQuery("改写后的问题：“快速排序的时间复杂度是多少？”\n说明：..."); got != "快速排序的时间复杂度是多少？" {
+		t.Fatalf("unexpected normalized query: %q", got)
+	}
+	if got := normalizeRewrittenQuery(strings.Repeat("长", maxRewrittenQueryLength+1)); got != "" {
+		t.Fatalf("expected overlong rewrite to be rejected, got %q", got)
+	}
+}
@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
 	"sort"
+	"strings"
 	"time"
 
 	"pai_smart_go_v2/internal/model"
@@ -10,6 +12,11 @@ import (
 	"pai_smart_go_v2/pkg/log"
 )
 
+const maxConversationTitleLength = 100
+
+// ErrConversationNotFound 表示会话不存在或不属于当前用户。
+var ErrConversationNotFound = errors.New("conversation not found")
+
 type ConversationAdminFilter struct {
 	UserID    *uint
 	StartTime *time.Time
@@ -30,7 +37,14 @@ type conversationUserFinder interface {
 }
 
 type ConversationService interface {
-	GetConversationHistory(ctx context.Context, userID uint) ([]model.ChatMessage, error)
+	// GetConversationHistory 返回指定会话的完整历史；conversationID 为空时返回当前会话。
+	GetConversationHistory(ctx context.Context, userID uint, conversationID string) ([]model.ChatMessage, error)
+	ListConversations(ctx context.Context, userID uint) ([]model.Conversation, error)
+	// CreateConversation 新建会话并切换为当前会话。
+	CreateConversation(ctx context.Context, userID uint, title string) (*model.Conversation, error)
+	RenameConversation(ctx context.Context, userID uint, conversationID string, title string) (*model.Conversation, error)
+	SwitchConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error)
+	DeleteConversation(ctx context.Context, userID uint, conversationID string) error
 	GetAllConversations(ctx context.Context, filter ConversationAdminFilter) ([]ConversationAdminRecord, error)
 }
 
@@ -43,7 +57,7 @@ func NewConversationService(repo repository.ConversationRepository, userFinder c
 	return &conversationService{repo: repo, userFinder: userFinder}
 }
 
-func (s *conversationService) GetConversationHistory(ctx context.Context, userID uint) ([]model.ChatMessage, error) {
+func (s *conversationService) GetConversationHistory(ctx context.Context, userID uint, conversationID string) ([]model.ChatMessage, error) {
 	if s.repo == nil {
 		return nil, ErrServiceUnavailable
 	}
@@ -51,21 +65,121 @@ func (s *conversationService) GetConversationHistory(ctx context.Context, userID
 		return nil, ErrInvalidInput
 	}
 
-	conversationID, err := s.repo.GetConversationID(ctx, userID)
+	conversationID = strings.TrimSpace(conversationID)
+	if conversationID == "" {
+		currentID, err := s.repo.GetConversationID(ctx, userID)
+		if err != nil {
+			log.Errorf("GetConversationHistory: get conversation id failed: %v", err)
+			return nil, ErrInternal
+		}
+		if currentID == "" {
+			return []model.ChatMessage{}, nil
+		}
+		conversationID = currentID
+	} else if _, err := s.getOwnedConversation(ctx, userID, conversationID); err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.GetConversationTranscript(ctx, conversationID)
 	if err != nil {
-		log.Errorf("GetConversationHistory: get conversation id failed: %v", err)
+		log.Errorf("GetConversationHistory: get transcript failed: %v", err)
 		return nil, ErrInternal
 	}
-	if conversationID == "" {
-		return []model.ChatMessage{}, nil
+	return history, nil
+}
+
+func (s *conversationService) ListConversations(ctx context.Context, userID uint) ([]model.Conversation, error) {
+	if s.repo == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if userID == 0 {
+		return nil, ErrInvalidInput
 	}
 
-	history, err := s.repo.GetConversationHistory(ctx, conversationID)
+	conversations, err := s.repo.ListConversations(ctx, userID)
 	if err != nil {
-		log.Errorf("GetConversationHistory: get history failed: %v", err)
+		log.Errorf("ListConversations: list conversations failed: %v", err)
 		return nil, ErrInternal
 	}
-	return history, nil
+	return conversations, nil
+}
+
+func (s *conversationService) CreateConversation(ctx context.Context, userID uint, title string) (*model.Conversation, error) {
+	if s.repo == nil {
+		return nil, ErrServiceUnavailable
+	}
+	title, err := normalizeConversationTitle(title)
+	if err != nil || userID == 0 {
+		return nil, ErrInvalidInput
+	}
+
+	conversation, err := s.repo.CreateConversation(ctx, userID, title)
+	if err != nil {
+		log.Errorf("CreateConversation: create conversation failed: %v", err)
+		return nil, ErrInternal
+	}
+	if err := s.repo.SetCurrentConversationID(ctx, userID, conversation.ID); err != nil {
+		log.Errorf("CreateConversation: switch to new conversation failed: %v", err)
+		return nil, ErrInternal
+	}
+	return conversation, nil
+}
+
+func (s *conversationService) RenameConversation(ctx context.Context, userID uint, conversationID string, title string) (*model.Conversation, error) {
+	if s.repo == nil {
+		return nil, ErrServiceUnavailable
+	}
+	title, err := normalizeConversationTitle(title)
+	if err != nil || userID == 0 || title == "" {
+		return nil, ErrInvalidInput
+	}
+
+	conversation, err := s.repo.RenameConversation(ctx, userID, strings.TrimSpace(conversationID), title)
+	if err != nil {
+		return nil, mapConversationRepoError("RenameConversation", err)
+	}
+	return conversation, nil
+}
+
+func (s *conversationService) SwitchConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error) {
+	if s.repo == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if userID == 0 {
+		return nil, ErrInvalidInput
+	}
+
+	conversation, err := s.getOwnedConversation(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetCurrentConversationID(ctx, userID, conversation.ID); err != nil {
+		log.Errorf("SwitchConversation: set current conversation failed: %v", err)
+		return nil, ErrInternal
+	}
+	return conversation, nil
+}
+
+func (s *conversationService) DeleteConversation(ctx context.Context, userID uint, conversationID string) error {
+	if s.repo == nil {
+		return ErrServiceUnavailable
+	}
+	if userID == 0 {
+		return ErrInvalidInput
+	}
+
+	if err := s.repo.DeleteConversation(ctx, userID, strings.TrimSpace(conversationID)); err != nil {
+		return mapConversationRepoError("DeleteConversation", err)
+	}
+	return nil
+}
+
+func (s *conversationService) getOwnedConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error) {
+	conversation, err := s.repo.GetConversation(ctx, userID, strings.TrimSpace(conversationID))
+	if err != nil {
+		return nil, mapConversationRepoError("getOwnedConversation", err)
+	}
+	return conversation, nil
 }
 
 func (s *conversationService) GetAllConversations(ctx context.Context, filter ConversationAdminFilter) ([]ConversationAdminRecord, error) {
@@ -76,19 +190,21 @@ func (s *conversationService) GetAllConversations(ctx context.Context, filter Co
 		return nil, ErrInvalidInput
 	}
 
-	mappings := make(map[uint]string)
+	mappings := make(map[uint][]string)
 	if filter.UserID != nil {
-		conversationID, err := s.repo.GetConversationID(ctx, *filter.UserID)
+		conversations, err := s.repo.ListConversations(ctx, *filter.UserID)
 		if err != nil {
-			log.Errorf("GetAllConversations: get conversation id by user failed: %v", err)
+			log.Errorf("GetAllConversations: list conversations by user failed: %v", err)
 			return nil, ErrInternal
 		}
-		if conversationID == "" {
+		if len(conversations) == 0 {
 			return []ConversationAdminRecord{}, nil
 		}
-		mappings[*filter.UserID] = conversationID
+		for _, conversation := range conversations {
+			mappings[*filter.UserID] = append(mappings[*filter.UserID], conversation.ID)
+		}
 	} else {
-		allMappings, err := s.repo.GetAllUserConversationMappings(ctx)
+		allMappings, err := s.repo.GetAllUserConversationIDs(ctx)
 		if err != nil {
 			log.Errorf("GetAllConversations: get all mappings failed: %v", err)
 			return nil, ErrInternal
@@ -97,32 +213,35 @@ func (s *conversationService) GetAllConversations(ctx context.Context, filter Co
 	}
 
 	records := make([]ConversationAdminRecord, 0)
-	for userID, conversationID := range mappings {
+	for userID, conversationIDs := range mappings {
 		user, err := s.userFinder.FindByID(userID)
 		if err != nil || user == nil {
 			continue
 		}
 
-		history, err := s.repo.GetConversationHistory(ctx, conversationID)
-		if err != nil {
-			continue
-		}
-
-		for _, message := range history {
-			if filter.StartTime != nil && message.CreatedAt.Before(*filter.StartTime) {
+		for _, conversationID := range conversationIDs {
+			history, err := s.repo.GetConversationTranscript(ctx, conversationID)
+			if err != nil {
+				log.Errorf("GetAllConversations: get transcript failed: conversation_id=%s err=%v", conversationID, err)
 				continue
 			}
-			if filter.EndTime != nil && message.CreatedAt.After(*filter.EndTime) {
-				continue
+
+			for _, message := range history {
+				if filter.StartTime != nil && message.CreatedAt.Before(*filter.StartTime) {
+					continue
+				}
+				if filter.EndTime != nil && message.CreatedAt.After(*filter.EndTime) {
+					continue
+				}
+				records = append(records, ConversationAdminRecord{
+					ConversationID: conversationID,
+					UserID:         userID,
+					Username:       user.Username,
+					Role:           message.Role,
+					Content:        message.Content,
+					CreatedAt:      message.CreatedAt,
+				})
 			}
-			records = append(records, ConversationAdminRecord{
-				ConversationID: conversationID,
-				UserID:         userID,
-				Username:       user.Username,
-				Role:           message.Role,
-				Content:        message.Content,
-				CreatedAt:      message.CreatedAt,
-			})
 		}
 	}
 
@@ -131,3 +250,19 @@ func (s *conversationService) GetAllConversations(ctx context.Context, filter Co
 	})
 	return records, nil
 }
+
+func normalizeConversationTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if len([]rune(title)) > maxConversationTitleLength {
+		return "", ErrInvalidInput
+	}
+	return title, nil
+}
+
+func mapConversationRepoError(operation string, err error) error {
+	if errors.Is(err, repository.ErrConversationNotFound) {
+		return ErrConversationNotFound
+	}
+	log.Errorf("%s: conversation repository failed: %v", operation, err)
+	return ErrInternal
+}
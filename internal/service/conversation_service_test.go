@@ -2,18 +2,25 @@ package service
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
 )
 
 type fakeConversationRepository struct {
 	getConversationIDFn             func(ctx context.Context, userID uint) (string, error)
 	getOrCreateConversationIDFn     func(ctx context.Context, userID uint) (string, error)
-	getConversationHistoryFn        func(ctx context.Context, conversationID string) ([]model.ChatMessage, error)
-	updateConversationHistoryFn     func(ctx context.Context, conversationID string, messages []model.ChatMessage) error
+	setCurrentConversationIDFn      func(ctx context.Context, userID uint, conversationID string) error
+	createConversationFn            func(ctx context.Context, userID uint, title string) (*model.Conversation, error)
+	getConversationFn               func(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error)
+	listConversationsFn             func(ctx context.Context, userID uint) ([]model.Conversation, error)
+	getConversationTranscriptFn     func(ctx context.Context, conversationID string) ([]model.ChatMessage, error)
+	appendConversationMessagesFn    func(ctx context.Context, conversationID string, messages []model.ChatMessage) error
 	getAllUserConversationMappingsFn func(ctx context.Context) (map[uint]string, error)
+	getAllUserConversationIDsFn      func(ctx context.Context) (map[uint][]string, error)
 }
 
 func (f *fakeConversationRepository) GetConversationID(ctx context.Context, userID uint) (string, error) {
@@ -30,20 +37,78 @@ func (f *fakeConversationRepository) GetOrCreateConversationID(ctx context.Conte
 	return "", nil
 }
 
+func (f *fakeConversationRepository) SetCurrentConversationID(ctx context.Context, userID uint, conversationID string) error {
+	if f.setCurrentConversationIDFn != nil {
+		return f.setCurrentConversationIDFn(ctx, userID, conversationID)
+	}
+	return nil
+}
+
+func (f *fakeConversationRepository) CreateConversation(ctx context.Context, userID uint, title string) (*model.Conversation, error) {
+	if f.createConversationFn != nil {
+		return f.createConversationFn(ctx, userID, title)
+	}
+	return &model.Conversation{ID: "conv-new", UserID: userID, Title: title}, nil
+}
+
+func (f *fakeConversationRepository) GetConversation(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error) {
+	if f.getConversationFn != nil {
+		return f.getConversationFn(ctx, userID, conversationID)
+	}
+	return &model.Conversation{ID: conversationID, UserID: userID}, nil
+}
+
+func (f *fakeConversationRepository) ListConversations(ctx context.Context, userID uint) ([]model.Conversation, error) {
+	if f.listConversationsFn != nil {
+		return f.listConversationsFn(ctx, userID)
+	}
+	return []model.Conversation{}, nil
+}
+
+func (f *fakeConversationRepository) RenameConversation(ctx context.Context, userID uint, conversationID string, title string) (*model.Conversation, error) {
+	conversation, err := f.GetConversation(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	conversation.Title = title
+	return conversation, nil
+}
+
+func (f *fakeConversationRepository) DeleteConversation(ctx context.Context, userID uint, conversationID string) error {
+	_, err := f.GetConversation(ctx, userID, conversationID)
+	return err
+}
+
 func (f *fakeConversationRepository) GetConversationHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
-	if f.getConversationHistoryFn != nil {
-		return f.getConversationHistoryFn(ctx, conversationID)
+	return []model.ChatMessage{}, nil
+}
+
+func (f *fakeConversationRepository) GetConversationTranscript(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
+	if f.getConversationTranscriptFn != nil {
+		return f.getConversationTranscriptFn(ctx, conversationID)
 	}
 	return []model.ChatMessage{}, nil
 }
 
-func (f *fakeConversationRepository) UpdateConversationHistory(ctx context.Context, conversationID string, messages []model.ChatMessage) error {
-	if f.updateConversationHistoryFn != nil {
-		return f.updateConversationHistoryFn(ctx, conversationID, messages)
+func (f *fakeConversationRepository) AppendConversationMessages(ctx context.Context, conversationID string, messages []model.ChatMessage) error {
+	if f.appendConversationMessagesFn != nil {
+		return f.appendConversationMessagesFn(ctx, conversationID, messages)
 	}
 	return nil
 }
 
+func (f *fakeConversationRepository) UpdateConversationSummary(ctx context.Context, conversationID string, summary string, summarizedUntilID uint) error {
+	return nil
+}
+
+func (f *fakeConversationRepository) UpdateConversationScope(ctx context.Context, conversationID string, scope *model.ChatScope) error {
+	return nil
+}
+
+func (f *fakeConversationRepository) BackfillFromRedis(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
 func (f *fakeConversationRepository) GetAllUserConversationMappings(ctx context.Context) (map[uint]string, error) {
 	if f.getAllUserConversationMappingsFn != nil {
 		return f.getAllUserConversationMappingsFn(ctx)
@@ -51,6 +116,13 @@ func (f *fakeConversationRepository) GetAllUserConversationMappings(ctx context.
 	return map[uint]string{}, nil
 }
 
+func (f *fakeConversationRepository) GetAllUserConversationIDs(ctx context.Context) (map[uint][]string, error) {
+	if f.getAllUserConversationIDsFn != nil {
+		return f.getAllUserConversationIDsFn(ctx)
+	}
+	return map[uint][]string{}, nil
+}
+
 type fakeConversationUserFinder struct {
 	findByIDFn func(userID uint) (*model.User, error)
 }
@@ -69,14 +141,14 @@ func TestConversationService_GetConversationHistory(t *testing.T) {
 			getConversationIDFn: func(ctx context.Context, userID uint) (string, error) {
 				return "conv-1", nil
 			},
-			getConversationHistoryFn: func(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
+			getConversationTranscriptFn: func(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
 				return []model.ChatMessage{{Role: "user", Content: "hello", CreatedAt: now}}, nil
 			},
 		},
 		&fakeConversationUserFinder{},
 	)
 
-	history, err := svc.GetConversationHistory(context.Background(), 3)
+	history, err := svc.GetConversationHistory(context.Background(), 3, "")
 	if err != nil {
 		t.Fatalf("GetConversationHistory() error = %v", err)
 	}
@@ -93,10 +165,10 @@ func TestConversationService_GetAllConversations_Filter(t *testing.T) {
 
 	svc := NewConversationService(
 		&fakeConversationRepository{
-			getConversationIDFn: func(ctx context.Context, userID uint) (string, error) {
-				return "conv-9", nil
+			listConversationsFn: func(ctx context.Context, userID uint) ([]model.Conversation, error) {
+				return []model.Conversation{{ID: "conv-9", UserID: userID}}, nil
 			},
-			getConversationHistoryFn: func(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
+			getConversationTranscriptFn: func(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
 				return []model.ChatMessage{
 					{Role: "user", Content: "keep", CreatedAt: inRange},
 					{Role: "assistant", Content: "drop", CreatedAt: outOfRange},
@@ -123,3 +195,70 @@ func TestConversationService_GetAllConversations_Filter(t *testing.T) {
 		t.Fatalf("unexpected records: %+v", records)
 	}
 }
+
+func TestConversationService_GetConversationHistory_ForeignConversation(t *testing.T) {
+	svc := NewConversationService(
+		&fakeConversationRepository{
+			getConversationFn: func(ctx context.Context, userID uint, conversationID string) (*model.Conversation, error) {
+				return nil, repository.ErrConversationNotFound
+			},
+		},
+		&fakeConversationUserFinder{},
+	)
+
+	_, err := svc.GetConversationHistory(context.Background(), 3, "conv-other")
+	if !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("expected ErrConversationNotFound, got %v", err)
+	}
+}
+
+func TestConversationService_CreateConversation_SwitchesCurrent(t *testing.T) {
+	var currentID string
+	svc := NewConversationService(
+		&fakeConversationRepository{
+			setCurrentConversationIDFn: func(ctx context.Context, userID uint, conversationID string) error {
+				currentID = conversationID
+				return nil
+			},
+		},
+		&fakeConversationUserFinder{},
+	)
+
+	conversation, err := svc.CreateConversation(context.Background(), 5, "  项目 A  ")
+	if err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+	if conversation.Title != "项目 A" || currentID != conversation.ID {
+		t.Fatalf("unexpected conversation=%+v current=%q", conversation, currentID)
+	}
+
+	longTitle := make([]rune, maxConversationTitleLength+1)
+	for i := range longTitle {
+		longTitle[i] = '长'
+	}
+	if _, err := svc.CreateConversation(context.Background(), 5, string(longTitle)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput for long title, got %v", err)
+	}
+}
+
+func TestConversationService_GetAllConversations_MultipleConversations(t *testing.T) {
+	svc := NewConversationService(
+		&fakeConversationRepository{
+			getAllUserConversationIDsFn: func(ctx context.Context) (map[uint][]string, error) {
+				return map[uint][]string{4: {"conv-a", "conv-b"}}, nil
+			},
+			getConversationTranscriptFn: func(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
+				return []model.ChatMessage{{Role: "user", Content: conversationID}}, nil
+			},
+		},
+		&fakeConversationUserFinder{},
+	)
+
+	records, err := svc.GetAllConversations(context.Background(), ConversationAdminFilter{})
+	if err != nil {
+		t.Fatalf("GetAllConversations() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected records from both conversations, got %+v", records)
+	}
+}
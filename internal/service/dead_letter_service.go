@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/log"
+	"pai_smart_go_v2/pkg/tasks"
+
+	"gorm.io/gorm"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetterProducer 抽象了死信 topic 的投递能力（如 Kafka producer）。
+type DeadLetterProducer interface {
+	ProduceDeadLetter(ctx context.Context, deadLetter tasks.DeadLetterTask) error
+}
+
+// DeadLetterList 是死信列表分页结果。
+type DeadLetterList struct {
+	Items []model.FileTaskDeadLetter `json:"items"`
+	Total int64                      `json:"total"`
+}
+
+// DeadLetterService 负责记录超过重试上限的文件处理任务，并提供管理员查询与重放。
+type DeadLetterService interface {
+	// HandleDeadLetter 由 Kafka consumer 调用：先写死信 topic，再落 MySQL 记录。
+	HandleDeadLetter(ctx context.Context, deadLetter tasks.DeadLetterTask) error
+	ListDeadLetters(ctx context.Context, filter repository.DeadLetterFilter) (*DeadLetterList, error)
+	GetDeadLetter(ctx context.Context, id uint) (*model.FileTaskDeadLetter, error)
+	// ReplayDeadLetter 把原始任务重新投递到处理 topic，并把文件处理状态重置为 pending。
+	ReplayDeadLetter(ctx context.Context, id uint) (*model.FileTaskDeadLetter, error)
+}
+
+type deadLetterService struct {
+	deadLetterRepo repository.DeadLetterRepository
+	uploadRepo     repository.UploadRepository
+	dlqProducer    DeadLetterProducer
+	taskProducer   TaskProducer
+}
+
+func NewDeadLetterService(
+	deadLetterRepo repository.DeadLetterRepository,
+	uploadRepo repository.UploadRepository,
+	dlqProducer DeadLetterProducer,
+	taskProducer TaskProducer,
+) DeadLetterService {
+	return &deadLetterService{
+		deadLetterRepo: deadLetterRepo,
+		uploadRepo:     uploadRepo,
+		dlqProducer:    dlqProducer,
+		taskProducer:   taskProducer,
+	}
+}
+
+func (s *deadLetterService) HandleDeadLetter(ctx context.Context, deadLetter tasks.DeadLetterTask) error {
+	if s.deadLetterRepo == nil || s.dlqProducer == nil {
+		return ErrServiceUnavailable
+	}
+
+	if err := s.dlqProducer.ProduceDeadLetter(ctx, deadLetter); err != nil {
+		return err
+	}
+
+	task := deadLetter.Task
+	record := &model.FileTaskDeadLetter{
+		FileMD5:     task.FileMD5,
+		FileName:    task.FileName,
+		UserID:      task.UserID,
+		OrgTag:      task.OrgTag,
+		IsPublic:    task.IsPublic,
+		ObjectKey:   task.ObjectKey,
+		Error:       deadLetter.Error,
+		Attempts:    deadLetter.Attempts,
+		SourceTopic: deadLetter.SourceTopic,
+		Partition:   deadLetter.Partition,
+		Offset:      deadLetter.Offset,
+		EnqueuedAt:  deadLetter.EnqueuedAt,
+		FailedAt:    deadLetter.FailedAt,
+		Status:      model.DeadLetterStatusPending,
+	}
+	return s.deadLetterRepo.Create(record)
+}
+
+func (s *deadLetterService) ListDeadLetters(ctx context.Context, filter repository.DeadLetterFilter) (*DeadLetterList, error) {
+	if s.deadLetterRepo == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if status := strings.TrimSpace(filter.Status); status != "" &&
+		status != model.DeadLetterStatusPending && status != model.DeadLetterStatusReplayed {
+		return nil, ErrInvalidInput
+	}
+
+	items, total, err := s.deadLetterRepo.List(filter)
+	if err != nil {
+		log.Errorf("ListDeadLetters: query failed: %v", err)
+		return nil, ErrInternal
+	}
+	return &DeadLetterList{Items: items, Total: total}, nil
+}
+
+func (s *deadLetterService) GetDeadLetter(ctx context.Context, id uint) (*model.FileTaskDeadLetter, error) {
+	if s.deadLetterRepo == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if id == 0 {
+		return nil, ErrInvalidInput
+	}
+
+	record, err := s.deadLetterRepo.FindByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeadLetterNotFound
+		}
+		log.Errorf("GetDeadLetter: query failed: %v", err)
+		return nil, ErrInternal
+	}
+	return record, nil
+}
+
+func (s *deadLetterService) ReplayDeadLetter(ctx context.Context, id uint) (*model.FileTaskDeadLetter, error) {
+	if s.taskProducer == nil || s.uploadRepo == nil {
+		return nil, ErrServiceUnavailable
+	}
+
+	record, err := s.GetDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	task := tasks.FileProcessingTask{
+		FileMD5:   record.FileMD5,
+		FileName:  record.FileName,
+		UserID:    record.UserID,
+		OrgTag:    record.OrgTag,
+		IsPublic:  record.IsPublic,
+		ObjectKey: record.ObjectKey,
+	}
+	// 文档版本和所在文件夹可能在进入死信后发生变化，以当前上传记录为准；上传记录已删除时不再重放。
+	upload, err := s.uploadRepo.FindByFileMD5AndUserID(record.FileMD5, record.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFileNotFound
+		}
+		log.Errorf("ReplayDeadLetter: query upload failed: md5=%s user=%d err=%v", record.FileMD5, record.UserID, err)
+		return nil, ErrInternal
+	}
+	task.DocumentID = upload.DocumentID
+	task.FolderID = upload.FolderID
+
+	// 投递失败时恢复原状态，避免文件一直停在 pending。
+	previousStatus := upload.ProcessingStatus
+	if err := s.uploadRepo.UpdateFileProcessingStatus(task.FileMD5, task.UserID, model.FileProcessingStatusPending); err != nil {
+		log.Errorf("ReplayDeadLetter: reset processing status failed: %v", err)
+		return nil, ErrInternal
+	}
+	if err := s.taskProducer.ProduceFileTask(ctx, task); err != nil {
+		log.Errorf("ReplayDeadLetter: produce task failed: %v", err)
+		if previousStatus != "" {
+			if restoreErr := s.uploadRepo.UpdateFileProcessingStatus(task.FileMD5, task.UserID, previousStatus); restoreErr != nil {
+				log.Errorf("ReplayDeadLetter: restore processing status failed: md5=%s user=%d err=%v", task.FileMD5, task.UserID, restoreErr)
+			}
+		}
+		return nil, ErrInternal
+	}
+
+	now := time.Now()
+	if err := s.deadLetterRepo.MarkReplayed(record.ID, now); err != nil {
+		log.Errorf("ReplayDeadLetter: mark replayed failed: id=%d err=%v", record.ID, err)
+		return nil, ErrInternal
+	}
+	record.Status = model.DeadLetterStatusReplayed
+	record.ReplayCount++
+	record.ReplayedAt = &now
+
+	log.Infof("ReplayDeadLetter: 已重新投递死信任务: id=%d md5=%s", record.ID, record.FileMD5)
+	return record, nil
+}
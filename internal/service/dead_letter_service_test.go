@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/tasks"
+
+	"gorm.io/gorm"
+)
+
+type fakeDeadLetterRepo struct {
+	created     []*model.FileTaskDeadLetter
+	records     map[uint]*model.FileTaskDeadLetter
+	lastFilter  repository.DeadLetterFilter
+	replayedIDs []uint
+	createErr   error
+	markErr     error
+}
+
+func (f *fakeDeadLetterRepo) Create(deadLetter *model.FileTaskDeadLetter) error {
+	if f.createErr != nil {
+		return f.createErr
+	}
+	f.created = append(f.created, deadLetter)
+	return nil
+}
+
+func (f *fakeDeadLetterRepo) List(filter repository.DeadLetterFilter) ([]model.FileTaskDeadLetter, int64, error) {
+	f.lastFilter = filter
+	items := make([]model.FileTaskDeadLetter, 0, len(f.records))
+	for _, record := range f.records {
+		items = append(items, *record)
+	}
+	return items, int64(len(items)), nil
+}
+
+func (f *fakeDeadLetterRepo) FindByID(id uint) (*model.FileTaskDeadLetter, error) {
+	record, ok := f.records[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (f *fakeDeadLetterRepo) MarkReplayed(id uint, replayedAt time.Time) error {
+	if f.markErr != nil {
+		return f.markErr
+	}
+	f.replayedIDs = append(f.replayedIDs, id)
+	return nil
+}
+
+type fakeDeadLetterProducer struct {
+	err      error
+	produced []tasks.DeadLetterTask
+}
+
+func (f *fakeDeadLetterProducer) ProduceDeadLetter(ctx context.Context, deadLetter tasks.DeadLetterTask) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.produced = append(f.produced, deadLetter)
+	return nil
+}
+
+func TestDeadLetterService_HandleDeadLetter(t *testing.T) {
+	repo := &fakeDeadLetterRepo{}
+	producer := &fakeDeadLetterProducer{}
+	svc := NewDeadLetterService(repo, &fakeUploadRepo{}, producer, &fakeTaskProducer{})
+
+	failedAt := time.Now()
+	err := svc.HandleDeadLetter(context.Background(), tasks.DeadLetterTask{
+		Task:        tasks.FileProcessingTask{FileMD5: "md5-a", FileName: "a.pdf", UserID: 3, OrgTag: "team-a", ObjectKey: "uploads/3/md5-a/a.pdf"},
+		Error:       "tika error",
+		Attempts:    3,
+		SourceTopic: "file-processing",
+		Offset:      9,
+		FailedAt:    failedAt,
+	})
+	if err != nil {
+		t.Fatalf("HandleDeadLetter() error = %v", err)
+	}
+	if len(producer.produced) != 1 || len(repo.created) != 1 {
+		t.Fatalf("expected topic publish and record, got produced=%d created=%d", len(producer.produced), len(repo.created))
+	}
+	record := repo.created[0]
+	if record.FileMD5 != "md5-a" || record.ObjectKey != "uploads/3/md5-a/a.pdf" || record.Error != "tika error" ||
+		record.Attempts != 3 || record.Offset != 9 || !record.FailedAt.Equal(failedAt) || record.Status != model.DeadLetterStatusPending {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+}
+
+func TestDeadLetterService_HandleDeadLetter_ProduceFailed(t *testing.T) {
+	repo := &fakeDeadLetterRepo{}
+	svc := NewDeadLetterService(repo, &fakeUploadRepo{}, &fakeDeadLetterProducer{err: errors.New("kafka down")}, &fakeTaskProducer{})
+
+	if err := svc.HandleDeadLetter(context.Background(), tasks.DeadLetterTask{}); err == nil {
+		t.Fatalf("expected produce error")
+	}
+	if len(repo.created) != 0 {
+		t.Fatalf("expected no record when topic publish fails")
+	}
+}
+
+func TestDeadLetterService_ListDeadLetters_InvalidStatus(t *testing.T) {
+	svc := NewDeadLetterService(&fakeDeadLetterRepo{}, &fakeUploadRepo{}, &fakeDeadLetterProducer{}, &fakeTaskProducer{})
+
+	if _, err := svc.ListDeadLetters(context.Background(), repository.DeadLetterFilter{Status: "unknown"}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestDeadLetterService_GetDeadLetter_NotFound(t *testing.T) {
+	svc := NewDeadLetterService(&fakeDeadLetterRepo{}, &fakeUploadRepo{}, &fakeDeadLetterProducer{}, &fakeTaskProducer{})
+
+	if _, err := svc.GetDeadLetter(context.Background(), 7); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("expected ErrDeadLetterNotFound, got %v", err)
+	}
+}
+
+func TestDeadLetterService_ReplayDeadLetter(t *testing.T) {
+	repo := &fakeDeadLetterRepo{records: map[uint]*model.FileTaskDeadLetter{
+		5: {ID: 5, FileMD5: "md5-b", FileName: "b.pdf", UserID: 4, IsPublic: true, ObjectKey: "uploads/4/md5-b/b.pdf", Status: model.DeadLetterStatusPending},
+	}}
+	var resetStatus string
+	uploadRepo := &fakeUploadRepo{
+		findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+			return &model.FileUpload{FileMD5: fileMD5, UserID: userID, DocumentID: "doc-2", FolderID: 3, ProcessingStatus: model.FileProcessingStatusFailed}, nil
+		},
+		updateFileProcessingStatusFn: func(fileMD5 string, userID uint, processingStatus string) error {
+			if fileMD5 != "md5-b" || userID != 4 {
+				t.Fatalf("unexpected status reset target: %s %d", fileMD5, userID)
+			}
+			resetStatus = processingStatus
+			return nil
+		},
+	}
+	taskProducer := &fakeTaskProducer{}
+	svc := NewDeadLetterService(repo, uploadRepo, &fakeDeadLetterProducer{}, taskProducer)
+
+	record, err := svc.ReplayDeadLetter(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("ReplayDeadLetter() error = %v", err)
+	}
+	if taskProducer.called != 1 || taskProducer.lastTask.ObjectKey != "uploads/4/md5-b/b.pdf" || !taskProducer.lastTask.IsPublic || taskProducer.lastTask.DocumentID != "doc-2" || taskProducer.lastTask.FolderID != 3 {
+		t.Fatalf("unexpected replayed task: %+v", taskProducer.lastTask)
+	}
+	if resetStatus != model.FileProcessingStatusPending {
+		t.Fatalf("expected processing status reset to pending, got %q", resetStatus)
+	}
+	if len(repo.replayedIDs) != 1 || record.Status != model.DeadLetterStatusReplayed || record.ReplayCount != 1 || record.ReplayedAt == nil {
+		t.Fatalf("unexpected replay result: %+v", record)
+	}
+}
+
+func TestDeadLetterService_ReplayDeadLetter_ProduceFailed(t *testing.T) {
+	repo := &fakeDeadLetterRepo{records: map[uint]*model.FileTaskDeadLetter{5: {ID: 5, FileMD5: "md5-b", UserID: 4}}}
+	taskProducer := &fakeTaskProducer{produceFn: func(ctx context.Context, task tasks.FileProcessingTask) error {
+		return errors.New("kafka down")
+	}}
+	var statuses []string
+	uploadRepo := &fakeUploadRepo{
+		findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+			return &model.FileUpload{FileMD5: fileMD5, UserID: userID, ProcessingStatus: model.FileProcessingStatusFailed}, nil
+		},
+		updateFileProcessingStatusFn: func(fileMD5 string, userID uint, processingStatus string) error {
+			statuses = append(statuses, processingStatus)
+			return nil
+		},
+	}
+	svc := NewDeadLetterService(repo, uploadRepo, &fakeDeadLetterProducer{}, taskProducer)
+
+	if _, err := svc.ReplayDeadLetter(context.Background(), 5); !errors.Is(err, ErrInternal) {
+		t.Fatalf("expected ErrInternal, got %v", err)
+	}
+	if len(repo.replayedIDs) != 0 {
+		t.Fatalf("expected dead letter not marked replayed")
+	}
+	if len(statuses) != 2 || statuses[0] != model.FileProcessingStatusPending || statuses[1] != model.FileProcessingStatusFailed {
+		t.Fatalf("expected processing status restored after produce failure, got %v", statuses)
+	}
+}
+
+func TestDeadLetterService_ReplayDeadLetter_UploadDeleted(t *testing.T) {
+	repo := &fakeDeadLetterRepo{records: map[uint]*model.FileTaskDeadLetter{5: {ID: 5, FileMD5: "md5-b", UserID: 4}}}
+	taskProducer := &fakeTaskProducer{}
+	svc := NewDeadLetterService(repo, &fakeUploadRepo{}, &fakeDeadLetterProducer{}, taskProducer)
+
+	if _, err := svc.ReplayDeadLetter(context.Background(), 5); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("expected ErrFileNotFound, got %v", err)
+	}
+	if taskProducer.called != 0 || len(repo.replayedIDs) != 0 {
+		t.Fatalf("expected nothing replayed for a deleted upload")
+	}
+}
@@ -2,15 +2,20 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"pai_smart_go_v2/internal/model"
 	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/es"
 	"pai_smart_go_v2/pkg/log"
+	"pai_smart_go_v2/pkg/tasks"
 
 	"github.com/minio/minio-go/v7"
 )
@@ -35,13 +40,65 @@ type PreviewInfoDTO struct {
 	Truncated bool   `json:"truncated"`
 }
 
+// DocumentVersionRef 标识参与比对的一个版本。
+type DocumentVersionRef struct {
+	FileMD5  string `json:"fileMd5"`
+	FileName string `json:"fileName"`
+	Version  int    `json:"version"`
+}
+
+// DocumentVersionDiffDTO 是同一逻辑文档两个版本提取文本的按行差异。
+type DocumentVersionDiffDTO struct {
+	DocumentID string             `json:"documentId"`
+	From       DocumentVersionRef `json:"from"`
+	To         DocumentVersionRef `json:"to"`
+	TextDiff
+}
+
+// ReprocessFailure 记录批量重新处理中投递失败的文件。
+type ReprocessFailure struct {
+	FileMD5 string `json:"fileMd5"`
+	UserID  uint   `json:"userId"`
+}
+
+// ShareGrant 是一条共享授权：UserID 和 OrgTag 只设置一个，Permission 为 read（默认）或 manage。
+type ShareGrant struct {
+	UserID     uint   `json:"userId"`
+	OrgTag     string `json:"orgTag"`
+	Permission string `json:"permission"`
+}
+
+// BulkReprocessResult 是管理员批量重新处理的汇总结果。
+// NextAfterID 是本批最后一条记录的 id，作为下一批请求的 afterId；本批没有匹配时为 0，表示已处理完。
+type BulkReprocessResult struct {
+	Matched     int                `json:"matched"`
+	Enqueued    int                `json:"enqueued"`
+	Failed      []ReprocessFailure `json:"failed"`
+	NextAfterID uint               `json:"nextAfterId"`
+}
+
 const (
 	defaultDocumentDownloadExpiry = time.Hour
 	defaultPreviewContentLimit    = 12000
 )
 
+// 文档标签和自定义元数据的限制；元数据的键会成为 ES 字段路径 custom_metadata.<key>，只允许安全字符。
+const (
+	maxDocumentTags        = 20
+	maxDocumentTagRunes    = 50
+	maxCustomMetadataKeys  = 20
+	maxCustomMetadataValue = 255
+)
+
+// maxDocumentShares 是单个文档的授权条数上限。
+const maxDocumentShares = 100
+
+var customMetadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,50}$`)
+
 type documentUserOrgTagProvider interface {
 	GetUserEffectiveOrgTags(userID uint) ([]model.OrganizationTag, error)
+	// FindByID 用于校验共享授权的被授权用户存在，用户不存在时返回 ErrUserNotFound。
+	FindByID(userID uint) (*model.User, error)
 }
 
 type documentStorage interface {
@@ -56,14 +113,32 @@ type documentTextExtractor interface {
 
 type documentESClient interface {
 	DeleteDocumentsByFileMD5(ctx context.Context, fileMD5 string) error
+	MarkSuperseded(ctx context.Context, fileMD5s []string, userID uint, superseded bool) error
+	SetTags(ctx context.Context, fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error
+	SetSharing(ctx context.Context, fileMD5s []string, userID uint, sharing model.DocumentSharing) error
+	CountDocumentsByOwner(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error)
 }
 
 type DocumentService interface {
 	ListAccessibleFiles(ctx context.Context, user *model.User) ([]FileUploadDTO, error)
 	ListUploadedFiles(ctx context.Context, userID uint) ([]FileUploadDTO, error)
 	DeleteDocument(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) error
+	// ReprocessDocument 将已上传的文件重新投递到处理队列，文件所有者、管理员或拥有 manage 授权的用户可操作。
+	ReprocessDocument(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) (*model.FileUpload, error)
+	// BulkReprocess 按筛选条件批量重新投递文件处理任务，供管理员在更换 embedding 模型等场景使用。
+	BulkReprocess(ctx context.Context, filter repository.ReprocessFilter) (*BulkReprocessResult, error)
 	GenerateDownloadURL(ctx context.Context, fileMD5 string, fileName string, user *model.User) (*DownloadInfoDTO, error)
 	GetFilePreviewContent(ctx context.Context, fileMD5 string, fileName string, user *model.User) (*PreviewInfoDTO, error)
+	// ListDocumentVersions 返回 fileMD5 所属逻辑文档中当前用户可访问的全部版本，按版本号降序。
+	ListDocumentVersions(ctx context.Context, fileMD5 string, user *model.User) ([]FileUploadDTO, error)
+	// DiffDocumentVersions 比对同一逻辑文档两个版本的提取文本。
+	DiffDocumentVersions(ctx context.Context, fromMD5 string, toMD5 string, user *model.User) (*DocumentVersionDiffDTO, error)
+	// UpdateDocumentTags 整体覆盖文档的标签和自定义元数据，同一文档的所有版本一起更新，权限与重新处理相同。
+	UpdateDocumentTags(ctx context.Context, fileMD5 string, tags []string, customMetadata map[string]string, user *model.User, targetUserID *uint) (*model.FileUpload, error)
+	// ListDocumentShares 返回文档当前的共享授权。
+	ListDocumentShares(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) ([]model.DocumentShare, error)
+	// UpdateDocumentShares 整体覆盖文档的共享授权，同一文档的所有版本一起更新，并同步到分块和 ES。
+	UpdateDocumentShares(ctx context.Context, fileMD5 string, grants []ShareGrant, user *model.User, targetUserID *uint) ([]model.DocumentShare, error)
 }
 
 type documentService struct {
@@ -75,6 +150,7 @@ type documentService struct {
 	tikaClient      documentTextExtractor
 	docVectorRepo   repository.DocumentVectorRepository
 	esClient        documentESClient
+	taskProducer    TaskProducer
 }
 
 type minioDocumentStorage struct {
@@ -115,6 +191,7 @@ func NewDocumentService(
 	tikaClient documentTextExtractor,
 	docVectorRepo repository.DocumentVectorRepository,
 	esClient documentESClient,
+	taskProducer TaskProducer,
 ) DocumentService {
 	return &documentService{
 		uploadRepo:      uploadRepo,
@@ -125,6 +202,7 @@ func NewDocumentService(
 		tikaClient:      tikaClient,
 		docVectorRepo:   docVectorRepo,
 		esClient:        esClient,
+		taskProducer:    taskProducer,
 	}
 }
 
@@ -173,7 +251,7 @@ func (s *documentService) DeleteDocument(ctx context.Context, fileMD5 string, us
 		return ErrInvalidInput
 	}
 
-	upload, err := s.resolveDeletionTarget(strings.TrimSpace(fileMD5), user, targetUserID)
+	upload, err := s.resolveManagedUpload("DeleteDocument", strings.TrimSpace(fileMD5), user, targetUserID, false)
 	if err != nil {
 		return err
 	}
@@ -212,21 +290,447 @@ func (s *documentService) DeleteDocument(ctx context.Context, fileMD5 string, us
 		log.Errorf("DeleteDocument: delete chunk infos failed: %v", err)
 		return ErrInternal
 	}
+	if err := s.uploadRepo.ReplaceShares([]string{upload.FileMD5}, upload.UserID, nil); err != nil {
+		log.Errorf("DeleteDocument: delete document shares failed: %v", err)
+		return ErrInternal
+	}
 	if err := s.uploadRepo.DeleteFileUploadRecord(upload.FileMD5, upload.UserID); err != nil {
 		log.Errorf("DeleteDocument: delete upload record failed: %v", err)
 		return ErrInternal
 	}
+	if upload.IsLatest && upload.DocumentID != "" {
+		return s.promotePreviousVersion(ctx, upload)
+	}
 	return nil
 }
 
-func (s *documentService) resolveDeletionTarget(fileMD5 string, user *model.User, targetUserID *uint) (*model.FileUpload, error) {
+// promotePreviousVersion 在删除文档最新版本后，把剩余版本中版本号最高的一个恢复为最新版本并重新纳入默认检索。
+func (s *documentService) promotePreviousVersion(ctx context.Context, deleted *model.FileUpload) error {
+	versions, err := s.uploadRepo.FindDocumentVersions(deleted.DocumentID)
+	if err != nil {
+		log.Errorf("DeleteDocument: list remaining versions failed: document=%s err=%v", deleted.DocumentID, err)
+		return ErrInternal
+	}
+	for _, version := range versions {
+		if version.Status != model.FileUploadStatusUploaded || version.FileMD5 == deleted.FileMD5 {
+			continue
+		}
+		if err := s.uploadRepo.PromoteVersion(version.DocumentID, version.FileMD5, version.UserID); err != nil {
+			log.Errorf("DeleteDocument: promote version failed: document=%s md5=%s err=%v", version.DocumentID, version.FileMD5, err)
+			return ErrInternal
+		}
+		if err := s.esClient.MarkSuperseded(ctx, []string{version.FileMD5}, version.UserID, false); err != nil {
+			log.Errorf("DeleteDocument: restore elasticsearch docs failed: md5=%s err=%v", version.FileMD5, err)
+			return ErrInternal
+		}
+		if err := s.docVectorRepo.MarkSuperseded([]string{version.FileMD5}, version.UserID, false); err != nil {
+			log.Errorf("DeleteDocument: restore document vectors failed: md5=%s err=%v", version.FileMD5, err)
+			return ErrInternal
+		}
+		log.Infof("DeleteDocument: 已将版本 %d 恢复为最新版本: document=%s md5=%s", version.Version, version.DocumentID, version.FileMD5)
+		return nil
+	}
+	return nil
+}
+
+func (s *documentService) ReprocessDocument(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) (*model.FileUpload, error) {
+	if s.uploadRepo == nil || s.taskProducer == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil || strings.TrimSpace(fileMD5) == "" {
+		return nil, ErrInvalidInput
+	}
+
+	upload, err := s.resolveManagedUpload("ReprocessDocument", strings.TrimSpace(fileMD5), user, targetUserID, true)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Status != model.FileUploadStatusUploaded {
+		return nil, fmt.Errorf("%w: file upload is not completed", ErrInvalidInput)
+	}
+
+	if err := s.enqueueReprocess(ctx, upload); err != nil {
+		return nil, ErrInternal
+	}
+	log.Infof("ReprocessDocument: 已重新投递文件处理任务: actor=%d owner=%d md5=%s", user.ID, upload.UserID, upload.FileMD5)
+	return upload, nil
+}
+
+func (s *documentService) UpdateDocumentTags(ctx context.Context, fileMD5 string, tags []string, customMetadata map[string]string, user *model.User, targetUserID *uint) (*model.FileUpload, error) {
+	if s.uploadRepo == nil || s.docVectorRepo == nil || s.esClient == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil || strings.TrimSpace(fileMD5) == "" {
+		return nil, ErrInvalidInput
+	}
+	tags, customMetadata, err := normalizeDocumentTags(tags, customMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, err := s.resolveManagedUpload("UpdateDocumentTags", strings.TrimSpace(fileMD5), user, targetUserID, true)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.documentVersions("UpdateDocumentTags", upload)
+	if err != nil {
+		return nil, err
+	}
+	fileMD5s := uploadFileMD5s(versions)
+	indexedMD5s, err := ownedIndexedMD5s(ctx, "UpdateDocumentTags", s.esClient, upload.UserID, versions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.uploadRepo.UpdateTags(fileMD5s, upload.UserID, tags, customMetadata); err != nil {
+		log.Errorf("UpdateDocumentTags: update upload tags failed: md5s=%v err=%v", fileMD5s, err)
+		return nil, ErrInternal
+	}
+	if err := s.docVectorRepo.UpdateTags(fileMD5s, upload.UserID, tags, customMetadata); err != nil {
+		log.Errorf("UpdateDocumentTags: update document vectors failed: md5s=%v err=%v", fileMD5s, err)
+		return nil, ErrInternal
+	}
+	if err := ownedIndexUpdateError("UpdateDocumentTags", s.esClient.SetTags(ctx, fileMD5s, upload.UserID, tags, customMetadata), fileMD5s, indexedMD5s); err != nil {
+		return nil, err
+	}
+
+	upload.Tags = tags
+	upload.CustomMetadata = customMetadata
+	log.Infof("UpdateDocumentTags: 文档标签已更新: actor=%d owner=%d md5=%s tags=%d metadata=%d versions=%d", user.ID, upload.UserID, upload.FileMD5, len(tags), len(customMetadata), len(fileMD5s))
+	return upload, nil
+}
+
+func (s *documentService) ListDocumentShares(ctx context.Context, fileMD5 string, user *model.User, targetUserID *uint) ([]model.DocumentShare, error) {
+	if s.uploadRepo == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil || strings.TrimSpace(fileMD5) == "" {
+		return nil, ErrInvalidInput
+	}
+
+	upload, err := s.resolveManagedUpload("ListDocumentShares", strings.TrimSpace(fileMD5), user, targetUserID, true)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := s.uploadRepo.FindShares(upload.FileMD5, upload.UserID)
+	if err != nil {
+		log.Errorf("ListDocumentShares: query failed: md5=%s err=%v", upload.FileMD5, err)
+		return nil, ErrInternal
+	}
+	if shares == nil {
+		shares = []model.DocumentShare{}
+	}
+	return shares, nil
+}
+
+func (s *documentService) UpdateDocumentShares(ctx context.Context, fileMD5 string, grants []ShareGrant, user *model.User, targetUserID *uint) ([]model.DocumentShare, error) {
+	if s.uploadRepo == nil || s.orgTagRepo == nil || s.userTagProvider == nil || s.docVectorRepo == nil || s.esClient == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil || strings.TrimSpace(fileMD5) == "" {
+		return nil, ErrInvalidInput
+	}
+
+	upload, err := s.resolveManagedUpload("UpdateDocumentShares", strings.TrimSpace(fileMD5), user, targetUserID, true)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := s.normalizeShareGrants(grants, upload.UserID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.documentVersions("UpdateDocumentShares", upload)
+	if err != nil {
+		return nil, err
+	}
+	fileMD5s := uploadFileMD5s(versions)
+	indexedMD5s, err := ownedIndexedMD5s(ctx, "UpdateDocumentShares", s.esClient, upload.UserID, versions)
+	if err != nil {
+		return nil, err
+	}
+
+	sharing := model.BuildDocumentSharing(shares)
+	if err := s.uploadRepo.ReplaceShares(fileMD5s, upload.UserID, shares); err != nil {
+		log.Errorf("UpdateDocumentShares: replace shares failed: md5s=%v err=%v", fileMD5s, err)
+		return nil, ErrInternal
+	}
+	if err := s.docVectorRepo.UpdateSharing(fileMD5s, upload.UserID, sharing); err != nil {
+		log.Errorf("UpdateDocumentShares: update document vectors failed: md5s=%v err=%v", fileMD5s, err)
+		return nil, ErrInternal
+	}
+	if err := ownedIndexUpdateError("UpdateDocumentShares", s.esClient.SetSharing(ctx, fileMD5s, upload.UserID, sharing), fileMD5s, indexedMD5s); err != nil {
+		return nil, err
+	}
+	log.Infof("UpdateDocumentShares: 文档共享授权已更新: actor=%d owner=%d md5=%s grants=%d versions=%d", user.ID, upload.UserID, upload.FileMD5, len(shares), len(fileMD5s))
+
+	saved, err := s.uploadRepo.FindShares(upload.FileMD5, upload.UserID)
+	if err != nil {
+		log.Errorf("UpdateDocumentShares: reload shares failed: md5=%s err=%v", upload.FileMD5, err)
+		return nil, ErrInternal
+	}
+	if saved == nil {
+		saved = []model.DocumentShare{}
+	}
+	return saved, nil
+}
+
+// normalizeShareGrants 校验授权并转换为待保存的记录：用户和组织标签只能二选一，不能授权给所有者本人，
+// 组织标签必须存在；同一被授权方重复出现时以最高权限为准。
+func (s *documentService) normalizeShareGrants(grants []ShareGrant, ownerID uint, actorID uint) ([]model.DocumentShare, error) {
+	if len(grants) > maxDocumentShares {
+		return nil, fmt.Errorf("%w: at most %d share grants are allowed", ErrInvalidInput, maxDocumentShares)
+	}
+
+	shares := make([]model.DocumentShare, 0, len(grants))
+	index := make(map[string]int, len(grants))
+	var orgTagIDs []string
+	for _, grant := range grants {
+		orgTag := strings.TrimSpace(grant.OrgTag)
+		if (grant.UserID == 0) == (orgTag == "") {
+			return nil, fmt.Errorf("%w: each share grant needs exactly one of userId or orgTag", ErrInvalidInput)
+		}
+		if grant.UserID == ownerID {
+			return nil, fmt.Errorf("%w: cannot share a document with its owner", ErrInvalidInput)
+		}
+		permission := strings.ToLower(strings.TrimSpace(grant.Permission))
+		switch permission {
+		case "":
+			permission = model.SharePermissionRead
+		case model.SharePermissionRead, model.SharePermissionManage:
+		default:
+			return nil, fmt.Errorf("%w: unsupported share permission %q", ErrInvalidInput, grant.Permission)
+		}
+
+		key := fmt.Sprintf("user:%d", grant.UserID)
+		if orgTag != "" {
+			key = "tag:" + orgTag
+		}
+		if i, exists := index[key]; exists {
+			if permission == model.SharePermissionManage {
+				shares[i].Permission = permission
+			}
+			continue
+		}
+		index[key] = len(shares)
+		if orgTag != "" {
+			orgTagIDs = append(orgTagIDs, orgTag)
+		}
+		shares = append(shares, model.DocumentShare{
+			OwnerID:       ownerID,
+			GranteeUserID: grant.UserID,
+			GranteeOrgTag: orgTag,
+			Permission:    permission,
+			CreatedBy:     actorID,
+		})
+	}
+
+	for _, share := range shares {
+		if share.GranteeUserID == 0 {
+			continue
+		}
+		if _, err := s.userTagProvider.FindByID(share.GranteeUserID); err != nil {
+			if errors.Is(err, ErrUserNotFound) {
+				return nil, ErrUserNotFound
+			}
+			log.Errorf("UpdateDocumentShares: find grantee failed: user=%d err=%v", share.GranteeUserID, err)
+			return nil, ErrInternal
+		}
+	}
+	if len(orgTagIDs) > 0 {
+		tags, err := s.orgTagRepo.FindBatchByIDs(orgTagIDs)
+		if err != nil {
+			log.Errorf("UpdateDocumentShares: find org tags failed: tags=%v err=%v", orgTagIDs, err)
+			return nil, ErrInternal
+		}
+		if len(tags) != len(orgTagIDs) {
+			return nil, ErrOrgTagNotFound
+		}
+	}
+	return shares, nil
+}
+
+// documentVersions 返回上传记录所属逻辑文档的全部版本；未归入文档的旧记录只返回自身。
+func (s *documentService) documentVersions(action string, upload *model.FileUpload) ([]model.FileUpload, error) {
+	if upload.DocumentID == "" {
+		return []model.FileUpload{*upload}, nil
+	}
+	versions, err := s.uploadRepo.FindDocumentVersions(upload.DocumentID)
+	if err != nil {
+		log.Errorf("%s: list versions failed: document=%s err=%v", action, upload.DocumentID, err)
+		return nil, ErrInternal
+	}
+	return versions, nil
+}
+
+func uploadFileMD5s(uploads []model.FileUpload) []string {
+	fileMD5s := make([]string, 0, len(uploads))
+	for _, upload := range uploads {
+		fileMD5s = append(fileMD5s, upload.FileMD5)
+	}
+	return fileMD5s
+}
+
+type ownerDocumentCounter interface {
+	CountDocumentsByOwner(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error)
+}
+
+// ownedIndexedMD5s 返回 versions 中已索引的 fileMD5，并确认它们在 ES 中都有记在 ownerID 名下的分块。
+// 相同内容的分块按 fileMD5 共用，最后一次由其他上传者处理时记在对方名下，所有者的更新在 ES 中不会生效，
+// 此时在改动任何数据之前返回 ErrDocumentIndexStale，避免 MySQL 与 ES 的权限和过滤条件不一致。
+func ownedIndexedMD5s(ctx context.Context, action string, counter ownerDocumentCounter, ownerID uint, versions []model.FileUpload) ([]string, error) {
+	indexed := make([]string, 0, len(versions))
+	for _, version := range versions {
+		if version.ProcessingStatus == model.FileProcessingStatusIndexed {
+			indexed = append(indexed, version.FileMD5)
+		}
+	}
+	if len(indexed) == 0 {
+		return indexed, nil
+	}
+
+	counts, err := counter.CountDocumentsByOwner(ctx, indexed, ownerID)
+	if err != nil {
+		log.Errorf("%s: count owner documents failed: owner=%d md5s=%v err=%v", action, ownerID, indexed, err)
+		return nil, ErrInternal
+	}
+	for _, fileMD5 := range indexed {
+		if counts[fileMD5] == 0 {
+			log.Warnf("%s: 已索引版本的分块不在所有者名下: owner=%d md5=%s", action, ownerID, fileMD5)
+			return nil, ErrDocumentIndexStale
+		}
+	}
+	return indexed, nil
+}
+
+// ownedIndexUpdateError 转换 ES 更新的错误：没有匹配到分块时，如果有已索引的版本说明分块已不在所有者名下，
+// 返回 ErrDocumentIndexStale；全部版本都还没有索引时属于正常情况，处理时会从上传记录带上新值。
+func ownedIndexUpdateError(action string, err error, fileMD5s []string, indexedMD5s []string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, es.ErrDocumentsNotIndexed) && len(indexedMD5s) == 0:
+		return nil
+	case errors.Is(err, es.ErrDocumentsNotIndexed):
+		log.Warnf("%s: elasticsearch 中没有所有者名下的分块: md5s=%v err=%v", action, fileMD5s, err)
+		return ErrDocumentIndexStale
+	default:
+		log.Errorf("%s: update elasticsearch docs failed: md5s=%v err=%v", action, fileMD5s, err)
+		return ErrInternal
+	}
+}
+
+// normalizeDocumentTags 去掉标签首尾空白、空标签和重复标签，并校验数量和长度；结果为空时返回 nil 以清空字段。
+func normalizeDocumentTags(tags []string, customMetadata map[string]string) ([]string, map[string]string, error) {
+	var normalizedTags []string
+	seen := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxDocumentTagRunes {
+			return nil, nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidInput, tag, maxDocumentTagRunes)
+		}
+		if _, exists := seen[tag]; exists {
+			continue
+		}
+		seen[tag] = struct{}{}
+		normalizedTags = append(normalizedTags, tag)
+	}
+	if len(normalizedTags) > maxDocumentTags {
+		return nil, nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidInput, maxDocumentTags)
+	}
+
+	if len(customMetadata) > maxCustomMetadataKeys {
+		return nil, nil, fmt.Errorf("%w: at most %d metadata keys are allowed", ErrInvalidInput, maxCustomMetadataKeys)
+	}
+	var normalizedMetadata map[string]string
+	for key, value := range customMetadata {
+		key = strings.TrimSpace(key)
+		if !customMetadataKeyPattern.MatchString(key) {
+			return nil, nil, fmt.Errorf("%w: invalid metadata key %q", ErrInvalidInput, key)
+		}
+		value = strings.TrimSpace(value)
+		if utf8.RuneCountInString(value) > maxCustomMetadataValue {
+			return nil, nil, fmt.Errorf("%w: metadata value of %q is longer than %d characters", ErrInvalidInput, key, maxCustomMetadataValue)
+		}
+		if normalizedMetadata == nil {
+			normalizedMetadata = make(map[string]string, len(customMetadata))
+		}
+		normalizedMetadata[key] = value
+	}
+	return normalizedTags, normalizedMetadata, nil
+}
+
+func (s *documentService) BulkReprocess(ctx context.Context, filter repository.ReprocessFilter) (*BulkReprocessResult, error) {
+	if s.uploadRepo == nil || s.taskProducer == nil {
+		return nil, ErrServiceUnavailable
+	}
+
+	uploads, err := s.uploadRepo.FindReprocessCandidates(filter)
+	if err != nil {
+		log.Errorf("BulkReprocess: query candidates failed: %v", err)
+		return nil, ErrInternal
+	}
+
+	result := &BulkReprocessResult{Matched: len(uploads), Failed: make([]ReprocessFailure, 0)}
+	if len(uploads) > 0 {
+		result.NextAfterID = uploads[len(uploads)-1].ID
+	}
+	for i := range uploads {
+		if err := s.enqueueReprocess(ctx, &uploads[i]); err != nil {
+			result.Failed = append(result.Failed, ReprocessFailure{FileMD5: uploads[i].FileMD5, UserID: uploads[i].UserID})
+			continue
+		}
+		result.Enqueued++
+	}
+	log.Infof("BulkReprocess: matched=%d enqueued=%d failed=%d next_after_id=%d", result.Matched, result.Enqueued, len(result.Failed), result.NextAfterID)
+	return result, nil
+}
+
+// enqueueReprocess 将处理状态重置为 pending 并投递任务；投递失败时恢复原状态，避免文件一直停在 pending。
+func (s *documentService) enqueueReprocess(ctx context.Context, upload *model.FileUpload) error {
+	previousStatus := upload.ProcessingStatus
+	if err := s.uploadRepo.UpdateFileProcessingStatus(upload.FileMD5, upload.UserID, model.FileProcessingStatusPending); err != nil {
+		log.Errorf("enqueueReprocess: reset processing status failed: md5=%s user=%d err=%v", upload.FileMD5, upload.UserID, err)
+		return err
+	}
+
+	task := tasks.FileProcessingTask{
+		FileMD5:    upload.FileMD5,
+		FileName:   upload.FileName,
+		UserID:     upload.UserID,
+		OrgTag:     upload.OrgTag,
+		IsPublic:   upload.IsPublic,
+		ObjectKey:  buildUploadObjectKey(upload.UserID, upload.FileMD5, upload.FileName),
+		DocumentID: upload.DocumentID,
+		FolderID:   upload.FolderID,
+	}
+	if err := s.taskProducer.ProduceFileTask(ctx, task); err != nil {
+		log.Errorf("enqueueReprocess: produce task failed: md5=%s user=%d err=%v", upload.FileMD5, upload.UserID, err)
+		if previousStatus != "" {
+			if restoreErr := s.uploadRepo.UpdateFileProcessingStatus(upload.FileMD5, upload.UserID, previousStatus); restoreErr != nil {
+				log.Errorf("enqueueReprocess: restore processing status failed: md5=%s user=%d err=%v", upload.FileMD5, upload.UserID, restoreErr)
+			}
+		}
+		return err
+	}
+	upload.ProcessingStatus = model.FileProcessingStatusPending
+	upload.ProcessingErrorCode = ""
+	upload.ProcessingErrorMessage = ""
+	return nil
+}
+
+// resolveManagedUpload 定位当前用户可管理（删除、重新处理）的上传记录：
+// 普通用户只能操作自己的文件，allowManagers 时也可以操作以 manage 权限共享给自己的文件；管理员可通过 targetUserID 指定所有者。
+func (s *documentService) resolveManagedUpload(action string, fileMD5 string, user *model.User, targetUserID *uint, allowManagers bool) (*model.FileUpload, error) {
 	lookup := func(ownerUserID uint) (*model.FileUpload, error) {
 		upload, err := s.uploadRepo.FindByFileMD5AndUserID(fileMD5, ownerUserID)
 		if err != nil {
 			if strings.EqualFold(user.Role, "ADMIN") {
-				log.Warnf("DeleteDocument: find upload failed: actor=%d target=%d md5=%s err=%v", user.ID, ownerUserID, fileMD5, err)
+				log.Warnf("%s: find upload failed: actor=%d target=%d md5=%s err=%v", action, user.ID, ownerUserID, fileMD5, err)
 			} else {
-				log.Warnf("DeleteDocument: find upload failed: user=%d md5=%s err=%v", user.ID, fileMD5, err)
+				log.Warnf("%s: find upload failed: user=%d md5=%s err=%v", action, user.ID, fileMD5, err)
 			}
 			return nil, ErrFileNotFound
 		}
@@ -234,7 +738,15 @@ func (s *documentService) resolveDeletionTarget(fileMD5 string, user *model.User
 	}
 
 	if !strings.EqualFold(user.Role, "ADMIN") {
-		return lookup(user.ID)
+		if !allowManagers {
+			return lookup(user.ID)
+		}
+		if targetUserID == nil || *targetUserID == 0 || *targetUserID == user.ID {
+			if upload, err := s.uploadRepo.FindByFileMD5AndUserID(fileMD5, user.ID); err == nil {
+				return upload, nil
+			}
+		}
+		return s.resolveSharedManagedUpload(action, fileMD5, user, targetUserID, lookup)
 	}
 
 	if targetUserID != nil && *targetUserID != 0 {
@@ -243,7 +755,7 @@ func (s *documentService) resolveDeletionTarget(fileMD5 string, user *model.User
 
 	uploads, err := s.uploadRepo.FindBatchByMD5s([]string{fileMD5})
 	if err != nil {
-		log.Errorf("DeleteDocument: admin batch lookup failed: md5=%s err=%v", fileMD5, err)
+		log.Errorf("%s: admin batch lookup failed: md5=%s err=%v", action, fileMD5, err)
 		return nil, ErrInternal
 	}
 	switch len(uploads) {
@@ -256,6 +768,41 @@ func (s *documentService) resolveDeletionTarget(fileMD5 string, user *model.User
 	}
 }
 
+// resolveSharedManagedUpload 定位以 manage 权限共享给当前用户（直接授权或通过所属组织标签）的上传记录；
+// 多个所有者都授权了同一 fileMD5 时需要用 targetUserID 指定所有者。
+func (s *documentService) resolveSharedManagedUpload(action string, fileMD5 string, user *model.User, targetUserID *uint, lookup func(uint) (*model.FileUpload, error)) (*model.FileUpload, error) {
+	if s.userTagProvider == nil {
+		return nil, ErrFileNotFound
+	}
+	orgTags, err := s.userTagProvider.GetUserEffectiveOrgTags(user.ID)
+	if err != nil {
+		log.Errorf("%s: load user org tags failed: user=%d err=%v", action, user.ID, err)
+		return nil, ErrInternal
+	}
+	ownerIDs, err := s.uploadRepo.FindManagedOwnerIDs(fileMD5, user.ID, extractOrgTagIDs(orgTags))
+	if err != nil {
+		log.Errorf("%s: find managed owners failed: user=%d md5=%s err=%v", action, user.ID, fileMD5, err)
+		return nil, ErrInternal
+	}
+
+	if targetUserID != nil && *targetUserID != 0 {
+		for _, ownerID := range ownerIDs {
+			if ownerID == *targetUserID {
+				return lookup(ownerID)
+			}
+		}
+		return nil, ErrFileNotFound
+	}
+	switch len(ownerIDs) {
+	case 0:
+		return nil, ErrFileNotFound
+	case 1:
+		return lookup(ownerIDs[0])
+	default:
+		return nil, fmt.Errorf("%w: ambiguous file ownership, please specify userId", ErrInvalidInput)
+	}
+}
+
 func (s *documentService) GenerateDownloadURL(ctx context.Context, fileMD5 string, fileName string, user *model.User) (*DownloadInfoDTO, error) {
 	if s.uploadRepo == nil || s.userTagProvider == nil || s.minioClient == nil {
 		return nil, ErrServiceUnavailable
@@ -288,17 +835,9 @@ func (s *documentService) GetFilePreviewContent(ctx context.Context, fileMD5 str
 		return nil, err
 	}
 
-	object, err := s.minioClient.GetObject(ctx, s.bucketName, buildUploadObjectKey(upload.UserID, upload.FileMD5, upload.FileName), minio.GetObjectOptions{})
-	if err != nil {
-		log.Errorf("GetFilePreviewContent: get object failed: %v", err)
-		return nil, ErrInternal
-	}
-	defer object.Close()
-
-	content, err := s.tikaClient.ExtractText(ctx, object, upload.FileName)
+	content, err := s.extractUploadText(ctx, "GetFilePreviewContent", upload)
 	if err != nil {
-		log.Errorf("GetFilePreviewContent: tika extract failed: %v", err)
-		return nil, ErrInternal
+		return nil, err
 	}
 
 	truncated := false
@@ -316,6 +855,96 @@ func (s *documentService) GetFilePreviewContent(ctx context.Context, fileMD5 str
 	}, nil
 }
 
+func (s *documentService) ListDocumentVersions(ctx context.Context, fileMD5 string, user *model.User) ([]FileUploadDTO, error) {
+	if s.uploadRepo == nil || s.orgTagRepo == nil || s.userTagProvider == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil || strings.TrimSpace(fileMD5) == "" {
+		return nil, ErrInvalidInput
+	}
+
+	orgTags, err := s.userTagProvider.GetUserEffectiveOrgTags(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	tagIDs := extractOrgTagIDs(orgTags)
+
+	upload, err := s.uploadRepo.FindAccessibleFileByMD5(user.ID, tagIDs, strings.TrimSpace(fileMD5))
+	if err != nil {
+		log.Warnf("ListDocumentVersions: find by md5 failed: user=%d md5=%s err=%v", user.ID, fileMD5, err)
+		return nil, ErrFileNotFound
+	}
+	// 引入版本之前上传的文件没有逻辑文档 ID，只有它自己这一个版本。
+	if upload.DocumentID == "" {
+		return s.mapFileUploadsToDTOs([]model.FileUpload{*upload})
+	}
+
+	versions, err := s.uploadRepo.FindAccessibleDocumentVersions(user.ID, tagIDs, upload.DocumentID)
+	if err != nil {
+		log.Errorf("ListDocumentVersions: query versions failed: document=%s err=%v", upload.DocumentID, err)
+		return nil, ErrInternal
+	}
+	return s.mapFileUploadsToDTOs(versions)
+}
+
+func (s *documentService) DiffDocumentVersions(ctx context.Context, fromMD5 string, toMD5 string, user *model.User) (*DocumentVersionDiffDTO, error) {
+	if s.uploadRepo == nil || s.userTagProvider == nil || s.minioClient == nil || s.tikaClient == nil {
+		return nil, ErrServiceUnavailable
+	}
+	fromMD5, toMD5 = strings.TrimSpace(fromMD5), strings.TrimSpace(toMD5)
+	if fromMD5 == "" || toMD5 == "" {
+		return nil, ErrInvalidInput
+	}
+	if fromMD5 == toMD5 {
+		return nil, fmt.Errorf("%w: from and to must be different versions", ErrInvalidInput)
+	}
+
+	from, err := s.resolveAccessibleFile(ctx, fromMD5, "", user)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.resolveAccessibleFile(ctx, toMD5, "", user)
+	if err != nil {
+		return nil, err
+	}
+	if from.DocumentID == "" || from.DocumentID != to.DocumentID {
+		return nil, fmt.Errorf("%w: files are not versions of the same document", ErrInvalidInput)
+	}
+
+	fromText, err := s.extractUploadText(ctx, "DiffDocumentVersions", from)
+	if err != nil {
+		return nil, err
+	}
+	toText, err := s.extractUploadText(ctx, "DiffDocumentVersions", to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DocumentVersionDiffDTO{
+		DocumentID: from.DocumentID,
+		From:       DocumentVersionRef{FileMD5: from.FileMD5, FileName: from.FileName, Version: from.Version},
+		To:         DocumentVersionRef{FileMD5: to.FileMD5, FileName: to.FileName, Version: to.Version},
+		TextDiff:   diffText(fromText, toText),
+	}, nil
+}
+
+// extractUploadText 从 MinIO 读取合并后的文件并用 Tika 提取纯文本。
+func (s *documentService) extractUploadText(ctx context.Context, action string, upload *model.FileUpload) (string, error) {
+	object, err := s.minioClient.GetObject(ctx, s.bucketName, buildUploadObjectKey(upload.UserID, upload.FileMD5, upload.FileName), minio.GetObjectOptions{})
+	if err != nil {
+		log.Errorf("%s: get object failed: %v", action, err)
+		return "", ErrInternal
+	}
+	defer object.Close()
+
+	content, err := s.tikaClient.ExtractText(ctx, object, upload.FileName)
+	if err != nil {
+		log.Errorf("%s: tika extract failed: %v", action, err)
+		return "", ErrInternal
+	}
+	return content, nil
+}
+
 func (s *documentService) resolveAccessibleFile(ctx context.Context, fileMD5 string, fileName string, user *model.User) (*model.FileUpload, error) {
 	if user == nil {
 		return nil, ErrInvalidInput
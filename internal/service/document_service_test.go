@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/url"
 	"strings"
@@ -10,6 +11,9 @@ import (
 	"time"
 
 	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/es"
+	"pai_smart_go_v2/pkg/tasks"
 
 	"github.com/minio/minio-go/v7"
 	"gorm.io/gorm"
@@ -17,6 +21,15 @@ import (
 
 type fakeDocumentUserTagProvider struct {
 	getUserEffectiveOrgTagsFn func(userID uint) ([]model.OrganizationTag, error)
+	// missingUsers 中的用户 FindByID 返回 ErrUserNotFound。
+	missingUsers map[uint]bool
+}
+
+func (f *fakeDocumentUserTagProvider) FindByID(userID uint) (*model.User, error) {
+	if f.missingUsers[userID] {
+		return nil, ErrUserNotFound
+	}
+	return &model.User{ID: userID}, nil
 }
 
 func (f *fakeDocumentUserTagProvider) GetUserEffectiveOrgTags(userID uint) ([]model.OrganizationTag, error) {
@@ -66,21 +79,99 @@ func (f *fakeDocumentTextExtractor) ExtractText(ctx context.Context, reader io.R
 
 type fakeDocumentVectorRepo struct {
 	deleteByFileMD5Fn func(fileMD5 string) error
+	markSupersededFn  func(fileMD5s []string, userID uint, superseded bool) error
+	updateFolderFn    func(fileMD5s []string, userID uint, folderID uint) error
+	updateTagsFn      func(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error
+	updateSharingFn   func(fileMD5s []string, userID uint, sharing model.DocumentSharing) error
 }
 
 func (f *fakeDocumentVectorRepo) BatchCreate(vectors []model.DocumentVector) error { return nil }
 func (f *fakeDocumentVectorRepo) FindByFileMD5(fileMD5 string) ([]model.DocumentVector, error) {
 	return []model.DocumentVector{}, nil
 }
+func (f *fakeDocumentVectorRepo) ReplaceChunks(fileMD5 string, replacedChunkIDs []int, vectors []model.DocumentVector) error {
+	return nil
+}
 func (f *fakeDocumentVectorRepo) DeleteByFileMD5(fileMD5 string) error {
 	if f.deleteByFileMD5Fn != nil {
 		return f.deleteByFileMD5Fn(fileMD5)
 	}
 	return nil
 }
+func (f *fakeDocumentVectorRepo) ListFileMD5s(afterMD5 string, limit int) ([]string, error) {
+	return []string{}, nil
+}
+func (f *fakeDocumentVectorRepo) CountFiles() (int64, error) { return 0, nil }
+func (f *fakeDocumentVectorRepo) UpdateModelVersion(ids []uint, modelVersion string) error {
+	return nil
+}
+func (f *fakeDocumentVectorRepo) FindFileMD5sUpdatedSince(since time.Time) ([]string, error) {
+	return nil, nil
+}
+func (f *fakeDocumentVectorRepo) MarkSuperseded(fileMD5s []string, userID uint, superseded bool) error {
+	if f.markSupersededFn != nil {
+		return f.markSupersededFn(fileMD5s, userID, superseded)
+	}
+	return nil
+}
+func (f *fakeDocumentVectorRepo) UpdateFolder(fileMD5s []string, userID uint, folderID uint) error {
+	if f.updateFolderFn != nil {
+		return f.updateFolderFn(fileMD5s, userID, folderID)
+	}
+	return nil
+}
+func (f *fakeDocumentVectorRepo) UpdateTags(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+	if f.updateTagsFn != nil {
+		return f.updateTagsFn(fileMD5s, userID, tags, customMetadata)
+	}
+	return nil
+}
+func (f *fakeDocumentVectorRepo) UpdateSharing(fileMD5s []string, userID uint, sharing model.DocumentSharing) error {
+	if f.updateSharingFn != nil {
+		return f.updateSharingFn(fileMD5s, userID, sharing)
+	}
+	return nil
+}
 
 type fakeDocumentESClient struct {
 	deleteDocumentsByFileMD5Fn func(ctx context.Context, fileMD5 string) error
+	markSupersededFn           func(ctx context.Context, fileMD5s []string, userID uint, superseded bool) error
+	setTagsFn                  func(ctx context.Context, fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error
+	setSharingFn               func(ctx context.Context, fileMD5s []string, userID uint, sharing model.DocumentSharing) error
+	// countDocumentsByOwnerFn 为空时视为每个 fileMD5 都有所有者名下的分块。
+	countDocumentsByOwnerFn func(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error)
+}
+
+func (f *fakeDocumentESClient) CountDocumentsByOwner(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error) {
+	if f.countDocumentsByOwnerFn != nil {
+		return f.countDocumentsByOwnerFn(ctx, fileMD5s, userID)
+	}
+	counts := make(map[string]int64, len(fileMD5s))
+	for _, fileMD5 := range fileMD5s {
+		counts[fileMD5] = 1
+	}
+	return counts, nil
+}
+
+func (f *fakeDocumentESClient) SetSharing(ctx context.Context, fileMD5s []string, userID uint, sharing model.DocumentSharing) error {
+	if f.setSharingFn != nil {
+		return f.setSharingFn(ctx, fileMD5s, userID, sharing)
+	}
+	return nil
+}
+
+func (f *fakeDocumentESClient) SetTags(ctx context.Context, fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+	if f.setTagsFn != nil {
+		return f.setTagsFn(ctx, fileMD5s, userID, tags, customMetadata)
+	}
+	return nil
+}
+
+func (f *fakeDocumentESClient) MarkSuperseded(ctx context.Context, fileMD5s []string, userID uint, superseded bool) error {
+	if f.markSupersededFn != nil {
+		return f.markSupersededFn(ctx, fileMD5s, userID, superseded)
+	}
+	return nil
 }
 
 func (f *fakeDocumentESClient) DeleteDocumentsByFileMD5(ctx context.Context, fileMD5 string) error {
@@ -115,6 +206,7 @@ func TestDocumentService_ListAccessibleFiles(t *testing.T) {
 		&fakeDocumentTextExtractor{},
 		&fakeDocumentVectorRepo{},
 		&fakeDocumentESClient{},
+		nil,
 	)
 
 	files, err := svc.ListAccessibleFiles(context.Background(), &model.User{ID: 7})
@@ -143,6 +235,7 @@ func TestDocumentService_GenerateDownloadURL_AmbiguousFileName(t *testing.T) {
 		&fakeDocumentTextExtractor{},
 		&fakeDocumentVectorRepo{},
 		&fakeDocumentESClient{},
+		nil,
 	)
 
 	_, err := svc.GenerateDownloadURL(context.Background(), "", "dup.pdf", &model.User{ID: 3})
@@ -199,6 +292,7 @@ func TestDocumentService_DeleteDocument_CompleteCleanup(t *testing.T) {
 				return nil
 			},
 		},
+		nil,
 	)
 
 	err := svc.DeleteDocument(context.Background(), "md5v", &model.User{ID: 5}, nil)
@@ -247,6 +341,7 @@ func TestDocumentService_GetFilePreviewContent(t *testing.T) {
 		},
 		&fakeDocumentVectorRepo{},
 		&fakeDocumentESClient{},
+		nil,
 	)
 
 	info, err := svc.GetFilePreviewContent(context.Background(), "md5v", "", &model.User{ID: 9})
@@ -272,6 +367,7 @@ func TestDocumentService_DeleteDocument_NotFound(t *testing.T) {
 		&fakeDocumentTextExtractor{},
 		&fakeDocumentVectorRepo{},
 		&fakeDocumentESClient{},
+		nil,
 	)
 
 	err := svc.DeleteDocument(context.Background(), "missing", &model.User{ID: 1}, nil)
@@ -299,6 +395,7 @@ func TestDocumentService_DeleteDocument_AdminDeleteByTargetUser(t *testing.T) {
 		&fakeDocumentTextExtractor{},
 		&fakeDocumentVectorRepo{},
 		&fakeDocumentESClient{},
+		nil,
 	)
 
 	targetUserID := uint(42)
@@ -328,6 +425,7 @@ func TestDocumentService_DeleteDocument_AdminAmbiguousFileOwnership(t *testing.T
 		&fakeDocumentTextExtractor{},
 		&fakeDocumentVectorRepo{},
 		&fakeDocumentESClient{},
+		nil,
 	)
 
 	err := svc.DeleteDocument(context.Background(), "md5v", &model.User{ID: 1, Role: "ADMIN"}, nil)
@@ -335,3 +433,597 @@ func TestDocumentService_DeleteDocument_AdminAmbiguousFileOwnership(t *testing.T
 		t.Fatalf("expected ErrInvalidInput, got %v", err)
 	}
 }
+
+func TestDocumentService_ReprocessDocument_ResetsStatusAndProducesTask(t *testing.T) {
+	var statuses []string
+	producer := &fakeTaskProducer{}
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+				return &model.FileUpload{FileMD5: fileMD5, FileName: "doc.pdf", UserID: userID, OrgTag: "team-a", Status: model.FileUploadStatusUploaded, ProcessingStatus: model.FileProcessingStatusFailed}, nil
+			},
+			updateFileProcessingStatusFn: func(fileMD5 string, userID uint, processingStatus string) error {
+				statuses = append(statuses, processingStatus)
+				return nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{},
+		&fakeDocumentESClient{},
+		producer,
+	)
+
+	upload, err := svc.ReprocessDocument(context.Background(), "md5v", &model.User{ID: 7}, nil)
+	if err != nil {
+		t.Fatalf("ReprocessDocument() error = %v", err)
+	}
+	if upload.ProcessingStatus != model.FileProcessingStatusPending {
+		t.Fatalf("unexpected processing status: %s", upload.ProcessingStatus)
+	}
+	if len(statuses) != 1 || statuses[0] != model.FileProcessingStatusPending {
+		t.Fatalf("unexpected status updates: %v", statuses)
+	}
+	if producer.called != 1 || producer.lastTask.UserID != 7 || producer.lastTask.OrgTag != "team-a" || producer.lastTask.ObjectKey != buildUploadObjectKey(7, "md5v", "doc.pdf") {
+		t.Fatalf("unexpected task: called=%d task=%+v", producer.called, producer.lastTask)
+	}
+}
+
+func TestDocumentService_ReprocessDocument_RejectsIncompleteUpload(t *testing.T) {
+	producer := &fakeTaskProducer{}
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+				return &model.FileUpload{FileMD5: fileMD5, UserID: userID, Status: model.FileUploadStatusUploading}, nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{},
+		&fakeDocumentESClient{},
+		producer,
+	)
+
+	_, err := svc.ReprocessDocument(context.Background(), "md5v", &model.User{ID: 7}, nil)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+	if producer.called != 0 {
+		t.Fatalf("expected no task to be produced, got %d", producer.called)
+	}
+}
+
+func TestDocumentService_BulkReprocess_RestoresStatusOnProduceFailure(t *testing.T) {
+	statuses := map[string][]string{}
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findReprocessCandidatesFn: func(filter repository.ReprocessFilter) ([]model.FileUpload, error) {
+				if filter.ModelVersion != "old-model" {
+					t.Fatalf("unexpected filter: %+v", filter)
+				}
+				return []model.FileUpload{
+					{ID: 11, FileMD5: "md5-a", FileName: "a.pdf", UserID: 1, Status: model.FileUploadStatusUploaded, ProcessingStatus: model.FileProcessingStatusIndexed},
+					{ID: 12, FileMD5: "md5-b", FileName: "b.pdf", UserID: 2, Status: model.FileUploadStatusUploaded, ProcessingStatus: model.FileProcessingStatusIndexed},
+				}, nil
+			},
+			updateFileProcessingStatusFn: func(fileMD5 string, userID uint, processingStatus string) error {
+				statuses[fileMD5] = append(statuses[fileMD5], processingStatus)
+				return nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{},
+		&fakeDocumentESClient{},
+		&fakeTaskProducer{
+			produceFn: func(ctx context.Context, task tasks.FileProcessingTask) error {
+				if task.FileMD5 == "md5-b" {
+					return errors.New("kafka down")
+				}
+				return nil
+			},
+		},
+	)
+
+	result, err := svc.BulkReprocess(context.Background(), repository.ReprocessFilter{ModelVersion: "old-model"})
+	if err != nil {
+		t.Fatalf("BulkReprocess() error = %v", err)
+	}
+	if result.Matched != 2 || result.Enqueued != 1 || len(result.Failed) != 1 || result.Failed[0].FileMD5 != "md5-b" || result.Failed[0].UserID != 2 || result.NextAfterID != 12 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if strings.Join(statuses["md5-b"], ",") != "pending,indexed" {
+		t.Fatalf("expected md5-b status to be restored, got %v", statuses["md5-b"])
+	}
+}
+
+func TestDocumentService_DeleteDocument_PromotesPreviousVersion(t *testing.T) {
+	calls := make([]string, 0)
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+				return &model.FileUpload{FileMD5: fileMD5, FileName: "doc.pdf", UserID: userID, DocumentID: "doc-1", Version: 3, IsLatest: true}, nil
+			},
+			findDocumentVersionsFn: func(documentID string) ([]model.FileUpload, error) {
+				return []model.FileUpload{
+					{FileMD5: "md5-v2-uploading", UserID: 5, DocumentID: documentID, Version: 2, Status: model.FileUploadStatusUploading},
+					{FileMD5: "md5-v1", UserID: 5, DocumentID: documentID, Version: 1, Status: model.FileUploadStatusUploaded},
+				}, nil
+			},
+			promoteVersionFn: func(documentID string, fileMD5 string, userID uint) error {
+				calls = append(calls, "promote:"+fileMD5)
+				return nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{
+			markSupersededFn: func(fileMD5s []string, userID uint, superseded bool) error {
+				calls = append(calls, fmt.Sprintf("vectors:%v:%d:%t", fileMD5s, userID, superseded))
+				return nil
+			},
+		},
+		&fakeDocumentESClient{
+			markSupersededFn: func(ctx context.Context, fileMD5s []string, userID uint, superseded bool) error {
+				calls = append(calls, fmt.Sprintf("es:%v:%d:%t", fileMD5s, userID, superseded))
+				return nil
+			},
+		},
+		nil,
+	)
+
+	if err := svc.DeleteDocument(context.Background(), "md5-v3", &model.User{ID: 5}, nil); err != nil {
+		t.Fatalf("DeleteDocument() error = %v", err)
+	}
+	expected := []string{"promote:md5-v1", "es:[md5-v1]:5:false", "vectors:[md5-v1]:5:false"}
+	if strings.Join(calls, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected promotion calls: got=%v want=%v", calls, expected)
+	}
+}
+
+func TestDocumentService_ListDocumentVersions(t *testing.T) {
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findAccessibleFileByMD5Fn: func(userID uint, orgTags []string, fileMD5 string) (*model.FileUpload, error) {
+				return &model.FileUpload{FileMD5: fileMD5, DocumentID: "doc-1", Version: 1}, nil
+			},
+			findAccessibleVersionsFn: func(userID uint, orgTags []string, documentID string) ([]model.FileUpload, error) {
+				if userID != 9 || documentID != "doc-1" {
+					t.Fatalf("unexpected query args: user=%d document=%s", userID, documentID)
+				}
+				return []model.FileUpload{
+					{FileMD5: "md5-v2", DocumentID: documentID, Version: 2, IsLatest: true},
+					{FileMD5: "md5-v1", DocumentID: documentID, Version: 1},
+				}, nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{},
+		&fakeDocumentESClient{},
+		nil,
+	)
+
+	versions, err := svc.ListDocumentVersions(context.Background(), "md5-v1", &model.User{ID: 9})
+	if err != nil {
+		t.Fatalf("ListDocumentVersions() error = %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 || !versions[0].IsLatest {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+}
+
+func TestDocumentService_DiffDocumentVersions(t *testing.T) {
+	uploads := map[string]model.FileUpload{
+		"md5-v1":    {FileMD5: "md5-v1", FileName: "doc.txt", UserID: 9, DocumentID: "doc-1", Version: 1},
+		"md5-v2":    {FileMD5: "md5-v2", FileName: "doc.txt", UserID: 9, DocumentID: "doc-1", Version: 2},
+		"md5-other": {FileMD5: "md5-other", FileName: "other.txt", UserID: 9, DocumentID: "doc-2", Version: 1},
+	}
+	contents := map[string]string{
+		"uploads/9/md5-v1/doc.txt": "标题\n第一段\n第二段\n",
+		"uploads/9/md5-v2/doc.txt": "标题\n第一段（修订）\n第二段\n第三段\n",
+	}
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findAccessibleFileByMD5Fn: func(userID uint, orgTags []string, fileMD5 string) (*model.FileUpload, error) {
+				upload, ok := uploads[fileMD5]
+				if !ok {
+					return nil, gorm.ErrRecordNotFound
+				}
+				return &upload, nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{
+			getObjectFn: func(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader(contents[objectName])), nil
+			},
+		},
+		"bucket-a",
+		&fakeDocumentTextExtractor{
+			extractTextFn: func(ctx context.Context, reader io.Reader, fileName string) (string, error) {
+				payload, _ := io.ReadAll(reader)
+				return string(payload), nil
+			},
+		},
+		&fakeDocumentVectorRepo{},
+		&fakeDocumentESClient{},
+		nil,
+	)
+
+	diff, err := svc.DiffDocumentVersions(context.Background(), "md5-v1", "md5-v2", &model.User{ID: 9})
+	if err != nil {
+		t.Fatalf("DiffDocumentVersions() error = %v", err)
+	}
+	if diff.DocumentID != "doc-1" || diff.From.Version != 1 || diff.To.Version != 2 {
+		t.Fatalf("unexpected diff header: %+v", diff)
+	}
+	if diff.Added != 2 || diff.Removed != 1 || len(diff.Hunks) != 1 {
+		t.Fatalf("unexpected diff summary: %+v", diff)
+	}
+
+	if _, err := svc.DiffDocumentVersions(context.Background(), "md5-v1", "md5-other", &model.User{ID: 9}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput for different documents, got %v", err)
+	}
+	if _, err := svc.DiffDocumentVersions(context.Background(), "md5-v1", "md5-missing", &model.User{ID: 9}); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("expected ErrFileNotFound, got %v", err)
+	}
+}
+
+func TestDocumentService_UpdateDocumentTags_AllVersions(t *testing.T) {
+	var uploadMD5s, vectorMD5s, esMD5s []string
+	var savedTags []string
+	var savedMetadata map[string]string
+	var vectorOwner, esOwner uint
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+				return &model.FileUpload{FileMD5: fileMD5, UserID: userID, DocumentID: "doc-1", Version: 1}, nil
+			},
+			findDocumentVersionsFn: func(documentID string) ([]model.FileUpload, error) {
+				return []model.FileUpload{{FileMD5: "md5-v2", UserID: 7}, {FileMD5: "md5-v1", UserID: 7}}, nil
+			},
+			updateTagsFn: func(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+				uploadMD5s, savedTags, savedMetadata = fileMD5s, tags, customMetadata
+				return nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{
+			updateTagsFn: func(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+				vectorMD5s, vectorOwner = fileMD5s, userID
+				return nil
+			},
+		},
+		&fakeDocumentESClient{
+			setTagsFn: func(ctx context.Context, fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+				esMD5s, esOwner = fileMD5s, userID
+				return nil
+			},
+		},
+		&fakeTaskProducer{},
+	)
+
+	upload, err := svc.UpdateDocumentTags(context.Background(), "md5-v1", []string{" 财务 ", "", "财务", "2024"}, map[string]string{"project": " apollo "}, &model.User{ID: 7}, nil)
+	if err != nil {
+		t.Fatalf("UpdateDocumentTags() error = %v", err)
+	}
+	if len(savedTags) != 2 || savedTags[0] != "财务" || savedTags[1] != "2024" || savedMetadata["project"] != "apollo" {
+		t.Fatalf("unexpected normalized tags: %v %v", savedTags, savedMetadata)
+	}
+	for _, md5s := range [][]string{uploadMD5s, vectorMD5s, esMD5s} {
+		if len(md5s) != 2 || md5s[0] != "md5-v2" || md5s[1] != "md5-v1" {
+			t.Fatalf("expected every version updated, got %v", md5s)
+		}
+	}
+	if vectorOwner != 7 || esOwner != 7 {
+		t.Fatalf("expected vector and es updates scoped to the owner, vectors=%d es=%d", vectorOwner, esOwner)
+	}
+	if len(upload.Tags) != 2 || upload.CustomMetadata["project"] != "apollo" {
+		t.Fatalf("unexpected upload: %+v", upload)
+	}
+}
+
+func TestDocumentService_UpdateDocumentTags_IndexHeldByOtherUploader(t *testing.T) {
+	var uploadCalls int
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+				return &model.FileUpload{FileMD5: fileMD5, UserID: userID, ProcessingStatus: model.FileProcessingStatusIndexed}, nil
+			},
+			updateTagsFn: func(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+				uploadCalls++
+				return nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{},
+		&fakeDocumentESClient{
+			countDocumentsByOwnerFn: func(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error) {
+				return map[string]int64{}, nil
+			},
+		},
+		&fakeTaskProducer{},
+	)
+
+	_, err := svc.UpdateDocumentTags(context.Background(), "md5-1", []string{"合同"}, nil, &model.User{ID: 7}, nil)
+	if !errors.Is(err, ErrDocumentIndexStale) {
+		t.Fatalf("expected ErrDocumentIndexStale, got %v", err)
+	}
+	if uploadCalls != 0 {
+		t.Fatalf("expected tags not written, got %d upload updates", uploadCalls)
+	}
+}
+
+func TestDocumentService_UpdateDocumentShares_AllVersions(t *testing.T) {
+	var replacedMD5s, vectorMD5s, esMD5s []string
+	var replaced []model.DocumentShare
+	var sharing model.DocumentSharing
+	var vectorOwner, esOwner uint
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+				return &model.FileUpload{FileMD5: fileMD5, UserID: userID, DocumentID: "doc-1", Version: 1}, nil
+			},
+			findDocumentVersionsFn: func(documentID string) ([]model.FileUpload, error) {
+				return []model.FileUpload{{FileMD5: "md5-v2", UserID: 7}, {FileMD5: "md5-v1", UserID: 7}}, nil
+			},
+			replaceSharesFn: func(fileMD5s []string, ownerID uint, shares []model.DocumentShare) error {
+				replacedMD5s, replaced = fileMD5s, shares
+				return nil
+			},
+			findSharesFn: func(fileMD5 string, ownerID uint) ([]model.DocumentShare, error) {
+				return replaced, nil
+			},
+		},
+		&fakeOrgTagRepo{
+			findBatchByIDsFn: func(tagIDs []string) ([]model.OrganizationTag, error) {
+				return []model.OrganizationTag{{TagID: "team-b"}}, nil
+			},
+		},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{
+			updateSharingFn: func(fileMD5s []string, userID uint, next model.DocumentSharing) error {
+				vectorMD5s, sharing, vectorOwner = fileMD5s, next, userID
+				return nil
+			},
+		},
+		&fakeDocumentESClient{
+			setSharingFn: func(ctx context.Context, fileMD5s []string, userID uint, next model.DocumentSharing) error {
+				esMD5s, esOwner = fileMD5s, userID
+				return nil
+			},
+		},
+		&fakeTaskProducer{},
+	)
+
+	shares, err := svc.UpdateDocumentShares(context.Background(), "md5-v1", []ShareGrant{
+		{UserID: 9},
+		{OrgTag: " team-b ", Permission: "manage"},
+		{UserID: 9, Permission: "MANAGE"},
+	}, &model.User{ID: 7}, nil)
+	if err != nil {
+		t.Fatalf("UpdateDocumentShares() error = %v", err)
+	}
+	if len(shares) != 2 || shares[0].GranteeUserID != 9 || shares[0].Permission != model.SharePermissionManage ||
+		shares[1].GranteeOrgTag != "team-b" || shares[1].OwnerID != 7 || shares[1].CreatedBy != 7 {
+		t.Fatalf("unexpected shares: %+v", shares)
+	}
+	for _, md5s := range [][]string{replacedMD5s, vectorMD5s, esMD5s} {
+		if len(md5s) != 2 || md5s[0] != "md5-v2" || md5s[1] != "md5-v1" {
+			t.Fatalf("expected every version updated, got %v", md5s)
+		}
+	}
+	if len(sharing.SharedUserIDs) != 1 || sharing.SharedUserIDs[0] != 9 || len(sharing.SharedOrgTags) != 1 || sharing.SharedOrgTags[0] != "team-b" {
+		t.Fatalf("unexpected sharing: %+v", sharing)
+	}
+	if vectorOwner != 7 || esOwner != 7 {
+		t.Fatalf("expected vector and es updates scoped to the owner, vectors=%d es=%d", vectorOwner, esOwner)
+	}
+}
+
+func TestDocumentService_UpdateDocumentShares_Validation(t *testing.T) {
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+				return &model.FileUpload{FileMD5: fileMD5, UserID: userID}, nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{missingUsers: map[uint]bool{404: true}},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{},
+		&fakeDocumentESClient{},
+		&fakeTaskProducer{},
+	)
+
+	cases := []struct {
+		name  string
+		grant ShareGrant
+		want  error
+	}{
+		{name: "unknown user", grant: ShareGrant{UserID: 404}, want: ErrUserNotFound},
+		{name: "no grantee", grant: ShareGrant{}, want: ErrInvalidInput},
+		{name: "both grantees", grant: ShareGrant{UserID: 9, OrgTag: "team-b"}, want: ErrInvalidInput},
+		{name: "owner", grant: ShareGrant{UserID: 7}, want: ErrInvalidInput},
+		{name: "unknown permission", grant: ShareGrant{UserID: 9, Permission: "write"}, want: ErrInvalidInput},
+		{name: "unknown org tag", grant: ShareGrant{OrgTag: "missing"}, want: ErrOrgTagNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.UpdateDocumentShares(context.Background(), "md5-1", []ShareGrant{tc.grant}, &model.User{ID: 7}, nil)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestDocumentService_UpdateDocumentShares_IndexHeldByOtherUploader(t *testing.T) {
+	var replaceCalls, esCalls int
+	svc := NewDocumentService(
+		&fakeUploadRepo{
+			findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+				return &model.FileUpload{FileMD5: fileMD5, UserID: userID, DocumentID: "doc-1", Version: 2}, nil
+			},
+			findDocumentVersionsFn: func(documentID string) ([]model.FileUpload, error) {
+				return []model.FileUpload{
+					{FileMD5: "md5-v2", UserID: 7, ProcessingStatus: model.FileProcessingStatusPending},
+					{FileMD5: "md5-v1", UserID: 7, ProcessingStatus: model.FileProcessingStatusIndexed},
+				}, nil
+			},
+			replaceSharesFn: func(fileMD5s []string, ownerID uint, shares []model.DocumentShare) error {
+				replaceCalls++
+				return nil
+			},
+		},
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{},
+		&fakeDocumentESClient{
+			// md5-v1 的分块最后由另一位上传者处理，记在对方名下。
+			countDocumentsByOwnerFn: func(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error) {
+				if len(fileMD5s) != 1 || fileMD5s[0] != "md5-v1" || userID != 7 {
+					t.Fatalf("expected only indexed versions counted for the owner, got %v user=%d", fileMD5s, userID)
+				}
+				return map[string]int64{}, nil
+			},
+			setSharingFn: func(ctx context.Context, fileMD5s []string, userID uint, sharing model.DocumentSharing) error {
+				esCalls++
+				return nil
+			},
+		},
+		&fakeTaskProducer{},
+	)
+
+	_, err := svc.UpdateDocumentShares(context.Background(), "md5-v2", []ShareGrant{{UserID: 9}}, &model.User{ID: 7}, nil)
+	if !errors.Is(err, ErrDocumentIndexStale) {
+		t.Fatalf("expected ErrDocumentIndexStale, got %v", err)
+	}
+	if replaceCalls != 0 || esCalls != 0 {
+		t.Fatalf("expected nothing written, replace=%d es=%d", replaceCalls, esCalls)
+	}
+}
+
+func TestOwnedIndexUpdateError(t *testing.T) {
+	notIndexed := fmt.Errorf("update sharing failed: %w", es.ErrDocumentsNotIndexed)
+	if err := ownedIndexUpdateError("op", notIndexed, []string{"md5-a"}, nil); err != nil {
+		t.Fatalf("expected zero matches tolerated before indexing, got %v", err)
+	}
+	if err := ownedIndexUpdateError("op", notIndexed, []string{"md5-a"}, []string{"md5-a"}); !errors.Is(err, ErrDocumentIndexStale) {
+		t.Fatalf("expected ErrDocumentIndexStale, got %v", err)
+	}
+	if err := ownedIndexUpdateError("op", errors.New("es down"), []string{"md5-a"}, nil); !errors.Is(err, ErrInternal) {
+		t.Fatalf("expected ErrInternal, got %v", err)
+	}
+}
+
+func TestDocumentService_ManageGrantee(t *testing.T) {
+	var managedQuery []string
+	uploadRepo := &fakeUploadRepo{
+		findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+			if userID != 7 {
+				return nil, gorm.ErrRecordNotFound
+			}
+			return &model.FileUpload{FileMD5: fileMD5, UserID: 7, Status: model.FileUploadStatusUploaded}, nil
+		},
+		findManagedOwnerIDsFn: func(fileMD5 string, userID uint, orgTags []string) ([]uint, error) {
+			managedQuery = orgTags
+			if userID == 9 {
+				return []uint{7}, nil
+			}
+			return nil, nil
+		},
+	}
+	svc := NewDocumentService(
+		uploadRepo,
+		&fakeOrgTagRepo{},
+		&fakeDocumentUserTagProvider{
+			getUserEffectiveOrgTagsFn: func(userID uint) ([]model.OrganizationTag, error) {
+				return []model.OrganizationTag{{TagID: "team-b"}}, nil
+			},
+		},
+		&fakeDocumentStorage{},
+		"bucket-a",
+		&fakeDocumentTextExtractor{},
+		&fakeDocumentVectorRepo{},
+		&fakeDocumentESClient{},
+		&fakeTaskProducer{},
+	)
+
+	upload, err := svc.UpdateDocumentTags(context.Background(), "md5-1", []string{"财务"}, nil, &model.User{ID: 9}, nil)
+	if err != nil {
+		t.Fatalf("UpdateDocumentTags() by manage grantee error = %v", err)
+	}
+	if upload.UserID != 7 || len(managedQuery) != 1 || managedQuery[0] != "team-b" {
+		t.Fatalf("unexpected upload %+v or org tags %v", upload, managedQuery)
+	}
+
+	if _, err := svc.ReprocessDocument(context.Background(), "md5-1", &model.User{ID: 10}, nil); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("expected ErrFileNotFound without manage grant, got %v", err)
+	}
+	if err := svc.DeleteDocument(context.Background(), "md5-1", &model.User{ID: 9}, nil); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("expected delete to stay owner-only, got %v", err)
+	}
+}
+
+func TestNormalizeDocumentTags_Validation(t *testing.T) {
+	tooMany := make([]string, 0, maxDocumentTags+1)
+	for i := 0; i <= maxDocumentTags; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("tag-%d", i))
+	}
+	cases := []struct {
+		name     string
+		tags     []string
+		metadata map[string]string
+	}{
+		{name: "too many tags", tags: tooMany},
+		{name: "tag too long", tags: []string{strings.Repeat("长", maxDocumentTagRunes+1)}},
+		{name: "invalid key", metadata: map[string]string{"project.name": "apollo"}},
+		{name: "value too long", metadata: map[string]string{"project": strings.Repeat("a", maxCustomMetadataValue+1)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := normalizeDocumentTags(tc.tags, tc.metadata); !errors.Is(err, ErrInvalidInput) {
+				t.Fatalf("expected ErrInvalidInput, got %v", err)
+			}
+		})
+	}
+
+	tags, metadata, err := normalizeDocumentTags([]string{" "}, map[string]string{})
+	if err != nil || tags != nil || metadata != nil {
+		t.Fatalf("expected empty input to clear tags, got %v %v %v", tags, metadata, err)
+	}
+}
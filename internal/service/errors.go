@@ -4,3 +4,7 @@ import "errors"
 
 // ErrServiceUnavailable 表示依赖未就绪，接口当前不可用。
 var ErrServiceUnavailable = errors.New("service unavailable")
+
+// ErrDocumentIndexStale 表示文档已索引，但 ES 中相同内容的分块记在其他上传者名下，
+// 对所有者的标签、共享、文件夹更新不会在检索中生效；所有者重新处理文档后即可恢复。
+var ErrDocumentIndexStale = errors.New("document index is held by another uploader")
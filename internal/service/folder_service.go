@@ -0,0 +1,398 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/log"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrFolderNotFound 表示文件夹不存在，或当前用户无权访问。
+	ErrFolderNotFound = errors.New("folder not found")
+	// ErrFolderNotEmpty 表示文件夹下仍有子文件夹或文档，不能删除。
+	ErrFolderNotEmpty = errors.New("folder is not empty")
+)
+
+const maxFolderNameRunes = 255
+
+type folderUserOrgTagProvider interface {
+	GetUserEffectiveOrgTags(userID uint) ([]model.OrganizationTag, error)
+}
+
+type folderESClient interface {
+	SetFolder(ctx context.Context, fileMD5s []string, userID uint, folderID uint) error
+	CountDocumentsByOwner(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error)
+}
+
+// FolderService 管理文档文件夹：个人文件夹只有所有者可见，组织文件夹对该组织标签的成员可见。
+// 文件夹只用于组织文档和限定检索范围，不改变文档本身的访问权限。
+type FolderService interface {
+	// CreateFolder 创建文件夹。指定 parentID 时继承父文件夹的归属，orgTag 须为空或与父文件夹一致；
+	// 否则 orgTag 为空创建个人文件夹，非空时创建该组织标签下的根文件夹。
+	CreateFolder(ctx context.Context, user *model.User, name string, parentID *uint, orgTag string) (*model.Folder, error)
+	RenameFolder(ctx context.Context, user *model.User, folderID uint, name string) (*model.Folder, error)
+	// MoveFolder 把文件夹移动到 parentID 下，parentID 为 nil 时移动到根目录；不能跨归属移动，也不能移到自己的子树中。
+	MoveFolder(ctx context.Context, user *model.User, folderID uint, parentID *uint) (*model.Folder, error)
+	// DeleteFolder 保护删除：文件夹下仍有子文件夹或文档时返回 ErrFolderNotEmpty。
+	DeleteFolder(ctx context.Context, user *model.User, folderID uint) error
+	// GetFolderTree 返回当前用户可访问的文件夹树，父文件夹不可访问的节点作为根节点返回。
+	GetFolderTree(ctx context.Context, user *model.User) ([]*model.FolderNode, error)
+	// MoveDocument 把用户自己的文档（连同全部版本）移动到 folderID，folderID 为 0 时移回根目录。
+	MoveDocument(ctx context.Context, user *model.User, fileMD5 string, folderID uint) error
+	// ResolveSubtree 校验用户可访问 folderID，并返回它及全部后代文件夹的 ID，供检索限定范围。
+	ResolveSubtree(ctx context.Context, user *model.User, folderID uint) ([]uint, error)
+}
+
+type folderService struct {
+	folderRepo      repository.FolderRepository
+	uploadRepo      repository.UploadRepository
+	docVectorRepo   repository.DocumentVectorRepository
+	esClient        folderESClient
+	userTagProvider folderUserOrgTagProvider
+}
+
+func NewFolderService(
+	folderRepo repository.FolderRepository,
+	uploadRepo repository.UploadRepository,
+	docVectorRepo repository.DocumentVectorRepository,
+	esClient folderESClient,
+	userTagProvider folderUserOrgTagProvider,
+) FolderService {
+	return &folderService{
+		folderRepo:      folderRepo,
+		uploadRepo:      uploadRepo,
+		docVectorRepo:   docVectorRepo,
+		esClient:        esClient,
+		userTagProvider: userTagProvider,
+	}
+}
+
+func (s *folderService) CreateFolder(ctx context.Context, user *model.User, name string, parentID *uint, orgTag string) (*model.Folder, error) {
+	if s.folderRepo == nil || s.userTagProvider == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil {
+		return nil, ErrInvalidInput
+	}
+	name, err := normalizeFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+	orgTag = strings.TrimSpace(orgTag)
+
+	tagIDs, err := s.userOrgTagIDs(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := &model.Folder{Name: name, UserID: user.ID, OrgTag: orgTag}
+	if parentID != nil && *parentID != 0 {
+		parent, err := s.findAccessibleFolder(*parentID, user.ID, tagIDs)
+		if err != nil {
+			return nil, err
+		}
+		if orgTag != "" && orgTag != parent.OrgTag {
+			return nil, ErrInvalidInput
+		}
+		folder.ParentID = &parent.ID
+		folder.OrgTag = parent.OrgTag
+	} else if orgTag != "" && !containsString(tagIDs, orgTag) {
+		return nil, ErrOrgTagNotOwned
+	}
+
+	if err := s.folderRepo.Create(folder); err != nil {
+		log.Errorf("CreateFolder: create folder failed: user=%d err=%v", user.ID, err)
+		return nil, ErrInternal
+	}
+	return folder, nil
+}
+
+func (s *folderService) RenameFolder(ctx context.Context, user *model.User, folderID uint, name string) (*model.Folder, error) {
+	if s.folderRepo == nil || s.userTagProvider == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil {
+		return nil, ErrInvalidInput
+	}
+	name, err := normalizeFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tagIDs, err := s.userOrgTagIDs(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := s.findAccessibleFolder(folderID, user.ID, tagIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	folder.Name = name
+	if err := s.updateFolder(folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+func (s *folderService) MoveFolder(ctx context.Context, user *model.User, folderID uint, parentID *uint) (*model.Folder, error) {
+	if s.folderRepo == nil || s.userTagProvider == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil {
+		return nil, ErrInvalidInput
+	}
+
+	tagIDs, err := s.userOrgTagIDs(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := s.findAccessibleFolder(folderID, user.ID, tagIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID == nil || *parentID == 0 {
+		folder.ParentID = nil
+	} else {
+		parent, err := s.findAccessibleFolder(*parentID, user.ID, tagIDs)
+		if err != nil {
+			return nil, err
+		}
+		if parent.OrgTag != folder.OrgTag || (folder.OrgTag == "" && parent.UserID != folder.UserID) {
+			return nil, ErrInvalidInput
+		}
+
+		// 目标父文件夹不能是自己或自己的后代，否则会形成环。
+		subtree, err := s.folderRepo.FindSubtreeIDs(folder.ID)
+		if err != nil {
+			log.Errorf("MoveFolder: query subtree failed: folder=%d err=%v", folder.ID, err)
+			return nil, ErrInternal
+		}
+		for _, id := range subtree {
+			if id == parent.ID {
+				return nil, ErrInvalidInput
+			}
+		}
+		folder.ParentID = &parent.ID
+	}
+
+	if err := s.updateFolder(folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+func (s *folderService) DeleteFolder(ctx context.Context, user *model.User, folderID uint) error {
+	if s.folderRepo == nil || s.userTagProvider == nil {
+		return ErrServiceUnavailable
+	}
+	if user == nil {
+		return ErrInvalidInput
+	}
+
+	tagIDs, err := s.userOrgTagIDs(user.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.findAccessibleFolder(folderID, user.ID, tagIDs); err != nil {
+		return err
+	}
+
+	if err := s.folderRepo.Delete(folderID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrFolderNotEmpty):
+			return ErrFolderNotEmpty
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return ErrFolderNotFound
+		}
+		log.Errorf("DeleteFolder: delete folder failed: folder=%d err=%v", folderID, err)
+		return ErrInternal
+	}
+	return nil
+}
+
+func (s *folderService) GetFolderTree(ctx context.Context, user *model.User) ([]*model.FolderNode, error) {
+	if s.folderRepo == nil || s.userTagProvider == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil {
+		return nil, ErrInvalidInput
+	}
+
+	tagIDs, err := s.userOrgTagIDs(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := s.folderRepo.FindAccessible(user.ID, tagIDs)
+	if err != nil {
+		log.Errorf("GetFolderTree: query folders failed: user=%d err=%v", user.ID, err)
+		return nil, ErrInternal
+	}
+
+	folderIDs := make([]uint, 0, len(folders))
+	for _, folder := range folders {
+		folderIDs = append(folderIDs, folder.ID)
+	}
+	counts, err := s.folderRepo.CountDocuments(folderIDs)
+	if err != nil {
+		log.Errorf("GetFolderTree: count documents failed: user=%d err=%v", user.ID, err)
+		return nil, ErrInternal
+	}
+	return buildFolderTree(folders, counts), nil
+}
+
+func (s *folderService) MoveDocument(ctx context.Context, user *model.User, fileMD5 string, folderID uint) error {
+	if s.folderRepo == nil || s.uploadRepo == nil || s.docVectorRepo == nil || s.esClient == nil || s.userTagProvider == nil {
+		return ErrServiceUnavailable
+	}
+	fileMD5 = strings.TrimSpace(fileMD5)
+	if user == nil || fileMD5 == "" {
+		return ErrInvalidInput
+	}
+
+	upload, err := s.uploadRepo.FindByFileMD5AndUserID(fileMD5, user.ID)
+	if err != nil {
+		log.Warnf("MoveDocument: find upload failed: user=%d md5=%s err=%v", user.ID, fileMD5, err)
+		return ErrFileNotFound
+	}
+	if folderID != 0 {
+		tagIDs, err := s.userOrgTagIDs(user.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := s.findAccessibleFolder(folderID, user.ID, tagIDs); err != nil {
+			return err
+		}
+	}
+
+	versions := []model.FileUpload{*upload}
+	if upload.DocumentID != "" {
+		versions, err = s.uploadRepo.FindDocumentVersions(upload.DocumentID)
+		if err != nil {
+			log.Errorf("MoveDocument: list versions failed: document=%s err=%v", upload.DocumentID, err)
+			return ErrInternal
+		}
+	}
+	fileMD5s := uploadFileMD5s(versions)
+	indexedMD5s, err := ownedIndexedMD5s(ctx, "MoveDocument", s.esClient, user.ID, versions)
+	if err != nil {
+		return err
+	}
+
+	if err := s.uploadRepo.UpdateFolder(fileMD5s, user.ID, folderID); err != nil {
+		log.Errorf("MoveDocument: update upload folder failed: md5s=%v err=%v", fileMD5s, err)
+		return ErrInternal
+	}
+	if err := s.docVectorRepo.UpdateFolder(fileMD5s, user.ID, folderID); err != nil {
+		log.Errorf("MoveDocument: update document vectors failed: md5s=%v err=%v", fileMD5s, err)
+		return ErrInternal
+	}
+	if err := ownedIndexUpdateError("MoveDocument", s.esClient.SetFolder(ctx, fileMD5s, user.ID, folderID), fileMD5s, indexedMD5s); err != nil {
+		return err
+	}
+	log.Infof("MoveDocument: 文档已移动: user=%d md5=%s folder=%d versions=%d", user.ID, fileMD5, folderID, len(fileMD5s))
+	return nil
+}
+
+func (s *folderService) ResolveSubtree(ctx context.Context, user *model.User, folderID uint) ([]uint, error) {
+	if s.folderRepo == nil || s.userTagProvider == nil {
+		return nil, ErrServiceUnavailable
+	}
+	if user == nil || folderID == 0 {
+		return nil, ErrInvalidInput
+	}
+
+	tagIDs, err := s.userOrgTagIDs(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.findAccessibleFolder(folderID, user.ID, tagIDs); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.folderRepo.FindSubtreeIDs(folderID)
+	if err != nil {
+		log.Errorf("ResolveSubtree: query subtree failed: folder=%d err=%v", folderID, err)
+		return nil, ErrInternal
+	}
+	return ids, nil
+}
+
+func (s *folderService) userOrgTagIDs(userID uint) ([]string, error) {
+	orgTags, err := s.userTagProvider.GetUserEffectiveOrgTags(userID)
+	if err != nil {
+		return nil, err
+	}
+	return extractOrgTagIDs(orgTags), nil
+}
+
+// findAccessibleFolder 查询文件夹并校验访问权限；无权访问与不存在一样返回 ErrFolderNotFound，避免泄露文件夹是否存在。
+func (s *folderService) findAccessibleFolder(folderID uint, userID uint, tagIDs []string) (*model.Folder, error) {
+	folder, err := s.folderRepo.FindByID(folderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFolderNotFound
+		}
+		log.Errorf("findAccessibleFolder: query folder failed: folder=%d err=%v", folderID, err)
+		return nil, ErrInternal
+	}
+	if !folder.AccessibleBy(userID, tagIDs) {
+		return nil, ErrFolderNotFound
+	}
+	return folder, nil
+}
+
+func (s *folderService) updateFolder(folder *model.Folder) error {
+	if err := s.folderRepo.Update(folder); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFolderNotFound
+		}
+		log.Errorf("updateFolder: update folder failed: folder=%d err=%v", folder.ID, err)
+		return ErrInternal
+	}
+	return nil
+}
+
+func normalizeFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxFolderNameRunes || strings.ContainsAny(name, "/\\") {
+		return "", ErrInvalidInput
+	}
+	return name, nil
+}
+
+// buildFolderTree 按 ParentID 组装文件夹树，folders 须按 id 升序以保证子节点顺序稳定。
+func buildFolderTree(folders []model.Folder, counts map[uint]int64) []*model.FolderNode {
+	nodes := make(map[uint]*model.FolderNode, len(folders))
+	for _, folder := range folders {
+		nodes[folder.ID] = &model.FolderNode{
+			ID:            folder.ID,
+			Name:          folder.Name,
+			ParentID:      folder.ParentID,
+			OrgTag:        folder.OrgTag,
+			DocumentCount: counts[folder.ID],
+			Children:      []*model.FolderNode{},
+		}
+	}
+
+	roots := make([]*model.FolderNode, 0)
+	for _, folder := range folders {
+		node := nodes[folder.ID]
+		if folder.ParentID != nil {
+			if parent, ok := nodes[*folder.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// fakeFolderRepo 用内存 map 模拟 folders 表。
+type fakeFolderRepo struct {
+	folders  map[uint]*model.Folder
+	counts   map[uint]int64
+	nextID   uint
+	deleteFn func(id uint) error
+}
+
+func newFakeFolderRepo(folders ...model.Folder) *fakeFolderRepo {
+	repo := &fakeFolderRepo{folders: map[uint]*model.Folder{}, counts: map[uint]int64{}, nextID: 100}
+	for i := range folders {
+		folder := folders[i]
+		repo.folders[folder.ID] = &folder
+	}
+	return repo
+}
+
+func (f *fakeFolderRepo) Create(folder *model.Folder) error {
+	f.nextID++
+	folder.ID = f.nextID
+	stored := *folder
+	f.folders[folder.ID] = &stored
+	return nil
+}
+
+func (f *fakeFolderRepo) FindByID(id uint) (*model.Folder, error) {
+	folder, ok := f.folders[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *folder
+	return &copied, nil
+}
+
+func (f *fakeFolderRepo) FindAccessible(userID uint, orgTags []string) ([]model.Folder, error) {
+	var result []model.Folder
+	for id := uint(0); id <= f.nextID; id++ {
+		if folder, ok := f.folders[id]; ok && folder.AccessibleBy(userID, orgTags) {
+			result = append(result, *folder)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeFolderRepo) FindSubtreeIDs(rootID uint) ([]uint, error) {
+	ids := []uint{rootID}
+	for i := 0; i < len(ids); i++ {
+		for id := uint(0); id <= f.nextID; id++ {
+			if folder, ok := f.folders[id]; ok && folder.ParentID != nil && *folder.ParentID == ids[i] {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (f *fakeFolderRepo) Update(folder *model.Folder) error {
+	if _, ok := f.folders[folder.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	stored := *folder
+	f.folders[folder.ID] = &stored
+	return nil
+}
+
+func (f *fakeFolderRepo) Delete(id uint) error {
+	if f.deleteFn != nil {
+		return f.deleteFn(id)
+	}
+	delete(f.folders, id)
+	return nil
+}
+
+func (f *fakeFolderRepo) CountDocuments(folderIDs []uint) (map[uint]int64, error) {
+	return f.counts, nil
+}
+
+type fakeFolderESClient struct {
+	fileMD5s []string
+	userID   uint
+	folderID uint
+	// notOwned 中的 fileMD5 在 ES 中没有所有者名下的分块。
+	notOwned map[string]bool
+	calls    int
+}
+
+func (f *fakeFolderESClient) CountDocumentsByOwner(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error) {
+	counts := make(map[string]int64, len(fileMD5s))
+	for _, fileMD5 := range fileMD5s {
+		if !f.notOwned[fileMD5] {
+			counts[fileMD5] = 1
+		}
+	}
+	return counts, nil
+}
+
+func (f *fakeFolderESClient) SetFolder(ctx context.Context, fileMD5s []string, userID uint, folderID uint) error {
+	f.fileMD5s = fileMD5s
+	f.userID = userID
+	f.folderID = folderID
+	f.calls++
+	return nil
+}
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+func newTestFolderService(repo *fakeFolderRepo, uploadRepo *fakeUploadRepo, vectorRepo *fakeDocumentVectorRepo, esClient *fakeFolderESClient) FolderService {
+	tags := &fakeDocumentUserTagProvider{
+		getUserEffectiveOrgTagsFn: func(userID uint) ([]model.OrganizationTag, error) {
+			if userID == 1 {
+				return []model.OrganizationTag{{TagID: "team-a"}}, nil
+			}
+			return []model.OrganizationTag{}, nil
+		},
+	}
+	return NewFolderService(repo, uploadRepo, vectorRepo, esClient, tags)
+}
+
+func TestFolderService_GetFolderTree(t *testing.T) {
+	repo := newFakeFolderRepo(
+		model.Folder{ID: 1, Name: "个人", UserID: 1},
+		model.Folder{ID: 2, Name: "团队", UserID: 3, OrgTag: "team-a"},
+		model.Folder{ID: 3, Name: "手册", UserID: 3, OrgTag: "team-a", ParentID: uintPtr(2)},
+		model.Folder{ID: 4, Name: "别人的", UserID: 2},
+	)
+	repo.nextID = 4
+	repo.counts[3] = 2
+	svc := newTestFolderService(repo, &fakeUploadRepo{}, &fakeDocumentVectorRepo{}, &fakeFolderESClient{})
+
+	tree, err := svc.GetFolderTree(context.Background(), &model.User{ID: 1})
+	if err != nil {
+		t.Fatalf("GetFolderTree() error: %v", err)
+	}
+	if len(tree) != 2 || tree[0].ID != 1 || tree[1].ID != 2 {
+		t.Fatalf("unexpected roots: %+v", tree)
+	}
+	if len(tree[1].Children) != 1 || tree[1].Children[0].ID != 3 || tree[1].Children[0].DocumentCount != 2 {
+		t.Fatalf("unexpected children: %+v", tree[1].Children)
+	}
+}
+
+func TestFolderService_CreateAndMoveFolder(t *testing.T) {
+	repo := newFakeFolderRepo(
+		model.Folder{ID: 1, Name: "根", UserID: 1},
+		model.Folder{ID: 2, Name: "子", UserID: 1, ParentID: uintPtr(1)},
+		model.Folder{ID: 3, Name: "团队", UserID: 3, OrgTag: "team-a"},
+	)
+	repo.nextID = 3
+	svc := newTestFolderService(repo, &fakeUploadRepo{}, &fakeDocumentVectorRepo{}, &fakeFolderESClient{})
+	ctx := context.Background()
+	user := &model.User{ID: 1}
+
+	child, err := svc.CreateFolder(ctx, user, " 季度报告 ", uintPtr(3), "")
+	if err != nil {
+		t.Fatalf("CreateFolder() error: %v", err)
+	}
+	if child.Name != "季度报告" || child.OrgTag != "team-a" || child.ParentID == nil || *child.ParentID != 3 {
+		t.Fatalf("expected child to inherit the org folder scope, got %+v", child)
+	}
+	if _, err := svc.CreateFolder(ctx, user, "a/b", nil, ""); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput for a name with a slash, got %v", err)
+	}
+	if _, err := svc.CreateFolder(ctx, user, "外部", nil, "team-b"); !errors.Is(err, ErrOrgTagNotOwned) {
+		t.Fatalf("expected ErrOrgTagNotOwned, got %v", err)
+	}
+
+	if _, err := svc.MoveFolder(ctx, user, 1, uintPtr(2)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected moving a folder under its child to fail, got %v", err)
+	}
+	if _, err := svc.MoveFolder(ctx, user, 2, uintPtr(3)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected moving a personal folder into an org folder to fail, got %v", err)
+	}
+	moved, err := svc.MoveFolder(ctx, user, 2, nil)
+	if err != nil || moved.ParentID != nil || repo.folders[2].ParentID != nil {
+		t.Fatalf("expected folder moved to root, got %+v err=%v", moved, err)
+	}
+}
+
+func TestFolderService_DeleteFolder(t *testing.T) {
+	repo := newFakeFolderRepo(
+		model.Folder{ID: 1, Name: "根", UserID: 1},
+		model.Folder{ID: 2, Name: "别人的", UserID: 2},
+	)
+	repo.deleteFn = func(id uint) error { return repository.ErrFolderNotEmpty }
+	svc := newTestFolderService(repo, &fakeUploadRepo{}, &fakeDocumentVectorRepo{}, &fakeFolderESClient{})
+	ctx := context.Background()
+
+	if err := svc.DeleteFolder(ctx, &model.User{ID: 1}, 1); !errors.Is(err, ErrFolderNotEmpty) {
+		t.Fatalf("expected ErrFolderNotEmpty, got %v", err)
+	}
+	if err := svc.DeleteFolder(ctx, &model.User{ID: 1}, 2); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("expected another user's folder to be hidden, got %v", err)
+	}
+}
+
+func TestFolderService_MoveDocumentMovesAllVersions(t *testing.T) {
+	repo := newFakeFolderRepo(model.Folder{ID: 5, Name: "团队", UserID: 3, OrgTag: "team-a"})
+	var movedUploads, movedVectors []string
+	var vectorOwner uint
+	uploadRepo := &fakeUploadRepo{
+		findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+			if fileMD5 != "md5-v2" || userID != 1 {
+				return nil, gorm.ErrRecordNotFound
+			}
+			return &model.FileUpload{FileMD5: fileMD5, UserID: userID, DocumentID: "doc-1"}, nil
+		},
+		findDocumentVersionsFn: func(documentID string) ([]model.FileUpload, error) {
+			return []model.FileUpload{{FileMD5: "md5-v2"}, {FileMD5: "md5-v1"}}, nil
+		},
+		updateFolderFn: func(fileMD5s []string, userID uint, folderID uint) error {
+			movedUploads = fileMD5s
+			return nil
+		},
+	}
+	vectorRepo := &fakeDocumentVectorRepo{
+		updateFolderFn: func(fileMD5s []string, userID uint, folderID uint) error {
+			movedVectors, vectorOwner = fileMD5s, userID
+			return nil
+		},
+	}
+	esClient := &fakeFolderESClient{}
+	svc := newTestFolderService(repo, uploadRepo, vectorRepo, esClient)
+	ctx := context.Background()
+
+	if err := svc.MoveDocument(ctx, &model.User{ID: 1}, "md5-v2", 5); err != nil {
+		t.Fatalf("MoveDocument() error: %v", err)
+	}
+	if len(movedUploads) != 2 || len(movedVectors) != 2 || len(esClient.fileMD5s) != 2 || esClient.folderID != 5 {
+		t.Fatalf("expected both versions moved, uploads=%v vectors=%v es=%v folder=%d", movedUploads, movedVectors, esClient.fileMD5s, esClient.folderID)
+	}
+	if vectorOwner != 1 || esClient.userID != 1 {
+		t.Fatalf("expected vector and es updates scoped to the owner, vectors=%d es=%d", vectorOwner, esClient.userID)
+	}
+
+	if err := svc.MoveDocument(ctx, &model.User{ID: 2}, "md5-v2", 0); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("expected ErrFileNotFound for a non-owner, got %v", err)
+	}
+	if err := svc.MoveDocument(ctx, &model.User{ID: 1}, "md5-v2", 9); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("expected ErrFolderNotFound for a missing folder, got %v", err)
+	}
+}
+
+func TestFolderService_MoveDocumentRejectsIndexHeldByOtherUploader(t *testing.T) {
+	repo := newFakeFolderRepo(model.Folder{ID: 5, Name: "团队", UserID: 3, OrgTag: "team-a"})
+	var uploadCalls int
+	uploadRepo := &fakeUploadRepo{
+		findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+			return &model.FileUpload{FileMD5: fileMD5, UserID: userID, ProcessingStatus: model.FileProcessingStatusIndexed}, nil
+		},
+		updateFolderFn: func(fileMD5s []string, userID uint, folderID uint) error {
+			uploadCalls++
+			return nil
+		},
+	}
+	esClient := &fakeFolderESClient{notOwned: map[string]bool{"md5-shared": true}}
+	svc := newTestFolderService(repo, uploadRepo, &fakeDocumentVectorRepo{}, esClient)
+
+	err := svc.MoveDocument(context.Background(), &model.User{ID: 1}, "md5-shared", 5)
+	if !errors.Is(err, ErrDocumentIndexStale) {
+		t.Fatalf("expected ErrDocumentIndexStale, got %v", err)
+	}
+	if uploadCalls != 0 || esClient.calls != 0 {
+		t.Fatalf("expected nothing moved, uploads=%d es=%d", uploadCalls, esClient.calls)
+	}
+}
+
+func TestFolderService_ResolveSubtree(t *testing.T) {
+	repo := newFakeFolderRepo(
+		model.Folder{ID: 1, Name: "团队", UserID: 3, OrgTag: "team-a"},
+		model.Folder{ID: 2, Name: "子", UserID: 3, OrgTag: "team-a", ParentID: uintPtr(1)},
+	)
+	repo.nextID = 2
+	svc := newTestFolderService(repo, &fakeUploadRepo{}, &fakeDocumentVectorRepo{}, &fakeFolderESClient{})
+	ctx := context.Background()
+
+	ids, err := svc.ResolveSubtree(ctx, &model.User{ID: 1}, 1)
+	if err != nil || len(ids) != 2 || ids[1] != 2 {
+		t.Fatalf("unexpected subtree: %v err=%v", ids, err)
+	}
+	if _, err := svc.ResolveSubtree(ctx, &model.User{ID: 2}, 1); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("expected ErrFolderNotFound outside the org, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
+	"pai_smart_go_v2/pkg/embedding"
+	"pai_smart_go_v2/pkg/log"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIndexMigrationNotFound = errors.New("index migration not found")
+	ErrIndexMigrationRunning  = errors.New("index migration already running")
+)
+
+// IndexMigrationRunner 执行一次索引迁移（见 pipeline.IndexMigrator），结束时自行落库最终状态。
+type IndexMigrationRunner interface {
+	Run(ctx context.Context, migration *model.IndexMigration, client embedding.Client) error
+}
+
+// EmbeddingClientFactory 按模型和维度创建 embedding 客户端，其余参数沿用当前配置。
+type EmbeddingClientFactory func(model string, dimensions int) (embedding.Client, error)
+
+// IndexMigrationService 供管理员发起 embedding 模型迁移并查看进度；同一进程同时只允许一个迁移。
+type IndexMigrationService interface {
+	StartMigration(ctx context.Context, modelVersion string, vectorDims int) (*model.IndexMigration, error)
+	ListMigrations(ctx context.Context, limit int) ([]model.IndexMigration, error)
+	GetMigration(ctx context.Context, id uint) (*model.IndexMigration, error)
+}
+
+type indexMigrationService struct {
+	migrationRepo repository.IndexMigrationRepository
+	runner        IndexMigrationRunner
+	newClient     EmbeddingClientFactory
+
+	mu      sync.Mutex
+	running bool
+}
+
+func NewIndexMigrationService(
+	migrationRepo repository.IndexMigrationRepository,
+	runner IndexMigrationRunner,
+	newClient EmbeddingClientFactory,
+) IndexMigrationService {
+	return &indexMigrationService{
+		migrationRepo: migrationRepo,
+		runner:        runner,
+		newClient:     newClient,
+	}
+}
+
+func (s *indexMigrationService) StartMigration(ctx context.Context, modelVersion string, vectorDims int) (*model.IndexMigration, error) {
+	if s.migrationRepo == nil || s.runner == nil || s.newClient == nil {
+		return nil, ErrServiceUnavailable
+	}
+	modelVersion = strings.TrimSpace(modelVersion)
+	if modelVersion == "" || vectorDims <= 0 {
+		return nil, ErrInvalidInput
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return nil, ErrIndexMigrationRunning
+	}
+
+	client, err := s.newClient(modelVersion, vectorDims)
+	if err != nil {
+		log.Errorf("StartMigration: create embedding client failed: model=%s err=%v", modelVersion, err)
+		return nil, ErrInternal
+	}
+
+	migration := &model.IndexMigration{
+		ModelVersion: modelVersion,
+		VectorDims:   vectorDims,
+		Status:       model.IndexMigrationStatusRunning,
+		StartedAt:    time.Now(),
+	}
+	if err := s.migrationRepo.Create(migration); err != nil {
+		log.Errorf("StartMigration: create record failed: %v", err)
+		return nil, ErrInternal
+	}
+	snapshot := *migration
+
+	s.running = true
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			s.running = false
+			s.mu.Unlock()
+		}()
+		// 迁移耗时远超单个请求，不能沿用请求的 ctx。
+		_ = s.runner.Run(context.Background(), migration, client)
+	}()
+
+	log.Infof("StartMigration: 已启动索引迁移: id=%d model=%s dims=%d", snapshot.ID, modelVersion, vectorDims)
+	return &snapshot, nil
+}
+
+func (s *indexMigrationService) ListMigrations(ctx context.Context, limit int) ([]model.IndexMigration, error) {
+	if s.migrationRepo == nil {
+		return nil, ErrServiceUnavailable
+	}
+	migrations, err := s.migrationRepo.List(limit)
+	if err != nil {
+		log.Errorf("ListMigrations: query failed: %v", err)
+		return nil, ErrInternal
+	}
+	return migrations, nil
+}
+
+func (s *indexMigrationService) GetMigration(ctx context.Context, id uint) (*model.IndexMigration, error) {
+	if s.migrationRepo == nil {
+		return nil, ErrServiceUnavailable
+	}
+	migration, err := s.migrationRepo.FindByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrIndexMigrationNotFound
+		}
+		log.Errorf("GetMigration: query failed: %v", err)
+		return nil, ErrInternal
+	}
+	return migration, nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/pkg/embedding"
+
+	"gorm.io/gorm"
+)
+
+type fakeIndexMigrationRepo struct {
+	mu      sync.Mutex
+	created []model.IndexMigration
+}
+
+func (f *fakeIndexMigrationRepo) Create(migration *model.IndexMigration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	migration.ID = uint(len(f.created) + 1)
+	f.created = append(f.created, *migration)
+	return nil
+}
+
+func (f *fakeIndexMigrationRepo) Save(migration *model.IndexMigration) error { return nil }
+
+func (f *fakeIndexMigrationRepo) FindByID(id uint) (*model.IndexMigration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if int(id) > len(f.created) || id == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	migration := f.created[id-1]
+	return &migration, nil
+}
+
+func (f *fakeIndexMigrationRepo) List(limit int) ([]model.IndexMigration, error) {
+	return f.created, nil
+}
+
+func (f *fakeIndexMigrationRepo) MarkInterrupted(finishedAt time.Time) (int64, error) {
+	return 0, nil
+}
+
+type fakeIndexMigrationRunner struct {
+	started chan *model.IndexMigration
+	release chan struct{}
+}
+
+func (f *fakeIndexMigrationRunner) Run(ctx context.Context, migration *model.IndexMigration, client embedding.Client) error {
+	f.started <- migration
+	<-f.release
+	migration.Status = model.IndexMigrationStatusCompleted
+	return nil
+}
+
+func TestIndexMigrationService_StartMigration_RejectsConcurrentRun(t *testing.T) {
+	runner := &fakeIndexMigrationRunner{started: make(chan *model.IndexMigration, 1), release: make(chan struct{})}
+	var gotModel string
+	var gotDims int
+	svc := NewIndexMigrationService(&fakeIndexMigrationRepo{}, runner, func(model string, dimensions int) (embedding.Client, error) {
+		gotModel, gotDims = model, dimensions
+		return &fakeSearchEmbeddingClient{}, nil
+	})
+
+	migration, err := svc.StartMigration(context.Background(), " text-embedding-v4 ", 1024)
+	if err != nil {
+		t.Fatalf("StartMigration() error = %v", err)
+	}
+	if migration.ID != 1 || migration.Status != model.IndexMigrationStatusRunning || gotModel != "text-embedding-v4" || gotDims != 1024 {
+		t.Fatalf("unexpected migration: %+v model=%s dims=%d", migration, gotModel, gotDims)
+	}
+	<-runner.started
+
+	if _, err := svc.StartMigration(context.Background(), "text-embedding-v4", 1024); !errors.Is(err, ErrIndexMigrationRunning) {
+		t.Fatalf("expected ErrIndexMigrationRunning, got %v", err)
+	}
+
+	close(runner.release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := svc.StartMigration(context.Background(), "text-embedding-v4", 1024)
+		if err == nil {
+			<-runner.started
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected migration slot to be released, last err=%v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestIndexMigrationService_StartMigration_InvalidInput(t *testing.T) {
+	svc := NewIndexMigrationService(&fakeIndexMigrationRepo{}, &fakeIndexMigrationRunner{}, func(model string, dimensions int) (embedding.Client, error) {
+		t.Fatalf("client factory should not be called")
+		return nil, nil
+	})
+
+	if _, err := svc.StartMigration(context.Background(), "", 1024); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput for empty model, got %v", err)
+	}
+	if _, err := svc.StartMigration(context.Background(), "text-embedding-v4", 0); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput for zero dims, got %v", err)
+	}
+}
+
+func TestIndexMigrationService_GetMigration_NotFound(t *testing.T) {
+	svc := NewIndexMigrationService(&fakeIndexMigrationRepo{}, nil, nil)
+
+	if _, err := svc.GetMigration(context.Background(), 9); !errors.Is(err, ErrIndexMigrationNotFound) {
+		t.Fatalf("expected ErrIndexMigrationNotFound, got %v", err)
+	}
+}
@@ -3,12 +3,15 @@ package service
 import (
 	"context"
 	"strings"
+	"time"
 	"unicode"
 
+	"pai_smart_go_v2/internal/config"
 	"pai_smart_go_v2/internal/model"
 	"pai_smart_go_v2/pkg/embedding"
 	"pai_smart_go_v2/pkg/es"
 	"pai_smart_go_v2/pkg/log"
+	"pai_smart_go_v2/pkg/rerank"
 )
 
 const (
@@ -17,8 +20,18 @@ const (
 	knnRecallMultiplier     = 30
 	numCandidatesMultiplier = 60
 	rescoreWindowMultiplier = 5
+	defaultRerankTopN       = 20
+	// titleMatchBoost 标题与查询匹配时的加权，低于短语匹配（2.0），高于正文普通匹配（1.0）。
+	titleMatchBoost = 1.5
+	// maxScopeFiles 是检索范围中最多可指定的文件数。
+	maxScopeFiles = 100
+	// facetBucketSize 是分面检索时每个分面最多返回的取值数。
+	facetBucketSize = 20
 )
 
+// facetNames 是分面检索固定返回的分面，没有命中的分面返回空数组。
+var facetNames = []string{es.FacetTags, es.FacetOrgTags, es.FacetFileTypes, es.FacetUploaders, es.FacetUploadMonths}
+
 var searchStopwords = []string{
 	"请问", "请教", "帮我", "帮忙", "一下", "一下子", "一下吧",
 	"什么是", "是什么", "如何", "怎么", "怎样", "为什么",
@@ -27,12 +40,79 @@ var searchStopwords = []string{
 
 type SearchService interface {
 	HybridSearch(ctx context.Context, query string, topK int, user *model.User) ([]model.SearchResponseDTO, error)
+	// HybridSearchWithFilter 在权限过滤之外再按文档元数据过滤。
+	HybridSearchWithFilter(ctx context.Context, query string, topK int, user *model.User, filter SearchFilter) ([]model.SearchResponseDTO, error)
+	// FacetedSearch 与 HybridSearchWithFilter 相同，另外返回命中文档按标签、组织、文件类型、上传者和上传月份的分布。
+	FacetedSearch(ctx context.Context, query string, topK int, user *model.User, filter SearchFilter) (*FacetedSearchResult, error)
+	// ValidateScope 校验用户能否使用对话范围，范围中的文件夹不存在或无权访问时返回对应错误。
+	ValidateScope(ctx context.Context, user *model.User, scope *model.ChatScope) error
+}
+
+// FacetedSearchResult 是分面检索的结果；Facets 的计数是去重后的文档数，统计范围是全部命中文档而不只是返回的前 topK 条。
+type FacetedSearchResult struct {
+	Results []model.SearchResponseDTO `json:"results"`
+	Facets  es.Facets                 `json:"facets"`
+}
+
+// SearchFilter 是检索时可选的文档元数据条件，零值字段不生效；日期和页数区间均为闭区间。
+type SearchFilter struct {
+	Language     string
+	Author       string
+	AuthoredFrom *time.Time
+	AuthoredTo   *time.Time
+	MinPages     int
+	MaxPages     int
+	// AllVersions 为 true 时同时检索已被新版本取代的旧版本，默认只检索各文档的最新版本。
+	AllVersions bool
+	// FolderID 非 0 时只检索该文件夹及其全部子文件夹中的文档。
+	FolderID uint
+	// Scope 是对话选定的知识库范围，各条件取并集后与其他过滤条件叠加。
+	Scope *model.ChatScope
+	// Tags 中的标签必须全部命中；CustomMetadata 按键精确匹配。
+	Tags           []string
+	CustomMetadata map[string]string
+	FileType       string
+	OrgTag         string
+	UploaderID     uint
+	UploadedFrom   *time.Time
+	UploadedTo     *time.Time
+}
+
+func (f SearchFilter) validate() error {
+	if f.MinPages < 0 || f.MaxPages < 0 {
+		return ErrInvalidInput
+	}
+	if f.MaxPages > 0 && f.MinPages > f.MaxPages {
+		return ErrInvalidInput
+	}
+	if f.AuthoredFrom != nil && f.AuthoredTo != nil && f.AuthoredFrom.After(*f.AuthoredTo) {
+		return ErrInvalidInput
+	}
+	if f.Scope != nil && len(f.Scope.FileMD5s) > maxScopeFiles {
+		return ErrInvalidInput
+	}
+	if f.UploadedFrom != nil && f.UploadedTo != nil && f.UploadedFrom.After(*f.UploadedTo) {
+		return ErrInvalidInput
+	}
+	if len(f.Tags) > maxDocumentTags || len(f.CustomMetadata) > maxCustomMetadataKeys {
+		return ErrInvalidInput
+	}
+	for key := range f.CustomMetadata {
+		if !customMetadataKeyPattern.MatchString(key) {
+			return ErrInvalidInput
+		}
+	}
+	return nil
 }
 
 type searchUserOrgTagProvider interface {
 	GetUserEffectiveOrgTags(userID uint) ([]model.OrganizationTag, error)
 }
 
+type searchFolderResolver interface {
+	ResolveSubtree(ctx context.Context, user *model.User, folderID uint) ([]uint, error)
+}
+
 type searchUploadRepository interface {
 	FindBatchByMD5s(fileMD5s []string) ([]model.FileUpload, error)
 }
@@ -42,33 +122,133 @@ type searchService struct {
 	esClient        es.Client
 	userService     searchUserOrgTagProvider
 	uploadRepo      searchUploadRepository
+	folderResolver  searchFolderResolver
+	reranker        rerank.Reranker
+	rerankCfg       config.RerankConfig
 }
 
+// NewSearchService 创建检索服务；reranker 为 nil 时跳过重排，直接返回 ES 的排序结果；
+// folderResolver 为 nil 时不支持按文件夹限定检索范围。
 func NewSearchService(
 	embeddingClient embedding.Client,
 	esClient es.Client,
 	userService searchUserOrgTagProvider,
 	uploadRepo searchUploadRepository,
+	folderResolver searchFolderResolver,
+	reranker rerank.Reranker,
+	rerankCfg config.RerankConfig,
 ) SearchService {
 	return &searchService{
 		embeddingClient: embeddingClient,
 		esClient:        esClient,
 		userService:     userService,
 		uploadRepo:      uploadRepo,
+		folderResolver:  folderResolver,
+		reranker:        reranker,
+		rerankCfg:       rerankCfg,
 	}
 }
 
+func (s *searchService) resolveFolderSubtree(ctx context.Context, user *model.User, folderID uint) ([]uint, error) {
+	if s.folderResolver == nil {
+		return nil, ErrServiceUnavailable
+	}
+	return s.folderResolver.ResolveSubtree(ctx, user, folderID)
+}
+
+// buildScopeFilter 把对话范围转换为 ES 过滤条件，范围中的文件夹展开为整棵子树。
+func (s *searchService) buildScopeFilter(ctx context.Context, user *model.User, scope *model.ChatScope) (es.ScopeFilter, error) {
+	scope = normalizeChatScope(scope)
+	if scope == nil {
+		return es.ScopeFilter{}, nil
+	}
+
+	filter := es.ScopeFilter{FileMD5s: scope.FileMD5s}
+	if scope.OrgTag != "" {
+		filter.OrgTags = []string{scope.OrgTag}
+	}
+	if scope.FolderID != 0 {
+		folderIDs, err := s.resolveFolderSubtree(ctx, user, scope.FolderID)
+		if err != nil {
+			return es.ScopeFilter{}, err
+		}
+		filter.FolderIDs = folderIDs
+	}
+	return filter, nil
+}
+
+func (s *searchService) ValidateScope(ctx context.Context, user *model.User, scope *model.ChatScope) error {
+	_, err := s.buildScopeFilter(ctx, user, scope)
+	return err
+}
+
 func (s *searchService) HybridSearch(ctx context.Context, query string, topK int, user *model.User) ([]model.SearchResponseDTO, error) {
-	if s.embeddingClient == nil || s.esClient == nil || s.userService == nil || s.uploadRepo == nil {
+	return s.HybridSearchWithFilter(ctx, query, topK, user, SearchFilter{})
+}
+
+func (s *searchService) HybridSearchWithFilter(ctx context.Context, query string, topK int, user *model.User, filter SearchFilter) ([]model.SearchResponseDTO, error) {
+	req, rawQuery, topK, err := s.buildSearchRequest(ctx, query, topK, user, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	hits, err := s.esClient.SearchDocuments(ctx, req)
+	if err != nil {
+		log.Errorf("HybridSearch: elasticsearch query failed: %v", err)
 		return nil, ErrInternal
 	}
+	results, err := s.toSearchResults(hits)
+	if err != nil {
+		return nil, err
+	}
+	return s.rerankResults(ctx, rawQuery, results, topK), nil
+}
+
+func (s *searchService) FacetedSearch(ctx context.Context, query string, topK int, user *model.User, filter SearchFilter) (*FacetedSearchResult, error) {
+	req, rawQuery, topK, err := s.buildSearchRequest(ctx, query, topK, user, filter)
+	if err != nil {
+		return nil, err
+	}
+	req.FacetSize = facetBucketSize
+
+	hits, facets, err := s.esClient.SearchDocumentsWithFacets(ctx, req)
+	if err != nil {
+		log.Errorf("FacetedSearch: elasticsearch query failed: %v", err)
+		return nil, ErrInternal
+	}
+	results, err := s.toSearchResults(hits)
+	if err != nil {
+		return nil, err
+	}
+
+	normalizedFacets := make(es.Facets, len(facetNames))
+	for _, name := range facetNames {
+		normalizedFacets[name] = facets[name]
+		if normalizedFacets[name] == nil {
+			normalizedFacets[name] = []es.FacetBucket{}
+		}
+	}
+	return &FacetedSearchResult{
+		Results: s.rerankResults(ctx, rawQuery, results, topK),
+		Facets:  normalizedFacets,
+	}, nil
+}
+
+// buildSearchRequest 校验参数并构造 ES 检索请求，返回原始查询和规范化后的 topK 供重排使用。
+func (s *searchService) buildSearchRequest(ctx context.Context, query string, topK int, user *model.User, filter SearchFilter) (es.SearchRequest, string, int, error) {
+	if s.embeddingClient == nil || s.esClient == nil || s.userService == nil || s.uploadRepo == nil {
+		return es.SearchRequest{}, "", 0, ErrInternal
+	}
 	if user == nil {
-		return nil, ErrInvalidInput
+		return es.SearchRequest{}, "", 0, ErrInvalidInput
+	}
+	if err := filter.validate(); err != nil {
+		return es.SearchRequest{}, "", 0, err
 	}
 
 	rawQuery := strings.TrimSpace(query)
 	if rawQuery == "" {
-		return nil, ErrInvalidInput
+		return es.SearchRequest{}, "", 0, ErrInvalidInput
 	}
 
 	topK = normalizeTopK(topK)
@@ -78,37 +258,74 @@ func (s *searchService) HybridSearch(ctx context.Context, query string, topK int
 		phraseQuery = normalizedQuery
 	}
 	if normalizedQuery == "" {
-		return nil, ErrInvalidInput
+		return es.SearchRequest{}, "", 0, ErrInvalidInput
 	}
 
 	orgTags, err := s.userService.GetUserEffectiveOrgTags(user.ID)
 	if err != nil {
-		return nil, err
+		return es.SearchRequest{}, "", 0, err
+	}
+
+	var folderIDs []uint
+	if filter.FolderID != 0 {
+		folderIDs, err = s.resolveFolderSubtree(ctx, user, filter.FolderID)
+		if err != nil {
+			return es.SearchRequest{}, "", 0, err
+		}
+	}
+	scope, err := s.buildScopeFilter(ctx, user, filter.Scope)
+	if err != nil {
+		return es.SearchRequest{}, "", 0, err
 	}
 
 	queryVector, err := s.embeddingClient.CreateEmbedding(ctx, rawQuery)
 	if err != nil {
 		log.Errorf("HybridSearch: create query embedding failed: %v", err)
-		return nil, ErrInternal
+		return es.SearchRequest{}, "", 0, ErrInternal
+	}
+
+	// 启用重排时多召回一些候选，由重排决定最终的 topK；KNN 和 rescore 的窗口按候选数放大。
+	candidateK := topK
+	if s.reranker != nil && s.rerankTopN() > candidateK {
+		candidateK = s.rerankTopN()
 	}
 
-	hits, err := s.esClient.SearchDocuments(ctx, es.SearchRequest{
+	return es.SearchRequest{
 		QueryVector:        queryVector,
 		Query:              normalizedQuery,
 		Phrase:             phraseQuery,
-		TopK:               topK,
-		KNNK:               topK * knnRecallMultiplier,
-		NumCandidates:      topK * numCandidatesMultiplier,
-		RescoreWindow:      topK * rescoreWindowMultiplier,
+		TopK:               candidateK,
+		KNNK:               candidateK * knnRecallMultiplier,
+		NumCandidates:      candidateK * numCandidatesMultiplier,
+		RescoreWindow:      candidateK * rescoreWindowMultiplier,
 		QueryWeight:        0.35,
 		RescoreQueryWeight: 1.25,
 		UserID:             user.ID,
 		OrgTags:            extractOrgTagIDs(orgTags),
-	})
-	if err != nil {
-		log.Errorf("HybridSearch: elasticsearch query failed: %v", err)
-		return nil, ErrInternal
-	}
+		Metadata: es.MetadataFilter{
+			Language:       filter.Language,
+			Author:         filter.Author,
+			AuthoredFrom:   filter.AuthoredFrom,
+			AuthoredTo:     filter.AuthoredTo,
+			MinPages:       filter.MinPages,
+			MaxPages:       filter.MaxPages,
+			Tags:           filter.Tags,
+			FileType:       filter.FileType,
+			OrgTag:         filter.OrgTag,
+			UploaderID:     filter.UploaderID,
+			UploadedFrom:   filter.UploadedFrom,
+			UploadedTo:     filter.UploadedTo,
+			CustomMetadata: filter.CustomMetadata,
+		},
+		TitleBoost:        titleMatchBoost,
+		IncludeSuperseded: filter.AllVersions,
+		FolderIDs:         folderIDs,
+		Scope:             scope,
+	}, rawQuery, topK, nil
+}
+
+// toSearchResults 把 ES 命中转换为检索结果，并补上文件名。
+func (s *searchService) toSearchResults(hits []es.SearchHit) ([]model.SearchResponseDTO, error) {
 	if len(hits) == 0 {
 		return []model.SearchResponseDTO{}, nil
 	}
@@ -130,20 +347,84 @@ func (s *searchService) HybridSearch(ctx context.Context, query string, topK int
 	results := make([]model.SearchResponseDTO, 0, len(hits))
 	for _, hit := range hits {
 		results = append(results, model.SearchResponseDTO{
-			FileMD5:     hit.Source.FileMD5,
-			FileName:    fileNameByMD5[hit.Source.FileMD5],
-			ChunkID:     hit.Source.ChunkID,
-			TextContent: hit.Source.TextContent,
-			Score:       hit.Score,
-			UserID:      hit.Source.UserID,
-			OrgTag:      hit.Source.OrgTag,
-			IsPublic:    hit.Source.IsPublic,
+			FileMD5:        hit.Source.FileMD5,
+			FileName:       fileNameByMD5[hit.Source.FileMD5],
+			ChunkID:        hit.Source.ChunkID,
+			TextContent:    hit.Source.TextContent,
+			Score:          hit.Score,
+			UserID:         hit.Source.UserID,
+			OrgTag:         hit.Source.OrgTag,
+			IsPublic:       hit.Source.IsPublic,
+			Title:          hit.Source.Title,
+			Author:         hit.Source.Author,
+			PageCount:      hit.Source.PageCount,
+			Language:       hit.Source.Language,
+			PageStart:      hit.Source.PageStart,
+			PageEnd:        hit.Source.PageEnd,
+			CharStart:      hit.Source.CharStart,
+			CharEnd:        hit.Source.CharEnd,
+			SectionPath:    hit.Source.SectionPath,
+			Superseded:     hit.Source.Superseded,
+			FolderID:       hit.Source.FolderID,
+			Tags:           hit.Source.Tags,
+			CustomMetadata: hit.Source.CustomMetadata,
+			FileType:       hit.Source.FileType,
 		})
 	}
-
 	return results, nil
 }
 
+// rerankResults 对前 rerankTopN 条结果重排并截断到 topK。
+// 重排失败时保留 ES 原始排序，不让可选阶段影响检索可用性。
+func (s *searchService) rerankResults(ctx context.Context, query string, results []model.SearchResponseDTO, topK int) []model.SearchResponseDTO {
+	if s.reranker != nil && len(results) > 1 {
+		n := s.rerankTopN()
+		if n > len(results) {
+			n = len(results)
+		}
+		documents := make([]string, 0, n)
+		for _, result := range results[:n] {
+			documents = append(documents, result.TextContent)
+		}
+
+		ranked, err := s.reranker.Rerank(ctx, query, documents)
+		if err != nil {
+			log.Warnf("HybridSearch: rerank failed, keep elasticsearch order: %v", err)
+		} else {
+			reordered := make([]model.SearchResponseDTO, 0, len(results))
+			used := make([]bool, n)
+			for _, item := range ranked {
+				if item.Index < 0 || item.Index >= n || used[item.Index] {
+					continue
+				}
+				used[item.Index] = true
+				result := results[item.Index]
+				result.Score = item.Score
+				reordered = append(reordered, result)
+			}
+			// 重排接口可能只返回部分结果，其余候选保持原顺序接在后面。
+			for i := 0; i < n; i++ {
+				if !used[i] {
+					reordered = append(reordered, results[i])
+				}
+			}
+			results = append(reordered, results[n:]...)
+		}
+	}
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+func (s *searchService) rerankTopN() int {
+	if s.rerankCfg.TopN > 0 {
+		return s.rerankCfg.TopN
+	}
+	return defaultRerankTopN
+}
+
 func normalizeQuery(query string) (normalized string, phrase string) {
 	cleaned := strings.ToLower(strings.TrimSpace(query))
 	for _, stopword := range searchStopwords {
@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"pai_smart_go_v2/internal/config"
 	"pai_smart_go_v2/internal/model"
 	"pai_smart_go_v2/pkg/es"
+	"pai_smart_go_v2/pkg/rerank"
 )
 
 type fakeSearchEmbeddingClient struct {
@@ -20,14 +23,47 @@ func (f *fakeSearchEmbeddingClient) CreateEmbedding(ctx context.Context, text st
 	return nil, nil
 }
 
+func (f *fakeSearchEmbeddingClient) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vector, err := f.CreateEmbedding(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, vector)
+	}
+	return vectors, nil
+}
+
 type fakeSearchESClient struct {
-	searchDocumentsFn func(ctx context.Context, req es.SearchRequest) ([]es.SearchHit, error)
+	searchDocumentsFn           func(ctx context.Context, req es.SearchRequest) ([]es.SearchHit, error)
+	searchDocumentsWithFacetsFn func(ctx context.Context, req es.SearchRequest) ([]es.SearchHit, es.Facets, error)
 }
 
 func (f *fakeSearchESClient) EnsureIndex(ctx context.Context) error {
 	return nil
 }
 
+func (f *fakeSearchESClient) ActiveIndex(ctx context.Context) (string, error) {
+	return "knowledge_base_v1", nil
+}
+
+func (f *fakeSearchESClient) ActiveIndexModel(ctx context.Context) (es.IndexModel, error) {
+	return es.IndexModel{Index: "knowledge_base_v1"}, nil
+}
+
+func (f *fakeSearchESClient) CreateIndexVersion(ctx context.Context, vectorDims int, modelVersion string) (string, error) {
+	return "knowledge_base_v2", nil
+}
+
+func (f *fakeSearchESClient) SwapAlias(ctx context.Context, index string) error {
+	return nil
+}
+
+func (f *fakeSearchESClient) ForIndex(index string) es.Client {
+	return f
+}
+
 func (f *fakeSearchESClient) BulkIndexDocuments(ctx context.Context, docs []model.EsDocument) error {
 	return nil
 }
@@ -39,6 +75,41 @@ func (f *fakeSearchESClient) SearchDocuments(ctx context.Context, req es.SearchR
 	return nil, nil
 }
 
+func (f *fakeSearchESClient) SearchDocumentsWithFacets(ctx context.Context, req es.SearchRequest) ([]es.SearchHit, es.Facets, error) {
+	if f.searchDocumentsWithFacetsFn != nil {
+		return f.searchDocumentsWithFacetsFn(ctx, req)
+	}
+	return nil, es.Facets{}, nil
+}
+
+func (f *fakeSearchESClient) DeleteDocumentsByVectorIDs(ctx context.Context, vectorIDs []string) error {
+	return nil
+}
+
+func (f *fakeSearchESClient) CountDocumentsByOwner(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error) {
+	return map[string]int64{}, nil
+}
+
+func (f *fakeSearchESClient) GetDocumentsByVectorIDs(ctx context.Context, vectorIDs []string) (map[string]model.EsDocument, error) {
+	return map[string]model.EsDocument{}, nil
+}
+
+func (f *fakeSearchESClient) MarkSuperseded(ctx context.Context, fileMD5s []string, userID uint, superseded bool) error {
+	return nil
+}
+
+func (f *fakeSearchESClient) SetFolder(ctx context.Context, fileMD5s []string, userID uint, folderID uint) error {
+	return nil
+}
+
+func (f *fakeSearchESClient) SetTags(ctx context.Context, fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+	return nil
+}
+
+func (f *fakeSearchESClient) SetSharing(ctx context.Context, fileMD5s []string, userID uint, sharing model.DocumentSharing) error {
+	return nil
+}
+
 func (f *fakeSearchESClient) DeleteDocumentsByFileMD5(ctx context.Context, fileMD5 string) error {
 	return nil
 }
@@ -127,6 +198,9 @@ func TestSearchService_HybridSearch_Success(t *testing.T) {
 				return []model.FileUpload{{FileMD5: "md5-a", FileName: "go.pdf"}}, nil
 			},
 		},
+		nil,
+		nil,
+		config.RerankConfig{},
 	)
 
 	results, err := svc.HybridSearch(context.Background(), "请问 Go 并发是什么？", 5, &model.User{ID: 8})
@@ -138,12 +212,89 @@ func TestSearchService_HybridSearch_Success(t *testing.T) {
 	}
 }
 
+type fakeReranker struct {
+	rerankFn func(ctx context.Context, query string, documents []string) ([]rerank.Result, error)
+}
+
+func (f *fakeReranker) Rerank(ctx context.Context, query string, documents []string) ([]rerank.Result, error) {
+	return f.rerankFn(ctx, query, documents)
+}
+
+func newRerankSearchService(t *testing.T, reranker rerank.Reranker) SearchService {
+	t.Helper()
+	return NewSearchService(
+		&fakeSearchEmbeddingClient{
+			createEmbeddingFn: func(ctx context.Context, text string) ([]float32, error) {
+				return []float32{0.1}, nil
+			},
+		},
+		&fakeSearchESClient{
+			searchDocumentsFn: func(ctx context.Context, req es.SearchRequest) ([]es.SearchHit, error) {
+				if req.TopK != 3 {
+					t.Fatalf("expected rerank candidates to widen ES topK, got %d", req.TopK)
+				}
+				if req.KNNK != 3*knnRecallMultiplier || req.NumCandidates != 3*numCandidatesMultiplier || req.RescoreWindow != 3*rescoreWindowMultiplier {
+					t.Fatalf("expected recall windows sized from rerank candidates, got knn=%d candidates=%d rescore=%d", req.KNNK, req.NumCandidates, req.RescoreWindow)
+				}
+				return []es.SearchHit{
+					{Score: 9, Source: model.EsDocument{FileMD5: "a", TextContent: "无关内容"}},
+					{Score: 8, Source: model.EsDocument{FileMD5: "b", TextContent: "Go 并发模型"}},
+					{Score: 7, Source: model.EsDocument{FileMD5: "c", TextContent: "goroutine 调度"}},
+				}, nil
+			},
+		},
+		&fakeSearchUserOrgTagProvider{},
+		&fakeSearchUploadRepository{},
+		nil,
+		reranker,
+		config.RerankConfig{TopN: 3},
+	)
+}
+
+func TestSearchService_HybridSearch_Rerank(t *testing.T) {
+	svc := newRerankSearchService(t, &fakeReranker{
+		rerankFn: func(ctx context.Context, query string, documents []string) ([]rerank.Result, error) {
+			if query != "Go 并发" || len(documents) != 3 {
+				t.Fatalf("unexpected rerank input: query=%q documents=%+v", query, documents)
+			}
+			return []rerank.Result{{Index: 1, Score: 0.9}, {Index: 2, Score: 0.5}}, nil
+		},
+	})
+
+	results, err := svc.HybridSearch(context.Background(), "Go 并发", 2, &model.User{ID: 1})
+	if err != nil {
+		t.Fatalf("HybridSearch() error = %v", err)
+	}
+	if len(results) != 2 || results[0].FileMD5 != "b" || results[0].Score != 0.9 || results[1].FileMD5 != "c" {
+		t.Fatalf("unexpected reranked results: %+v", results)
+	}
+}
+
+func TestSearchService_HybridSearch_RerankFailureKeepsOrder(t *testing.T) {
+	svc := newRerankSearchService(t, &fakeReranker{
+		rerankFn: func(ctx context.Context, query string, documents []string) ([]rerank.Result, error) {
+			return nil, errors.New("rerank down")
+		},
+	})
+
+	results, err := svc.HybridSearch(context.Background(), "Go 并发", 2, &model.User{ID: 1})
+	if err != nil {
+		t.Fatalf("HybridSearch() error = %v", err)
+	}
+	if len(results) != 2 || results[0].FileMD5 != "a" || results[0].Score != 9 {
+		t.Fatalf("expected elasticsearch order to be kept, got %+v", results)
+	}
+}
+
 func TestSearchService_HybridSearch_EmptyQuery(t *testing.T) {
 	svc := NewSearchService(
 		&fakeSearchEmbeddingClient{},
 		&fakeSearchESClient{},
 		&fakeSearchUserOrgTagProvider{},
 		&fakeSearchUploadRepository{},
+		nil,
+		nil,
+		config.RerankConfig{},
 	)
 
 	_, err := svc.HybridSearch(context.Background(), "   ", 5, &model.User{ID: 1})
@@ -166,6 +317,9 @@ func TestSearchService_HybridSearch_EmbeddingFailure(t *testing.T) {
 			},
 		},
 		&fakeSearchUploadRepository{},
+		nil,
+		nil,
+		config.RerankConfig{},
 	)
 
 	_, err := svc.HybridSearch(context.Background(), "go", 5, &model.User{ID: 1})
@@ -174,6 +328,209 @@ func TestSearchService_HybridSearch_EmbeddingFailure(t *testing.T) {
 	}
 }
 
+func TestSearchService_HybridSearchWithFilter_PassesMetadataFilter(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc := NewSearchService(
+		&fakeSearchEmbeddingClient{},
+		&fakeSearchESClient{
+			searchDocumentsFn: func(ctx context.Context, req es.SearchRequest) ([]es.SearchHit, error) {
+				if req.Metadata.Language != "zh" || req.Metadata.AuthoredFrom != &from || req.Metadata.MinPages != 3 {
+					t.Fatalf("unexpected metadata filter: %+v", req.Metadata)
+				}
+				if req.TitleBoost != titleMatchBoost {
+					t.Fatalf("unexpected title boost: %v", req.TitleBoost)
+				}
+				if !req.IncludeSuperseded {
+					t.Fatalf("expected allVersions to include superseded chunks")
+				}
+				return []es.SearchHit{{Score: 1, Source: model.EsDocument{FileMD5: "md5-a", Title: "季度报告", PageCount: 12, Language: "zh", Superseded: true}}}, nil
+			},
+		},
+		&fakeSearchUserOrgTagProvider{
+			getUserEffectiveOrgTagsFn: func(userID uint) ([]model.OrganizationTag, error) {
+				return []model.OrganizationTag{}, nil
+			},
+		},
+		&fakeSearchUploadRepository{},
+		nil,
+		nil,
+		config.RerankConfig{},
+	)
+
+	results, err := svc.HybridSearchWithFilter(context.Background(), "报告", 5, &model.User{ID: 1}, SearchFilter{Language: "zh", AuthoredFrom: &from, MinPages: 3, AllVersions: true})
+	if err != nil {
+		t.Fatalf("HybridSearchWithFilter() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Title != "季度报告" || results[0].PageCount != 12 || results[0].Language != "zh" || !results[0].Superseded {
+		t.Fatalf("expected metadata in results: %+v", results)
+	}
+}
+
+type fakeSearchFolderResolver struct {
+	resolveSubtreeFn func(ctx context.Context, user *model.User, folderID uint) ([]uint, error)
+}
+
+func (f *fakeSearchFolderResolver) ResolveSubtree(ctx context.Context, user *model.User, folderID uint) ([]uint, error) {
+	return f.resolveSubtreeFn(ctx, user, folderID)
+}
+
+func TestSearchService_HybridSearchWithFilter_FolderSubtree(t *testing.T) {
+	var gotFolderIDs []uint
+	resolver := &fakeSearchFolderResolver{
+		resolveSubtreeFn: func(ctx context.Context, user *model.User, folderID uint) ([]uint, error) {
+			if folderID == 9 {
+				return nil, ErrFolderNotFound
+			}
+			return []uint{folderID, 7}, nil
+		},
+	}
+	svc := NewSearchService(
+		&fakeSearchEmbeddingClient{},
+		&fakeSearchESClient{
+			searchDocumentsFn: func(ctx context.Context, req es.SearchRequest) ([]es.SearchHit, error) {
+				gotFolderIDs = req.FolderIDs
+				return []es.SearchHit{{Score: 1, Source: model.EsDocument{FileMD5: "md5-a", FolderID: 7}}}, nil
+			},
+		},
+		&fakeSearchUserOrgTagProvider{},
+		&fakeSearchUploadRepository{},
+		resolver,
+		nil,
+		config.RerankConfig{},
+	)
+
+	results, err := svc.HybridSearchWithFilter(context.Background(), "报告", 5, &model.User{ID: 1}, SearchFilter{FolderID: 3})
+	if err != nil {
+		t.Fatalf("HybridSearchWithFilter() error = %v", err)
+	}
+	if len(gotFolderIDs) != 2 || gotFolderIDs[0] != 3 || gotFolderIDs[1] != 7 {
+		t.Fatalf("expected subtree folder filter, got %v", gotFolderIDs)
+	}
+	if len(results) != 1 || results[0].FolderID != 7 {
+		t.Fatalf("expected folder id in results: %+v", results)
+	}
+
+	if _, err := svc.HybridSearchWithFilter(context.Background(), "报告", 5, &model.User{ID: 1}, SearchFilter{FolderID: 9}); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("expected ErrFolderNotFound, got %v", err)
+	}
+}
+
+func TestSearchService_ValidateScope(t *testing.T) {
+	resolver := &fakeSearchFolderResolver{
+		resolveSubtreeFn: func(ctx context.Context, user *model.User, folderID uint) ([]uint, error) {
+			if folderID == 9 {
+				return nil, ErrFolderNotFound
+			}
+			return []uint{folderID}, nil
+		},
+	}
+	svc := NewSearchService(&fakeSearchEmbeddingClient{}, &fakeSearchESClient{}, &fakeSearchUserOrgTagProvider{}, &fakeSearchUploadRepository{}, resolver, nil, config.RerankConfig{})
+
+	if err := svc.ValidateScope(context.Background(), &model.User{ID: 1}, &model.ChatScope{FolderID: 4}); err != nil {
+		t.Fatalf("ValidateScope() error = %v", err)
+	}
+	if err := svc.ValidateScope(context.Background(), &model.User{ID: 1}, &model.ChatScope{FolderID: 9}); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("expected ErrFolderNotFound, got %v", err)
+	}
+	if err := svc.ValidateScope(context.Background(), &model.User{ID: 1}, nil); err != nil {
+		t.Fatalf("expected empty scope to be valid, got %v", err)
+	}
+}
+
+func TestSearchService_HybridSearchWithFilter_Scope(t *testing.T) {
+	var gotScope es.ScopeFilter
+	resolver := &fakeSearchFolderResolver{
+		resolveSubtreeFn: func(ctx context.Context, user *model.User, folderID uint) ([]uint, error) {
+			return []uint{folderID, 8}, nil
+		},
+	}
+	svc := NewSearchService(
+		&fakeSearchEmbeddingClient{},
+		&fakeSearchESClient{
+			searchDocumentsFn: func(ctx context.Context, req es.SearchRequest) ([]es.SearchHit, error) {
+				gotScope = req.Scope
+				return []es.SearchHit{}, nil
+			},
+		},
+		&fakeSearchUserOrgTagProvider{},
+		&fakeSearchUploadRepository{},
+		resolver,
+		nil,
+		config.RerankConfig{},
+	)
+
+	scope := &model.ChatScope{FileMD5s: []string{"md5-a", " "}, OrgTag: "team-a", FolderID: 4}
+	if _, err := svc.HybridSearchWithFilter(context.Background(), "报告", 5, &model.User{ID: 1}, SearchFilter{Scope: scope}); err != nil {
+		t.Fatalf("HybridSearchWithFilter() error = %v", err)
+	}
+	if len(gotScope.FileMD5s) != 1 || len(gotScope.OrgTags) != 1 || gotScope.OrgTags[0] != "team-a" || len(gotScope.FolderIDs) != 2 {
+		t.Fatalf("unexpected scope filter: %+v", gotScope)
+	}
+
+	tooMany := &model.ChatScope{FileMD5s: make([]string, maxScopeFiles+1)}
+	if _, err := svc.HybridSearchWithFilter(context.Background(), "报告", 5, &model.User{ID: 1}, SearchFilter{Scope: tooMany}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput for too many files, got %v", err)
+	}
+}
+
+func TestSearchService_HybridSearchWithFilter_InvalidRange(t *testing.T) {
+	svc := NewSearchService(&fakeSearchEmbeddingClient{}, &fakeSearchESClient{}, &fakeSearchUserOrgTagProvider{}, &fakeSearchUploadRepository{}, nil, nil, config.RerankConfig{})
+
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, filter := range []SearchFilter{
+		{AuthoredFrom: &from, AuthoredTo: &to},
+		{MinPages: 10, MaxPages: 2},
+		{UploadedFrom: &from, UploadedTo: &to},
+		{CustomMetadata: map[string]string{"a.b": "c"}},
+	} {
+		if _, err := svc.HybridSearchWithFilter(context.Background(), "go", 5, &model.User{ID: 1}, filter); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("expected ErrInvalidInput for %+v, got %v", filter, err)
+		}
+	}
+}
+
+func TestSearchService_FacetedSearch(t *testing.T) {
+	var gotReq es.SearchRequest
+	svc := NewSearchService(
+		&fakeSearchEmbeddingClient{},
+		&fakeSearchESClient{
+			searchDocumentsWithFacetsFn: func(ctx context.Context, req es.SearchRequest) ([]es.SearchHit, es.Facets, error) {
+				gotReq = req
+				hits := []es.SearchHit{{Score: 2, Source: model.EsDocument{FileMD5: "md5-a", Tags: []string{"财务"}, FileType: "pdf"}}}
+				return hits, es.Facets{es.FacetTags: {{Key: "财务", Count: 3}}}, nil
+			},
+		},
+		&fakeSearchUserOrgTagProvider{},
+		&fakeSearchUploadRepository{},
+		nil,
+		nil,
+		config.RerankConfig{},
+	)
+
+	result, err := svc.FacetedSearch(context.Background(), "报告", 5, &model.User{ID: 1}, SearchFilter{
+		Tags:           []string{"财务"},
+		FileType:       "pdf",
+		UploaderID:     7,
+		CustomMetadata: map[string]string{"project": "apollo"},
+	})
+	if err != nil {
+		t.Fatalf("FacetedSearch() error = %v", err)
+	}
+	if gotReq.FacetSize != facetBucketSize || len(gotReq.Metadata.Tags) != 1 || gotReq.Metadata.FileType != "pdf" || gotReq.Metadata.UploaderID != 7 || gotReq.Metadata.CustomMetadata["project"] != "apollo" {
+		t.Fatalf("unexpected search request: %+v", gotReq)
+	}
+	if len(result.Results) != 1 || result.Results[0].FileType != "pdf" || len(result.Results[0].Tags) != 1 {
+		t.Fatalf("unexpected results: %+v", result.Results)
+	}
+	if len(result.Facets) != len(facetNames) || len(result.Facets[es.FacetTags]) != 1 {
+		t.Fatalf("unexpected facets: %+v", result.Facets)
+	}
+	if buckets := result.Facets[es.FacetUploaders]; buckets == nil || len(buckets) != 0 {
+		t.Fatalf("expected empty uploader facet, got %v", buckets)
+	}
+}
+
 func TestNormalizeQuery(t *testing.T) {
 	normalized, phrase := normalizeQuery("请问，Go 语言是什么？")
 	if normalized != "go 语言" {
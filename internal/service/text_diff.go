@@ -0,0 +1,186 @@
+package service
+
+import "strings"
+
+const (
+	DiffOpEqual  = "equal"
+	DiffOpInsert = "insert"
+	DiffOpDelete = "delete"
+
+	// maxDiffLines 限制参与比对的行数，LCS 表大小为两侧行数之积。
+	maxDiffLines     = 2000
+	diffContextLines = 3
+)
+
+// DiffLine 是差异中的一行；FromLine/ToLine 为该行在旧/新文本中的行号（从 1 开始），不存在时为 0。
+type DiffLine struct {
+	Op       string `json:"op"`
+	Text     string `json:"text"`
+	FromLine int    `json:"fromLine,omitempty"`
+	ToLine   int    `json:"toLine,omitempty"`
+}
+
+// DiffHunk 是一段连续的改动及其前后各 diffContextLines 行上下文。
+type DiffHunk struct {
+	FromStart int        `json:"fromStart"`
+	ToStart   int        `json:"toStart"`
+	Lines     []DiffLine `json:"lines"`
+}
+
+// TextDiff 是两段文本按行比对的结果。Truncated 表示任一侧超过 maxDiffLines 行，只比对了前面部分。
+type TextDiff struct {
+	Added     int        `json:"added"`
+	Removed   int        `json:"removed"`
+	Hunks     []DiffHunk `json:"hunks"`
+	Truncated bool       `json:"truncated"`
+}
+
+// diffText 按行比对 from 和 to，忽略行尾空白。
+func diffText(from, to string) TextDiff {
+	a, truncatedA := splitDiffLines(from)
+	b, truncatedB := splitDiffLines(to)
+	lines := diffLines(a, b)
+
+	result := TextDiff{Hunks: buildDiffHunks(lines, diffContextLines), Truncated: truncatedA || truncatedB}
+	for _, line := range lines {
+		switch line.Op {
+		case DiffOpInsert:
+			result.Added++
+		case DiffOpDelete:
+			result.Removed++
+		}
+	}
+	return result
+}
+
+func splitDiffLines(text string) ([]string, bool) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return []string{}, false
+	}
+	lines := strings.Split(text, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t\r")
+	}
+	if len(lines) > maxDiffLines {
+		return lines[:maxDiffLines], true
+	}
+	return lines, false
+}
+
+// diffLines 先去掉公共前后缀，再用 LCS 求出中间部分的最短编辑序列。
+func diffLines(a, b []string) []DiffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	result := make([]DiffLine, 0, len(a)+len(b)-prefix-suffix)
+	for i := 0; i < prefix; i++ {
+		result = append(result, DiffLine{Op: DiffOpEqual, Text: a[i], FromLine: i + 1, ToLine: i + 1})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(midA), len(midB)
+	// lcs[i][j] 为 midA[i:] 与 midB[j:] 的最长公共子序列长度，行数不超过 maxDiffLines，uint16 足够。
+	lcs := make([][]uint16, n+1)
+	for i := range lcs {
+		lcs[i] = make([]uint16, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case midA[i] == midB[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		fromLine, toLine := prefix+i+1, prefix+j+1
+		switch {
+		case i < n && j < m && midA[i] == midB[j]:
+			result = append(result, DiffLine{Op: DiffOpEqual, Text: midA[i], FromLine: fromLine, ToLine: toLine})
+			i++
+			j++
+		case j < m && (i == n || lcs[i][j+1] > lcs[i+1][j]):
+			result = append(result, DiffLine{Op: DiffOpInsert, Text: midB[j], ToLine: toLine})
+			j++
+		default:
+			result = append(result, DiffLine{Op: DiffOpDelete, Text: midA[i], FromLine: fromLine})
+			i++
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		result = append(result, DiffLine{
+			Op:       DiffOpEqual,
+			Text:     a[len(a)-suffix+k],
+			FromLine: len(a) - suffix + k + 1,
+			ToLine:   len(b) - suffix + k + 1,
+		})
+	}
+	return result
+}
+
+// buildDiffHunks 把改动行连同前后 context 行上下文分组，间隔不超过 2*context 行的改动合并为一段。
+func buildDiffHunks(lines []DiffLine, context int) []DiffHunk {
+	hunks := make([]DiffHunk, 0)
+	start, end := -1, -1
+	flush := func() {
+		if start < 0 {
+			return
+		}
+		hunk := DiffHunk{Lines: append([]DiffLine(nil), lines[start:end]...)}
+		hunk.FromStart, hunk.ToStart = hunkStart(lines, start)
+		hunks = append(hunks, hunk)
+		start, end = -1, -1
+	}
+
+	for i, line := range lines {
+		if line.Op == DiffOpEqual {
+			continue
+		}
+		lo := i - context
+		if lo < 0 {
+			lo = 0
+		}
+		hi := i + context + 1
+		if hi > len(lines) {
+			hi = len(lines)
+		}
+		if start >= 0 && lo > end {
+			flush()
+		}
+		if start < 0 {
+			start = lo
+		}
+		end = hi
+	}
+	flush()
+	return hunks
+}
+
+// hunkStart 返回从 lines[index] 开始的片段在旧/新文本中的起始行号。
+func hunkStart(lines []DiffLine, index int) (int, int) {
+	fromStart, toStart := 1, 1
+	for _, line := range lines[:index] {
+		if line.FromLine > 0 {
+			fromStart = line.FromLine + 1
+		}
+		if line.ToLine > 0 {
+			toStart = line.ToLine + 1
+		}
+	}
+	return fromStart, toStart
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiffText_ReportsChangedLines(t *testing.T) {
+	diff := diffText("a\nb\nc\n", "a\nB\nc\nd")
+	if diff.Added != 2 || diff.Removed != 1 || diff.Truncated {
+		t.Fatalf("unexpected summary: %+v", diff)
+	}
+	if len(diff.Hunks) != 1 {
+		t.Fatalf("expected a single hunk, got %+v", diff.Hunks)
+	}
+
+	ops := make([]string, 0)
+	for _, line := range diff.Hunks[0].Lines {
+		ops = append(ops, line.Op+":"+line.Text)
+	}
+	expected := "equal:a,delete:b,insert:B,equal:c,insert:d"
+	if strings.Join(ops, ",") != expected {
+		t.Fatalf("unexpected lines: got=%s want=%s", strings.Join(ops, ","), expected)
+	}
+	if last := diff.Hunks[0].Lines[4]; last.ToLine != 4 || last.FromLine != 0 {
+		t.Fatalf("unexpected line numbers: %+v", last)
+	}
+}
+
+func TestDiffText_SplitsDistantChangesIntoHunks(t *testing.T) {
+	lines := make([]string, 20)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("第 %d 行", i+1)
+	}
+	from := strings.Join(lines, "\n")
+	lines[1] = "第 2 行（修改）"
+	lines[17] = "第 18 行（修改）"
+	to := strings.Join(lines, "\n")
+
+	diff := diffText(from, to)
+	if len(diff.Hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %+v", diff.Hunks)
+	}
+	if diff.Hunks[0].FromStart != 1 || diff.Hunks[1].FromStart != 15 || diff.Hunks[1].ToStart != 15 {
+		t.Fatalf("unexpected hunk starts: %+v", diff.Hunks)
+	}
+	// 第 15-17 行上下文 + 删除/插入两行 + 文末剩余的第 19-20 行。
+	if got := len(diff.Hunks[1].Lines); got != 7 {
+		t.Fatalf("unexpected hunk size: %d lines", got)
+	}
+}
+
+func TestDiffText_IdenticalAndTruncated(t *testing.T) {
+	if diff := diffText("same\r\ntext  \n", "same\ntext"); len(diff.Hunks) != 0 || diff.Added != 0 || diff.Removed != 0 {
+		t.Fatalf("expected no changes, got %+v", diff)
+	}
+
+	long := strings.Repeat("x\n", maxDiffLines+10)
+	if diff := diffText(long, "x"); !diff.Truncated {
+		t.Fatalf("expected oversized text to be truncated")
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"pai_smart_go_v2/internal/repository"
 	"pai_smart_go_v2/pkg/log"
 	"pai_smart_go_v2/pkg/tasks"
+	"pai_smart_go_v2/pkg/token"
 
 	"github.com/minio/minio-go/v7"
 	"gorm.io/gorm"
@@ -39,14 +40,24 @@ var allowedExtensions = map[string]bool{
 	".pdf": true, ".docx": true, ".doc": true,
 	".txt": true, ".md": true, ".csv": true,
 	".xlsx": true, ".xls": true, ".pptx": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".tif": true, ".tiff": true,
+}
+
+// VersionTarget 指定本次上传是否作为已有文档的新版本，零值表示上传一个新文档。
+// DocumentID 优先；只设置 SameName 时按文件名匹配当前用户最新的同名文档，找不到则作为新文档。
+type VersionTarget struct {
+	DocumentID string
+	SameName   bool
 }
 
 // UploadResult 上传成功后返回给 Handler 的结果
 type UploadResult struct {
-	FileMD5   string `json:"fileMd5"`
-	FileName  string `json:"fileName"`
-	TotalSize int64  `json:"totalSize"`
-	IsQuick   bool   `json:"isQuick"` // 是否秒传（已存在相同文件）
+	FileMD5    string `json:"fileMd5"`
+	FileName   string `json:"fileName"`
+	TotalSize  int64  `json:"totalSize"`
+	IsQuick    bool   `json:"isQuick"` // 是否秒传（已存在相同文件）
+	DocumentID string `json:"documentId,omitempty"`
+	Version    int    `json:"version,omitempty"`
 }
 
 // DownloadResult 封装下载所需的全部信息，Handler 只需做 HTTP 响应转换。
@@ -70,13 +81,18 @@ type ChunkUploadResult struct {
 	Progress       float64 `json:"progress"`
 }
 
+// UploadStatusResult 中 Progress 是上传进度；Processing 是后台处理的阶段和进度，尚未开始处理时为空。
+// 处理失败时 ProcessingErrorCode / ProcessingErrorMessage 给出分类后的原因。
 type UploadStatusResult struct {
-	FileMD5          string  `json:"fileMd5"`
-	Status           int     `json:"status"`
-	ProcessingStatus string  `json:"processingStatus"`
-	Completed        bool    `json:"completed"`
-	UploadedChunks   []int   `json:"uploadedChunks"`
-	Progress         float64 `json:"progress"`
+	FileMD5                string                   `json:"fileMd5"`
+	Status                 int                      `json:"status"`
+	ProcessingStatus       string                   `json:"processingStatus"`
+	ProcessingErrorCode    string                   `json:"processingErrorCode,omitempty"`
+	ProcessingErrorMessage string                   `json:"processingErrorMessage,omitempty"`
+	Completed              bool                     `json:"completed"`
+	UploadedChunks         []int                    `json:"uploadedChunks"`
+	Progress               float64                  `json:"progress"`
+	Processing             *model.FileProcessingJob `json:"processing,omitempty"`
 }
 
 type FastUploadCheckResult struct {
@@ -98,7 +114,7 @@ type MergeResult struct {
 // UploadService 定义文件上传域的业务接口
 type UploadService interface {
 	// SimpleUpload 简单上传：计算MD5 → 秒传检查 → 上传MinIO → 写DB（阶段六）
-	SimpleUpload(ctx context.Context, userID uint, orgTag string, fileName string, fileSize int64, reader io.Reader) (*UploadResult, error)
+	SimpleUpload(ctx context.Context, userID uint, orgTag string, fileName string, fileSize int64, reader io.Reader, target VersionTarget) (*UploadResult, error)
 
 	// DownloadFile 根据 fileMD5 + userID 查找文件记录，并从 MinIO 获取文件流。
 	DownloadFile(ctx context.Context, fileMD5 string, userID uint) (*DownloadResult, error)
@@ -109,14 +125,18 @@ type UploadService interface {
 	// GetUploadStatus 返回当前文件的上传进度，兼容原始前端轮询接口。
 	GetUploadStatus(ctx context.Context, fileMD5 string, userID uint) (*UploadStatusResult, error)
 
+	// SubscribeProcessingProgress 订阅文件的处理进度推送，fileMD5 为空时订阅该用户所有文件。
+	// 调用方必须调用返回的 close 函数。
+	SubscribeProcessingProgress(ctx context.Context, fileMD5 string, userID uint) (<-chan model.FileProcessingJob, func() error, error)
+
 	// CheckFastUpload 返回秒传检查结果，兼容原始前端上传链路。
 	CheckFastUpload(ctx context.Context, fileMD5 string, userID uint) (*FastUploadCheckResult, error)
 
 	// GetSupportedTypes 返回允许上传的扩展名列表。
 	GetSupportedTypes() []string
 
-	// UploadChunk 上传单个分片到 MinIO 并在 Redis bitmap 中标记
-	UploadChunk(ctx context.Context, fileMD5 string, fileName string, totalSize int64, chunkIndex int, reader io.Reader, chunkSize int64, userID uint, orgTag string, isPublic bool) (*ChunkUploadResult, error)
+	// UploadChunk 上传单个分片到 MinIO 并在 Redis bitmap 中标记；首个分片创建记录时按 target 确定文档版本。
+	UploadChunk(ctx context.Context, fileMD5 string, fileName string, totalSize int64, chunkIndex int, reader io.Reader, chunkSize int64, userID uint, orgTag string, isPublic bool, target VersionTarget) (*ChunkUploadResult, error)
 
 	// MergeChunks 合并所有分片为最终文件，更新状态，异步清理临时数据
 	MergeChunks(ctx context.Context, fileMD5 string, fileName string, userID uint) (*MergeResult, error)
@@ -134,6 +154,7 @@ type uploadService struct {
 	minioClient  *minio.Client
 	bucketName   string
 	taskProducer TaskProducer
+	jobRepo      repository.ProcessingJobRepository
 }
 
 // NewUploadService 创建 UploadService 实例。
@@ -144,6 +165,7 @@ func NewUploadService(
 	minioClient *minio.Client,
 	bucketName string,
 	taskProducer TaskProducer,
+	jobRepo repository.ProcessingJobRepository,
 ) UploadService {
 	return &uploadService{
 		uploadRepo:   uploadRepo,
@@ -151,6 +173,7 @@ func NewUploadService(
 		minioClient:  minioClient,
 		bucketName:   bucketName,
 		taskProducer: taskProducer,
+		jobRepo:      jobRepo,
 	}
 }
 
@@ -158,7 +181,7 @@ func NewUploadService(
 //  1. 读取文件内容并计算 MD5
 //  2. 检查是否已上传过（秒传）
 //  3. 上传到 MinIO 对象存储
-//  4. 写入数据库记录
+//  4. 写入数据库记录；作为新版本上传时，把它设为文档的最新版本
 func (s *uploadService) SimpleUpload(
 	ctx context.Context,
 	userID uint,
@@ -166,6 +189,7 @@ func (s *uploadService) SimpleUpload(
 	fileName string,
 	fileSize int64,
 	reader io.Reader,
+	target VersionTarget,
 ) (*UploadResult, error) {
 	// 0a. 文件扩展名校验：只接受 RAG 管线能处理的格式，提前拦截无效上传
 	ext := strings.ToLower(filepath.Ext(fileName))
@@ -201,10 +225,12 @@ func (s *uploadService) SimpleUpload(
 	if err == nil && existing != nil {
 		log.Infof("秒传命中: user=%d, md5=%s, file=%s", userID, fileMD5, fileName)
 		return &UploadResult{
-			FileMD5:   existing.FileMD5,
-			FileName:  existing.FileName,
-			TotalSize: existing.TotalSize,
-			IsQuick:   true,
+			FileMD5:    existing.FileMD5,
+			FileName:   existing.FileName,
+			TotalSize:  existing.TotalSize,
+			IsQuick:    true,
+			DocumentID: existing.DocumentID,
+			Version:    existing.Version,
 		}, nil
 	}
 	// 非 "record not found" 的错误才需要处理
@@ -213,6 +239,11 @@ func (s *uploadService) SimpleUpload(
 		return nil, ErrInternal
 	}
 
+	version, err := s.resolveDocumentVersion(userID, fileName, target)
+	if err != nil {
+		return nil, err
+	}
+
 	// 3. 上传到 MinIO
 	// 对象键格式：uploads/<userID>/<md5>/<原始文件名>
 	objectKey := fmt.Sprintf("uploads/%d/%s/%s", userID, fileMD5, fileName)
@@ -243,18 +274,32 @@ func (s *uploadService) SimpleUpload(
 		ProcessingStatus: model.FileProcessingStatusPending,
 		UserID:           userID,
 		OrgTag:           orgTag,
+		DocumentID:       version.DocumentID,
+		Version:          version.Version,
+		FolderID:         version.FolderID,
+		Tags:             version.Tags,
+		CustomMetadata:   version.CustomMetadata,
+		IsLatest:         true,
 	}
 	if err := s.uploadRepo.Create(upload); err != nil {
 		log.Errorf("写入文件记录失败: %v", err)
 		return nil, ErrInternal
 	}
+	if err := s.inheritShares(upload, version.Shares); err != nil {
+		return nil, err
+	}
+	if err := s.promoteVersion(upload); err != nil {
+		return nil, err
+	}
 	s.produceFileTask(ctx, upload, objectKey)
 
 	return &UploadResult{
-		FileMD5:   fileMD5,
-		FileName:  fileName,
-		TotalSize: int64(len(fileBytes)),
-		IsQuick:   false,
+		FileMD5:    fileMD5,
+		FileName:   fileName,
+		TotalSize:  int64(len(fileBytes)),
+		IsQuick:    false,
+		DocumentID: version.DocumentID,
+		Version:    version.Version,
 	}, nil
 }
 
@@ -345,15 +390,18 @@ func (s *uploadService) GetUploadStatus(ctx context.Context, fileMD5 string, use
 	}
 
 	result := &UploadStatusResult{
-		FileMD5:          existing.FileMD5,
-		Status:           existing.Status,
-		ProcessingStatus: existing.ProcessingStatus,
-		Completed:        existing.Status == model.FileUploadStatusUploaded,
-		UploadedChunks:   []int{},
-		Progress:         0,
+		FileMD5:                existing.FileMD5,
+		Status:                 existing.Status,
+		ProcessingStatus:       existing.ProcessingStatus,
+		ProcessingErrorCode:    existing.ProcessingErrorCode,
+		ProcessingErrorMessage: existing.ProcessingErrorMessage,
+		Completed:              existing.Status == model.FileUploadStatusUploaded,
+		UploadedChunks:         []int{},
+		Progress:               0,
 	}
 	if existing.Status == model.FileUploadStatusUploaded {
 		result.Progress = 100
+		result.Processing = s.findProcessingJob(fileMD5, userID)
 		return result, nil
 	}
 
@@ -370,6 +418,65 @@ func (s *uploadService) GetUploadStatus(ctx context.Context, fileMD5 string, use
 	return result, nil
 }
 
+// findProcessingJob 查询文件的处理进度；进度只是附加信息，查询失败不影响上传状态接口。
+func (s *uploadService) findProcessingJob(fileMD5 string, userID uint) *model.FileProcessingJob {
+	if s.jobRepo == nil {
+		return nil
+	}
+	job, err := s.jobRepo.FindByFileMD5AndUserID(fileMD5, userID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Errorf("GetUploadStatus: 查询处理进度失败: %v", err)
+		}
+		return nil
+	}
+	return job
+}
+
+func (s *uploadService) SubscribeProcessingProgress(ctx context.Context, fileMD5 string, userID uint) (<-chan model.FileProcessingJob, func() error, error) {
+	if s.jobRepo == nil {
+		return nil, nil, ErrServiceUnavailable
+	}
+	fileMD5 = strings.TrimSpace(fileMD5)
+	if userID == 0 {
+		return nil, nil, ErrInvalidInput
+	}
+	if fileMD5 != "" {
+		if _, err := s.uploadRepo.FindByFileMD5AndUserID(fileMD5, userID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, ErrFileNotFound
+			}
+			log.Errorf("SubscribeProcessingProgress: 查询文件记录失败: %v", err)
+			return nil, nil, ErrInternal
+		}
+	}
+
+	jobs, closeFn, err := s.jobRepo.SubscribeProgress(ctx, userID)
+	if err != nil {
+		log.Errorf("SubscribeProcessingProgress: 订阅处理进度失败: %v", err)
+		return nil, nil, ErrServiceUnavailable
+	}
+	if fileMD5 == "" {
+		return jobs, closeFn, nil
+	}
+
+	filtered := make(chan model.FileProcessingJob)
+	go func() {
+		defer close(filtered)
+		for job := range jobs {
+			if job.FileMD5 != fileMD5 {
+				continue
+			}
+			select {
+			case filtered <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return filtered, closeFn, nil
+}
+
 func (s *uploadService) CheckFastUpload(ctx context.Context, fileMD5 string, userID uint) (*FastUploadCheckResult, error) {
 	fileMD5 = strings.TrimSpace(fileMD5)
 	if fileMD5 == "" || userID == 0 {
@@ -420,6 +527,7 @@ func (s *uploadService) UploadChunk(
 	userID uint,
 	orgTag string,
 	isPublic bool,
+	target VersionTarget,
 ) (*ChunkUploadResult, error) {
 	ext := strings.ToLower(filepath.Ext(fileName))
 	if !allowedExtensions[ext] {
@@ -444,6 +552,11 @@ func (s *uploadService) UploadChunk(
 			log.Errorf("UploadChunk: 查询文件记录失败: %v", err)
 			return nil, ErrInternal
 		}
+		// 新版本在合并完成前不会取代旧版本：文档列表只列已上传完成的记录。
+		version, versionErr := s.resolveDocumentVersion(userID, fileName, target)
+		if versionErr != nil {
+			return nil, versionErr
+		}
 		upload := &model.FileUpload{
 			FileMD5:          fileMD5,
 			FileName:         fileName,
@@ -453,11 +566,20 @@ func (s *uploadService) UploadChunk(
 			UserID:           userID,
 			OrgTag:           orgTag,
 			IsPublic:         isPublic,
+			DocumentID:       version.DocumentID,
+			Version:          version.Version,
+			FolderID:         version.FolderID,
+			Tags:             version.Tags,
+			CustomMetadata:   version.CustomMetadata,
+			IsLatest:         true,
 		}
 		if createErr := s.uploadRepo.Create(upload); createErr != nil {
 			log.Errorf("UploadChunk: 创建文件记录失败: %v", createErr)
 			return nil, ErrInternal
 		}
+		if shareErr := s.inheritShares(upload, version.Shares); shareErr != nil {
+			return nil, shareErr
+		}
 	} else if existing.Status == model.FileUploadStatusUploaded {
 		uploadedChunks := makeRange(totalChunks)
 		return &ChunkUploadResult{UploadedChunks: uploadedChunks, Progress: 100}, nil
@@ -583,6 +705,9 @@ func (s *uploadService) MergeChunks(ctx context.Context, fileMD5, fileName strin
 		log.Errorf("MergeChunks: 更新处理状态失败: %v", err)
 		return nil, ErrInternal
 	}
+	if err := s.promoteVersion(upload); err != nil {
+		return nil, err
+	}
 	s.produceFileTask(ctx, upload, destKey)
 
 	go s.cleanupAfterMerge(fileMD5, userID, totalChunks)
@@ -608,6 +733,108 @@ func (s *uploadService) cleanupAfterMerge(fileMD5 string, userID uint, totalChun
 	log.Infof("cleanupAfterMerge: 清理完成, md5=%s, user=%d", fileMD5, userID)
 }
 
+// documentVersion 是新上传文件在逻辑文档中的位置；新版本沿用上一版本所在的文件夹、标签、自定义元数据和共享授权。
+type documentVersion struct {
+	DocumentID     string
+	Version        int
+	FolderID       uint
+	Tags           []string
+	CustomMetadata map[string]string
+	Shares         []model.DocumentShare
+}
+
+// resolveDocumentVersion 按 target 确定新上传文件所属的逻辑文档和版本号。
+// 只有文档所有者能追加版本；指定的 DocumentID 不存在或属于其他用户时返回 ErrFileNotFound。
+func (s *uploadService) resolveDocumentVersion(userID uint, fileName string, target VersionTarget) (documentVersion, error) {
+	documentID := strings.TrimSpace(target.DocumentID)
+	if documentID == "" && target.SameName {
+		latest, err := s.uploadRepo.FindLatestByFileName(userID, fileName)
+		switch {
+		case err == nil:
+			documentID = latest.DocumentID
+			if documentID == "" {
+				documentID = newDocumentID()
+				if err := s.uploadRepo.AssignDocumentID(latest.FileMD5, userID, documentID); err != nil {
+					log.Errorf("resolveDocumentVersion: 补全文档 ID 失败: md5=%s err=%v", latest.FileMD5, err)
+					return documentVersion{}, ErrInternal
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		default:
+			log.Errorf("resolveDocumentVersion: 查询同名文档失败: %v", err)
+			return documentVersion{}, ErrInternal
+		}
+	}
+	if documentID == "" {
+		return documentVersion{DocumentID: newDocumentID(), Version: 1}, nil
+	}
+
+	versions, err := s.uploadRepo.FindDocumentVersions(documentID)
+	if err != nil {
+		log.Errorf("resolveDocumentVersion: 查询文档版本失败: document=%s err=%v", documentID, err)
+		return documentVersion{}, ErrInternal
+	}
+	if len(versions) == 0 || versions[0].UserID != userID {
+		return documentVersion{}, ErrFileNotFound
+	}
+	next := documentVersion{DocumentID: documentID, Version: versions[0].Version + 1}
+	base := latestUploadedVersion(versions)
+	if base == nil {
+		return next, nil
+	}
+	shares, err := s.uploadRepo.FindShares(base.FileMD5, userID)
+	if err != nil {
+		log.Errorf("resolveDocumentVersion: 查询共享授权失败: md5=%s err=%v", base.FileMD5, err)
+		return documentVersion{}, ErrInternal
+	}
+	next.FolderID = base.FolderID
+	next.Tags = base.Tags
+	next.CustomMetadata = base.CustomMetadata
+	next.Shares = shares
+	return next, nil
+}
+
+// latestUploadedVersion 返回文档当前生效的版本（已上传完成且 is_latest），新版本从它继承文件夹、标签和共享授权。
+// 版本号最大的记录可能还在上传中或已失败，不能作为继承来源；找不到时返回 nil。
+func latestUploadedVersion(versions []model.FileUpload) *model.FileUpload {
+	for i := range versions {
+		if versions[i].Status == model.FileUploadStatusUploaded && versions[i].IsLatest {
+			return &versions[i]
+		}
+	}
+	return nil
+}
+
+// inheritShares 把上一版本的共享授权复制给新版本，新版本处理入库时会带上这些被授权方。
+func (s *uploadService) inheritShares(upload *model.FileUpload, shares []model.DocumentShare) error {
+	if len(shares) == 0 {
+		return nil
+	}
+	if err := s.uploadRepo.ReplaceShares([]string{upload.FileMD5}, upload.UserID, shares); err != nil {
+		log.Errorf("inheritShares: 复制共享授权失败: md5=%s err=%v", upload.FileMD5, err)
+		return ErrInternal
+	}
+	return nil
+}
+
+// promoteVersion 在新版本上传完成后把它设为文档的最新版本；第一个版本创建时已是最新，无需处理。
+// 旧版本的分块在新版本索引完成后才移出检索，见 pipeline.Processor。
+func (s *uploadService) promoteVersion(upload *model.FileUpload) error {
+	if upload.DocumentID == "" || upload.Version <= 1 {
+		return nil
+	}
+	if err := s.uploadRepo.PromoteVersion(upload.DocumentID, upload.FileMD5, upload.UserID); err != nil {
+		log.Errorf("promoteVersion: 更新最新版本失败: document=%s md5=%s err=%v", upload.DocumentID, upload.FileMD5, err)
+		return ErrInternal
+	}
+	log.Infof("文档新版本已上传: document=%s version=%d md5=%s", upload.DocumentID, upload.Version, upload.FileMD5)
+	return nil
+}
+
+func newDocumentID() string {
+	return token.GenerateRandomString(16)
+}
+
 // makeRange 生成 [0, n) 的整数切片
 func makeRange(n int) []int {
 	result := make([]int, n)
@@ -631,12 +858,14 @@ func (s *uploadService) produceFileTask(ctx context.Context, upload *model.FileU
 	}
 
 	task := tasks.FileProcessingTask{
-		FileMD5:   upload.FileMD5,
-		FileName:  upload.FileName,
-		UserID:    upload.UserID,
-		OrgTag:    upload.OrgTag,
-		IsPublic:  upload.IsPublic,
-		ObjectKey: objectKey,
+		FileMD5:    upload.FileMD5,
+		FileName:   upload.FileName,
+		UserID:     upload.UserID,
+		OrgTag:     upload.OrgTag,
+		IsPublic:   upload.IsPublic,
+		ObjectKey:  objectKey,
+		DocumentID: upload.DocumentID,
+		FolderID:   upload.FolderID,
 	}
 
 	if err := s.taskProducer.ProduceFileTask(ctx, task); err != nil {
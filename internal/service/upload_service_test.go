@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"pai_smart_go_v2/internal/model"
+	"pai_smart_go_v2/internal/repository"
 
 	"gorm.io/gorm"
 )
@@ -23,6 +24,7 @@ type fakeUploadRepo struct {
 	findAccessibleFileByMD5Fn    func(userID uint, orgTags []string, fileMD5 string) (*model.FileUpload, error)
 	findAccessibleFilesByNameFn  func(userID uint, orgTags []string, fileName string) ([]model.FileUpload, error)
 	findByIDFn                   func(id uint) (*model.FileUpload, error)
+	findReprocessCandidatesFn    func(filter repository.ReprocessFilter) ([]model.FileUpload, error)
 	deleteFileUploadRecordFn     func(fileMD5 string, userID uint) error
 	updateFileUploadStatusFn     func(fileMD5 string, userID uint, status int, mergedAt *time.Time) error
 	updateFileProcessingStatusFn func(fileMD5 string, userID uint, processingStatus string) error
@@ -33,6 +35,16 @@ type fakeUploadRepo struct {
 	markChunkUploadedFn          func(ctx context.Context, fileMD5 string, userID uint, chunkIndex int) error
 	getUploadedChunksFromRedisFn func(ctx context.Context, fileMD5 string, userID uint, totalChunks int) ([]int, error)
 	deleteUploadMarkFn           func(ctx context.Context, fileMD5 string, userID uint) error
+	findDocumentVersionsFn       func(documentID string) ([]model.FileUpload, error)
+	findAccessibleVersionsFn     func(userID uint, orgTags []string, documentID string) ([]model.FileUpload, error)
+	findLatestByFileNameFn       func(userID uint, fileName string) (*model.FileUpload, error)
+	assignDocumentIDFn           func(fileMD5 string, userID uint, documentID string) error
+	promoteVersionFn             func(documentID string, fileMD5 string, userID uint) error
+	updateFolderFn               func(fileMD5s []string, userID uint, folderID uint) error
+	updateTagsFn                 func(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error
+	findSharesFn                 func(fileMD5 string, ownerID uint) ([]model.DocumentShare, error)
+	replaceSharesFn              func(fileMD5s []string, ownerID uint, shares []model.DocumentShare) error
+	findManagedOwnerIDsFn        func(fileMD5 string, userID uint, orgTags []string) ([]uint, error)
 }
 
 func (f *fakeUploadRepo) Create(upload *model.FileUpload) error {
@@ -91,6 +103,17 @@ func (f *fakeUploadRepo) FindByID(id uint) (*model.FileUpload, error) {
 	return nil, gorm.ErrRecordNotFound
 }
 
+func (f *fakeUploadRepo) FindReprocessCandidates(filter repository.ReprocessFilter) ([]model.FileUpload, error) {
+	if f.findReprocessCandidatesFn != nil {
+		return f.findReprocessCandidatesFn(filter)
+	}
+	return []model.FileUpload{}, nil
+}
+
+func (f *fakeUploadRepo) FindFileMD5sUpdatedSince(since time.Time) ([]string, error) {
+	return []string{}, nil
+}
+
 func (f *fakeUploadRepo) DeleteFileUploadRecord(fileMD5 string, userID uint) error {
 	if f.deleteFileUploadRecordFn != nil {
 		return f.deleteFileUploadRecordFn(fileMD5, userID)
@@ -112,6 +135,84 @@ func (f *fakeUploadRepo) UpdateFileProcessingStatus(fileMD5 string, userID uint,
 	return nil
 }
 
+func (f *fakeUploadRepo) MarkFileProcessingFailed(fileMD5 string, userID uint, errorCode string, errorMessage string) error {
+	return nil
+}
+
+func (f *fakeUploadRepo) UpdateDocumentMetadata(fileMD5 string, userID uint, metadata model.DocumentMetadata) error {
+	return nil
+}
+
+func (f *fakeUploadRepo) FindDocumentVersions(documentID string) ([]model.FileUpload, error) {
+	if f.findDocumentVersionsFn != nil {
+		return f.findDocumentVersionsFn(documentID)
+	}
+	return []model.FileUpload{}, nil
+}
+
+func (f *fakeUploadRepo) FindAccessibleDocumentVersions(userID uint, orgTags []string, documentID string) ([]model.FileUpload, error) {
+	if f.findAccessibleVersionsFn != nil {
+		return f.findAccessibleVersionsFn(userID, orgTags, documentID)
+	}
+	return []model.FileUpload{}, nil
+}
+
+func (f *fakeUploadRepo) FindLatestByFileName(userID uint, fileName string) (*model.FileUpload, error) {
+	if f.findLatestByFileNameFn != nil {
+		return f.findLatestByFileNameFn(userID, fileName)
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeUploadRepo) AssignDocumentID(fileMD5 string, userID uint, documentID string) error {
+	if f.assignDocumentIDFn != nil {
+		return f.assignDocumentIDFn(fileMD5, userID, documentID)
+	}
+	return nil
+}
+
+func (f *fakeUploadRepo) PromoteVersion(documentID string, fileMD5 string, userID uint) error {
+	if f.promoteVersionFn != nil {
+		return f.promoteVersionFn(documentID, fileMD5, userID)
+	}
+	return nil
+}
+
+func (f *fakeUploadRepo) UpdateFolder(fileMD5s []string, userID uint, folderID uint) error {
+	if f.updateFolderFn != nil {
+		return f.updateFolderFn(fileMD5s, userID, folderID)
+	}
+	return nil
+}
+
+func (f *fakeUploadRepo) UpdateTags(fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+	if f.updateTagsFn != nil {
+		return f.updateTagsFn(fileMD5s, userID, tags, customMetadata)
+	}
+	return nil
+}
+
+func (f *fakeUploadRepo) FindShares(fileMD5 string, ownerID uint) ([]model.DocumentShare, error) {
+	if f.findSharesFn != nil {
+		return f.findSharesFn(fileMD5, ownerID)
+	}
+	return nil, nil
+}
+
+func (f *fakeUploadRepo) ReplaceShares(fileMD5s []string, ownerID uint, shares []model.DocumentShare) error {
+	if f.replaceSharesFn != nil {
+		return f.replaceSharesFn(fileMD5s, ownerID, shares)
+	}
+	return nil
+}
+
+func (f *fakeUploadRepo) FindManagedOwnerIDs(fileMD5 string, userID uint, orgTags []string) ([]uint, error) {
+	if f.findManagedOwnerIDsFn != nil {
+		return f.findManagedOwnerIDsFn(fileMD5, userID, orgTags)
+	}
+	return nil, nil
+}
+
 func (f *fakeUploadRepo) CreateChunkInfo(chunk *model.ChunkInfo) error {
 	if f.createChunkInfoFn != nil {
 		return f.createChunkInfoFn(chunk)
@@ -234,7 +335,7 @@ func TestUploadService_CheckFile_NotFound(t *testing.T) {
 			return nil, gorm.ErrRecordNotFound
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	result, err := svc.CheckFile(context.Background(), "md5-x", 7)
 	if err != nil {
@@ -251,7 +352,7 @@ func TestUploadService_CheckFile_Completed(t *testing.T) {
 			return &model.FileUpload{FileMD5: fileMD5, UserID: userID, Status: 1}, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	result, err := svc.CheckFile(context.Background(), "md5-y", 8)
 	if err != nil {
@@ -278,7 +379,7 @@ func TestUploadService_CheckFile_InProgress(t *testing.T) {
 			return []int{0, 2}, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	result, err := svc.CheckFile(context.Background(), "md5-z", 9)
 	if err != nil {
@@ -309,7 +410,7 @@ func TestUploadService_GetUploadStatus_InProgress(t *testing.T) {
 			return []int{0, 2}, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	result, err := svc.GetUploadStatus(context.Background(), "md5-z", 9)
 	if err != nil {
@@ -323,6 +424,109 @@ func TestUploadService_GetUploadStatus_InProgress(t *testing.T) {
 	}
 }
 
+type fakeProcessingJobRepo struct {
+	jobs    map[string]*model.FileProcessingJob
+	updates chan model.FileProcessingJob
+}
+
+func (f *fakeProcessingJobRepo) Save(job *model.FileProcessingJob) error {
+	return nil
+}
+
+func (f *fakeProcessingJobRepo) FindByFileMD5AndUserID(fileMD5 string, userID uint) (*model.FileProcessingJob, error) {
+	if job, ok := f.jobs[fileMD5]; ok {
+		return job, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeProcessingJobRepo) PublishProgress(ctx context.Context, job *model.FileProcessingJob) error {
+	return nil
+}
+
+func (f *fakeProcessingJobRepo) SubscribeProgress(ctx context.Context, userID uint) (<-chan model.FileProcessingJob, func() error, error) {
+	return f.updates, func() error { return nil }, nil
+}
+
+func TestUploadService_GetUploadStatus_IncludesProcessingJob(t *testing.T) {
+	uploadRepo := &fakeUploadRepo{
+		findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+			return &model.FileUpload{FileMD5: fileMD5, UserID: userID, Status: model.FileUploadStatusUploaded, ProcessingStatus: model.FileProcessingStatusProcessing}, nil
+		},
+	}
+	jobRepo := &fakeProcessingJobRepo{jobs: map[string]*model.FileProcessingJob{
+		"md5-j": {FileMD5: "md5-j", Stage: model.ProcessingStageEmbed, Progress: 55, TotalChunks: 10, EmbeddedChunks: 2},
+	}}
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, jobRepo)
+
+	result, err := svc.GetUploadStatus(context.Background(), "md5-j", 9)
+	if err != nil {
+		t.Fatalf("GetUploadStatus() error: %v", err)
+	}
+	if result.Processing == nil || result.Processing.Stage != model.ProcessingStageEmbed || result.Processing.Progress != 55 {
+		t.Fatalf("unexpected processing progress: %+v", result.Processing)
+	}
+}
+
+func TestUploadService_GetUploadStatus_ReturnsFailureReason(t *testing.T) {
+	uploadRepo := &fakeUploadRepo{
+		findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+			return &model.FileUpload{
+				FileMD5:                fileMD5,
+				UserID:                 userID,
+				Status:                 model.FileUploadStatusUploaded,
+				ProcessingStatus:       model.FileProcessingStatusFailed,
+				ProcessingErrorCode:    model.ProcessingErrorEncryptedDocument,
+				ProcessingErrorMessage: "The document is encrypted or password protected",
+			}, nil
+		},
+	}
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
+
+	result, err := svc.GetUploadStatus(context.Background(), "md5-f", 9)
+	if err != nil {
+		t.Fatalf("GetUploadStatus() error: %v", err)
+	}
+	if result.ProcessingStatus != model.FileProcessingStatusFailed || result.ProcessingErrorCode != model.ProcessingErrorEncryptedDocument || result.ProcessingErrorMessage == "" {
+		t.Fatalf("unexpected failure reason: %+v", result)
+	}
+}
+
+func TestUploadService_SubscribeProcessingProgress_FiltersByFile(t *testing.T) {
+	uploadRepo := &fakeUploadRepo{
+		findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
+			return &model.FileUpload{FileMD5: fileMD5, UserID: userID}, nil
+		},
+	}
+	updates := make(chan model.FileProcessingJob, 3)
+	updates <- model.FileProcessingJob{FileMD5: "other", Stage: model.ProcessingStageChunk}
+	updates <- model.FileProcessingJob{FileMD5: "md5-k", Stage: model.ProcessingStageIndex}
+	close(updates)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, &fakeProcessingJobRepo{updates: updates})
+
+	jobs, closeFn, err := svc.SubscribeProcessingProgress(context.Background(), "md5-k", 9)
+	if err != nil {
+		t.Fatalf("SubscribeProcessingProgress() error: %v", err)
+	}
+	defer closeFn()
+
+	var got []model.FileProcessingJob
+	for job := range jobs {
+		got = append(got, job)
+	}
+	if len(got) != 1 || got[0].FileMD5 != "md5-k" {
+		t.Fatalf("unexpected filtered jobs: %+v", got)
+	}
+}
+
+func TestUploadService_SubscribeProcessingProgress_Unavailable(t *testing.T) {
+	svc := NewUploadService(&fakeUploadRepo{}, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
+
+	if _, _, err := svc.SubscribeProcessingProgress(context.Background(), "md5-k", 9); !errors.Is(err, ErrServiceUnavailable) {
+		t.Fatalf("expected ErrServiceUnavailable, got %v", err)
+	}
+}
+
 func TestUploadService_CheckFastUpload_Completed(t *testing.T) {
 	uploadRepo := &fakeUploadRepo{
 		findByFileMD5AndUserIDFn: func(fileMD5 string, userID uint) (*model.FileUpload, error) {
@@ -335,7 +539,7 @@ func TestUploadService_CheckFastUpload_Completed(t *testing.T) {
 			}, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	result, err := svc.CheckFastUpload(context.Background(), "md5-q", 7)
 	if err != nil {
@@ -347,7 +551,7 @@ func TestUploadService_CheckFastUpload_Completed(t *testing.T) {
 }
 
 func TestUploadService_GetSupportedTypes_Sorted(t *testing.T) {
-	svc := NewUploadService(&fakeUploadRepo{}, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(&fakeUploadRepo{}, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	types := svc.GetSupportedTypes()
 	if len(types) == 0 {
@@ -361,13 +565,13 @@ func TestUploadService_GetSupportedTypes_Sorted(t *testing.T) {
 }
 
 func TestUploadService_UploadChunk_UnsupportedFileType(t *testing.T) {
-	svc := NewUploadService(&fakeUploadRepo{}, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(&fakeUploadRepo{}, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	_, err := svc.UploadChunk(
 		context.Background(),
 		"md5-v", "a.exe", 100, 0,
 		strings.NewReader("chunk"), int64(len("chunk")),
-		1, "team-a", false,
+		1, "team-a", false, VersionTarget{},
 	)
 	if !errors.Is(err, ErrUnsupportedFileType) {
 		t.Fatalf("expected ErrUnsupportedFileType, got %v", err)
@@ -386,13 +590,13 @@ func TestUploadService_UploadChunk_AlreadyCompleted(t *testing.T) {
 			}, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	result, err := svc.UploadChunk(
 		context.Background(),
 		"md5-v", "a.pdf", DefaultChunkSize*2+1, 0,
 		strings.NewReader("chunk"), int64(len("chunk")),
-		1, "team-a", false,
+		1, "team-a", false, VersionTarget{},
 	)
 	if err != nil {
 		t.Fatalf("UploadChunk() error: %v", err)
@@ -411,13 +615,13 @@ func TestUploadService_UploadChunk_FillOrgTagUserError(t *testing.T) {
 			return nil, errors.New("db down")
 		},
 	}
-	svc := NewUploadService(&fakeUploadRepo{}, userRepo, nil, "uploads", nil)
+	svc := NewUploadService(&fakeUploadRepo{}, userRepo, nil, "uploads", nil, nil)
 
 	_, err := svc.UploadChunk(
 		context.Background(),
 		"md5-v", "a.pdf", 100, 0,
 		strings.NewReader("chunk"), int64(len("chunk")),
-		1, "", false,
+		1, "", false, VersionTarget{},
 	)
 	if !errors.Is(err, ErrInternal) {
 		t.Fatalf("expected ErrInternal, got %v", err)
@@ -430,7 +634,7 @@ func TestUploadService_MergeChunks_NotFound(t *testing.T) {
 			return nil, gorm.ErrRecordNotFound
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	_, err := svc.MergeChunks(context.Background(), "md5-1", "a.pdf", 1)
 	if !errors.Is(err, ErrFileNotFound) {
@@ -449,7 +653,7 @@ func TestUploadService_MergeChunks_AlreadyMerged(t *testing.T) {
 			}, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	result, err := svc.MergeChunks(context.Background(), "md5-2", "a.pdf", 11)
 	if err != nil {
@@ -475,7 +679,7 @@ func TestUploadService_MergeChunks_Incomplete(t *testing.T) {
 			return []int{0, 1}, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	_, err := svc.MergeChunks(context.Background(), "md5-3", "a.pdf", 12)
 	if !errors.Is(err, ErrChunksIncomplete) {
@@ -501,13 +705,13 @@ func TestUploadService_UploadChunk_AlreadyUploadedIdempotentPath(t *testing.T) {
 			return []int{0, 1}, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	result, err := svc.UploadChunk(
 		context.Background(),
 		"md5-k", "a.pdf", DefaultChunkSize*2, 1,
 		strings.NewReader("chunk"), int64(len("chunk")),
-		5, "team-a", false,
+		5, "team-a", false, VersionTarget{},
 	)
 	if err != nil {
 		t.Fatalf("UploadChunk() error: %v", err)
@@ -539,13 +743,13 @@ func TestUploadService_UploadChunk_OrgTagFillSuccess(t *testing.T) {
 			return &model.User{ID: userID, PrimaryOrg: "team-user"}, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, userRepo, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, userRepo, nil, "uploads", nil, nil)
 
 	_, err := svc.UploadChunk(
 		context.Background(),
 		"md5-org", "a.pdf", 100, 0,
 		strings.NewReader("chunk"), int64(len("chunk")),
-		6, "", true,
+		6, "", true, VersionTarget{},
 	)
 	if !calledCreate {
 		t.Fatalf("expected Create() to be called")
@@ -561,7 +765,7 @@ func TestUploadService_CheckFile_RepoError(t *testing.T) {
 			return nil, errors.New("db error")
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	_, err := svc.CheckFile(context.Background(), "md5-err", 1)
 	if !errors.Is(err, ErrInternal) {
@@ -584,13 +788,13 @@ func TestUploadService_UploadChunk_NilReaderStillSupportedInIdempotentBranch(t *
 			return true, nil
 		},
 	}
-	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil)
+	svc := NewUploadService(uploadRepo, &fakeUploadUserRepo{}, nil, "uploads", nil, nil)
 
 	result, err := svc.UploadChunk(
 		context.Background(),
 		"md5-nil", "a.pdf", DefaultChunkSize, 0,
 		io.NopCloser(strings.NewReader("")), 0,
-		3, "team-a", false,
+		3, "team-a", false, VersionTarget{},
 	)
 	if err != nil {
 		t.Fatalf("UploadChunk() error: %v", err)
@@ -644,3 +848,58 @@ func TestUploadService_ProduceFileTask_FailureShouldNotPanic(t *testing.T) {
 		t.Fatalf("expected producer called once, got %d", producer.called)
 	}
 }
+
+func TestUploadService_ResolveDocumentVersion(t *testing.T) {
+	assigned := ""
+	svc := &uploadService{uploadRepo: &fakeUploadRepo{
+		findLatestByFileNameFn: func(userID uint, fileName string) (*model.FileUpload, error) {
+			if fileName != "legacy.pdf" {
+				return nil, gorm.ErrRecordNotFound
+			}
+			return &model.FileUpload{FileMD5: "md5-legacy", UserID: userID, Version: 1}, nil
+		},
+		assignDocumentIDFn: func(fileMD5 string, userID uint, documentID string) error {
+			assigned = documentID
+			return nil
+		},
+		findDocumentVersionsFn: func(documentID string) ([]model.FileUpload, error) {
+			switch documentID {
+			case "doc-1":
+				// v4 还在上传中，不能作为继承来源；版本号仍接在 v4 之后。
+				return []model.FileUpload{
+					{FileMD5: "md5-v4", DocumentID: documentID, UserID: 9, Version: 4, FolderID: 8, Tags: []string{"草稿"}, Status: model.FileUploadStatusUploading, IsLatest: false},
+					{FileMD5: "md5-v3", DocumentID: documentID, UserID: 9, Version: 3, FolderID: 5, Tags: []string{"财务"}, Status: model.FileUploadStatusUploaded, IsLatest: true},
+					{DocumentID: documentID, UserID: 9, Version: 2, Status: model.FileUploadStatusUploaded},
+				}, nil
+			case assigned:
+				return []model.FileUpload{{DocumentID: documentID, UserID: 9, Version: 1, Status: model.FileUploadStatusUploaded, IsLatest: true}}, nil
+			}
+			return []model.FileUpload{}, nil
+		},
+		findSharesFn: func(fileMD5 string, ownerID uint) ([]model.DocumentShare, error) {
+			if fileMD5 != "md5-v3" {
+				return nil, nil
+			}
+			return []model.DocumentShare{{FileMD5: fileMD5, OwnerID: ownerID, GranteeOrgTag: "team-b", Permission: model.SharePermissionRead}}, nil
+		},
+	}}
+
+	version, err := svc.resolveDocumentVersion(9, "a.pdf", VersionTarget{})
+	if err != nil || version.DocumentID == "" || version.Version != 1 || version.FolderID != 0 {
+		t.Fatalf("expected a new document, got %+v err=%v", version, err)
+	}
+
+	version, err = svc.resolveDocumentVersion(9, "a.pdf", VersionTarget{DocumentID: "doc-1"})
+	if err != nil || version.DocumentID != "doc-1" || version.Version != 5 || version.FolderID != 5 || len(version.Tags) != 1 || version.Tags[0] != "财务" || len(version.Shares) != 1 {
+		t.Fatalf("expected version 5 of doc-1 inheriting folder 5, tags and shares from v3, got %+v err=%v", version, err)
+	}
+
+	version, err = svc.resolveDocumentVersion(9, "legacy.pdf", VersionTarget{SameName: true})
+	if err != nil || assigned == "" || version.DocumentID != assigned || version.Version != 2 {
+		t.Fatalf("expected legacy upload to get a document id, got %+v assigned=%q err=%v", version, assigned, err)
+	}
+
+	if _, err := svc.resolveDocumentVersion(10, "a.pdf", VersionTarget{DocumentID: "doc-1"}); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("expected ErrFileNotFound for another user's document, got %v", err)
+	}
+}
@@ -40,10 +40,17 @@ func RunMigrate() error {
 
 	if err := DB.AutoMigrate(
 		&model.User{},
-		&model.OrganizationTag{}, // 阶段 5
-		&model.FileUpload{},      // 阶段 6: 文件上传记录
-		&model.ChunkInfo{},       // 阶段 7: 分片上传记录
-		&model.DocumentVector{},  // 阶段 9: 文本分块结果
+		&model.OrganizationTag{},    // 阶段 5
+		&model.FileUpload{},         // 阶段 6: 文件上传记录
+		&model.ChunkInfo{},          // 阶段 7: 分片上传记录
+		&model.DocumentVector{},     // 阶段 9: 文本分块结果
+		&model.Conversation{},       // 会话元信息
+		&model.ChatMessageRecord{},  // 完整对话记录
+		&model.FileTaskDeadLetter{}, // 文件处理死信记录
+		&model.FileProcessingJob{},  // 文件处理进度
+		&model.IndexMigration{},     // embedding 模型迁移任务
+		&model.Folder{},             // 文档文件夹
+		&model.DocumentShare{},      // 文档共享授权
 	); err != nil {
 		log.Errorf("Failed to run migrations: %v", err)
 		return err
@@ -0,0 +1,225 @@
+package embedding
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/pkg/log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const defaultCacheTTL = 30 * 24 * time.Hour
+
+// Cache 抽象向量缓存存储，实现可用 Redis 或测试替身。
+// GetMany 返回与 keys 等长的切片，未命中的位置为 nil。
+type Cache interface {
+	GetMany(ctx context.Context, keys []string) ([][]float32, error)
+	SetMany(ctx context.Context, entries map[string][]float32, ttl time.Duration) error
+}
+
+// CacheStats 是进程启动以来的缓存命中统计，按文本条数计。
+type CacheStats struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	Errors  uint64  `json:"errors"`
+	HitRate float64 `json:"hitRate"`
+}
+
+// CachedClient 在 Client 外面包一层按内容寻址的缓存：
+// key 由 model、dimensions 和 sha256(text) 组成，换模型或维度不会读到旧向量。
+type CachedClient struct {
+	inner      Client
+	cache      Cache
+	model      string
+	dimensions int
+	ttl        time.Duration
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	errors atomic.Uint64
+}
+
+func NewCachedClient(inner Client, cache Cache, cfg config.EmbeddingConfig) *CachedClient {
+	ttl := time.Duration(cfg.Cache.TTLHours) * time.Hour
+	if cfg.Cache.TTLHours <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &CachedClient{
+		inner:      inner,
+		cache:      cache,
+		model:      cfg.Model,
+		dimensions: cfg.Dimensions,
+		ttl:        ttl,
+	}
+}
+
+func (c *CachedClient) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := c.CreateEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// CreateEmbeddings 先批量查缓存，只把未命中的文本（同批内去重）交给下游接口。
+// 缓存读写失败只记日志，不影响向量生成。
+func (c *CachedClient) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return [][]float32{}, nil
+	}
+
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		keys[i] = CacheKey(c.model, c.dimensions, text)
+	}
+
+	vectors, err := c.cache.GetMany(ctx, keys)
+	if err != nil || len(vectors) != len(keys) {
+		if err == nil {
+			err = fmt.Errorf("cache returned %d entries for %d keys", len(vectors), len(keys))
+		}
+		c.errors.Add(1)
+		log.Warnf("[EmbeddingCache] 读取缓存失败，直接调用 embedding 接口: %v", err)
+		vectors = make([][]float32, len(texts))
+	}
+
+	missingTexts := make([]string, 0)
+	missingPositions := make(map[string][]int)
+	for i, vector := range vectors {
+		if vector != nil {
+			continue
+		}
+		if _, seen := missingPositions[keys[i]]; !seen {
+			missingTexts = append(missingTexts, texts[i])
+		}
+		missingPositions[keys[i]] = append(missingPositions[keys[i]], i)
+	}
+
+	missed := 0
+	for _, positions := range missingPositions {
+		missed += len(positions)
+	}
+	c.hits.Add(uint64(len(texts) - missed))
+	c.misses.Add(uint64(missed))
+	if len(missingTexts) == 0 {
+		return vectors, nil
+	}
+
+	created, err := c.inner.CreateEmbeddings(ctx, missingTexts)
+	if err != nil {
+		return nil, err
+	}
+	if len(created) != len(missingTexts) {
+		return nil, fmt.Errorf("embedding result count mismatch: got=%d want=%d", len(created), len(missingTexts))
+	}
+
+	entries := make(map[string][]float32, len(created))
+	for i, vector := range created {
+		key := CacheKey(c.model, c.dimensions, missingTexts[i])
+		entries[key] = vector
+		for _, pos := range missingPositions[key] {
+			vectors[pos] = vector
+		}
+	}
+	if err := c.cache.SetMany(ctx, entries, c.ttl); err != nil {
+		c.errors.Add(1)
+		log.Warnf("[EmbeddingCache] 写入缓存失败: entries=%d err=%v", len(entries), err)
+	}
+
+	return vectors, nil
+}
+
+// Stats 返回命中统计快照。
+func (c *CachedClient) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Errors: c.errors.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// CacheKey 生成向量缓存 key：embedding:cache:{model}:{dimensions}:{sha256(text)}。
+func CacheKey(model string, dimensions int, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("embedding:cache:%s:%d:%s", model, dimensions, hex.EncodeToString(sum[:]))
+}
+
+type redisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache 用 Redis 字符串保存向量，值为小端序 float32 数组。
+func NewRedisCache(client *redis.Client) Cache {
+	if client == nil {
+		return nil
+	}
+	return &redisCache{client: client}
+}
+
+func (r *redisCache) GetMany(ctx context.Context, keys []string) ([][]float32, error) {
+	vectors := make([][]float32, len(keys))
+	if len(keys) == 0 {
+		return vectors, nil
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue
+		}
+		vector, err := decodeVector([]byte(raw))
+		if err != nil {
+			log.Warnf("[EmbeddingCache] 缓存值损坏，按未命中处理: key=%s err=%v", keys[i], err)
+			continue
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func (r *redisCache) SetMany(ctx context.Context, entries map[string][]float32, ttl time.Duration) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	pipe := r.client.Pipeline()
+	for key, vector := range entries {
+		pipe.Set(ctx, key, encodeVector(vector), ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(value))
+	}
+	return buf
+}
+
+func decodeVector(raw []byte) ([]float32, error) {
+	if len(raw) == 0 || len(raw)%4 != 0 {
+		return nil, fmt.Errorf("invalid vector payload length %d", len(raw))
+	}
+	vector := make([]float32, len(raw)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	return vector, nil
+}
@@ -0,0 +1,154 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/pkg/log"
+)
+
+func init() {
+	log.Init("error", "console", "")
+}
+
+type fakeCache struct {
+	entries map[string][]float32
+	getErr  error
+	setErr  error
+	ttl     time.Duration
+}
+
+func (f *fakeCache) GetMany(ctx context.Context, keys []string) ([][]float32, error) {
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	vectors := make([][]float32, len(keys))
+	for i, key := range keys {
+		vectors[i] = f.entries[key]
+	}
+	return vectors, nil
+}
+
+func (f *fakeCache) SetMany(ctx context.Context, entries map[string][]float32, ttl time.Duration) error {
+	if f.setErr != nil {
+		return f.setErr
+	}
+	if f.entries == nil {
+		f.entries = map[string][]float32{}
+	}
+	for key, vector := range entries {
+		f.entries[key] = vector
+	}
+	f.ttl = ttl
+	return nil
+}
+
+type fakeInnerClient struct {
+	calls [][]string
+	err   error
+}
+
+func (f *fakeInnerClient) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := f.CreateEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func (f *fakeInnerClient) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	f.calls = append(f.calls, texts)
+	if f.err != nil {
+		return nil, f.err
+	}
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vectors = append(vectors, []float32{float32(len(text))})
+	}
+	return vectors, nil
+}
+
+func TestCachedClient_CreateEmbeddings(t *testing.T) {
+	inner := &fakeInnerClient{}
+	cache := &fakeCache{entries: map[string][]float32{
+		CacheKey("text-embedding-v4", 1, "cached"): {9},
+	}}
+	client := NewCachedClient(inner, cache, config.EmbeddingConfig{Model: "text-embedding-v4", Dimensions: 1})
+
+	vectors, err := client.CreateEmbeddings(context.Background(), []string{"cached", "ab", "abc", "ab"})
+	if err != nil {
+		t.Fatalf("CreateEmbeddings() error = %v", err)
+	}
+	if len(inner.calls) != 1 || len(inner.calls[0]) != 2 {
+		t.Fatalf("expected only deduplicated misses to hit the api, got %+v", inner.calls)
+	}
+	if vectors[0][0] != 9 || vectors[1][0] != 2 || vectors[2][0] != 3 || vectors[3][0] != 2 {
+		t.Fatalf("unexpected vectors: %+v", vectors)
+	}
+	if cache.ttl != defaultCacheTTL || len(cache.entries) != 3 {
+		t.Fatalf("expected misses to be written back, got ttl=%s entries=%d", cache.ttl, len(cache.entries))
+	}
+
+	if _, err := client.CreateEmbedding(context.Background(), "abc"); err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+	if len(inner.calls) != 1 {
+		t.Fatalf("expected second lookup to be served from cache, got %+v", inner.calls)
+	}
+
+	stats := client.Stats()
+	if stats.Hits != 2 || stats.Misses != 3 || stats.HitRate != 0.4 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCachedClient_CacheFailureFallsThrough(t *testing.T) {
+	inner := &fakeInnerClient{}
+	client := NewCachedClient(inner, &fakeCache{getErr: errors.New("redis down"), setErr: errors.New("redis down")}, config.EmbeddingConfig{Model: "m"})
+
+	vectors, err := client.CreateEmbeddings(context.Background(), []string{"a"})
+	if err != nil {
+		t.Fatalf("CreateEmbeddings() error = %v", err)
+	}
+	if len(vectors) != 1 || len(inner.calls) != 1 {
+		t.Fatalf("expected api call when cache is down, got vectors=%+v calls=%+v", vectors, inner.calls)
+	}
+	if stats := client.Stats(); stats.Errors != 2 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCachedClient_PropagatesAPIError(t *testing.T) {
+	inner := &fakeInnerClient{err: &APIError{StatusCode: 503}}
+	client := NewCachedClient(inner, &fakeCache{}, config.EmbeddingConfig{Model: "m"})
+
+	_, err := client.CreateEmbeddings(context.Background(), []string{"a"})
+	if !IsRetryable(err) {
+		t.Fatalf("expected retryable api error to pass through, got %v", err)
+	}
+}
+
+func TestCacheKey_IncludesModelAndDimensions(t *testing.T) {
+	if CacheKey("m1", 1024, "hello") == CacheKey("m2", 1024, "hello") {
+		t.Fatalf("expected model to be part of cache key")
+	}
+	if CacheKey("m1", 1024, "hello") == CacheKey("m1", 2048, "hello") {
+		t.Fatalf("expected dimensions to be part of cache key")
+	}
+}
+
+func TestEncodeDecodeVector(t *testing.T) {
+	vector, err := decodeVector(encodeVector([]float32{0.5, -1.25}))
+	if err != nil {
+		t.Fatalf("decodeVector() error = %v", err)
+	}
+	if len(vector) != 2 || vector[0] != 0.5 || vector[1] != -1.25 {
+		t.Fatalf("unexpected vector: %+v", vector)
+	}
+	if _, err := decodeVector([]byte{1, 2, 3}); err == nil {
+		t.Fatalf("expected invalid payload error")
+	}
+}
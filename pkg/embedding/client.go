@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -17,6 +19,41 @@ const defaultTimeout = 15 * time.Second
 
 type Client interface {
 	CreateEmbedding(ctx context.Context, text string) ([]float32, error)
+	// CreateEmbeddings 一次请求生成多条文本的向量，返回顺序与 texts 一致。
+	CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// ErrDimensionMismatch 表示接口返回的向量维度与配置的 dimensions 不一致，重试不会成功。
+var ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+
+// APIError 表示 embedding 接口返回了非 200 状态码。
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("embedding api status=%d body=%s", e.StatusCode, e.Body)
+}
+
+// IsRetryable 判断 embedding 调用失败是否值得重试：
+// 限流（429）、服务端 5xx、网络错误和超时可以重试，其余 4xx 与响应格式错误重试也不会成功。
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
 }
 
 type client struct {
@@ -35,6 +72,7 @@ type createEmbeddingRequest struct {
 
 type createEmbeddingResponse struct {
 	Data []struct {
+		Index     int       `json:"index"`
 		Embedding []float32 `json:"embedding"`
 	} `json:"data"`
 }
@@ -70,9 +108,26 @@ func (c *client) CreateEmbedding(ctx context.Context, text string) ([]float32, e
 		return nil, fmt.Errorf("embedding text is empty")
 	}
 
+	vectors, err := c.CreateEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func (c *client) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return [][]float32{}, nil
+	}
+	for i, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("embedding text %d is empty", i)
+		}
+	}
+
 	reqBody := createEmbeddingRequest{
 		Model:      c.model,
-		Input:      []string{text},
+		Input:      texts,
 		Dimensions: c.dimensions,
 	}
 
@@ -99,19 +154,34 @@ func (c *client) CreateEmbedding(ctx context.Context, text string) ([]float32, e
 		return nil, fmt.Errorf("read embedding response failed: %w", err)
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("embedding api status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
 	}
 
 	var parsed createEmbeddingResponse
 	if err := json.Unmarshal(body, &parsed); err != nil {
 		return nil, fmt.Errorf("unmarshal embedding response failed: %w", err)
 	}
-	if len(parsed.Data) == 0 || len(parsed.Data[0].Embedding) == 0 {
+	if len(parsed.Data) == 0 {
 		return nil, fmt.Errorf("embedding response is empty")
 	}
-	if c.dimensions > 0 && len(parsed.Data[0].Embedding) != c.dimensions {
-		return nil, fmt.Errorf("embedding dimension mismatch: got=%d want=%d", len(parsed.Data[0].Embedding), c.dimensions)
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding response count mismatch: got=%d want=%d", len(parsed.Data), len(texts))
+	}
+
+	// 按 index 还原顺序，兼容不保证返回顺序的服务端。
+	vectors := make([][]float32, len(texts))
+	for _, item := range parsed.Data {
+		if item.Index < 0 || item.Index >= len(texts) || vectors[item.Index] != nil {
+			return nil, fmt.Errorf("embedding response has invalid index %d", item.Index)
+		}
+		if len(item.Embedding) == 0 {
+			return nil, fmt.Errorf("embedding response is empty")
+		}
+		if c.dimensions > 0 && len(item.Embedding) != c.dimensions {
+			return nil, fmt.Errorf("%w: got=%d want=%d", ErrDimensionMismatch, len(item.Embedding), c.dimensions)
+		}
+		vectors[item.Index] = item.Embedding
 	}
 
-	return parsed.Data[0].Embedding, nil
+	return vectors, nil
 }
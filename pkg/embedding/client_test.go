@@ -3,6 +3,7 @@ package embedding
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
@@ -62,8 +63,59 @@ func TestClient_CreateEmbedding_DimensionMismatch(t *testing.T) {
 		})},
 	}
 
-	if _, err := client.CreateEmbedding(context.Background(), "hello"); err == nil {
-		t.Fatalf("expected dimension mismatch error")
+	if _, err := client.CreateEmbedding(context.Background(), "hello"); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func TestClient_CreateEmbeddings_RestoresOrder(t *testing.T) {
+	client := &client{
+		baseURL:    "http://embedding.local",
+		apiKey:     "test-key",
+		model:      "text-embedding-v4",
+		dimensions: 1,
+		httpClient: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			var req createEmbeddingRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request failed: %v", err)
+			}
+			if len(req.Input) != 2 || req.Input[0] != "a" || req.Input[1] != "b" {
+				t.Fatalf("unexpected input: %+v", req.Input)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"data":[{"index":1,"embedding":[0.2]},{"index":0,"embedding":[0.1]}]}`)),
+			}, nil
+		})},
+	}
+
+	vectors, err := client.CreateEmbeddings(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("CreateEmbeddings() error = %v", err)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 0.1 || vectors[1][0] != 0.2 {
+		t.Fatalf("unexpected vectors: %+v", vectors)
+	}
+}
+
+func TestClient_CreateEmbeddings_APIError(t *testing.T) {
+	client := &client{
+		baseURL: "http://embedding.local",
+		model:   "text-embedding-v4",
+		httpClient: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Body:       io.NopCloser(strings.NewReader(`rate limited`)),
+			}, nil
+		})},
+	}
+
+	_, err := client.CreateEmbeddings(context.Background(), []string{"a"})
+	if !IsRetryable(err) {
+		t.Fatalf("expected 429 to be retryable, got %v", err)
+	}
+	if IsRetryable(&APIError{StatusCode: http.StatusBadRequest}) {
+		t.Fatalf("expected 400 to be non-retryable")
 	}
 }
 
@@ -0,0 +1,60 @@
+package embedding
+
+import (
+	"context"
+	"sync"
+)
+
+// ModelInfo 由能报告当前模型的 Client 实现，调用方据此写入 model_version 并校验向量维度。
+type ModelInfo interface {
+	Model() string
+	Dimensions() int
+}
+
+// SwitchableClient 允许在运行中整体替换下游 Client 及其模型信息，
+// 用于索引迁移完成、别名切换到新模型索引后让检索和文档处理同步改用新模型。
+type SwitchableClient struct {
+	mu         sync.RWMutex
+	inner      Client
+	model      string
+	dimensions int
+}
+
+func NewSwitchableClient(inner Client, model string, dimensions int) *SwitchableClient {
+	return &SwitchableClient{inner: inner, model: model, dimensions: dimensions}
+}
+
+// Switch 原子地替换下游 Client；已经发出的请求仍由旧 Client 完成。
+func (c *SwitchableClient) Switch(inner Client, model string, dimensions int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inner = inner
+	c.model = model
+	c.dimensions = dimensions
+}
+
+func (c *SwitchableClient) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return c.current().CreateEmbedding(ctx, text)
+}
+
+func (c *SwitchableClient) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	return c.current().CreateEmbeddings(ctx, texts)
+}
+
+func (c *SwitchableClient) Model() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.model
+}
+
+func (c *SwitchableClient) Dimensions() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dimensions
+}
+
+func (c *SwitchableClient) current() Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.inner
+}
@@ -0,0 +1,27 @@
+package embedding
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSwitchableClient_Switch(t *testing.T) {
+	oldClient := &fakeInnerClient{}
+	newClient := &fakeInnerClient{}
+	client := NewSwitchableClient(oldClient, "model-a", 2)
+
+	if _, err := client.CreateEmbeddings(context.Background(), []string{"a"}); err != nil {
+		t.Fatalf("CreateEmbeddings() error = %v", err)
+	}
+	client.Switch(newClient, "model-b", 4)
+	if _, err := client.CreateEmbedding(context.Background(), "b"); err != nil {
+		t.Fatalf("CreateEmbedding() error = %v", err)
+	}
+
+	if len(oldClient.calls) != 1 || len(newClient.calls) != 1 {
+		t.Fatalf("unexpected calls: old=%v new=%v", oldClient.calls, newClient.calls)
+	}
+	if client.Model() != "model-b" || client.Dimensions() != 4 {
+		t.Fatalf("unexpected model info: %s %d", client.Model(), client.Dimensions())
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"time"
 
 	"pai_smart_go_v2/internal/config"
 	"pai_smart_go_v2/internal/model"
@@ -16,19 +19,62 @@ import (
 )
 
 const (
-	defaultIndexName  = "knowledge_base"
-	defaultVectorDims = 2048
-	defaultAnalyzer   = "standard"
+	defaultIndexName   = "knowledge_base"
+	defaultVectorDims  = 2048
+	defaultAnalyzer    = "standard"
+	indexVersionSuffix = "_v"
 )
 
+// ErrDocumentsNotIndexed 表示 update-by-query 没有匹配到用户名下的任何分块：
+// 相同内容的分块按 fileMD5 共用，最后一次由其他用户处理时分块记在对方名下，更新不会生效。
+var ErrDocumentsNotIndexed = errors.New("no documents indexed under the owner")
+
+// Client 读写的 IndexName 是别名，背后是带版本号的具体索引（<别名>_v<N>）；
+// 更换 embedding 模型时先建新版本索引并迁移数据，再原子切换别名。
 type Client interface {
+	// EnsureIndex 确保别名存在；都不存在时创建 <别名>_v1 并挂上别名。
+	// 旧部署中直接以别名为名创建的索引会原样沿用，直到第一次迁移。
 	EnsureIndex(ctx context.Context) error
+	// ActiveIndex 返回别名当前指向的具体索引。
+	ActiveIndex(ctx context.Context) (string, error)
+	// ActiveIndexModel 读取别名当前指向索引的 _meta，返回建索引时记录的模型和向量维度。
+	ActiveIndexModel(ctx context.Context) (IndexModel, error)
+	// CreateIndexVersion 按给定维度创建下一个版本的索引并返回索引名，不挂别名。
+	CreateIndexVersion(ctx context.Context, vectorDims int, modelVersion string) (string, error)
+	// SwapAlias 用一次 _aliases 请求把别名从当前索引切到 index。
+	SwapAlias(ctx context.Context, index string) error
+	// ForIndex 返回直接读写具体索引 index 的客户端，供迁移任务写入尚未挂别名的新索引。
+	ForIndex(index string) Client
 	BulkIndexDocuments(ctx context.Context, docs []model.EsDocument) error
 	SearchDocuments(ctx context.Context, req SearchRequest) ([]SearchHit, error)
+	// SearchDocumentsWithFacets 与 SearchDocuments 相同，另外按标签、组织、文件类型、上传者和上传月份聚合命中的文档数。
+	SearchDocumentsWithFacets(ctx context.Context, req SearchRequest) ([]SearchHit, Facets, error)
 	DeleteDocumentsByFileMD5(ctx context.Context, fileMD5 string) error
+	DeleteDocumentsByVectorIDs(ctx context.Context, vectorIDs []string) error
+	// GetDocumentsByVectorIDs 用 _mget 按 vector_id 读取文档（含向量），不存在的文档不出现在返回值中。
+	GetDocumentsByVectorIDs(ctx context.Context, vectorIDs []string) (map[string]model.EsDocument, error)
+	// MarkSuperseded 用 update-by-query 更新用户名下 fileMD5s 所有分块的 superseded 字段，文档版本变化时调用。
+	MarkSuperseded(ctx context.Context, fileMD5s []string, userID uint, superseded bool) error
+	// CountDocumentsByOwner 按 fileMD5 统计用户名下的分块数，没有分块的 fileMD5 不出现在返回值中。
+	CountDocumentsByOwner(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error)
+	// SetFolder、SetTags、SetSharing 没有匹配到任何分块时返回 ErrDocumentsNotIndexed，调用方只应传入已索引的 fileMD5。
+	// SetFolder 用 update-by-query 更新用户名下 fileMD5s 所有分块的 folder_id，文档移动到其他文件夹时调用。
+	SetFolder(ctx context.Context, fileMD5s []string, userID uint, folderID uint) error
+	// SetTags 用 update-by-query 覆盖用户名下 fileMD5s 所有分块的 tags 和 custom_metadata，用户修改文档标签时调用。
+	SetTags(ctx context.Context, fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error
+	// SetSharing 用 update-by-query 覆盖用户名下 fileMD5s 所有分块的共享授权字段，文档授权变化时调用。
+	SetSharing(ctx context.Context, fileMD5s []string, userID uint, sharing model.DocumentSharing) error
 	IndexName() string
 }
 
+// IndexModel 是索引 _meta 中记录的 embedding 模型；ModelVersion 为空表示建索引时未记录模型，
+// 未写 _meta 的旧索引从 vector 字段映射读取维度。
+type IndexModel struct {
+	Index        string
+	ModelVersion string
+	VectorDims   int
+}
+
 type client struct {
 	raw *elasticsearch.Client
 	cfg config.ElasticsearchConfig
@@ -54,8 +100,69 @@ type SearchRequest struct {
 	RescoreQueryWeight float64
 	UserID             uint
 	OrgTags            []string
+	Metadata           MetadataFilter
+	// TitleBoost 大于 0 时，标题与查询匹配的分块额外加分。
+	TitleBoost float64
+	// IncludeSuperseded 为 true 时同时检索文档的历史版本，默认只检索最新版本。
+	IncludeSuperseded bool
+	// FolderIDs 非空时只检索这些文件夹中的文档，由调用方展开为整棵子树。
+	FolderIDs []uint
+	// Scope 是对话选定的知识库范围，与权限过滤叠加。
+	Scope ScopeFilter
+	// FacetSize 是每个分面最多返回的桶数，只有 SearchDocumentsWithFacets 使用。
+	FacetSize int
+}
+
+// ScopeFilter 把检索限定在指定文件、组织标签或文件夹内，三者取并集；全部为空时不过滤。
+type ScopeFilter struct {
+	FileMD5s  []string
+	OrgTags   []string
+	FolderIDs []uint
+}
+
+func (f ScopeFilter) isEmpty() bool {
+	return len(f.FileMD5s) == 0 && len(f.OrgTags) == 0 && len(f.FolderIDs) == 0
+}
+
+// MetadataFilter 按文档元数据过滤检索结果，零值字段不参与过滤。
+type MetadataFilter struct {
+	Language     string
+	Author       string
+	AuthoredFrom *time.Time
+	AuthoredTo   *time.Time
+	MinPages     int
+	MaxPages     int
+	// Tags 中的标签必须全部命中。
+	Tags         []string
+	FileType     string
+	OrgTag       string
+	UploaderID   uint
+	UploadedFrom *time.Time
+	UploadedTo   *time.Time
+	// CustomMetadata 按键精确匹配自定义元数据的值。
+	CustomMetadata map[string]string
 }
 
+// 分面名称，同时用作 ES 聚合名。
+const (
+	FacetTags         = "tags"
+	FacetOrgTags      = "orgTags"
+	FacetFileTypes    = "fileTypes"
+	FacetUploaders    = "uploaders"
+	FacetUploadMonths = "uploadMonths"
+)
+
+const defaultFacetSize = 10
+
+// FacetBucket 是分面中的一个取值及命中的文档数（按 file_md5 去重，不是分块数）。
+type FacetBucket struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// Facets 以分面名称为键。
+type Facets map[string][]FacetBucket
+
 type SearchHit struct {
 	Score  float64
 	Source model.EsDocument
@@ -68,6 +175,16 @@ type searchResponse struct {
 			Source model.EsDocument `json:"_source"`
 		} `json:"hits"`
 	} `json:"hits"`
+	Aggregations map[string]struct {
+		Buckets []struct {
+			Key         json.RawMessage `json:"key"`
+			KeyAsString string          `json:"key_as_string"`
+			DocCount    int64           `json:"doc_count"`
+			Docs        struct {
+				Value int64 `json:"value"`
+			} `json:"docs"`
+		} `json:"buckets"`
+	} `json:"aggregations"`
 }
 
 func NewClient(cfg config.ElasticsearchConfig) (Client, error) {
@@ -104,14 +221,184 @@ func (c *client) EnsureIndex(ctx context.Context) error {
 
 	switch res.StatusCode {
 	case 200:
-		return nil
+		return c.putMetadataMapping(ctx)
 	case 404:
-		return c.createIndex(ctx)
+		return c.createIndex(ctx, indexVersionName(c.cfg.IndexName, 1), c.cfg.VectorDims, "", true)
 	default:
 		return fmt.Errorf("check index exists failed: %s", responseError(res))
 	}
 }
 
+func (c *client) ActiveIndex(ctx context.Context) (string, error) {
+	res, err := c.raw.Indices.GetAlias(
+		c.raw.Indices.GetAlias.WithContext(ctx),
+		c.raw.Indices.GetAlias.WithName(c.cfg.IndexName),
+	)
+	if err != nil {
+		return "", fmt.Errorf("get alias failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == 404:
+		return c.legacyIndex(ctx)
+	case res.IsError():
+		return "", fmt.Errorf("get alias failed: %s", responseError(res))
+	}
+
+	var parsed map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("decode alias response failed: %w", err)
+	}
+	if len(parsed) != 1 {
+		return "", fmt.Errorf("alias %s points to %d indexes, expected exactly 1", c.cfg.IndexName, len(parsed))
+	}
+	for index := range parsed {
+		return index, nil
+	}
+	return "", nil
+}
+
+func (c *client) ActiveIndexModel(ctx context.Context) (IndexModel, error) {
+	res, err := c.raw.Indices.GetMapping(
+		c.raw.Indices.GetMapping.WithContext(ctx),
+		c.raw.Indices.GetMapping.WithIndex(c.cfg.IndexName),
+	)
+	if err != nil {
+		return IndexModel{}, fmt.Errorf("get index mapping failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return IndexModel{}, fmt.Errorf("get index mapping failed: %s", responseError(res))
+	}
+
+	var parsed map[string]struct {
+		Mappings struct {
+			Meta struct {
+				ModelVersion string `json:"model_version"`
+				VectorDims   int    `json:"vector_dims"`
+			} `json:"_meta"`
+			Properties struct {
+				Vector struct {
+					Dims int `json:"dims"`
+				} `json:"vector"`
+			} `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return IndexModel{}, fmt.Errorf("decode index mapping failed: %w", err)
+	}
+	if len(parsed) != 1 {
+		return IndexModel{}, fmt.Errorf("alias %s points to %d indexes, expected exactly 1", c.cfg.IndexName, len(parsed))
+	}
+	for index, mapping := range parsed {
+		dims := mapping.Mappings.Meta.VectorDims
+		if dims == 0 {
+			dims = mapping.Mappings.Properties.Vector.Dims
+		}
+		return IndexModel{Index: index, ModelVersion: mapping.Mappings.Meta.ModelVersion, VectorDims: dims}, nil
+	}
+	return IndexModel{}, nil
+}
+
+// legacyIndex 处理别名不存在的情况：同名具体索引存在时返回它本身。
+func (c *client) legacyIndex(ctx context.Context) (string, error) {
+	res, err := c.raw.Indices.Exists([]string{c.cfg.IndexName}, c.raw.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("check index exists failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return c.cfg.IndexName, nil
+	case 404:
+		return "", fmt.Errorf("index or alias %s not found", c.cfg.IndexName)
+	default:
+		return "", fmt.Errorf("check index exists failed: %s", responseError(res))
+	}
+}
+
+func (c *client) CreateIndexVersion(ctx context.Context, vectorDims int, modelVersion string) (string, error) {
+	if vectorDims <= 0 {
+		return "", fmt.Errorf("vector dims must be greater than 0")
+	}
+
+	res, err := c.raw.Indices.Get(
+		[]string{c.cfg.IndexName + indexVersionSuffix + "*"},
+		c.raw.Indices.Get.WithContext(ctx),
+	)
+	if err != nil {
+		return "", fmt.Errorf("list index versions failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", fmt.Errorf("list index versions failed: %s", responseError(res))
+	}
+
+	var existing map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&existing); err != nil {
+		return "", fmt.Errorf("decode index list failed: %w", err)
+	}
+	latest := 0
+	for index := range existing {
+		if version, ok := parseIndexVersion(c.cfg.IndexName, index); ok && version > latest {
+			latest = version
+		}
+	}
+
+	index := indexVersionName(c.cfg.IndexName, latest+1)
+	if err := c.createIndex(ctx, index, vectorDims, modelVersion, false); err != nil {
+		return "", err
+	}
+	return index, nil
+}
+
+func (c *client) SwapAlias(ctx context.Context, index string) error {
+	index = strings.TrimSpace(index)
+	if index == "" {
+		return fmt.Errorf("target index is empty")
+	}
+
+	active, err := c.ActiveIndex(ctx)
+	if err != nil {
+		return err
+	}
+	if active == index {
+		return nil
+	}
+
+	actions := []interface{}{
+		map[string]interface{}{"add": map[string]interface{}{"index": index, "alias": c.cfg.IndexName}},
+	}
+	if active == c.cfg.IndexName {
+		// 旧部署的同名具体索引必须删除，别名才能使用这个名字；数据已全部迁到新索引。
+		actions = append(actions, map[string]interface{}{"remove_index": map[string]interface{}{"index": active}})
+	} else {
+		actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": active, "alias": c.cfg.IndexName}})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return fmt.Errorf("marshal alias actions failed: %w", err)
+	}
+	res, err := c.raw.Indices.UpdateAliases(bytes.NewReader(body), c.raw.Indices.UpdateAliases.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("swap alias failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("swap alias failed: %s", responseError(res))
+	}
+	return nil
+}
+
+func (c *client) ForIndex(index string) Client {
+	cfg := c.cfg
+	cfg.IndexName = index
+	return &client{raw: c.raw, cfg: cfg}
+}
+
 func (c *client) BulkIndexDocuments(ctx context.Context, docs []model.EsDocument) error {
 	if len(docs) == 0 {
 		return nil
@@ -181,7 +468,32 @@ func (c *client) SearchDocuments(ctx context.Context, req SearchRequest) ([]Sear
 		return nil, fmt.Errorf("topK must be greater than 0")
 	}
 
-	body, err := json.Marshal(buildSearchBody(req))
+	parsed, err := c.search(ctx, buildSearchBody(req))
+	if err != nil {
+		return nil, err
+	}
+	return toSearchHits(parsed), nil
+}
+
+func (c *client) SearchDocumentsWithFacets(ctx context.Context, req SearchRequest) ([]SearchHit, Facets, error) {
+	if len(req.QueryVector) == 0 {
+		return nil, nil, fmt.Errorf("query vector is empty")
+	}
+	if req.TopK <= 0 {
+		return nil, nil, fmt.Errorf("topK must be greater than 0")
+	}
+
+	body := buildSearchBody(req)
+	body["aggs"] = buildFacetAggs(positiveOrDefault(req.FacetSize, defaultFacetSize))
+	parsed, err := c.search(ctx, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return toSearchHits(parsed), toFacets(parsed), nil
+}
+
+func (c *client) search(ctx context.Context, searchBody map[string]interface{}) (*searchResponse, error) {
+	body, err := json.Marshal(searchBody)
 	if err != nil {
 		return nil, fmt.Errorf("marshal search body failed: %w", err)
 	}
@@ -204,7 +516,10 @@ func (c *client) SearchDocuments(ctx context.Context, req SearchRequest) ([]Sear
 	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
 		return nil, fmt.Errorf("decode search response failed: %w", err)
 	}
+	return &parsed, nil
+}
 
+func toSearchHits(parsed *searchResponse) []SearchHit {
 	hits := make([]SearchHit, 0, len(parsed.Hits.Hits))
 	for _, hit := range parsed.Hits.Hits {
 		hits = append(hits, SearchHit{
@@ -212,7 +527,31 @@ func (c *client) SearchDocuments(ctx context.Context, req SearchRequest) ([]Sear
 			Source: hit.Source,
 		})
 	}
-	return hits, nil
+	return hits
+}
+
+// toFacets 把聚合结果转换为分面；数值型的键（如 user_id）统一转成字符串，日期直方图使用格式化后的月份。
+func toFacets(parsed *searchResponse) Facets {
+	facets := make(Facets, len(parsed.Aggregations))
+	for name, agg := range parsed.Aggregations {
+		buckets := make([]FacetBucket, 0, len(agg.Buckets))
+		for _, bucket := range agg.Buckets {
+			key := bucket.KeyAsString
+			if key == "" {
+				var raw interface{}
+				_ = json.Unmarshal(bucket.Key, &raw)
+				switch value := raw.(type) {
+				case string:
+					key = value
+				case float64:
+					key = strconv.FormatFloat(value, 'f', -1, 64)
+				}
+			}
+			buckets = append(buckets, FacetBucket{Key: key, Count: bucket.Docs.Value})
+		}
+		facets[name] = buckets
+	}
+	return facets
 }
 
 func (c *client) DeleteDocumentsByFileMD5(ctx context.Context, fileMD5 string) error {
@@ -232,8 +571,9 @@ func (c *client) DeleteDocumentsByFileMD5(ctx context.Context, fileMD5 string) e
 		return fmt.Errorf("marshal delete-by-query body failed: %w", err)
 	}
 
+	// 迁移期间新版本索引还没挂别名，按版本前缀一起删除，避免已删除的文件在切换别名后重新出现。
 	res, err := c.raw.DeleteByQuery(
-		[]string{c.cfg.IndexName},
+		[]string{c.cfg.IndexName, c.cfg.IndexName + indexVersionSuffix + "*"},
 		bytes.NewReader(body),
 		c.raw.DeleteByQuery.WithContext(ctx),
 		c.raw.DeleteByQuery.WithRefresh(true),
@@ -249,14 +589,250 @@ func (c *client) DeleteDocumentsByFileMD5(ctx context.Context, fileMD5 string) e
 	return nil
 }
 
-func (c *client) createIndex(ctx context.Context) error {
-	body, err := json.Marshal(buildIndexMapping(c.cfg))
+func (c *client) MarkSuperseded(ctx context.Context, fileMD5s []string, userID uint, superseded bool) error {
+	if _, err := c.updateByFileMD5s(ctx, fileMD5s, userID, "ctx._source.superseded = params.superseded", map[string]interface{}{"superseded": superseded}); err != nil {
+		return fmt.Errorf("update superseded flag failed: %w", err)
+	}
+	return nil
+}
+
+func (c *client) SetTags(ctx context.Context, fileMD5s []string, userID uint, tags []string, customMetadata map[string]string) error {
+	params := map[string]interface{}{"tags": tags, "custom_metadata": customMetadata}
+	if err := c.updateOwnedByFileMD5s(ctx, fileMD5s, userID, "ctx._source.tags = params.tags; ctx._source.custom_metadata = params.custom_metadata", params); err != nil {
+		return fmt.Errorf("update tags failed: %w", err)
+	}
+	return nil
+}
+
+func (c *client) SetSharing(ctx context.Context, fileMD5s []string, userID uint, sharing model.DocumentSharing) error {
+	params := map[string]interface{}{"shared_user_ids": sharing.SharedUserIDs, "shared_org_tags": sharing.SharedOrgTags}
+	if err := c.updateOwnedByFileMD5s(ctx, fileMD5s, userID, "ctx._source.shared_user_ids = params.shared_user_ids; ctx._source.shared_org_tags = params.shared_org_tags", params); err != nil {
+		return fmt.Errorf("update sharing failed: %w", err)
+	}
+	return nil
+}
+
+func (c *client) SetFolder(ctx context.Context, fileMD5s []string, userID uint, folderID uint) error {
+	if err := c.updateOwnedByFileMD5s(ctx, fileMD5s, userID, "ctx._source.folder_id = params.folder_id", map[string]interface{}{"folder_id": folderID}); err != nil {
+		return fmt.Errorf("update folder failed: %w", err)
+	}
+	return nil
+}
+
+func (c *client) CountDocumentsByOwner(ctx context.Context, fileMD5s []string, userID uint) (map[string]int64, error) {
+	counts := make(map[string]int64, len(fileMD5s))
+	if len(fileMD5s) == 0 {
+		return counts, nil
+	}
+
+	parsed, err := c.search(ctx, map[string]interface{}{
+		"size":  0,
+		"query": ownedFileMD5sQuery(fileMD5s, userID),
+		"aggs": map[string]interface{}{
+			"files": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "file_md5", "size": len(fileMD5s)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("count owner documents failed: %w", err)
+	}
+	for _, bucket := range parsed.Aggregations["files"].Buckets {
+		var fileMD5 string
+		if err := json.Unmarshal(bucket.Key, &fileMD5); err != nil {
+			return nil, fmt.Errorf("decode file_md5 bucket failed: %w", err)
+		}
+		counts[fileMD5] = bucket.DocCount
+	}
+	return counts, nil
+}
+
+// updateOwnedByFileMD5s 与 updateByFileMD5s 相同，但一个分块都没匹配到时返回 ErrDocumentsNotIndexed，
+// 避免用户名下的分块不在索引中时更新静默成功、MySQL 与 ES 的权限和过滤条件不一致。
+func (c *client) updateOwnedByFileMD5s(ctx context.Context, fileMD5s []string, userID uint, script string, params map[string]interface{}) error {
+	if len(fileMD5s) == 0 {
+		return nil
+	}
+	matched, err := c.updateByFileMD5s(ctx, fileMD5s, userID, script, params)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return fmt.Errorf("%w: user=%d md5s=%v", ErrDocumentsNotIndexed, userID, fileMD5s)
+	}
+	return nil
+}
+
+// updateByFileMD5s 对用户名下 fileMD5s 的所有分块执行一段 painless 脚本并返回匹配的分块数，
+// 不影响其他用户上传的相同内容的文件。
+func (c *client) updateByFileMD5s(ctx context.Context, fileMD5s []string, userID uint, script string, params map[string]interface{}) (int64, error) {
+	if len(fileMD5s) == 0 {
+		return 0, nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"query": ownedFileMD5sQuery(fileMD5s, userID),
+		"script": map[string]interface{}{
+			"source": script,
+			"lang":   "painless",
+			"params": params,
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("marshal update-by-query body failed: %w", err)
+	}
+
+	// 与删除一样同时更新迁移中尚未挂别名的新版本索引。
+	res, err := c.raw.UpdateByQuery(
+		[]string{c.cfg.IndexName, c.cfg.IndexName + indexVersionSuffix + "*"},
+		c.raw.UpdateByQuery.WithBody(bytes.NewReader(body)),
+		c.raw.UpdateByQuery.WithContext(ctx),
+		c.raw.UpdateByQuery.WithRefresh(true),
+		c.raw.UpdateByQuery.WithConflicts("proceed"),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, fmt.Errorf("%s", responseError(res))
+	}
+
+	var parsed struct {
+		Total int64 `json:"total"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return 0, fmt.Errorf("decode update-by-query response failed: %w", err)
+	}
+	return parsed.Total, nil
+}
+
+func ownedFileMD5sQuery(fileMD5s []string, userID uint) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []map[string]interface{}{
+				{"terms": map[string]interface{}{"file_md5": fileMD5s}},
+				{"term": map[string]interface{}{"user_id": userID}},
+			},
+		},
+	}
+}
+
+// DeleteDocumentsByVectorIDs 用 bulk delete 删除指定 vector_id，文档不存在（404）视为成功。
+func (c *client) DeleteDocumentsByVectorIDs(ctx context.Context, vectorIDs []string) error {
+	if len(vectorIDs) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, vectorID := range vectorIDs {
+		meta := map[string]map[string]string{
+			"delete": {
+				"_id": vectorID,
+			},
+		}
+		if err := encoder.Encode(meta); err != nil {
+			return fmt.Errorf("encode bulk delete metadata failed: %w", err)
+		}
+	}
+
+	opts := []func(*esapi.BulkRequest){
+		c.raw.Bulk.WithContext(ctx),
+		c.raw.Bulk.WithIndex(c.cfg.IndexName),
+	}
+	if c.cfg.RefreshOnWrite {
+		opts = append(opts, c.raw.Bulk.WithRefresh("true"))
+	}
+
+	res, err := c.raw.Bulk(&body, opts...)
+	if err != nil {
+		return fmt.Errorf("bulk delete documents failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("bulk delete documents failed: %s", responseError(res))
+	}
+
+	var parsed bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return fmt.Errorf("decode bulk response failed: %w", err)
+	}
+	for _, item := range parsed.Items {
+		for action, result := range item {
+			if result.Status >= 300 && result.Status != 404 {
+				return fmt.Errorf("bulk %s failed: status=%d error=%s", action, result.Status, strings.TrimSpace(string(result.Error)))
+			}
+		}
+	}
+	return nil
+}
+
+func (c *client) GetDocumentsByVectorIDs(ctx context.Context, vectorIDs []string) (map[string]model.EsDocument, error) {
+	if len(vectorIDs) == 0 {
+		return map[string]model.EsDocument{}, nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"ids": vectorIDs})
+	if err != nil {
+		return nil, fmt.Errorf("marshal mget body failed: %w", err)
+	}
+
+	res, err := c.raw.Mget(
+		bytes.NewReader(body),
+		c.raw.Mget.WithContext(ctx),
+		c.raw.Mget.WithIndex(c.cfg.IndexName),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get documents by vector ids failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("get documents by vector ids failed: %s", responseError(res))
+	}
+
+	var parsed struct {
+		Docs []struct {
+			ID     string           `json:"_id"`
+			Found  bool             `json:"found"`
+			Source model.EsDocument `json:"_source"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("decode mget response failed: %w", err)
+	}
+
+	docs := make(map[string]model.EsDocument, len(parsed.Docs))
+	for _, doc := range parsed.Docs {
+		if doc.Found {
+			docs[doc.ID] = doc.Source
+		}
+	}
+	return docs, nil
+}
+
+func (c *client) createIndex(ctx context.Context, index string, vectorDims int, modelVersion string, withAlias bool) error {
+	cfg := c.cfg
+	cfg.VectorDims = vectorDims
+	indexBody := buildIndexMapping(cfg)
+	indexBody["mappings"].(map[string]interface{})["_meta"] = map[string]interface{}{
+		"model_version": modelVersion,
+		"vector_dims":   vectorDims,
+	}
+	if withAlias {
+		indexBody["aliases"] = map[string]interface{}{c.cfg.IndexName: map[string]interface{}{}}
+	}
+
+	body, err := json.Marshal(indexBody)
 	if err != nil {
 		return fmt.Errorf("marshal index mapping failed: %w", err)
 	}
 
 	res, err := c.raw.Indices.Create(
-		c.cfg.IndexName,
+		index,
 		c.raw.Indices.Create.WithContext(ctx),
 		c.raw.Indices.Create.WithBody(bytes.NewReader(body)),
 	)
@@ -271,6 +847,45 @@ func (c *client) createIndex(ctx context.Context) error {
 	return nil
 }
 
+// putMetadataMapping 给已存在的索引补上文档元数据和分块位置字段的映射；字段已存在且类型一致时为空操作。
+func (c *client) putMetadataMapping(ctx context.Context) error {
+	body, err := json.Marshal(map[string]interface{}{"properties": metadataProperties(c.cfg)})
+	if err != nil {
+		return fmt.Errorf("marshal metadata mapping failed: %w", err)
+	}
+
+	res, err := c.raw.Indices.PutMapping(
+		[]string{c.cfg.IndexName},
+		bytes.NewReader(body),
+		c.raw.Indices.PutMapping.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("put metadata mapping failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("put metadata mapping failed: %s", responseError(res))
+	}
+	return nil
+}
+
+func indexVersionName(alias string, version int) string {
+	return fmt.Sprintf("%s%s%d", alias, indexVersionSuffix, version)
+}
+
+func parseIndexVersion(alias string, index string) (int, bool) {
+	raw, ok := strings.CutPrefix(index, alias+indexVersionSuffix)
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
 func normalizeConfig(cfg config.ElasticsearchConfig) (config.ElasticsearchConfig, error) {
 	if len(cfg.Addresses) == 0 {
 		return cfg, fmt.Errorf("elasticsearch addresses are empty")
@@ -292,7 +907,7 @@ func normalizeConfig(cfg config.ElasticsearchConfig) (config.ElasticsearchConfig
 }
 
 func buildIndexMapping(cfg config.ElasticsearchConfig) map[string]interface{} {
-	return map[string]interface{}{
+	mapping := map[string]interface{}{
 		"mappings": map[string]interface{}{
 			"properties": map[string]interface{}{
 				"vector_id": map[string]interface{}{
@@ -330,11 +945,93 @@ func buildIndexMapping(cfg config.ElasticsearchConfig) map[string]interface{} {
 			},
 		},
 	}
+	properties := mapping["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	for field, definition := range metadataProperties(cfg) {
+		properties[field] = definition
+	}
+	return mapping
+}
+
+func metadataProperties(cfg config.ElasticsearchConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"title": map[string]interface{}{
+			"type":            "text",
+			"analyzer":        cfg.Analyzer,
+			"search_analyzer": cfg.SearchAnalyzer,
+		},
+		"author": map[string]interface{}{
+			"type": "keyword",
+		},
+		"authored_at": map[string]interface{}{
+			"type": "date",
+		},
+		"page_count": map[string]interface{}{
+			"type": "integer",
+		},
+		"language": map[string]interface{}{
+			"type": "keyword",
+		},
+		"page_start": map[string]interface{}{
+			"type": "integer",
+		},
+		"page_end": map[string]interface{}{
+			"type": "integer",
+		},
+		"char_start": map[string]interface{}{
+			"type": "integer",
+		},
+		"char_end": map[string]interface{}{
+			"type": "integer",
+		},
+		"section_path": map[string]interface{}{
+			"type": "keyword",
+		},
+		"superseded": map[string]interface{}{
+			"type": "boolean",
+		},
+		"folder_id": map[string]interface{}{
+			"type": "long",
+		},
+		"tags": map[string]interface{}{
+			"type": "keyword",
+		},
+		"custom_metadata": map[string]interface{}{
+			"type": "flattened",
+		},
+		"file_type": map[string]interface{}{
+			"type": "keyword",
+		},
+		"uploaded_at": map[string]interface{}{
+			"type": "date",
+		},
+		"shared_user_ids": map[string]interface{}{
+			"type": "long",
+		},
+		"shared_org_tags": map[string]interface{}{
+			"type": "keyword",
+		},
+	}
 }
 
 func buildSearchBody(req SearchRequest) map[string]interface{} {
-	permissionFilter := buildPermissionFilter(req.UserID, req.OrgTags)
-	textShould := buildTextShouldClauses(req.Query, req.Phrase)
+	filters := append([]interface{}{buildPermissionFilter(req.UserID, req.OrgTags)}, buildMetadataFilters(req.Metadata)...)
+	if !req.IncludeSuperseded {
+		// 引入版本之前写入的文档没有 superseded 字段，用 must_not 把它们当作最新版本。
+		filters = append(filters, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{"term": map[string]interface{}{"superseded": true}},
+			},
+		})
+	}
+	if len(req.FolderIDs) > 0 {
+		filters = append(filters, map[string]interface{}{
+			"terms": map[string]interface{}{"folder_id": req.FolderIDs},
+		})
+	}
+	if scopeFilter := buildScopeFilter(req.Scope); scopeFilter != nil {
+		filters = append(filters, scopeFilter)
+	}
+	textShould := buildTextShouldClauses(req.Query, req.Phrase, req.TitleBoost)
 
 	body := map[string]interface{}{
 		"size": req.TopK,
@@ -347,15 +1044,31 @@ func buildSearchBody(req SearchRequest) map[string]interface{} {
 			"user_id",
 			"org_tag",
 			"is_public",
+			"superseded",
+			"folder_id",
+			"title",
+			"author",
+			"authored_at",
+			"page_count",
+			"language",
+			"page_start",
+			"page_end",
+			"char_start",
+			"char_end",
+			"section_path",
+			"tags",
+			"custom_metadata",
+			"file_type",
+			"uploaded_at",
 		},
 		"knn": map[string]interface{}{
 			"field":          "vector",
 			"query_vector":   req.QueryVector,
 			"k":              positiveOrDefault(req.KNNK, req.TopK),
 			"num_candidates": positiveOrDefault(req.NumCandidates, positiveOrDefault(req.KNNK, req.TopK)),
-			"filter":         permissionFilter,
+			"filter":         filters,
 		},
-		"query": buildQueryClause(permissionFilter, textShould),
+		"query": buildQueryClause(filters, textShould),
 	}
 
 	if len(textShould) > 0 {
@@ -378,20 +1091,53 @@ func buildSearchBody(req SearchRequest) map[string]interface{} {
 	return body
 }
 
+// buildPermissionFilter 与 MySQL 侧的可访问文件判断保持一致：公开、自己的、所属组织标签的，以及共享给本人或所属组织标签的文档。
 func buildPermissionFilter(userID uint, orgTags []string) map[string]interface{} {
-	should := make([]interface{}, 0, 3)
+	should := make([]interface{}, 0, 5)
 	should = append(should,
 		map[string]interface{}{"term": map[string]interface{}{"is_public": true}},
 		map[string]interface{}{"term": map[string]interface{}{"user_id": userID}},
+		map[string]interface{}{"term": map[string]interface{}{"shared_user_ids": userID}},
 	)
 	if len(orgTags) > 0 {
-		should = append(should, map[string]interface{}{
-			"terms": map[string]interface{}{
-				"org_tag": orgTags,
+		should = append(should,
+			map[string]interface{}{
+				"terms": map[string]interface{}{
+					"org_tag": orgTags,
+				},
 			},
-		})
+			map[string]interface{}{
+				"terms": map[string]interface{}{
+					"shared_org_tags": orgTags,
+				},
+			},
+		)
+	}
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// buildScopeFilter 把对话范围转换为 should 子句，命中任意一个文件、组织标签或文件夹即可；范围为空时返回 nil。
+func buildScopeFilter(scope ScopeFilter) map[string]interface{} {
+	if scope.isEmpty() {
+		return nil
 	}
 
+	should := make([]interface{}, 0, 3)
+	if len(scope.FileMD5s) > 0 {
+		should = append(should, map[string]interface{}{"terms": map[string]interface{}{"file_md5": scope.FileMD5s}})
+	}
+	if len(scope.OrgTags) > 0 {
+		should = append(should, map[string]interface{}{"terms": map[string]interface{}{"org_tag": scope.OrgTags}})
+	}
+	if len(scope.FolderIDs) > 0 {
+		should = append(should, map[string]interface{}{"terms": map[string]interface{}{"folder_id": scope.FolderIDs}})
+	}
 	return map[string]interface{}{
 		"bool": map[string]interface{}{
 			"should":               should,
@@ -400,7 +1146,94 @@ func buildPermissionFilter(userID uint, orgTags []string) map[string]interface{}
 	}
 }
 
-func buildTextShouldClauses(query string, phrase string) []interface{} {
+// buildMetadataFilters 把元数据条件转换为 ES filter 子句，与权限过滤同时作用于 knn 和 bool 查询。
+func buildMetadataFilters(filter MetadataFilter) []interface{} {
+	filters := make([]interface{}, 0, 4)
+	if language := strings.ToLower(strings.TrimSpace(filter.Language)); language != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"language": language}})
+	}
+	if author := strings.TrimSpace(filter.Author); author != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"author": author}})
+	}
+	if filter.AuthoredFrom != nil || filter.AuthoredTo != nil {
+		dateRange := map[string]interface{}{}
+		if filter.AuthoredFrom != nil {
+			dateRange["gte"] = filter.AuthoredFrom.Format(time.RFC3339)
+		}
+		if filter.AuthoredTo != nil {
+			dateRange["lte"] = filter.AuthoredTo.Format(time.RFC3339)
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"authored_at": dateRange}})
+	}
+	if filter.MinPages > 0 || filter.MaxPages > 0 {
+		pageRange := map[string]interface{}{}
+		if filter.MinPages > 0 {
+			pageRange["gte"] = filter.MinPages
+		}
+		if filter.MaxPages > 0 {
+			pageRange["lte"] = filter.MaxPages
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"page_count": pageRange}})
+	}
+	for _, tag := range filter.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"tags": tag}})
+		}
+	}
+	if fileType := strings.ToLower(strings.TrimSpace(filter.FileType)); fileType != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"file_type": fileType}})
+	}
+	if orgTag := strings.TrimSpace(filter.OrgTag); orgTag != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"org_tag": orgTag}})
+	}
+	if filter.UploaderID > 0 {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"user_id": filter.UploaderID}})
+	}
+	if filter.UploadedFrom != nil || filter.UploadedTo != nil {
+		dateRange := map[string]interface{}{}
+		if filter.UploadedFrom != nil {
+			dateRange["gte"] = filter.UploadedFrom.Format(time.RFC3339)
+		}
+		if filter.UploadedTo != nil {
+			dateRange["lte"] = filter.UploadedTo.Format(time.RFC3339)
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"uploaded_at": dateRange}})
+	}
+	for key, value := range filter.CustomMetadata {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"custom_metadata." + key: value}})
+	}
+	return filters
+}
+
+// buildFacetAggs 构造分面聚合；每个桶用 file_md5 的 cardinality 统计文档数，避免同一文档的多个分块重复计数。
+func buildFacetAggs(size int) map[string]interface{} {
+	docCount := map[string]interface{}{
+		"docs": map[string]interface{}{"cardinality": map[string]interface{}{"field": "file_md5"}},
+	}
+	termsAgg := func(field string) map[string]interface{} {
+		return map[string]interface{}{
+			"terms": map[string]interface{}{"field": field, "size": size},
+			"aggs":  docCount,
+		}
+	}
+	return map[string]interface{}{
+		FacetTags:      termsAgg("tags"),
+		FacetOrgTags:   termsAgg("org_tag"),
+		FacetFileTypes: termsAgg("file_type"),
+		FacetUploaders: termsAgg("user_id"),
+		FacetUploadMonths: map[string]interface{}{
+			"date_histogram": map[string]interface{}{
+				"field":             "uploaded_at",
+				"calendar_interval": "month",
+				"format":            "yyyy-MM",
+				"min_doc_count":     1,
+			},
+			"aggs": docCount,
+		},
+	}
+}
+
+func buildTextShouldClauses(query string, phrase string, titleBoost float64) []interface{} {
 	query = strings.TrimSpace(query)
 	phrase = strings.TrimSpace(phrase)
 	if query == "" {
@@ -427,12 +1260,22 @@ func buildTextShouldClauses(query string, phrase string) []interface{} {
 			},
 		})
 	}
+	if titleBoost > 0 {
+		should = append(should, map[string]interface{}{
+			"match": map[string]interface{}{
+				"title": map[string]interface{}{
+					"query": query,
+					"boost": titleBoost,
+				},
+			},
+		})
+	}
 	return should
 }
 
-func buildQueryClause(permissionFilter map[string]interface{}, textShould []interface{}) map[string]interface{} {
+func buildQueryClause(filters []interface{}, textShould []interface{}) map[string]interface{} {
 	boolQuery := map[string]interface{}{
-		"filter": []interface{}{permissionFilter},
+		"filter": filters,
 	}
 	if len(textShould) > 0 {
 		boolQuery["must"] = []interface{}{
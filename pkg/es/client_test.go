@@ -2,10 +2,13 @@ package es
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"pai_smart_go_v2/internal/config"
 	"pai_smart_go_v2/internal/model"
@@ -13,7 +16,7 @@ import (
 	"github.com/elastic/go-elasticsearch/v8"
 )
 
-func TestClient_EnsureIndex_CreatesMissingIndex(t *testing.T) {
+func TestClient_EnsureIndex_CreatesVersionedIndexBehindAlias(t *testing.T) {
 	var createBody string
 	raw, err := elasticsearch.NewClient(elasticsearch.Config{
 		Addresses: []string{"http://es.local"},
@@ -25,7 +28,7 @@ func TestClient_EnsureIndex_CreatesMissingIndex(t *testing.T) {
 					Header:     http.Header{"X-Elastic-Product": []string{"Elasticsearch"}},
 					Body:       io.NopCloser(strings.NewReader("")),
 				}, nil
-			case r.Method == http.MethodPut && r.URL.Path == "/knowledge_base":
+			case r.Method == http.MethodPut && r.URL.Path == "/knowledge_base_v1":
 				body, readErr := io.ReadAll(r.Body)
 				if readErr != nil {
 					t.Fatalf("ReadAll() error = %v", readErr)
@@ -67,6 +70,9 @@ func TestClient_EnsureIndex_CreatesMissingIndex(t *testing.T) {
 	if !strings.Contains(createBody, `"dense_vector"`) || !strings.Contains(createBody, `"dims":2`) {
 		t.Fatalf("unexpected index mapping body: %s", createBody)
 	}
+	if !strings.Contains(createBody, `"aliases":{"knowledge_base":{}}`) {
+		t.Fatalf("expected index to be created behind alias: %s", createBody)
+	}
 }
 
 func TestClient_BulkIndexDocuments(t *testing.T) {
@@ -134,6 +140,118 @@ func TestClient_BulkIndexDocuments(t *testing.T) {
 	}
 }
 
+func TestClient_ActiveIndexModel(t *testing.T) {
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Method != http.MethodGet || r.URL.Path != "/knowledge_base/_mapping" {
+				t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header: http.Header{
+					"X-Elastic-Product": []string{"Elasticsearch"},
+					"Content-Type":      []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"knowledge_base_v2":{"mappings":{"_meta":{"model_version":"text-embedding-v4","vector_dims":1024},"properties":{"vector":{"type":"dense_vector","dims":1024}}}}}`)),
+			}, nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+
+	client := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+	active, err := client.ActiveIndexModel(context.Background())
+	if err != nil {
+		t.Fatalf("ActiveIndexModel() error = %v", err)
+	}
+	if active.Index != "knowledge_base_v2" || active.ModelVersion != "text-embedding-v4" || active.VectorDims != 1024 {
+		t.Fatalf("unexpected index model: %+v", active)
+	}
+}
+
+func TestClient_DeleteDocumentsByVectorIDs(t *testing.T) {
+	var bulkBody string
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Method != http.MethodPost || r.URL.Path != "/knowledge_base/_bulk" {
+				t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+			}
+			body, readErr := io.ReadAll(r.Body)
+			if readErr != nil {
+				t.Fatalf("ReadAll() error = %v", readErr)
+			}
+			bulkBody = string(body)
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header: http.Header{
+					"X-Elastic-Product": []string{"Elasticsearch"},
+					"Content-Type":      []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"errors":false,"items":[{"delete":{"status":200}},{"delete":{"status":404}}]}`)),
+			}, nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+
+	client := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+	if err := client.DeleteDocumentsByVectorIDs(context.Background(), []string{"md5_3", "md5_4"}); err != nil {
+		t.Fatalf("DeleteDocumentsByVectorIDs() error = %v", err)
+	}
+	if !strings.Contains(bulkBody, `{"delete":{"_id":"md5_3"}}`) || !strings.Contains(bulkBody, `{"delete":{"_id":"md5_4"}}`) {
+		t.Fatalf("unexpected bulk body: %s", bulkBody)
+	}
+}
+
+func TestClient_GetDocumentsByVectorIDs(t *testing.T) {
+	var mgetBody string
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if r.URL.Path != "/knowledge_base/_mget" {
+				t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+			}
+			body, readErr := io.ReadAll(r.Body)
+			if readErr != nil {
+				t.Fatalf("ReadAll() error = %v", readErr)
+			}
+			mgetBody = string(body)
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header: http.Header{
+					"X-Elastic-Product": []string{"Elasticsearch"},
+					"Content-Type":      []string{"application/json"},
+				},
+				Body: io.NopCloser(strings.NewReader(`{"docs":[
+					{"_id":"md5_0","found":true,"_source":{"vector_id":"md5_0","chunk_id":0,"vector":[0.1,0.2],"model_version":"m"}},
+					{"_id":"md5_1","found":false}
+				]}`)),
+			}, nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+
+	client := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+	docs, err := client.GetDocumentsByVectorIDs(context.Background(), []string{"md5_0", "md5_1"})
+	if err != nil {
+		t.Fatalf("GetDocumentsByVectorIDs() error = %v", err)
+	}
+	if mgetBody != `{"ids":["md5_0","md5_1"]}` {
+		t.Fatalf("unexpected mget body: %s", mgetBody)
+	}
+	if len(docs) != 1 || len(docs["md5_0"].Vector) != 2 || docs["md5_0"].ModelVersion != "m" {
+		t.Fatalf("unexpected docs: %+v", docs)
+	}
+}
+
 func TestClient_SearchDocuments(t *testing.T) {
 	var searchBody string
 	raw, err := elasticsearch.NewClient(elasticsearch.Config{
@@ -238,6 +356,349 @@ func TestBuildSearchBody_QuerylessFallsBackToFilterOnly(t *testing.T) {
 	}
 }
 
+func TestBuildSearchBody_MetadataFiltersAndTitleBoost(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	body := buildSearchBody(SearchRequest{
+		QueryVector: []float32{0.1, 0.2},
+		Query:       "季度 报告",
+		TopK:        5,
+		UserID:      9,
+		Metadata:    MetadataFilter{Language: "ZH", Author: "张三", AuthoredFrom: &from, MinPages: 10},
+		TitleBoost:  1.5,
+	})
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	raw := string(encoded)
+	for _, want := range []string{
+		`"term":{"language":"zh"}`,
+		`"term":{"author":"张三"}`,
+		`"range":{"authored_at":{"gte":"2024-01-01T00:00:00Z"}}`,
+		`"range":{"page_count":{"gte":10}}`,
+		`"title":{"boost":1.5,"query":"季度 报告"}`,
+	} {
+		if !strings.Contains(raw, want) {
+			t.Fatalf("expected %s in search body: %s", want, raw)
+		}
+	}
+	knnFilters := body["knn"].(map[string]interface{})["filter"].([]interface{})
+	if len(knnFilters) != 6 {
+		t.Fatalf("expected permission, metadata and version filters on knn, got %d", len(knnFilters))
+	}
+}
+
+func TestBuildSearchBody_ExcludesSupersededUnlessRequested(t *testing.T) {
+	supersededFilter := `"must_not":{"term":{"superseded":true}}`
+
+	body := buildSearchBody(SearchRequest{QueryVector: []float32{0.1}, Query: "手册", TopK: 3, UserID: 1})
+	encoded, _ := json.Marshal(body)
+	if strings.Count(string(encoded), supersededFilter) != 2 {
+		t.Fatalf("expected superseded filter on knn and query: %s", encoded)
+	}
+
+	body = buildSearchBody(SearchRequest{QueryVector: []float32{0.1}, Query: "手册", TopK: 3, UserID: 1, IncludeSuperseded: true})
+	encoded, _ = json.Marshal(body)
+	if strings.Contains(string(encoded), supersededFilter) {
+		t.Fatalf("history search should not filter superseded versions: %s", encoded)
+	}
+}
+
+func TestBuildSearchBody_FolderFilter(t *testing.T) {
+	folderFilter := `{"terms":{"folder_id":[3,4]}}`
+
+	body := buildSearchBody(SearchRequest{QueryVector: []float32{0.1}, Query: "手册", TopK: 3, UserID: 1, FolderIDs: []uint{3, 4}})
+	encoded, _ := json.Marshal(body)
+	if strings.Count(string(encoded), folderFilter) != 2 {
+		t.Fatalf("expected folder filter on knn and query: %s", encoded)
+	}
+
+	body = buildSearchBody(SearchRequest{QueryVector: []float32{0.1}, Query: "手册", TopK: 3, UserID: 1})
+	encoded, _ = json.Marshal(body)
+	if strings.Contains(string(encoded), `"terms":{"folder_id"`) {
+		t.Fatalf("unscoped search should not filter by folder: %s", encoded)
+	}
+}
+
+func TestClient_MarkSuperseded(t *testing.T) {
+	var gotPath, gotBody string
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(r.Body)
+			gotPath, gotBody = r.URL.Path, string(body)
+			return jsonResponse(http.StatusOK, `{"total":2,"updated":2}`), nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+	c := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+
+	if err := c.MarkSuperseded(context.Background(), []string{"md5-v1", "md5-v2"}, 7, true); err != nil {
+		t.Fatalf("MarkSuperseded() error = %v", err)
+	}
+	if gotPath != "/knowledge_base,knowledge_base_v*/_update_by_query" {
+		t.Fatalf("unexpected path: %s", gotPath)
+	}
+	if !strings.Contains(gotBody, `"terms":{"file_md5":["md5-v1","md5-v2"]}`) || !strings.Contains(gotBody, `"term":{"user_id":7}`) || !strings.Contains(gotBody, `"params":{"superseded":true}`) {
+		t.Fatalf("unexpected body: %s", gotBody)
+	}
+}
+
+func TestBuildSearchBody_ScopeFilter(t *testing.T) {
+	body := buildSearchBody(SearchRequest{
+		QueryVector: []float32{0.1},
+		Query:       "手册",
+		TopK:        3,
+		UserID:      1,
+		Scope:       ScopeFilter{FileMD5s: []string{"md5-a"}, FolderIDs: []uint{2}},
+	})
+	encoded, _ := json.Marshal(body)
+	scopeFilter := `{"bool":{"minimum_should_match":1,"should":[{"terms":{"file_md5":["md5-a"]}},{"terms":{"folder_id":[2]}}]}}`
+	if strings.Count(string(encoded), scopeFilter) != 2 {
+		t.Fatalf("expected scope filter on knn and query: %s", encoded)
+	}
+
+	if buildScopeFilter(ScopeFilter{}) != nil {
+		t.Fatalf("empty scope should not add a filter")
+	}
+}
+
+func TestClient_SetFolder(t *testing.T) {
+	var gotPath, gotBody string
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(r.Body)
+			gotPath, gotBody = r.URL.Path, string(body)
+			return jsonResponse(http.StatusOK, `{"total":2,"updated":2}`), nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+	c := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+
+	if err := c.SetFolder(context.Background(), []string{"md5-v1", "md5-v2"}, 7, 6); err != nil {
+		t.Fatalf("SetFolder() error = %v", err)
+	}
+	if gotPath != "/knowledge_base,knowledge_base_v*/_update_by_query" {
+		t.Fatalf("unexpected path: %s", gotPath)
+	}
+	if !strings.Contains(gotBody, `"terms":{"file_md5":["md5-v1","md5-v2"]}`) || !strings.Contains(gotBody, `"term":{"user_id":7}`) || !strings.Contains(gotBody, `"params":{"folder_id":6}`) {
+		t.Fatalf("unexpected body: %s", gotBody)
+	}
+}
+
+func TestClient_SetFolder_NoOwnedDocuments(t *testing.T) {
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			return jsonResponse(http.StatusOK, `{"total":0,"updated":0}`), nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+	c := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+
+	if err := c.SetFolder(context.Background(), []string{"md5-v1"}, 7, 6); !errors.Is(err, ErrDocumentsNotIndexed) {
+		t.Fatalf("expected ErrDocumentsNotIndexed, got %v", err)
+	}
+	// MarkSuperseded 的目标版本可能从未索引，匹配为 0 不算错误。
+	if err := c.MarkSuperseded(context.Background(), []string{"md5-v1"}, 7, true); err != nil {
+		t.Fatalf("MarkSuperseded() error = %v", err)
+	}
+}
+
+func TestClient_CountDocumentsByOwner(t *testing.T) {
+	var gotBody string
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if r.URL.Path != "/knowledge_base/_search" {
+				t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+			}
+			body, _ := io.ReadAll(r.Body)
+			gotBody = string(body)
+			return jsonResponse(http.StatusOK, `{"hits":{"hits":[]},"aggregations":{"files":{"buckets":[{"key":"md5-v1","doc_count":4}]}}}`), nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+	c := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+
+	counts, err := c.CountDocumentsByOwner(context.Background(), []string{"md5-v1", "md5-v2"}, 7)
+	if err != nil {
+		t.Fatalf("CountDocumentsByOwner() error = %v", err)
+	}
+	if len(counts) != 1 || counts["md5-v1"] != 4 {
+		t.Fatalf("unexpected counts: %+v", counts)
+	}
+	if !strings.Contains(gotBody, `"term":{"user_id":7}`) || !strings.Contains(gotBody, `"size":0`) {
+		t.Fatalf("unexpected body: %s", gotBody)
+	}
+}
+
+func TestBuildSearchBody_TagAndCustomMetadataFilters(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	body := buildSearchBody(SearchRequest{
+		QueryVector: []float32{0.1},
+		TopK:        3,
+		UserID:      1,
+		Metadata: MetadataFilter{
+			Tags:           []string{"财务", "2024"},
+			FileType:       "PDF",
+			OrgTag:         "team-a",
+			UploaderID:     7,
+			UploadedFrom:   &from,
+			CustomMetadata: map[string]string{"project": "apollo"},
+		},
+	})
+	encoded, _ := json.Marshal(body)
+	for _, want := range []string{
+		`"term":{"tags":"财务"}`,
+		`"term":{"tags":"2024"}`,
+		`"term":{"file_type":"pdf"}`,
+		`"term":{"org_tag":"team-a"}`,
+		`"term":{"user_id":7}`,
+		`"range":{"uploaded_at":{"gte":"2024-03-01T00:00:00Z"}}`,
+		`"term":{"custom_metadata.project":"apollo"}`,
+	} {
+		if strings.Count(string(encoded), want) != 2 {
+			t.Fatalf("expected %s on knn and query: %s", want, encoded)
+		}
+	}
+}
+
+func TestClient_SearchDocumentsWithFacets(t *testing.T) {
+	var searchBody string
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(r.Body)
+			searchBody = string(body)
+			return jsonResponse(http.StatusOK, `{
+				"hits": {"hits": [{"_score": 2.5, "_source": {"file_md5": "md5-a", "tags": ["财务"], "file_type": "pdf"}}]},
+				"aggregations": {
+					"tags": {"buckets": [{"key": "财务", "doc_count": 12, "docs": {"value": 3}}]},
+					"uploaders": {"buckets": [{"key": 7, "doc_count": 5, "docs": {"value": 2}}]},
+					"uploadMonths": {"buckets": [{"key": 1709251200000, "key_as_string": "2024-03", "doc_count": 4, "docs": {"value": 1}}]}
+				}
+			}`), nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+	c := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+
+	hits, facets, err := c.SearchDocumentsWithFacets(context.Background(), SearchRequest{QueryVector: []float32{0.1}, TopK: 5, UserID: 1, FacetSize: 20})
+	if err != nil {
+		t.Fatalf("SearchDocumentsWithFacets() error = %v", err)
+	}
+	if len(hits) != 1 || hits[0].Source.FileType != "pdf" || len(hits[0].Source.Tags) != 1 {
+		t.Fatalf("unexpected hits: %+v", hits)
+	}
+	if got := facets[FacetTags]; len(got) != 1 || got[0] != (FacetBucket{Key: "财务", Count: 3}) {
+		t.Fatalf("unexpected tag facet: %+v", got)
+	}
+	if got := facets[FacetUploaders]; len(got) != 1 || got[0].Key != "7" {
+		t.Fatalf("unexpected uploader facet: %+v", got)
+	}
+	if got := facets[FacetUploadMonths]; len(got) != 1 || got[0].Key != "2024-03" {
+		t.Fatalf("unexpected month facet: %+v", got)
+	}
+	for _, want := range []string{
+		`"terms":{"field":"tags","size":20}`,
+		`"cardinality":{"field":"file_md5"}`,
+		`"calendar_interval":"month"`,
+	} {
+		if !strings.Contains(searchBody, want) {
+			t.Fatalf("expected %s in search body: %s", want, searchBody)
+		}
+	}
+}
+
+func TestBuildPermissionFilter_IncludesShareGrants(t *testing.T) {
+	encoded, _ := json.Marshal(buildPermissionFilter(7, []string{"team-a"}))
+	for _, want := range []string{
+		`{"term":{"shared_user_ids":7}}`,
+		`{"terms":{"shared_org_tags":["team-a"]}}`,
+		`{"terms":{"org_tag":["team-a"]}}`,
+	} {
+		if !strings.Contains(string(encoded), want) {
+			t.Fatalf("expected %s in permission filter: %s", want, encoded)
+		}
+	}
+
+	encoded, _ = json.Marshal(buildPermissionFilter(7, nil))
+	if strings.Contains(string(encoded), "shared_org_tags") || !strings.Contains(string(encoded), `"shared_user_ids":7`) {
+		t.Fatalf("unexpected permission filter without org tags: %s", encoded)
+	}
+}
+
+func TestClient_SetSharing(t *testing.T) {
+	var gotPath, gotBody string
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(r.Body)
+			gotPath, gotBody = r.URL.Path, string(body)
+			return jsonResponse(http.StatusOK, `{"total":2,"updated":2}`), nil
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+	c := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+
+	sharing := model.DocumentSharing{SharedUserIDs: []uint{5}, SharedOrgTags: []string{"team-b"}}
+	if err := c.SetSharing(context.Background(), []string{"md5-v1"}, 7, sharing); err != nil {
+		t.Fatalf("SetSharing() error = %v", err)
+	}
+	if gotPath != "/knowledge_base,knowledge_base_v*/_update_by_query" {
+		t.Fatalf("unexpected path: %s", gotPath)
+	}
+	if !strings.Contains(gotBody, `"params":{"shared_org_tags":["team-b"],"shared_user_ids":[5]}`) || !strings.Contains(gotBody, `"term":{"user_id":7}`) {
+		t.Fatalf("unexpected body: %s", gotBody)
+	}
+}
+
+func TestClient_EnsureIndex_ExistingIndexAddsMetadataMapping(t *testing.T) {
+	var mappingBody string
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			switch {
+			case r.Method == http.MethodHead && r.URL.Path == "/knowledge_base":
+				return jsonResponse(http.StatusOK, ""), nil
+			case r.Method == http.MethodPut && r.URL.Path == "/knowledge_base/_mapping":
+				body, _ := io.ReadAll(r.Body)
+				mappingBody = string(body)
+				return jsonResponse(http.StatusOK, `{"acknowledged":true}`), nil
+			default:
+				t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+				return nil, nil
+			}
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+
+	client := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base", Analyzer: "standard", SearchAnalyzer: "standard"}}
+	if err := client.EnsureIndex(context.Background()); err != nil {
+		t.Fatalf("EnsureIndex() error = %v", err)
+	}
+	if !strings.Contains(mappingBody, `"authored_at":{"type":"date"}`) || !strings.Contains(mappingBody, `"language":{"type":"keyword"}`) {
+		t.Fatalf("unexpected mapping body: %s", mappingBody)
+	}
+}
+
 func TestBuildIndexMapping_DefaultSearchAnalyzer(t *testing.T) {
 	cfg, err := normalizeConfig(config.ElasticsearchConfig{
 		Addresses:  []string{"http://localhost:9200"},
@@ -261,6 +722,108 @@ func TestBuildIndexMapping_DefaultSearchAnalyzer(t *testing.T) {
 	}
 }
 
+func TestClient_CreateIndexVersion_UsesNextVersion(t *testing.T) {
+	var createdPath, createBody string
+	raw, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: []string{"http://es.local"},
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/knowledge_base_v*":
+				return jsonResponse(http.StatusOK, `{"knowledge_base_v1":{},"knowledge_base_v3":{},"knowledge_base_vx":{}}`), nil
+			case r.Method == http.MethodPut:
+				body, _ := io.ReadAll(r.Body)
+				createdPath, createBody = r.URL.Path, string(body)
+				return jsonResponse(http.StatusOK, `{"acknowledged":true}`), nil
+			default:
+				t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+				return nil, nil
+			}
+		}),
+	})
+	if err != nil {
+		t.Fatalf("elasticsearch.NewClient() error = %v", err)
+	}
+
+	client := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base", VectorDims: 2, Analyzer: "standard", SearchAnalyzer: "standard"}}
+	index, err := client.CreateIndexVersion(context.Background(), 4, "text-embedding-v4")
+	if err != nil {
+		t.Fatalf("CreateIndexVersion() error = %v", err)
+	}
+	if index != "knowledge_base_v4" || createdPath != "/knowledge_base_v4" {
+		t.Fatalf("unexpected index: %s path=%s", index, createdPath)
+	}
+	if !strings.Contains(createBody, `"dims":4`) || !strings.Contains(createBody, `"model_version":"text-embedding-v4"`) || strings.Contains(createBody, `"aliases"`) {
+		t.Fatalf("unexpected create body: %s", createBody)
+	}
+}
+
+func TestClient_SwapAlias(t *testing.T) {
+	cases := []struct {
+		name       string
+		aliasResp  func() *http.Response
+		wantAction string
+	}{
+		{
+			name: "versioned",
+			aliasResp: func() *http.Response {
+				return jsonResponse(http.StatusOK, `{"knowledge_base_v1":{"aliases":{"knowledge_base":{}}}}`)
+			},
+			wantAction: `{"remove":{"alias":"knowledge_base","index":"knowledge_base_v1"}}`,
+		},
+		{
+			name:       "legacy",
+			aliasResp:  func() *http.Response { return jsonResponse(http.StatusNotFound, `{}`) },
+			wantAction: `{"remove_index":{"index":"knowledge_base"}}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var actionsBody string
+			raw, err := elasticsearch.NewClient(elasticsearch.Config{
+				Addresses: []string{"http://es.local"},
+				Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					switch {
+					case r.Method == http.MethodGet && r.URL.Path == "/_alias/knowledge_base":
+						return tc.aliasResp(), nil
+					case r.Method == http.MethodHead && r.URL.Path == "/knowledge_base":
+						return jsonResponse(http.StatusOK, ""), nil
+					case r.Method == http.MethodPost && r.URL.Path == "/_aliases":
+						body, _ := io.ReadAll(r.Body)
+						actionsBody = string(body)
+						return jsonResponse(http.StatusOK, `{"acknowledged":true}`), nil
+					default:
+						t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+						return nil, nil
+					}
+				}),
+			})
+			if err != nil {
+				t.Fatalf("elasticsearch.NewClient() error = %v", err)
+			}
+
+			client := &client{raw: raw, cfg: config.ElasticsearchConfig{IndexName: "knowledge_base"}}
+			if err := client.SwapAlias(context.Background(), "knowledge_base_v2"); err != nil {
+				t.Fatalf("SwapAlias() error = %v", err)
+			}
+			if !strings.Contains(actionsBody, `{"add":{"alias":"knowledge_base","index":"knowledge_base_v2"}}`) || !strings.Contains(actionsBody, tc.wantAction) {
+				t.Fatalf("unexpected alias actions: %s", actionsBody)
+			}
+		})
+	}
+}
+
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header: http.Header{
+			"X-Elastic-Product": []string{"Elasticsearch"},
+			"Content-Type":      []string{"application/json"},
+		},
+		Body: io.NopCloser(strings.NewReader(body)),
+	}
+}
+
 type roundTripperFunc func(*http.Request) (*http.Response, error)
 
 func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
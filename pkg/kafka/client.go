@@ -17,8 +17,12 @@ import (
 )
 
 const (
-	defaultMaxRetry           = 3
-	defaultRetryKeyTTLSeconds = 24 * 60 * 60
+	defaultMaxRetry              = 3
+	defaultRetryKeyTTLSeconds    = 24 * 60 * 60
+	defaultDeadLetterTopicSuffix = ".dlq"
+	// 计数、死信、写延迟队列失败时在 worker 内重试的起始间隔和上限。
+	defaultStepRetryInterval = time.Second
+	maxStepRetryInterval     = 30 * time.Second
 )
 
 type producerWriter interface {
@@ -27,16 +31,27 @@ type producerWriter interface {
 }
 
 type consumerReader interface {
+	messageCommitter
 	FetchMessage(ctx context.Context) (kafkago.Message, error)
-	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
 	Close() error
 }
 
 // TaskProcessor 由下游处理器实现，Kafka consumer 仅负责调度消息。
+// Process 返回的错误实现 permanentError 且 Permanent 为 true 时，consumer 不再重试，直接转入死信。
 type TaskProcessor interface {
 	Process(ctx context.Context, task tasks.FileProcessingTask) error
 }
 
+// permanentError 标记重试也不会成功的处理失败，例如文件加密、格式不支持或 embedding 维度不符。
+type permanentError interface {
+	Permanent() bool
+}
+
+func isPermanentError(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent) && permanent.Permanent()
+}
+
 // RetryStore 抽象 consumer 失败计数存储，实现可用 Redis 或测试替身。
 type RetryStore interface {
 	Incr(ctx context.Context, key string) (int64, error)
@@ -44,6 +59,11 @@ type RetryStore interface {
 	Del(ctx context.Context, key string) error
 }
 
+// DeadLetterHandler 接收超过重试上限的任务。返回错误时 consumer 会退避重试，成功前不提交 offset。
+type DeadLetterHandler interface {
+	HandleDeadLetter(ctx context.Context, deadLetter tasks.DeadLetterTask) error
+}
+
 // FileTaskProducer 给业务层注入发送能力，避免直接依赖全局函数。
 type FileTaskProducer interface {
 	ProduceFileTask(ctx context.Context, task tasks.FileProcessingTask) error
@@ -60,6 +80,10 @@ func (p *ProducerClient) ProduceFileTask(ctx context.Context, task tasks.FilePro
 	return ProduceFileTask(ctx, task)
 }
 
+func (p *ProducerClient) ProduceDeadLetter(ctx context.Context, deadLetter tasks.DeadLetterTask) error {
+	return ProduceDeadLetter(ctx, deadLetter)
+}
+
 type redisRetryStore struct {
 	client *redis.Client
 }
@@ -84,8 +108,9 @@ func (s *redisRetryStore) Del(ctx context.Context, key string) error {
 }
 
 var (
-	producer  producerWriter
-	newReader = func(cfg kafkago.ReaderConfig) consumerReader {
+	producer           producerWriter
+	deadLetterProducer producerWriter
+	newReader          = func(cfg kafkago.ReaderConfig) consumerReader {
 		return kafkago.NewReader(cfg)
 	}
 )
@@ -106,14 +131,59 @@ func InitProducer(cfg config.KafkaConfig) error {
 		BatchTimeout: 20 * time.Millisecond,
 		Async:        false,
 	}
+	deadLetterProducer = &kafkago.Writer{
+		Addr:                   kafkago.TCP(cfg.Brokers...),
+		Topic:                  DeadLetterTopic(cfg),
+		Balancer:               &kafkago.LeastBytes{},
+		RequiredAcks:           kafkago.RequireAll,
+		BatchTimeout:           20 * time.Millisecond,
+		AllowAutoTopicCreation: true,
+		Async:                  false,
+	}
 	return nil
 }
 
 func CloseProducer() error {
-	if producer == nil {
-		return nil
+	var errs []error
+	if producer != nil {
+		errs = append(errs, producer.Close())
+	}
+	if deadLetterProducer != nil {
+		errs = append(errs, deadLetterProducer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// DeadLetterTopic 返回死信 topic 名称。
+func DeadLetterTopic(cfg config.KafkaConfig) string {
+	if topic := strings.TrimSpace(cfg.DeadLetterTopic); topic != "" {
+		return topic
 	}
-	return producer.Close()
+	return strings.TrimSpace(cfg.Topic) + defaultDeadLetterTopicSuffix
+}
+
+// ProduceDeadLetter 把超过重试上限的任务写入死信 topic，key 仍为 FileMD5。
+func ProduceDeadLetter(ctx context.Context, deadLetter tasks.DeadLetterTask) error {
+	if deadLetterProducer == nil {
+		return fmt.Errorf("kafka dead-letter producer is not initialized")
+	}
+
+	payload, err := json.Marshal(deadLetter)
+	if err != nil {
+		return fmt.Errorf("marshal dead letter failed: %w", err)
+	}
+
+	msg := kafkago.Message{
+		Key:   []byte(deadLetter.Task.FileMD5),
+		Value: payload,
+		Time:  deadLetter.FailedAt,
+	}
+	if err := deadLetterProducer.WriteMessages(ctx, msg); err != nil {
+		return fmt.Errorf("write dead-letter message failed: %w", err)
+	}
+
+	log.Infof("[Kafka] 死信任务发送成功: MD5=%s attempts=%d", deadLetter.Task.FileMD5, deadLetter.Attempts)
+	return nil
 }
 
 func ProduceFileTask(ctx context.Context, task tasks.FileProcessingTask) error {
@@ -145,11 +215,15 @@ func ProduceFileTask(ctx context.Context, task tasks.FileProcessingTask) error {
 	return nil
 }
 
+// StartConsumer 消费文件处理任务，cfg.Workers 个 worker 并发处理，同一 FileMD5 的消息保持顺序。delayQueue 不为空时，失败任务按指数退避写入延迟队列并立即提交 offset，
+// 不再阻塞所在分区；为空时在 worker 内按同样的退避原地重试，直到成功或转入死信。
 func StartConsumer(
 	ctx context.Context,
 	cfg config.KafkaConfig,
 	retryStore RetryStore,
+	delayQueue DelayQueue,
 	processor TaskProcessor,
+	deadLetters DeadLetterHandler,
 ) error {
 	if len(cfg.Brokers) == 0 {
 		return fmt.Errorf("kafka brokers is empty")
@@ -180,14 +254,14 @@ func StartConsumer(
 		_ = reader.Close()
 	}()
 
-	maxRetry := cfg.MaxRetry
-	if maxRetry <= 0 {
-		maxRetry = defaultMaxRetry
-	}
-	retryTTL := time.Duration(cfg.RetryKeyTTLSeconds) * time.Second
-	if cfg.RetryKeyTTLSeconds <= 0 {
-		retryTTL = defaultRetryKeyTTLSeconds * time.Second
-	}
+	policy := newRetryPolicy(cfg, retryStore, delayQueue)
+	tracker := newOffsetTracker(reader)
+	pool := newWorkerPool(ctx, cfg.Workers, func(ctx context.Context, msg kafkago.Message) {
+		if err := consumeOne(ctx, tracker, msg, policy, processor, deadLetters); err != nil {
+			log.Errorf("[Consumer] 消息处理流程异常: %v", err)
+		}
+	})
+	defer pool.close()
 
 	for {
 		msg, err := reader.FetchMessage(ctx)
@@ -199,20 +273,86 @@ func StartConsumer(
 			continue
 		}
 
-		if err := consumeOne(ctx, reader, msg, retryStore, processor, maxRetry, retryTTL); err != nil {
-			log.Errorf("[Consumer] 消息处理流程异常: %v", err)
+		tracker.track(msg)
+		if !pool.dispatch(ctx, msg) {
+			return nil
 		}
 	}
 }
 
+// retryPolicy 汇总 consumer 的失败重试参数。
+type retryPolicy struct {
+	store      RetryStore
+	delayQueue DelayQueue
+	maxRetry   int
+	keyTTL     time.Duration
+	backoff    func(attempts int64) time.Duration
+	// stepInterval 是 retryStep 的起始重试间隔。
+	stepInterval time.Duration
+}
+
+func newRetryPolicy(cfg config.KafkaConfig, retryStore RetryStore, delayQueue DelayQueue) retryPolicy {
+	maxRetry := cfg.MaxRetry
+	if maxRetry <= 0 {
+		maxRetry = defaultMaxRetry
+	}
+	keyTTL := time.Duration(cfg.RetryKeyTTLSeconds) * time.Second
+	if cfg.RetryKeyTTLSeconds <= 0 {
+		keyTTL = defaultRetryKeyTTLSeconds * time.Second
+	}
+	return retryPolicy{
+		store:      retryStore,
+		delayQueue: delayQueue,
+		maxRetry:   maxRetry,
+		keyTTL:     keyTTL,
+		backoff: func(attempts int64) time.Duration {
+			return retryBackoff(cfg, attempts)
+		},
+		stepInterval: defaultStepRetryInterval,
+	}
+}
+
+// retryStep 反复执行失败后不能跳过的步骤（失败计数、死信、写延迟队列），直到成功或 ctx 结束。
+// kafka-go 的消费组在 rebalance 或重启前不会重投递未提交的消息，直接放弃会让该分区之后的 offset 一直无法提交。
+func (p retryPolicy) retryStep(ctx context.Context, step string, fn func() error) error {
+	wait := p.stepInterval
+	if wait <= 0 {
+		wait = defaultStepRetryInterval
+	}
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		log.Errorf("[Consumer] %s失败，%s 后重试: %v", step, wait, err)
+		if !sleepContext(ctx, wait) {
+			return fmt.Errorf("%s failed: %w", step, err)
+		}
+		if wait *= 2; wait > maxStepRetryInterval {
+			wait = maxStepRetryInterval
+		}
+	}
+}
+
+// sleepContext 等待 d，ctx 先结束时返回 false。
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
 func consumeOne(
 	ctx context.Context,
-	reader consumerReader,
+	reader messageCommitter,
 	msg kafkago.Message,
-	retryStore RetryStore,
+	policy retryPolicy,
 	processor TaskProcessor,
-	maxRetry int,
-	retryTTL time.Duration,
+	deadLetters DeadLetterHandler,
 ) error {
 	log.Infof("[Consumer] 收到 Kafka 消息: topic=%s, partition=%d, offset=%d", msg.Topic, msg.Partition, msg.Offset)
 
@@ -222,22 +362,63 @@ func consumeOne(
 		return commitMessage(ctx, reader, msg)
 	}
 
-	if err := processor.Process(ctx, task); err != nil {
-		attempts, retryErr := incrementRetryCount(ctx, retryStore, task.FileMD5, retryTTL)
-		if retryErr != nil {
-			return fmt.Errorf("increment retry count failed: %w", retryErr)
+	for {
+		err := processor.Process(ctx, task)
+		if err == nil {
+			break
+		}
+
+		var attempts int64
+		if stepErr := policy.retryStep(ctx, "更新重试计数", func() error {
+			var incrErr error
+			attempts, incrErr = incrementRetryCount(ctx, policy.store, task.FileMD5, policy.keyTTL)
+			return incrErr
+		}); stepErr != nil {
+			return stepErr
 		}
 
-		if attempts >= int64(maxRetry) {
-			log.Errorf("[Consumer] 处理失败且超过重试上限，跳过: md5=%s attempts=%d err=%v", task.FileMD5, attempts, err)
+		permanent := isPermanentError(err)
+		if permanent || attempts >= int64(policy.maxRetry) {
+			if permanent {
+				log.Errorf("[Consumer] 处理失败且不可重试，直接转入死信: md5=%s attempts=%d err=%v", task.FileMD5, attempts, err)
+			} else {
+				log.Errorf("[Consumer] 处理失败且超过重试上限，转入死信: md5=%s attempts=%d err=%v", task.FileMD5, attempts, err)
+			}
+			if deadLetters != nil {
+				deadLetter := buildDeadLetter(msg, task, err, attempts)
+				if stepErr := policy.retryStep(ctx, "写入死信", func() error {
+					return deadLetters.HandleDeadLetter(ctx, deadLetter)
+				}); stepErr != nil {
+					return stepErr
+				}
+			}
+			// 计数清零，管理员重放时从头开始计算重试次数。
+			if clearErr := clearRetryCount(ctx, policy.store, task.FileMD5); clearErr != nil {
+				log.Errorf("[Consumer] 清理重试计数失败: %v", clearErr)
+			}
 			return commitMessage(ctx, reader, msg)
 		}
 
-		log.Errorf("[Consumer] 处理失败，等待 Kafka 重投递: md5=%s attempts=%d err=%v", task.FileMD5, attempts, err)
-		return nil
+		backoff := policy.backoff(attempts)
+		if policy.delayQueue == nil {
+			// 没有延迟队列时原地重试，期间该 worker 不处理其他消息。
+			log.Errorf("[Consumer] 处理失败，%s 后原地重试: md5=%s attempts=%d err=%v", backoff, task.FileMD5, attempts, err)
+			if !sleepContext(ctx, backoff) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		if stepErr := policy.retryStep(ctx, "写入延迟队列", func() error {
+			return policy.delayQueue.Schedule(ctx, task, time.Now().Add(backoff))
+		}); stepErr != nil {
+			return stepErr
+		}
+		log.Errorf("[Consumer] 处理失败，%s 后重试: md5=%s attempts=%d err=%v", backoff, task.FileMD5, attempts, err)
+		return commitMessage(ctx, reader, msg)
 	}
 
-	if err := clearRetryCount(ctx, retryStore, task.FileMD5); err != nil {
+	if err := clearRetryCount(ctx, policy.store, task.FileMD5); err != nil {
 		log.Errorf("[Consumer] 清理重试计数失败: %v", err)
 	}
 
@@ -248,7 +429,20 @@ func consumeOne(
 	return nil
 }
 
-func commitMessage(ctx context.Context, reader consumerReader, msg kafkago.Message) error {
+func buildDeadLetter(msg kafkago.Message, task tasks.FileProcessingTask, processErr error, attempts int64) tasks.DeadLetterTask {
+	return tasks.DeadLetterTask{
+		Task:        task,
+		Error:       processErr.Error(),
+		Attempts:    int(attempts),
+		SourceTopic: msg.Topic,
+		Partition:   msg.Partition,
+		Offset:      msg.Offset,
+		EnqueuedAt:  msg.Time,
+		FailedAt:    time.Now(),
+	}
+}
+
+func commitMessage(ctx context.Context, reader messageCommitter, msg kafkago.Message) error {
 	if err := reader.CommitMessages(ctx, msg); err != nil {
 		return fmt.Errorf("commit message failed: %w", err)
 	}
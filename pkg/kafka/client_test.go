@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"pai_smart_go_v2/pkg/log"
 	"testing"
 	"time"
 
+	"pai_smart_go_v2/internal/config"
 	"pai_smart_go_v2/pkg/tasks"
 
 	kafkago "github.com/segmentio/kafka-go"
@@ -84,10 +86,15 @@ func (f *fakeRetryStore) Del(ctx context.Context, key string) error {
 type fakeProcessor struct {
 	processErr error
 	called     int
+	// failures 为前 N 次调用返回 processErr，之后成功；为 0 时始终失败。
+	failures int
 }
 
 func (f *fakeProcessor) Process(ctx context.Context, task tasks.FileProcessingTask) error {
 	f.called++
+	if f.failures > 0 && f.called > f.failures {
+		return nil
+	}
 	return f.processErr
 }
 
@@ -120,10 +127,10 @@ func TestProduceFileTask_Success(t *testing.T) {
 	}
 }
 
-func TestConsumeOne_ProcessFailedBelowThreshold_NoCommit(t *testing.T) {
+func TestConsumeOne_NoDelayQueue_RetriesInPlace(t *testing.T) {
 	reader := &fakeReader{}
 	store := &fakeRetryStore{counts: map[string]int64{}}
-	processor := &fakeProcessor{processErr: errors.New("tika error")}
+	processor := &fakeProcessor{processErr: errors.New("tika error"), failures: 1}
 
 	task := tasks.FileProcessingTask{
 		FileMD5:   "md5-b",
@@ -134,15 +141,20 @@ func TestConsumeOne_ProcessFailedBelowThreshold_NoCommit(t *testing.T) {
 	raw, _ := json.Marshal(task)
 	msg := kafkago.Message{Value: raw}
 
-	err := consumeOne(context.Background(), reader, msg, store, processor, 3, time.Hour)
+	policy := testRetryPolicy(store, nil)
+	policy.backoff = func(attempts int64) time.Duration { return time.Millisecond }
+	err := consumeOne(context.Background(), reader, msg, policy, processor, nil)
 	if err != nil {
 		t.Fatalf("consumeOne() error = %v", err)
 	}
-	if reader.commitCount != 0 {
-		t.Fatalf("expected no commit, got %d", reader.commitCount)
+	if reader.commitCount != 1 {
+		t.Fatalf("expected commit after in-place retry succeeded, got %d", reader.commitCount)
 	}
-	if processor.called != 1 {
-		t.Fatalf("expected processor called once, got %d", processor.called)
+	if processor.called != 2 {
+		t.Fatalf("expected processor called twice, got %d", processor.called)
+	}
+	if _, ok := store.counts[retryKey("md5-b")]; ok {
+		t.Fatalf("expected retry key cleared after success")
 	}
 }
 
@@ -161,7 +173,7 @@ func TestConsumeOne_ProcessFailedReachThreshold_Commit(t *testing.T) {
 	msg := kafkago.Message{Value: raw}
 
 	store.counts[retryKey("md5-c")] = 2
-	err := consumeOne(context.Background(), reader, msg, store, processor, 3, time.Hour)
+	err := consumeOne(context.Background(), reader, msg, testRetryPolicy(store, nil), processor, nil)
 	if err != nil {
 		t.Fatalf("consumeOne() error = %v", err)
 	}
@@ -184,7 +196,7 @@ func TestConsumeOne_Success_ShouldCommitAndClearRetry(t *testing.T) {
 	raw, _ := json.Marshal(task)
 	msg := kafkago.Message{Value: raw}
 
-	err := consumeOne(context.Background(), reader, msg, store, processor, 3, time.Hour)
+	err := consumeOne(context.Background(), reader, msg, testRetryPolicy(store, nil), processor, nil)
 	if err != nil {
 		t.Fatalf("consumeOne() error = %v", err)
 	}
@@ -195,3 +207,292 @@ func TestConsumeOne_Success_ShouldCommitAndClearRetry(t *testing.T) {
 		t.Fatalf("expected retry key cleared")
 	}
 }
+
+type fakeDeadLetterHandler struct {
+	err         error
+	deadLetters []tasks.DeadLetterTask
+	// failures 为前 N 次调用返回 err，之后成功；为 0 时始终失败。
+	failures int
+	called   int
+}
+
+func (f *fakeDeadLetterHandler) HandleDeadLetter(ctx context.Context, deadLetter tasks.DeadLetterTask) error {
+	f.called++
+	if f.err != nil && (f.failures == 0 || f.called <= f.failures) {
+		return f.err
+	}
+	f.deadLetters = append(f.deadLetters, deadLetter)
+	return nil
+}
+
+func TestConsumeOne_ReachThreshold_PublishesDeadLetter(t *testing.T) {
+	reader := &fakeReader{}
+	store := &fakeRetryStore{counts: map[string]int64{retryKey("md5-e"): 2}}
+	processor := &fakeProcessor{processErr: errors.New("embedding api status=503")}
+	deadLetters := &fakeDeadLetterHandler{}
+
+	task := tasks.FileProcessingTask{FileMD5: "md5-e", FileName: "e.pdf", UserID: 5, ObjectKey: "uploads/5/md5-e/e.pdf"}
+	raw, _ := json.Marshal(task)
+	enqueuedAt := time.Now().Add(-time.Minute)
+	msg := kafkago.Message{Topic: "file-processing", Partition: 1, Offset: 42, Time: enqueuedAt, Value: raw}
+
+	if err := consumeOne(context.Background(), reader, msg, testRetryPolicy(store, nil), processor, deadLetters); err != nil {
+		t.Fatalf("consumeOne() error = %v", err)
+	}
+	if reader.commitCount != 1 {
+		t.Fatalf("expected commit once, got %d", reader.commitCount)
+	}
+	if len(deadLetters.deadLetters) != 1 {
+		t.Fatalf("expected one dead letter, got %d", len(deadLetters.deadLetters))
+	}
+	got := deadLetters.deadLetters[0]
+	if got.Task.FileMD5 != "md5-e" || got.Attempts != 3 || got.Error != "embedding api status=503" {
+		t.Fatalf("unexpected dead letter: %+v", got)
+	}
+	if got.SourceTopic != "file-processing" || got.Partition != 1 || got.Offset != 42 || !got.EnqueuedAt.Equal(enqueuedAt) || got.FailedAt.IsZero() {
+		t.Fatalf("unexpected dead letter position: %+v", got)
+	}
+	if _, ok := store.counts[retryKey("md5-e")]; ok {
+		t.Fatalf("expected retry key cleared after dead-lettering")
+	}
+}
+
+type fakePermanentError struct{}
+
+func (fakePermanentError) Error() string   { return "tika status=422: EncryptedDocumentException" }
+func (fakePermanentError) Permanent() bool { return true }
+
+func TestConsumeOne_PermanentFailure_DeadLettersOnFirstAttempt(t *testing.T) {
+	reader := &fakeReader{}
+	store := &fakeRetryStore{}
+	delayQueue := &fakeDelayQueue{}
+	processor := &fakeProcessor{processErr: fmt.Errorf("process failed: %w", fakePermanentError{})}
+	deadLetters := &fakeDeadLetterHandler{}
+
+	raw, _ := json.Marshal(tasks.FileProcessingTask{FileMD5: "md5-p", FileName: "p.pdf", UserID: 5})
+	msg := kafkago.Message{Topic: "file-processing", Value: raw}
+
+	if err := consumeOne(context.Background(), reader, msg, testRetryPolicy(store, delayQueue), processor, deadLetters); err != nil {
+		t.Fatalf("consumeOne() error = %v", err)
+	}
+	if processor.called != 1 || len(delayQueue.scheduled) != 0 {
+		t.Fatalf("expected no retry for a permanent failure, called=%d scheduled=%d", processor.called, len(delayQueue.scheduled))
+	}
+	if len(deadLetters.deadLetters) != 1 || deadLetters.deadLetters[0].Attempts != 1 || reader.commitCount != 1 {
+		t.Fatalf("expected one dead letter after the first attempt, got %+v commits=%d", deadLetters.deadLetters, reader.commitCount)
+	}
+}
+
+func TestConsumeOne_DeadLetterFailure_RetriesThenCommits(t *testing.T) {
+	reader := &fakeReader{}
+	store := &fakeRetryStore{counts: map[string]int64{retryKey("md5-f"): 2}}
+	processor := &fakeProcessor{processErr: errors.New("tika error")}
+	handler := &fakeDeadLetterHandler{err: errors.New("kafka down"), failures: 2}
+
+	task := tasks.FileProcessingTask{FileMD5: "md5-f", FileName: "f.pdf", UserID: 6, ObjectKey: "uploads/6/md5-f/f.pdf"}
+	raw, _ := json.Marshal(task)
+
+	if err := consumeOne(context.Background(), reader, kafkago.Message{Value: raw}, testRetryPolicy(store, nil), processor, handler); err != nil {
+		t.Fatalf("consumeOne() error = %v", err)
+	}
+	if handler.called != 3 || len(handler.deadLetters) != 1 || reader.commitCount != 1 {
+		t.Fatalf("expected dead letter retried until published and committed, calls=%d commits=%d", handler.called, reader.commitCount)
+	}
+}
+
+func TestConsumeOne_DeadLetterFailure_NoCommitOnShutdown(t *testing.T) {
+	reader := &fakeReader{}
+	store := &fakeRetryStore{counts: map[string]int64{retryKey("md5-f"): 2}}
+	processor := &fakeProcessor{processErr: errors.New("tika error")}
+
+	task := tasks.FileProcessingTask{FileMD5: "md5-f", FileName: "f.pdf", UserID: 6, ObjectKey: "uploads/6/md5-f/f.pdf"}
+	raw, _ := json.Marshal(task)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := consumeOne(ctx, reader, kafkago.Message{Value: raw}, testRetryPolicy(store, nil), processor, &fakeDeadLetterHandler{err: errors.New("kafka down")})
+	if err == nil {
+		t.Fatalf("expected dead letter error")
+	}
+	if reader.commitCount != 0 {
+		t.Fatalf("expected no commit when shutting down before dead letter succeeds, got %d", reader.commitCount)
+	}
+}
+
+func TestProduceDeadLetter_Success(t *testing.T) {
+	oldProducer := deadLetterProducer
+	defer func() { deadLetterProducer = oldProducer }()
+
+	w := &fakeWriter{}
+	deadLetterProducer = w
+
+	deadLetter := tasks.DeadLetterTask{
+		Task:     tasks.FileProcessingTask{FileMD5: "md5-g", ObjectKey: "uploads/7/md5-g/g.pdf"},
+		Error:    "tika error",
+		Attempts: 3,
+		FailedAt: time.Now(),
+	}
+	if err := ProduceDeadLetter(context.Background(), deadLetter); err != nil {
+		t.Fatalf("ProduceDeadLetter() error = %v", err)
+	}
+	if len(w.msgs) != 1 || string(w.msgs[0].Key) != "md5-g" {
+		t.Fatalf("unexpected messages: %+v", w.msgs)
+	}
+
+	var got tasks.DeadLetterTask
+	if err := json.Unmarshal(w.msgs[0].Value, &got); err != nil {
+		t.Fatalf("unmarshal dead letter failed: %v", err)
+	}
+	if got.Task.FileMD5 != "md5-g" || got.Attempts != 3 || got.Error != "tika error" {
+		t.Fatalf("unexpected dead letter payload: %+v", got)
+	}
+}
+
+func testRetryPolicy(store RetryStore, delayQueue DelayQueue) retryPolicy {
+	return retryPolicy{
+		store:      store,
+		delayQueue: delayQueue,
+		maxRetry:   3,
+		keyTTL:     time.Hour,
+		backoff:    func(attempts int64) time.Duration { return time.Duration(attempts) * time.Minute },
+		// 测试中让计数、死信、延迟队列失败后的重试立即进行。
+		stepInterval: time.Millisecond,
+	}
+}
+
+type scheduledTask struct {
+	task tasks.FileProcessingTask
+	at   time.Time
+}
+
+type fakeDelayQueue struct {
+	scheduleErr error
+	scheduled   []scheduledTask
+	due         []tasks.FileProcessingTask
+	// scheduleFailures 为前 N 次 Schedule 返回 scheduleErr，之后成功；为 0 时始终失败。
+	scheduleFailures int
+	scheduleCalls    int
+}
+
+func (f *fakeDelayQueue) Schedule(ctx context.Context, task tasks.FileProcessingTask, at time.Time) error {
+	f.scheduleCalls++
+	if f.scheduleErr != nil && (f.scheduleFailures == 0 || f.scheduleCalls <= f.scheduleFailures) {
+		return f.scheduleErr
+	}
+	f.scheduled = append(f.scheduled, scheduledTask{task: task, at: at})
+	return nil
+}
+
+func (f *fakeDelayQueue) PopDue(ctx context.Context, now time.Time, limit int) ([]tasks.FileProcessingTask, error) {
+	due := f.due
+	f.due = nil
+	return due, nil
+}
+
+type fakeTaskProducer struct {
+	failMD5  string
+	produced []tasks.FileProcessingTask
+}
+
+func (f *fakeTaskProducer) ProduceFileTask(ctx context.Context, task tasks.FileProcessingTask) error {
+	if task.FileMD5 == f.failMD5 {
+		return errors.New("kafka down")
+	}
+	f.produced = append(f.produced, task)
+	return nil
+}
+
+func TestConsumeOne_ProcessFailedBelowThreshold_SchedulesDelayedRetry(t *testing.T) {
+	reader := &fakeReader{}
+	store := &fakeRetryStore{counts: map[string]int64{retryKey("md5-h"): 1}}
+	queue := &fakeDelayQueue{}
+	processor := &fakeProcessor{processErr: errors.New("es unavailable")}
+
+	task := tasks.FileProcessingTask{FileMD5: "md5-h", FileName: "h.pdf", UserID: 8, ObjectKey: "uploads/8/md5-h/h.pdf"}
+	raw, _ := json.Marshal(task)
+
+	before := time.Now()
+	if err := consumeOne(context.Background(), reader, kafkago.Message{Value: raw}, testRetryPolicy(store, queue), processor, nil); err != nil {
+		t.Fatalf("consumeOne() error = %v", err)
+	}
+	if reader.commitCount != 1 {
+		t.Fatalf("expected offset committed after scheduling, got %d", reader.commitCount)
+	}
+	if len(queue.scheduled) != 1 || queue.scheduled[0].task.FileMD5 != "md5-h" {
+		t.Fatalf("unexpected scheduled tasks: %+v", queue.scheduled)
+	}
+	if delay := queue.scheduled[0].at.Sub(before); delay < 2*time.Minute || delay > 2*time.Minute+time.Second {
+		t.Fatalf("expected backoff for second attempt, got %s", delay)
+	}
+	if store.counts[retryKey("md5-h")] != 2 {
+		t.Fatalf("expected retry count kept for next attempt, got %d", store.counts[retryKey("md5-h")])
+	}
+}
+
+func TestConsumeOne_ScheduleFailed_LaterMessageStillCommitted(t *testing.T) {
+	committer := &recordingCommitter{}
+	tracker := newOffsetTracker(committer)
+	store := &fakeRetryStore{counts: map[string]int64{}}
+	queue := &fakeDelayQueue{scheduleErr: errors.New("redis down"), scheduleFailures: 2}
+	policy := testRetryPolicy(store, queue)
+
+	failed, _ := json.Marshal(tasks.FileProcessingTask{FileMD5: "md5-i", ObjectKey: "uploads/9/md5-i/i.pdf"})
+	next, _ := json.Marshal(tasks.FileProcessingTask{FileMD5: "md5-j", ObjectKey: "uploads/9/md5-j/j.pdf"})
+	first := partitionMessage(0, 10)
+	first.Value = failed
+	second := partitionMessage(0, 11)
+	second.Value = next
+	tracker.track(first)
+	tracker.track(second)
+
+	if err := consumeOne(context.Background(), tracker, first, policy, &fakeProcessor{processErr: errors.New("tika error")}, nil); err != nil {
+		t.Fatalf("consumeOne() error = %v", err)
+	}
+	if err := consumeOne(context.Background(), tracker, second, policy, &fakeProcessor{}, nil); err != nil {
+		t.Fatalf("consumeOne() error = %v", err)
+	}
+	if queue.scheduleCalls != 3 || len(queue.scheduled) != 1 {
+		t.Fatalf("expected schedule retried until it succeeded, calls=%d scheduled=%d", queue.scheduleCalls, len(queue.scheduled))
+	}
+	if got := committer.offsets(); len(got) != 2 || got[1] != 11 {
+		t.Fatalf("expected later offset on the same partition committed, got %v", got)
+	}
+}
+
+func TestRetryBackoff_ExponentialWithCap(t *testing.T) {
+	cfg := config.KafkaConfig{RetryBackoffSeconds: 5, RetryBackoffMaxSeconds: 30}
+	cases := map[int64]time.Duration{
+		1: 5 * time.Second,
+		2: 10 * time.Second,
+		3: 20 * time.Second,
+		4: 30 * time.Second,
+		9: 30 * time.Second,
+	}
+	for attempts, want := range cases {
+		if got := retryBackoff(cfg, attempts); got != want {
+			t.Fatalf("retryBackoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+	if got := retryBackoff(config.KafkaConfig{}, 1); got != defaultRetryBackoffSeconds*time.Second {
+		t.Fatalf("unexpected default backoff: %s", got)
+	}
+}
+
+func TestRequeueDueTasks_ProducesAndReschedulesFailures(t *testing.T) {
+	queue := &fakeDelayQueue{due: []tasks.FileProcessingTask{
+		{FileMD5: "md5-j", ObjectKey: "uploads/10/md5-j/j.pdf"},
+		{FileMD5: "md5-k", ObjectKey: "uploads/10/md5-k/k.pdf"},
+	}}
+	producer := &fakeTaskProducer{failMD5: "md5-k"}
+
+	requeued, err := requeueDueTasks(context.Background(), queue, producer, time.Now())
+	if err != nil {
+		t.Fatalf("requeueDueTasks() error = %v", err)
+	}
+	if requeued != 1 || len(producer.produced) != 1 || producer.produced[0].FileMD5 != "md5-j" {
+		t.Fatalf("unexpected requeue result: requeued=%d produced=%+v", requeued, producer.produced)
+	}
+	if len(queue.scheduled) != 1 || queue.scheduled[0].task.FileMD5 != "md5-k" {
+		t.Fatalf("expected failed task rescheduled, got %+v", queue.scheduled)
+	}
+}
@@ -0,0 +1,152 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"pai_smart_go_v2/internal/config"
+	"pai_smart_go_v2/pkg/log"
+	"pai_smart_go_v2/pkg/tasks"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultRetryBackoffSeconds     = 5
+	defaultRetryBackoffMaxSeconds  = 300
+	defaultRetryPollIntervalMillis = 1000
+	retryPollBatchSize             = 100
+	delayedRetryKey                = "kafka:retry:delayed"
+)
+
+// DelayQueue 保存待重试的任务，到期后由 StartRetryScheduler 重新投递到处理 topic。
+type DelayQueue interface {
+	Schedule(ctx context.Context, task tasks.FileProcessingTask, at time.Time) error
+	// PopDue 取出并删除最多 limit 个已到期的任务；多实例并发调用时每个任务只会被一个实例取到。
+	PopDue(ctx context.Context, now time.Time, limit int) ([]tasks.FileProcessingTask, error)
+}
+
+// redisDelayQueue 用 Redis sorted set 实现延迟队列，score 为到期时间的 Unix 毫秒。
+type redisDelayQueue struct {
+	client *redis.Client
+	key    string
+}
+
+func NewRedisDelayQueue(client *redis.Client) DelayQueue {
+	if client == nil {
+		return nil
+	}
+	return &redisDelayQueue{client: client, key: delayedRetryKey}
+}
+
+func (q *redisDelayQueue) Schedule(ctx context.Context, task tasks.FileProcessingTask, at time.Time) error {
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("marshal delayed task failed: %w", err)
+	}
+	return q.client.ZAdd(ctx, q.key, &redis.Z{Score: float64(at.UnixMilli()), Member: string(payload)}).Err()
+}
+
+func (q *redisDelayQueue) PopDue(ctx context.Context, now time.Time, limit int) ([]tasks.FileProcessingTask, error) {
+	members, err := q.client.ZRangeByScore(ctx, q.key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	due := make([]tasks.FileProcessingTask, 0, len(members))
+	for _, member := range members {
+		// ZREM 返回 1 的实例才算抢到该任务，避免多实例重复投递。
+		removed, err := q.client.ZRem(ctx, q.key, member).Result()
+		if err != nil {
+			return due, err
+		}
+		if removed == 0 {
+			continue
+		}
+		var task tasks.FileProcessingTask
+		if err := json.Unmarshal([]byte(member), &task); err != nil {
+			log.Errorf("[RetryScheduler] 延迟任务反序列化失败，已丢弃: %v", err)
+			continue
+		}
+		due = append(due, task)
+	}
+	return due, nil
+}
+
+// retryBackoff 返回第 attempts 次失败后的等待时间：base * 2^(attempts-1)，不超过 max。
+func retryBackoff(cfg config.KafkaConfig, attempts int64) time.Duration {
+	base := time.Duration(cfg.RetryBackoffSeconds) * time.Second
+	if cfg.RetryBackoffSeconds <= 0 {
+		base = defaultRetryBackoffSeconds * time.Second
+	}
+	maxBackoff := time.Duration(cfg.RetryBackoffMaxSeconds) * time.Second
+	if cfg.RetryBackoffMaxSeconds <= 0 {
+		maxBackoff = defaultRetryBackoffMaxSeconds * time.Second
+	}
+
+	backoff := base
+	for i := int64(1); i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// StartRetryScheduler 定期把到期的延迟任务重新投递到处理 topic，直到 ctx 取消。
+func StartRetryScheduler(ctx context.Context, cfg config.KafkaConfig, queue DelayQueue, producer FileTaskProducer) error {
+	if queue == nil {
+		return fmt.Errorf("delay queue is nil")
+	}
+	if producer == nil {
+		return fmt.Errorf("task producer is nil")
+	}
+
+	interval := time.Duration(cfg.RetryPollIntervalMillis) * time.Millisecond
+	if cfg.RetryPollIntervalMillis <= 0 {
+		interval = defaultRetryPollIntervalMillis * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := requeueDueTasks(ctx, queue, producer, time.Now()); err != nil {
+				log.Errorf("[RetryScheduler] 重新投递延迟任务失败: %v", err)
+			}
+		}
+	}
+}
+
+// requeueDueTasks 投递失败的任务会放回延迟队列，下一轮再试。
+func requeueDueTasks(ctx context.Context, queue DelayQueue, producer FileTaskProducer, now time.Time) (int, error) {
+	due, err := queue.PopDue(ctx, now, retryPollBatchSize)
+	if err != nil && len(due) == 0 {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, task := range due {
+		if produceErr := producer.ProduceFileTask(ctx, task); produceErr != nil {
+			log.Errorf("[RetryScheduler] 延迟任务投递失败，放回队列: md5=%s err=%v", task.FileMD5, produceErr)
+			if scheduleErr := queue.Schedule(ctx, task, now); scheduleErr != nil {
+				log.Errorf("[RetryScheduler] 延迟任务放回队列失败: md5=%s err=%v", task.FileMD5, scheduleErr)
+			}
+			continue
+		}
+		requeued++
+		log.Infof("[RetryScheduler] 延迟任务已重新投递: md5=%s", task.FileMD5)
+	}
+	return requeued, err
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+
+	"pai_smart_go_v2/pkg/log"
+	"pai_smart_go_v2/pkg/tasks"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultConsumerWorkers = 1
+	workerQueueSize        = 16
+)
+
+// messageCommitter 是 consumeOne 提交 offset 所需的最小能力，由 reader 或 offsetTracker 实现。
+type messageCommitter interface {
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// partitionOffsets 按拉取顺序记录一个分区内尚未提交的消息。
+type partitionOffsets struct {
+	inflight []kafkago.Message
+	acked    map[int64]bool
+}
+
+// offsetTracker 让多个 worker 乱序完成消息，但只把分区内连续完成的最高 offset 提交给 Kafka。
+// consumeOne 会重试到消息可以提交为止，只有停机时中断的消息会挡住后续提交，重启或 rebalance 后从该 offset 重新消费。
+type offsetTracker struct {
+	reader     messageCommitter
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+}
+
+func newOffsetTracker(reader messageCommitter) *offsetTracker {
+	return &offsetTracker{reader: reader, partitions: map[partitionKey]*partitionOffsets{}}
+}
+
+// track 必须在消息分发给 worker 之前按拉取顺序调用。
+func (t *offsetTracker) track(msg kafkago.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{topic: msg.Topic, partition: msg.Partition}
+	state, ok := t.partitions[key]
+	if ok && len(state.inflight) > 0 && msg.Offset <= state.inflight[len(state.inflight)-1].Offset {
+		// offset 回退说明发生了 rebalance 或重投递，旧的进度已无意义。
+		ok = false
+	}
+	if !ok {
+		state = &partitionOffsets{acked: map[int64]bool{}}
+		t.partitions[key] = state
+	}
+	state.inflight = append(state.inflight, msg)
+}
+
+// CommitMessages 标记消息已完成，并提交该分区连续完成的最高 offset。
+func (t *offsetTracker) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var commits []kafkago.Message
+	for _, msg := range msgs {
+		state, ok := t.partitions[partitionKey{topic: msg.Topic, partition: msg.Partition}]
+		if !ok {
+			continue
+		}
+		state.acked[msg.Offset] = true
+
+		var last *kafkago.Message
+		for len(state.inflight) > 0 && state.acked[state.inflight[0].Offset] {
+			head := state.inflight[0]
+			delete(state.acked, head.Offset)
+			state.inflight = state.inflight[1:]
+			last = &head
+		}
+		if last != nil {
+			commits = append(commits, *last)
+		}
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+	// 持锁提交，避免并发 worker 把较小的 offset 覆盖到较大的 offset 之后。
+	return t.reader.CommitMessages(ctx, commits...)
+}
+
+// workerPool 按 FileMD5 把消息固定分配给 worker：同一文件的任务串行处理，不同文件并行处理。
+type workerPool struct {
+	queues []chan kafkago.Message
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(ctx context.Context, workers int, handle func(ctx context.Context, msg kafkago.Message)) *workerPool {
+	if workers <= 0 {
+		workers = defaultConsumerWorkers
+	}
+	pool := &workerPool{queues: make([]chan kafkago.Message, workers)}
+	for i := range pool.queues {
+		queue := make(chan kafkago.Message, workerQueueSize)
+		pool.queues[i] = queue
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for msg := range queue {
+				if ctx.Err() != nil {
+					// 停机时丢弃排队中的消息，未提交的 offset 会在下次启动时重新消费。
+					continue
+				}
+				handle(ctx, msg)
+			}
+		}()
+	}
+	return pool
+}
+
+// dispatch 在目标 worker 队列已满时阻塞，以此对拉取形成背压。
+func (p *workerPool) dispatch(ctx context.Context, msg kafkago.Message) bool {
+	queue := p.queues[workerIndex(dispatchKey(msg), len(p.queues))]
+	select {
+	case queue <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// close 关闭所有队列并等待 worker 退出。
+func (p *workerPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// dispatchKey 优先使用消息 key（即 FileMD5），缺失时从消息体解析。
+func dispatchKey(msg kafkago.Message) string {
+	if len(msg.Key) > 0 {
+		return string(msg.Key)
+	}
+	var task tasks.FileProcessingTask
+	if err := json.Unmarshal(msg.Value, &task); err != nil {
+		log.Warnf("[Consumer] 无法解析消息 key，分配到 worker 0: offset=%d err=%v", msg.Offset, err)
+		return ""
+	}
+	return task.FileMD5
+}
+
+func workerIndex(key string, workers int) int {
+	if workers <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
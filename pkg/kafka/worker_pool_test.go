@@ -0,0 +1,141 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type recordingCommitter struct {
+	mu        sync.Mutex
+	committed []kafkago.Message
+}
+
+func (r *recordingCommitter) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *recordingCommitter) offsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	offsets := make([]int64, 0, len(r.committed))
+	for _, msg := range r.committed {
+		offsets = append(offsets, msg.Offset)
+	}
+	return offsets
+}
+
+func partitionMessage(partition int, offset int64) kafkago.Message {
+	return kafkago.Message{Topic: "file-processing", Partition: partition, Offset: offset}
+}
+
+func TestOffsetTracker_CommitsOnlyContiguousOffsets(t *testing.T) {
+	committer := &recordingCommitter{}
+	tracker := newOffsetTracker(committer)
+	for offset := int64(10); offset <= 12; offset++ {
+		tracker.track(partitionMessage(0, offset))
+	}
+	tracker.track(partitionMessage(1, 5))
+
+	ctx := context.Background()
+	_ = tracker.CommitMessages(ctx, partitionMessage(0, 12))
+	_ = tracker.CommitMessages(ctx, partitionMessage(0, 11))
+	if got := committer.offsets(); len(got) != 0 {
+		t.Fatalf("expected no commit while offset 10 is in flight, got %v", got)
+	}
+
+	_ = tracker.CommitMessages(ctx, partitionMessage(1, 5))
+	_ = tracker.CommitMessages(ctx, partitionMessage(0, 10))
+	got := committer.offsets()
+	if len(got) != 2 || got[0] != 5 || got[1] != 12 {
+		t.Fatalf("unexpected commits: %v", got)
+	}
+}
+
+func TestOffsetTracker_UnackedMessageBlocksPartition(t *testing.T) {
+	committer := &recordingCommitter{}
+	tracker := newOffsetTracker(committer)
+	tracker.track(partitionMessage(0, 1))
+	tracker.track(partitionMessage(0, 2))
+
+	_ = tracker.CommitMessages(context.Background(), partitionMessage(0, 2))
+	if got := committer.offsets(); len(got) != 0 {
+		t.Fatalf("expected offset 1 to block commits, got %v", got)
+	}
+}
+
+func TestOffsetTracker_ResetsOnOffsetRewind(t *testing.T) {
+	committer := &recordingCommitter{}
+	tracker := newOffsetTracker(committer)
+	tracker.track(partitionMessage(0, 7))
+	tracker.track(partitionMessage(0, 8))
+
+	// rebalance 后从已提交 offset 重新拉取。
+	tracker.track(partitionMessage(0, 7))
+	_ = tracker.CommitMessages(context.Background(), partitionMessage(0, 7))
+	if got := committer.offsets(); len(got) != 1 || got[0] != 7 {
+		t.Fatalf("unexpected commits after rewind: %v", got)
+	}
+}
+
+func TestWorkerPool_PreservesPerFileOrderAndRunsFilesConcurrently(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	seen := map[string][]int64{}
+	slowStarted := make(chan struct{})
+	releaseSlow := make(chan struct{})
+	fastDone := make(chan struct{})
+
+	pool := newWorkerPool(ctx, 4, func(ctx context.Context, msg kafkago.Message) {
+		key := string(msg.Key)
+		if key == "slow" && msg.Offset == 0 {
+			close(slowStarted)
+			<-releaseSlow
+		}
+		mu.Lock()
+		seen[key] = append(seen[key], msg.Offset)
+		mu.Unlock()
+		if key == "fast" && msg.Offset == 3 {
+			close(fastDone)
+		}
+	})
+
+	if workerIndex("slow", 4) == workerIndex("fast", 4) {
+		t.Fatalf("test keys must map to different workers")
+	}
+
+	pool.dispatch(ctx, kafkago.Message{Key: []byte("slow"), Offset: 0})
+	<-slowStarted
+	pool.dispatch(ctx, kafkago.Message{Key: []byte("slow"), Offset: 1})
+	pool.dispatch(ctx, kafkago.Message{Key: []byte("fast"), Offset: 2})
+	pool.dispatch(ctx, kafkago.Message{Key: []byte("fast"), Offset: 3})
+
+	select {
+	case <-fastDone:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("fast file blocked behind slow file")
+	}
+	close(releaseSlow)
+	pool.close()
+
+	if got := seen["slow"]; len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Fatalf("unexpected slow order: %v", got)
+	}
+	if got := seen["fast"]; len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatalf("unexpected fast order: %v", got)
+	}
+}
+
+func TestDispatchKey_FallsBackToPayload(t *testing.T) {
+	msg := kafkago.Message{Value: []byte(`{"file_md5":"md5-x"}`)}
+	if got := dispatchKey(msg); got != "md5-x" {
+		t.Fatalf("dispatchKey() = %q", got)
+	}
+}
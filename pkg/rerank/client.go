@@ -0,0 +1,178 @@
+// Package rerank 提供检索结果重排能力：调用 OpenAI/BGE 风格的 /rerank 接口，或使用本地词法打分兜底。
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"pai_smart_go_v2/internal/config"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+
+	ProviderHTTP    = "http"
+	ProviderLexical = "lexical"
+)
+
+// Result 表示一条重排结果，Index 指向传入 documents 的下标，按 Score 从高到低排列。
+type Result struct {
+	Index int
+	Score float64
+}
+
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string) ([]Result, error)
+}
+
+type httpReranker struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+type rerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+type rerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+// NewReranker 按配置创建重排器；未启用时返回 nil, nil，调用方据此跳过重排。
+func NewReranker(cfg config.RerankConfig) (Reranker, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	provider := strings.ToLower(strings.TrimSpace(cfg.Provider))
+	switch provider {
+	case ProviderLexical:
+		return NewLexicalReranker(), nil
+	case "", ProviderHTTP:
+	default:
+		return nil, fmt.Errorf("unsupported rerank provider: %s", cfg.Provider)
+	}
+
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		return nil, fmt.Errorf("rerank base_url is empty")
+	}
+	if strings.TrimSpace(cfg.Model) == "" {
+		return nil, fmt.Errorf("rerank model is empty")
+	}
+
+	timeout := defaultTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	var reranker Reranker = &httpReranker{
+		baseURL:    baseURL,
+		apiKey:     strings.TrimSpace(cfg.APIKey),
+		model:      cfg.Model,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+	if cfg.FallbackToLexical {
+		reranker = &fallbackReranker{primary: reranker, fallback: NewLexicalReranker()}
+	}
+	return reranker, nil
+}
+
+func (r *httpReranker) Rerank(ctx context.Context, query string, documents []string) ([]Result, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("rerank query is empty")
+	}
+	if len(documents) == 0 {
+		return []Result{}, nil
+	}
+
+	payload, err := json.Marshal(rerankRequest{
+		Model:     r.model,
+		Query:     query,
+		Documents: documents,
+		TopN:      len(documents),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal rerank request failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+"/rerank", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("create rerank request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("call rerank api failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read rerank response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rerank api status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var parsed rerankResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("unmarshal rerank response failed: %w", err)
+	}
+	if len(parsed.Results) == 0 {
+		return nil, fmt.Errorf("rerank response is empty")
+	}
+
+	results := make([]Result, 0, len(parsed.Results))
+	for _, item := range parsed.Results {
+		if item.Index < 0 || item.Index >= len(documents) {
+			return nil, fmt.Errorf("rerank result index out of range: %d", item.Index)
+		}
+		results = append(results, Result{Index: item.Index, Score: item.RelevanceScore})
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// fallbackReranker 在远端重排失败时退回本地词法打分，保证检索链路不因重排服务抖动而中断。
+type fallbackReranker struct {
+	primary  Reranker
+	fallback Reranker
+}
+
+func (r *fallbackReranker) Rerank(ctx context.Context, query string, documents []string) ([]Result, error) {
+	results, err := r.primary.Rerank(ctx, query, documents)
+	if err == nil {
+		return results, nil
+	}
+	fallbackResults, fallbackErr := r.fallback.Rerank(ctx, query, documents)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("rerank failed: %v; lexical fallback failed: %w", err, fallbackErr)
+	}
+	return fallbackResults, nil
+}
+
+func sortResults(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
@@ -0,0 +1,143 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"pai_smart_go_v2/internal/config"
+)
+
+func TestHTTPReranker_Rerank(t *testing.T) {
+	reranker := &httpReranker{
+		baseURL: "http://rerank.local",
+		apiKey:  "test-key",
+		model:   "bge-reranker",
+		httpClient: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if r.URL.Path != "/rerank" {
+				t.Fatalf("unexpected path: %s", r.URL.Path)
+			}
+			if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+				t.Fatalf("unexpected authorization header: %s", got)
+			}
+
+			var req rerankRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request failed: %v", err)
+			}
+			if req.Model != "bge-reranker" || req.Query != "go" || len(req.Documents) != 2 || req.TopN != 2 {
+				t.Fatalf("unexpected request: %+v", req)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"results":[{"index":0,"relevance_score":0.1},{"index":1,"relevance_score":0.8}]}`)),
+			}, nil
+		})},
+	}
+
+	results, err := reranker.Rerank(context.Background(), "go", []string{"java", "go"})
+	if err != nil {
+		t.Fatalf("Rerank() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Index != 1 || results[0].Score != 0.8 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
+
+func TestHTTPReranker_Rerank_IndexOutOfRange(t *testing.T) {
+	reranker := &httpReranker{
+		baseURL: "http://rerank.local",
+		model:   "bge-reranker",
+		httpClient: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"results":[{"index":5,"relevance_score":0.8}]}`)),
+			}, nil
+		})},
+	}
+
+	if _, err := reranker.Rerank(context.Background(), "go", []string{"go"}); err == nil {
+		t.Fatalf("expected out of range error")
+	}
+}
+
+func TestFallbackReranker_UsesLexicalOnFailure(t *testing.T) {
+	reranker := &fallbackReranker{
+		primary: rerankerFunc(func(ctx context.Context, query string, documents []string) ([]Result, error) {
+			return nil, errors.New("rerank api status=503")
+		}),
+		fallback: NewLexicalReranker(),
+	}
+
+	results, err := reranker.Rerank(context.Background(), "goroutine 调度", []string{"内存管理", "goroutine 的调度器"})
+	if err != nil {
+		t.Fatalf("Rerank() error = %v", err)
+	}
+	if results[0].Index != 1 {
+		t.Fatalf("expected lexical fallback to rank matching document first, got %+v", results)
+	}
+}
+
+func TestLexicalReranker_Rerank(t *testing.T) {
+	results, err := NewLexicalReranker().Rerank(context.Background(), "并发模型", []string{
+		"Go 的内存模型",
+		"Go 的并发模型基于 CSP",
+		"数据库索引",
+	})
+	if err != nil {
+		t.Fatalf("Rerank() error = %v", err)
+	}
+	if results[0].Index != 1 || results[len(results)-1].Index != 2 {
+		t.Fatalf("unexpected lexical order: %+v", results)
+	}
+	if results[0].Score <= 1 {
+		t.Fatalf("expected phrase bonus for full match, got %+v", results[0])
+	}
+}
+
+func TestLexicalTerms(t *testing.T) {
+	terms := lexicalTerms("Go并发 模型")
+	want := []string{"go", "并发", "模型"}
+	if len(terms) != len(want) {
+		t.Fatalf("unexpected terms: %+v", terms)
+	}
+	for i := range want {
+		if terms[i] != want[i] {
+			t.Fatalf("unexpected terms: %+v", terms)
+		}
+	}
+}
+
+func TestNewReranker(t *testing.T) {
+	reranker, err := NewReranker(config.RerankConfig{})
+	if err != nil || reranker != nil {
+		t.Fatalf("expected disabled reranker to be nil, got %v %v", reranker, err)
+	}
+	if _, err := NewReranker(config.RerankConfig{Enabled: true, Provider: "http"}); err == nil {
+		t.Fatalf("expected missing base_url error")
+	}
+	reranker, err = NewReranker(config.RerankConfig{Enabled: true, BaseURL: "http://rerank.local", Model: "bge", FallbackToLexical: true})
+	if err != nil {
+		t.Fatalf("NewReranker() error = %v", err)
+	}
+	if _, ok := reranker.(*fallbackReranker); !ok {
+		t.Fatalf("expected fallback reranker, got %T", reranker)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+type rerankerFunc func(ctx context.Context, query string, documents []string) ([]Result, error)
+
+func (f rerankerFunc) Rerank(ctx context.Context, query string, documents []string) ([]Result, error) {
+	return f(ctx, query, documents)
+}
@@ -0,0 +1,101 @@
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// lexicalPhraseBonus 是整句命中时的额外加分。
+const lexicalPhraseBonus = 0.5
+
+type lexicalReranker struct{}
+
+// NewLexicalReranker 返回不依赖外部服务的本地重排器：
+// 英文按单词、中文按相邻二字切分，按查询词项的覆盖率打分，整句命中再额外加分。
+func NewLexicalReranker() Reranker {
+	return lexicalReranker{}
+}
+
+func (lexicalReranker) Rerank(_ context.Context, query string, documents []string) ([]Result, error) {
+	terms := lexicalTerms(query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("rerank query has no searchable terms")
+	}
+	normalizedQuery := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+
+	results := make([]Result, 0, len(documents))
+	for i, document := range documents {
+		documentTerms := make(map[string]struct{})
+		for _, term := range lexicalTerms(document) {
+			documentTerms[term] = struct{}{}
+		}
+
+		matched := 0
+		for _, term := range terms {
+			if _, ok := documentTerms[term]; ok {
+				matched++
+			}
+		}
+		score := float64(matched) / float64(len(terms))
+		if normalizedQuery != "" && strings.Contains(strings.Join(strings.Fields(strings.ToLower(document)), " "), normalizedQuery) {
+			score += lexicalPhraseBonus
+		}
+		results = append(results, Result{Index: i, Score: score})
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// lexicalTerms 返回去重后的词项：连续字母数字为一个词，CJK 文本切成相邻二字（单字时保留单字）。
+func lexicalTerms(text string) []string {
+	seen := make(map[string]struct{})
+	terms := make([]string, 0)
+	add := func(term string) {
+		if term == "" {
+			return
+		}
+		if _, ok := seen[term]; ok {
+			return
+		}
+		seen[term] = struct{}{}
+		terms = append(terms, term)
+	}
+
+	var word strings.Builder
+	var han []rune
+	flushWord := func() {
+		add(word.String())
+		word.Reset()
+	}
+	flushHan := func() {
+		switch len(han) {
+		case 0:
+		case 1:
+			add(string(han))
+		default:
+			for i := 0; i+1 < len(han); i++ {
+				add(string(han[i : i+2]))
+			}
+		}
+		han = han[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			flushHan()
+			word.WriteRune(r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return terms
+}
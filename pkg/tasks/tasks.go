@@ -1,5 +1,7 @@
 package tasks
 
+import "time"
+
 // FileProcessingTask 是 Kafka 中用于触发文档处理管线的消息体。
 // objectKey 由生产端直接提供，消费者不再拼接存储路径规则。
 type FileProcessingTask struct {
@@ -9,4 +11,21 @@ type FileProcessingTask struct {
 	OrgTag    string `json:"org_tag"`
 	IsPublic  bool   `json:"is_public"`
 	ObjectKey string `json:"object_key"`
+	// DocumentID 为逻辑文档 ID，新版本索引完成后据此把同一文档的旧版本移出检索；旧消息中为空。
+	DocumentID string `json:"document_id,omitempty"`
+	// FolderID 为文档所在文件夹，写入分块后用于按文件夹子树检索；0 表示根目录。
+	FolderID uint `json:"folder_id,omitempty"`
+}
+
+// DeadLetterTask 是超过重试上限的文件处理任务，发往死信 topic，
+// 保留原始任务、最后一次错误、累计尝试次数以及来源消息位置，供管理员排查和重放。
+type DeadLetterTask struct {
+	Task        FileProcessingTask `json:"task"`
+	Error       string             `json:"error"`
+	Attempts    int                `json:"attempts"`
+	SourceTopic string             `json:"source_topic"`
+	Partition   int                `json:"partition"`
+	Offset      int64              `json:"offset"`
+	EnqueuedAt  time.Time          `json:"enqueued_at"`
+	FailedAt    time.Time          `json:"failed_at"`
 }
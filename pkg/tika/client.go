@@ -2,6 +2,7 @@ package tika
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"mime"
@@ -13,9 +14,20 @@ import (
 	"pai_smart_go_v2/internal/config"
 )
 
+// StatusError 表示 Tika 返回了非 200 状态码：415 为不支持的格式，422 通常是加密或损坏的文档。
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("tika response status=%d body=%s", e.StatusCode, e.Body)
+}
+
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL       string
+	httpClient    *http.Client
+	ocrHTTPClient *http.Client
 }
 
 func NewClient(cfg config.TikaConfig) (*Client, error) {
@@ -29,45 +41,101 @@ func NewClient(cfg config.TikaConfig) (*Client, error) {
 		timeout = 10 * time.Second
 	}
 
+	ocrTimeout := time.Duration(cfg.OCR.TimeoutSeconds) * time.Second
+	if cfg.OCR.TimeoutSeconds <= 0 {
+		ocrTimeout = 120 * time.Second
+	}
+
 	return &Client{
 		baseURL: strings.TrimRight(baseURL, "/"),
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
+		ocrHTTPClient: &http.Client{
+			Timeout: ocrTimeout,
+		},
 	}, nil
 }
 
 func (c *Client) ExtractText(ctx context.Context, reader io.Reader, fileName string) (string, error) {
+	body, err := c.put(ctx, c.httpClient, "/tika", "text/plain", reader, fileName, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// ExtractDocument 通过 /rmeta 同时提取正文和元数据（标题、作者、创建时间、页数、语言）。
+// PDF 和 Office 文档请求 XHTML 输出，以便保留分页和标题位置，其余格式直接取纯文本。
+func (c *Client) ExtractDocument(ctx context.Context, reader io.Reader, fileName string) (*Document, error) {
+	xhtml := wantsXHTML(fileName)
+	path := "/rmeta/text"
+	if xhtml {
+		path = "/rmeta/html"
+	}
+	body, err := c.put(ctx, c.httpClient, path, "application/json", reader, fileName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]interface{}
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, fmt.Errorf("decode tika rmeta response failed: %w", err)
+	}
+	return parseRecursiveMetadata(items, xhtml), nil
+}
+
+// ExtractTextWithOCR 让 Tika 调用 Tesseract 识别图片以及 PDF 页面中的文字，language 为 Tesseract 语言包，如 chi_sim+eng。
+// 需要 Tika Server 安装 Tesseract；PDF 使用 ocr_and_text 策略，保留页面中原有的文本层。
+func (c *Client) ExtractTextWithOCR(ctx context.Context, reader io.Reader, fileName, language string) (string, error) {
+	headers := map[string]string{
+		"X-Tika-OCRskipOcr":     "false",
+		"X-Tika-PDFOcrStrategy": "ocr_and_text",
+	}
+	if language = strings.TrimSpace(language); language != "" {
+		headers["X-Tika-OCRLanguage"] = language
+	}
+	body, err := c.put(ctx, c.ocrHTTPClient, "/tika", "text/plain", reader, fileName, headers)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func (c *Client) put(ctx context.Context, httpClient *http.Client, path string, accept string, reader io.Reader, fileName string, headers map[string]string) ([]byte, error) {
 	if reader == nil {
-		return "", fmt.Errorf("reader is nil")
+		return nil, fmt.Errorf("reader is nil")
 	}
 
 	contentType := detectContentType(fileName)
-	endpoint := c.baseURL + "/tika"
+	endpoint := c.baseURL + path
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, reader)
 	if err != nil {
-		return "", fmt.Errorf("create tika request failed: %w", err)
+		return nil, fmt.Errorf("create tika request failed: %w", err)
 	}
-	req.Header.Set("Accept", "text/plain")
+	req.Header.Set("Accept", accept)
 	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("call tika failed: %w", err)
+		return nil, fmt.Errorf("call tika failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("read tika response failed: %w", err)
+		return nil, fmt.Errorf("read tika response failed: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("tika response status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
 	}
 
-	return string(body), nil
+	return body, nil
 }
 
 func detectContentType(fileName string) string {
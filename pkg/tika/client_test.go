@@ -2,6 +2,8 @@ package tika
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"pai_smart_go_v2/internal/config"
@@ -49,6 +51,114 @@ func TestExtractText_Success(t *testing.T) {
 	}
 }
 
+func TestExtractTextWithOCR_SetsOCRHeaders(t *testing.T) {
+	client, err := NewClient(config.TikaConfig{BaseURL: "http://tika.local", TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.ocrHTTPClient = &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Header.Get("X-Tika-OCRLanguage") != "chi_sim+eng" || r.Header.Get("X-Tika-PDFOcrStrategy") != "ocr_and_text" {
+				t.Fatalf("unexpected ocr headers: %v", r.Header)
+			}
+			if r.Header.Get("Content-Type") != "image/png" {
+				t.Fatalf("unexpected content-type: %s", r.Header.Get("Content-Type"))
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader("扫描文字")),
+				Header:     make(http.Header),
+			}, nil
+		}),
+	}
+
+	text, err := client.ExtractTextWithOCR(context.Background(), strings.NewReader("png-bytes"), "scan.png", "chi_sim+eng")
+	if err != nil {
+		t.Fatalf("ExtractTextWithOCR() error = %v", err)
+	}
+	if text != "扫描文字" {
+		t.Fatalf("unexpected text: %s", text)
+	}
+}
+
+func TestExtractDocument_ParsesRecursiveMetadata(t *testing.T) {
+	client, err := NewClient(config.TikaConfig{BaseURL: "http://tika.local", TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.httpClient = &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Method != http.MethodPut || r.URL.Path != "/rmeta/text" || r.Header.Get("Accept") != "application/json" {
+				t.Fatalf("unexpected request: %s %s accept=%s", r.Method, r.URL.Path, r.Header.Get("Accept"))
+			}
+			body := `[
+				{"X-TIKA:content":"\n正文内容\n","dc:title":"季度报告","dc:creator":["张三","李四"],"dcterms:created":"2024-03-01T08:30:00Z","xmpTPg:NPages":"12","dc:language":"ZH"},
+				{"X-TIKA:content":"附件内容","dc:title":"附件"}
+			]`
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Header:     make(http.Header),
+			}, nil
+		}),
+	}
+
+	doc, err := client.ExtractDocument(context.Background(), strings.NewReader("text-bytes"), "report.txt")
+	if err != nil {
+		t.Fatalf("ExtractDocument() error = %v", err)
+	}
+	if doc.Text != "\n正文内容\n\n附件内容" || len(doc.Pages) != 0 {
+		t.Fatalf("unexpected text: %q pages=%v", doc.Text, doc.Pages)
+	}
+	meta := doc.Metadata
+	if meta.Title != "季度报告" || meta.Author != "张三" || meta.PageCount != 12 || meta.Language != "zh" {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+	if meta.CreatedAt == nil || meta.CreatedAt.Format("2006-01-02T15:04") != "2024-03-01T08:30" {
+		t.Fatalf("unexpected created time: %v", meta.CreatedAt)
+	}
+}
+
+func TestExtractDocument_PDFKeepsPagesAndHeadings(t *testing.T) {
+	client, err := NewClient(config.TikaConfig{BaseURL: "http://tika.local", TimeoutSeconds: 5})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.httpClient = &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.URL.Path != "/rmeta/html" {
+				t.Fatalf("unexpected path: %s", r.URL.Path)
+			}
+			xhtml := `<html xmlns="http://www.w3.org/1999/xhtml"><head><title>报告</title></head><body>` +
+				`<div class="page"><h1>1 概述</h1><p>第一页正文&amp;说明</p></div>` +
+				`<div class="page"><h2>1.1 背景</h2><p>第二页正文</p><table><tr><td>A</td><td>B</td></tr></table></div>` +
+				`</body></html>`
+			encoded, _ := json.Marshal([]map[string]interface{}{{"X-TIKA:content": xhtml, "xmpTPg:NPages": "2"}})
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(string(encoded))),
+				Header:     make(http.Header),
+			}, nil
+		}),
+	}
+
+	doc, err := client.ExtractDocument(context.Background(), strings.NewReader("pdf-bytes"), "report.pdf")
+	if err != nil {
+		t.Fatalf("ExtractDocument() error = %v", err)
+	}
+	want := "1 概述\n第一页正文&说明\n1.1 背景\n第二页正文\n\tA\tB\n"
+	if doc.Text != want {
+		t.Fatalf("unexpected text: %q", doc.Text)
+	}
+	runes := []rune(doc.Text)
+	if len(doc.Pages) != 2 || doc.Pages[1].Number != 2 || !strings.HasPrefix(string(runes[doc.Pages[1].Start:doc.Pages[1].End]), "1.1 背景") {
+		t.Fatalf("unexpected pages: %+v", doc.Pages)
+	}
+	if len(doc.Headings) != 2 || doc.Headings[1].Level != 2 || doc.Headings[1].Text != "1.1 背景" || doc.Headings[1].Offset != doc.Pages[1].Start {
+		t.Fatalf("unexpected headings: %+v", doc.Headings)
+	}
+}
+
 func TestExtractText_Non200(t *testing.T) {
 	client, err := NewClient(config.TikaConfig{BaseURL: "http://tika.local", TimeoutSeconds: 5})
 	if err != nil {
@@ -65,8 +175,9 @@ func TestExtractText_Non200(t *testing.T) {
 	}
 
 	_, err = client.ExtractText(context.Background(), strings.NewReader("bad"), "a.pdf")
-	if err == nil {
-		t.Fatalf("expected non-200 error")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || statusErr.Body != "bad file" {
+		t.Fatalf("expected StatusError, got %v", err)
 	}
 }
 
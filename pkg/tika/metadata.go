@@ -0,0 +1,119 @@
+package tika
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// rmeta 返回的正文字段，以及各解析器常用的元数据键（按优先级排列）。
+const contentKey = "X-TIKA:content"
+
+var (
+	titleKeys     = []string{"dc:title", "title", "pdf:docinfo:title"}
+	authorKeys    = []string{"dc:creator", "meta:author", "Author", "pdf:docinfo:creator"}
+	createdKeys   = []string{"dcterms:created", "meta:creation-date", "Creation-Date", "pdf:docinfo:created"}
+	pageCountKeys = []string{"xmpTPg:NPages", "meta:page-count", "Page-Count"}
+	languageKeys  = []string{"dc:language", "language", "Content-Language"}
+)
+
+var createdLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Document 是 /rmeta 的解析结果：Text 为容器文档及其内嵌文档的正文，Metadata 取自容器文档。
+// 以 XHTML 提取时 Pages 记录容器文档的分页，Headings 记录全部标题；纯文本提取时两者为空。
+type Document struct {
+	Text     string
+	Metadata Metadata
+	Pages    []Page
+	Headings []Heading
+}
+
+// Metadata 是检索关心的文档元数据，Tika 未识别到的字段保持零值。
+type Metadata struct {
+	Title     string
+	Author    string
+	CreatedAt *time.Time
+	PageCount int
+	Language  string
+}
+
+func parseRecursiveMetadata(items []map[string]interface{}, xhtml bool) *Document {
+	doc := &Document{}
+	if len(items) == 0 {
+		return doc
+	}
+
+	var text strings.Builder
+	offset := 0
+	for i, item := range items {
+		content, ok := item[contentKey].(string)
+		if !ok || strings.TrimSpace(content) == "" {
+			continue
+		}
+		var pages []Page
+		var headings []Heading
+		if xhtml {
+			content, pages, headings = parseXHTML(content)
+			if strings.TrimSpace(content) == "" {
+				continue
+			}
+		}
+		if text.Len() > 0 {
+			text.WriteString("\n")
+			offset++
+		}
+		// 内嵌文档（附件）的分页与容器文档无关，只保留容器文档的分页。
+		if i == 0 {
+			doc.Pages = pages
+		}
+		for _, heading := range headings {
+			heading.Offset += offset
+			doc.Headings = append(doc.Headings, heading)
+		}
+		text.WriteString(content)
+		offset += utf8.RuneCountInString(content)
+	}
+	doc.Text = text.String()
+
+	container := items[0]
+	doc.Metadata.Title = firstValue(container, titleKeys...)
+	doc.Metadata.Author = firstValue(container, authorKeys...)
+	doc.Metadata.Language = strings.ToLower(firstValue(container, languageKeys...))
+	if created := firstValue(container, createdKeys...); created != "" {
+		for _, layout := range createdLayouts {
+			if parsed, err := time.Parse(layout, created); err == nil {
+				doc.Metadata.CreatedAt = &parsed
+				break
+			}
+		}
+	}
+	if pages, err := strconv.Atoi(firstValue(container, pageCountKeys...)); err == nil && pages > 0 {
+		doc.Metadata.PageCount = pages
+	}
+	return doc
+}
+
+// firstValue 返回 keys 中第一个非空的值；多值字段（如多位作者）取第一个。
+func firstValue(item map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch value := item[key].(type) {
+		case string:
+			if trimmed := strings.TrimSpace(value); trimmed != "" {
+				return trimmed
+			}
+		case []interface{}:
+			for _, element := range value {
+				if text, ok := element.(string); ok && strings.TrimSpace(text) != "" {
+					return strings.TrimSpace(text)
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,201 @@
+package tika
+
+import (
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// paginatedExtensions 请求 XHTML 输出的格式：Tika 会用 <div class="page"> 标出 PDF 分页、
+// 用 <div class="slide-content"> 标出幻灯片，并把 Word 标题输出为 <h1>~<h6>。
+// 其余格式（纯文本、Markdown、表格）仍用纯文本输出，分块器依赖其原始排版。
+var paginatedExtensions = map[string]bool{
+	".pdf": true, ".doc": true, ".docx": true, ".ppt": true, ".pptx": true,
+}
+
+// Page 是正文中的一页（或一张幻灯片），Start/End 为 Text 中的字符（rune）偏移，左闭右开。
+type Page struct {
+	Number int
+	Start  int
+	End    int
+}
+
+// Heading 是正文中的标题，Offset 为标题在 Text 中的字符偏移。
+type Heading struct {
+	Level  int
+	Text   string
+	Offset int
+}
+
+func wantsXHTML(fileName string) bool {
+	return paginatedExtensions[strings.ToLower(filepath.Ext(fileName))]
+}
+
+// xhtmlBlockElements 开始和结束时都换行的块级元素。
+var xhtmlBlockElements = map[string]bool{
+	"p": true, "div": true, "li": true, "tr": true, "table": true, "ul": true, "ol": true,
+	"blockquote": true, "pre": true, "section": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// xhtmlSkippedElements 内容不属于正文的元素。
+var xhtmlSkippedElements = map[string]bool{
+	"head": true, "script": true, "style": true,
+}
+
+// xhtmlText 把 Tika 的 XHTML 输出转换为纯文本，同时记录分页和标题的位置。
+type xhtmlText struct {
+	builder  strings.Builder
+	runes    int
+	pages    []Page
+	headings []Heading
+
+	skipDepth int
+	divStack  []bool // 每层 div 是否为分页容器
+	heading   *Heading
+	headingSB strings.Builder
+}
+
+func parseXHTML(content string) (string, []Page, []Heading) {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	out := &xhtmlText{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 残缺的 XHTML 保留已解析出的部分，不让元数据增强影响正文提取。
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			out.start(t)
+		case xml.EndElement:
+			out.end(t.Name.Local)
+		case xml.CharData:
+			out.text(string(t))
+		}
+	}
+	out.closePages()
+	return out.builder.String(), out.pages, out.headings
+}
+
+func (x *xhtmlText) start(el xml.StartElement) {
+	name := strings.ToLower(el.Name.Local)
+	if xhtmlSkippedElements[name] || x.skipDepth > 0 {
+		x.skipDepth++
+		return
+	}
+
+	switch name {
+	case "br":
+		x.write("\n")
+		return
+	case "td", "th":
+		x.write("\t")
+		return
+	}
+	if xhtmlBlockElements[name] {
+		x.newline()
+	}
+	if name == "div" {
+		isPage := false
+		for _, attr := range el.Attr {
+			if attr.Name.Local == "class" && (hasClass(attr.Value, "page") || hasClass(attr.Value, "slide-content")) {
+				isPage = true
+			}
+		}
+		if isPage {
+			x.closePages()
+			x.pages = append(x.pages, Page{Number: len(x.pages) + 1, Start: x.runes, End: -1})
+		}
+		x.divStack = append(x.divStack, isPage)
+	}
+	if level := headingLevel(name); level > 0 {
+		x.heading = &Heading{Level: level, Offset: x.runes}
+		x.headingSB.Reset()
+	}
+}
+
+func (x *xhtmlText) end(local string) {
+	name := strings.ToLower(local)
+	if x.skipDepth > 0 {
+		x.skipDepth--
+		return
+	}
+	if headingLevel(name) > 0 && x.heading != nil {
+		if title := strings.Join(strings.Fields(x.headingSB.String()), " "); title != "" {
+			x.heading.Text = title
+			x.headings = append(x.headings, *x.heading)
+		}
+		x.heading = nil
+	}
+	if name == "div" && len(x.divStack) > 0 {
+		isPage := x.divStack[len(x.divStack)-1]
+		x.divStack = x.divStack[:len(x.divStack)-1]
+		if isPage {
+			x.newline()
+			x.closePages()
+		}
+		return
+	}
+	if xhtmlBlockElements[name] {
+		x.newline()
+	}
+}
+
+func (x *xhtmlText) text(data string) {
+	if x.skipDepth > 0 {
+		return
+	}
+	if strings.TrimSpace(data) == "" && (x.builder.Len() == 0 || strings.HasSuffix(x.builder.String(), "\n")) {
+		return
+	}
+	x.write(data)
+	if x.heading != nil {
+		x.headingSB.WriteString(data)
+	}
+}
+
+func (x *xhtmlText) write(s string) {
+	x.builder.WriteString(s)
+	x.runes += utf8.RuneCountInString(s)
+}
+
+func (x *xhtmlText) newline() {
+	if x.builder.Len() > 0 && !strings.HasSuffix(x.builder.String(), "\n") {
+		x.write("\n")
+	}
+}
+
+// closePages 结束尚未闭合的分页。
+func (x *xhtmlText) closePages() {
+	for i := range x.pages {
+		if x.pages[i].End < 0 {
+			x.pages[i].End = x.runes
+		}
+	}
+}
+
+func headingLevel(name string) int {
+	if len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6' {
+		return int(name[1] - '0')
+	}
+	return 0
+}
+
+func hasClass(value string, class string) bool {
+	for _, field := range strings.Fields(value) {
+		if field == class {
+			return true
+		}
+	}
+	return false
+}
@@ -664,6 +664,14 @@ function handleChatMessage(rawData) {
     return;
   }
 
+  if (message.type === "references") {
+    if (!state.activeAssistantBubble) {
+      state.activeAssistantBubble = appendChatBubble("assistant", "");
+    }
+    renderChatReferences(state.activeAssistantBubble, message.references || []);
+    return;
+  }
+
   if (typeof message.chunk === "string") {
     if (!state.activeAssistantBubble) {
       state.activeAssistantBubble = appendChatBubble("assistant", "");
@@ -992,6 +1000,19 @@ function appendChatBubble(role, content) {
   return bubble;
 }
 
+function renderChatReferences(bubble, references) {
+  if (!references.length) return;
+  const list = document.createElement("div");
+  list.className = "meta";
+  list.innerHTML = references
+    .map(
+      (ref) =>
+        `<div>[${escapeHtml(String(ref.index))}] ${escapeHtml(ref.fileName || ref.fileMd5)} · Chunk ${escapeHtml(String(ref.chunkId))}</div>`
+    )
+    .join("");
+  bubble.appendChild(list);
+}
+
 function renderTagTree(nodesList, depth = 0) {
   return nodesList
     .map((tag) => {